@@ -12,8 +12,11 @@ if [[ -z ${APP_DSN} ]]; then
   export APP_DSN=`sed -n 's/^dsn:[[:space:]]*"\(.*\)"/\1/p' ${CONFIG_FILE}`
 fi
 
+# the migrations need a role allowed to alter the tables, which the server should not connect as
+MIGRATE_DSN=${MIGRATE_DSN:-${APP_DSN}}
+
 echo "[`date`] Running DB migrations..."
-migrate -database "${APP_DSN}" -path ./migrations up
+migrate -database "${MIGRATE_DSN}" -path ./migrations up
 
 echo "[`date`] Starting server..."
 ./server -config ${CONFIG_FILE} >> /var/log/app/server.log 2>&1
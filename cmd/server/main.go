@@ -1,25 +1,54 @@
 package main
 
 import (
+	"backend/internal/album"
+	"backend/internal/apikey"
+	"backend/internal/audit"
 	"backend/internal/auth"
 	"backend/internal/config"
 	"backend/internal/errors"
+	"backend/internal/events"
 	"backend/internal/healthcheck"
+	"backend/internal/idempotency"
+	"backend/internal/invitation"
+	"backend/internal/job"
+	"backend/internal/mfa"
+	"backend/internal/notify"
+	"backend/internal/organization"
+	"backend/internal/ratelimit"
+	"backend/internal/session"
+	"backend/internal/softdelete"
+	"backend/internal/task"
 	"backend/internal/user"
+	"backend/internal/verification"
+	"backend/internal/webhook"
 	"backend/pkg/accesslog"
+	"backend/pkg/bodylimit"
+	"backend/pkg/cors"
 	"backend/pkg/dbcontext"
+	"backend/pkg/jobs"
 	"backend/pkg/log"
+	"backend/pkg/oidc"
+	"backend/pkg/password"
+	"backend/pkg/realip"
+	"backend/pkg/scheduler"
+	"backend/pkg/timeout"
+	"backend/pkg/tlsconfig"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"flag"
 	"fmt"
 	"github.com/go-ozzo/ozzo-dbx"
 	"github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/content"
-	"github.com/go-ozzo/ozzo-routing/v2/cors"
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	f "github.com/go-ozzo/ozzo-routing/v2/file"
@@ -35,27 +64,6 @@ func main() {
 	// create root logger tagged with server version
 	logger := log.New().With(nil, "version", Version)
 
-	// check if path ssl exists
-	/*if path, err := os.Getwd(); err == nil {
-		if err := os.Mkdir(path+"/certs", 0755); !os.IsExist(err) {
-			logger.Info("Creating path: " + path + "/certs")
-		}
-	}
-
-	certManager := autocert.Manager{
-		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist("docker-core.ml"), //Your domain here
-		Cache:      autocert.DirCache("certs"),               //Folder for storing certificates
-	}
-
-	if path, err := os.Getwd(); err == nil {
-		if err := os.Mkdir(path+"/storage", 0755); !os.IsExist(err) {
-			if err := os.Mkdir(path+"/storage/diagrams", 0755); !os.IsExist(err) {
-				logger.Info("Creating path: " + path + "/storage/diagrams")
-			}
-		}
-	}*/
-
 	// load application configurations
 	cfg, err := config.Load(*flagConfig, logger)
 	if err != nil {
@@ -79,23 +87,119 @@ func main() {
 
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
+	readiness := healthcheck.NewReadiness()
+	dbc := dbcontext.New(db)
+
+	// the emails are sent by background jobs, enqueued within the transactions of the requests
+	templates, err := notify.LoadTemplates(cfg.Mail.DefaultLocale)
+	if err != nil {
+		logger.Errorf("failed to load the email templates: %s", err)
+		os.Exit(-1)
+	}
+	notifier := notify.NewNotifier(notify.NewQueueMailer(jobs.NewClient(jobs.NewPostgresStore(dbc))), templates)
+
+	// the new passwords must follow the policy, and not be among the breached passwords if a list is given
+	policy := password.Policy{
+		MinLength:        cfg.Auth.Password.MinLength,
+		MaxLength:        cfg.Auth.Password.MaxLength,
+		RequireLowercase: cfg.Auth.Password.RequireLowercase,
+		RequireUppercase: cfg.Auth.Password.RequireUppercase,
+		RequireDigit:     cfg.Auth.Password.RequireDigit,
+		RequireSymbol:    cfg.Auth.Password.RequireSymbol,
+		RejectPersonal:   cfg.Auth.Password.RejectPersonal,
+	}
+	if cfg.Auth.Password.BreachedList != "" {
+		if policy.Breached, err = password.LoadBreachedList(cfg.Auth.Password.BreachedList); err != nil {
+			logger.Errorf("failed to load the breached password list: %s", err)
+			os.Exit(-1)
+		}
+		logger.Infof("loaded %v breached passwords", policy.Breached.Len())
+	}
 	hs := &http.Server{
-		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
-		/*TLSConfig: &tls.Config{
-			GetCertificate: certManager.GetCertificate,
-		},*/
+		Addr:              address,
+		Handler:           buildHandler(logger, dbc, cfg, readiness, notifier, policy),
+		ReadHeaderTimeout: time.Duration(cfg.HTTP.ReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(cfg.HTTP.ReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.HTTP.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.HTTP.IdleTimeout) * time.Second,
+		MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
 	}
+	// background tasks stop when the server shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	hs.RegisterOnShutdown(cancel)
+	go buildDispatcher(dbc, cfg.Events, logger).Run(ctx, time.Duration(cfg.Events.PollInterval)*time.Second)
+	go webhook.NewDeliverer(webhook.NewRepository(dbc, logger), dbc.Transactional,
+		&http.Client{Timeout: time.Duration(cfg.Webhooks.Timeout) * time.Second},
+		events.Options{
+			BatchSize:   cfg.Webhooks.BatchSize,
+			MaxAttempts: cfg.Webhooks.MaxAttempts,
+			Backoff:     time.Duration(cfg.Webhooks.RetryBackoff) * time.Second,
+		}, logger,
+	).Run(ctx, time.Duration(cfg.Webhooks.PollInterval)*time.Second)
 
-	// go http.ListenAndServe(":http", certManager.HTTPHandler(nil))
+	// the jobs are not bound to ctx: they are given the time to complete after the HTTP server has shut down
+	worker := jobs.NewWorker(jobs.NewPostgresStore(dbc), jobs.Options{
+		Concurrency:       cfg.Jobs.Concurrency,
+		PollInterval:      time.Duration(cfg.Jobs.PollInterval) * time.Second,
+		VisibilityTimeout: time.Duration(cfg.Jobs.VisibilityTimeout) * time.Second,
+		Backoff:           time.Duration(cfg.Jobs.RetryBackoff) * time.Second,
+	}, logger)
+	worker.Register(notify.JobType, notify.SendHandler(buildMailer(cfg.Mail, logger)))
+	worker.Start()
+
+	// the periodic tasks stop with ctx, and the shutdown waits for the running ones
+	tasksDone := make(chan struct{})
+	if cfg.Scheduler.Enabled {
+		sched, err := buildScheduler(dbc, cfg, logger)
+		if err != nil {
+			logger.Errorf("failed to set up the scheduler: %s", err)
+			os.Exit(-1)
+		}
+		go func() {
+			sched.Run(ctx)
+			close(tasksDone)
+		}()
+	} else {
+		close(tasksDone)
+	}
+
+	if cfg.TLS.Enabled {
+		tlsConfig, redirectHandler, err := buildTLSConfig(ctx, cfg.TLS, cfg.ServerPort, logger)
+		if err != nil {
+			logger.Errorf("failed to set up TLS: %s", err)
+			os.Exit(-1)
+		}
+		hs.TLSConfig = tlsConfig
+		if cfg.TLS.RedirectPort > 0 {
+			startRedirectServer(hs, cfg.TLS.RedirectPort, redirectHandler, logger)
+		}
+	}
 
 	// start the HTTP server with graceful shutdown
-	go routing.GracefulShutdown(hs, 10*time.Second, logger.Infof)
-	logger.Infof("server %v is running at %v", Version, address)
-	if err := hs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	shutdown := make(chan struct{})
+	go func() {
+		gracefulShutdown(hs, readiness, time.Duration(cfg.HTTP.DrainPeriod)*time.Second,
+			time.Duration(cfg.HTTP.ShutdownTimeout)*time.Second, logger)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.HTTP.ShutdownTimeout)*time.Second)
+		defer cancel()
+		if err := worker.Shutdown(ctx); err != nil {
+			logger.Errorf("the running jobs were cancelled: %v", err)
+		}
+		<-tasksDone
+		close(shutdown)
+	}()
+	logger.Infof("server %v is running at %v (TLS: %v)", Version, address, cfg.TLS.Enabled)
+	if cfg.TLS.Enabled {
+		err = hs.ListenAndServeTLS("", "")
+	} else {
+		err = hs.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		logger.Error(err)
 		os.Exit(-1)
 	}
+	// wait for the in-flight requests, jobs and tasks to complete before the DB connection is closed
+	<-shutdown
 
 	if _, err = os.Stat("temp"); os.IsNotExist(err) {
 		_ = os.Mkdir("temp", 0777)
@@ -103,36 +207,126 @@ func main() {
 }
 
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config, readiness *healthcheck.Readiness, notifier *notify.Notifier, policy password.Policy) http.Handler {
 	router := routing.New()
+	// the proxies are validated when loading the configuration
+	trustedProxies, _ := realip.ParseCIDRs(cfg.TrustedProxies)
 
 	router.Use(
 		accesslog.Handler(logger),
 		errors.Handler(logger),
 		content.TypeNegotiator(content.JSON),
-		cors.Handler(cors.AllowAll),
+		cors.Handler(cors.Options{
+			AllowOrigins:     cfg.CORS.AllowOrigins,
+			AllowMethods:     cfg.CORS.AllowMethods,
+			AllowHeaders:     cfg.CORS.AllowHeaders,
+			ExposeHeaders:    cfg.CORS.ExposeHeaders,
+			MaxAge:           cfg.CORS.MaxAge,
+			AllowCredentials: cfg.CORS.AllowCredentials,
+		}),
+		realip.Handler(trustedProxies),
+		bodylimit.Handler(cfg.HTTP.MaxBodyBytes, cfg.HTTP.RouteMaxBodyBytes),
+		timeout.Handler(time.Duration(cfg.HTTP.RequestTimeout)*time.Second),
 	)
 
-	healthcheck.RegisterHandlers(router, Version)
+	healthcheck.RegisterHandlers(router, Version, readiness)
 
 	rg := router.Group("/v1")
 
-	authHandler := auth.Handler(cfg.JWTSigningKey)
+	// public routes are rate limited per client IP before their handlers, authenticated routes per user
+	// by the authentication handler
+	rateLimiter := buildRateLimiter(db, cfg.RateLimit, logger)
+	auditRecorder := audit.NewRecorder(audit.NewRepository(db, logger), logger)
+	eventRecorder := events.NewRecorder(events.NewRepository(db, logger))
 
-	// lógica para backend.
+	// the requests are authenticated by a JWT of a session that has not been revoked, or by an API key.
+	// Their handlers then run in a transaction scoped to the user and their organization, which the row level
+	// security policies of the database restrict the rows to. The idempotency keys are claimed before the
+	// transaction, so that the concurrent requests with the same key see them, and the responses are stored within it
+	apiKeyService := apikey.NewService(apikey.NewRepository(db, logger), db.Transactional, auditRecorder, logger)
+	sessionService := session.NewService(session.NewRepository(db, logger), db.Transactional, auditRecorder, logger)
+	idempotencyRepo := idempotency.NewRepository(db)
+	authHandler := chain(
+		auth.Handler(cfg.JWTSigningKey, apiKeyService, sessionService, logger),
+		rateLimiter,
+		idempotency.Handler(idempotencyRepo, db.Transactional, time.Duration(cfg.IdempotencyKeyTTL)*time.Hour, logger,
+			db.TransactionHandler(idempotency.Complete(idempotencyRepo, logger)),
+		),
+	)
+	apikey.RegisterHandlers(rg.Group(""), apiKeyService, authHandler, logger)
+	session.RegisterHandlers(rg.Group(""), sessionService, authHandler, logger)
 
-	/*album.RegisterHandlers(rg.Group(""),
-		album.NewService(album.NewRepository(db, logger), logger),
+	album.RegisterHandlers(rg.Group(""),
+		album.NewService(album.NewRepository(db, logger), db.Transactional, auditRecorder, logger),
 		authHandler, logger,
-	)*/
+	)
+
+	verificationService := verification.NewService(verification.NewRepository(db, logger), db.Transactional, auditRecorder, notifier,
+		verification.Options{
+			TTL: time.Duration(cfg.Auth.VerificationTTL) * time.Hour,
+			URL: cfg.Auth.VerificationURL,
+		}, logger)
+	verification.RegisterHandlers(rg.Group(""), verificationService, rateLimiter, authHandler, logger)
+
+	// the policy is validated when loading the configuration
+	passwords, _ := password.New(password.Options{
+		Algorithm:         cfg.Auth.Password.Algorithm,
+		BcryptCost:        cfg.Auth.Password.BcryptCost,
+		Argon2Memory:      uint32(cfg.Auth.Password.Argon2Memory),
+		Argon2Iterations:  uint32(cfg.Auth.Password.Argon2Iterations),
+		Argon2Parallelism: uint8(cfg.Auth.Password.Argon2Parallelism),
+	})
+
+	// logging in requires a verified email address if a verifier is given
+	var verifier auth.EmailVerifier
+	if cfg.Auth.RequireVerifiedEmail {
+		verifier = verificationService
+	}
+	mfaService := mfa.NewService(mfa.NewRepository(db, logger), db.Transactional, auditRecorder,
+		mfa.Options{Issuer: cfg.Auth.MFAIssuer}, logger)
+	mfa.RegisterHandlers(rg.Group(""), mfaService, authHandler, logger)
 
 	auth.RegisterHandlers(rg.Group(""),
-		auth.NewService(db, cfg.JWTSigningKey, cfg.JWTExpiration, logger),
-		logger,
+		auth.NewService(auth.NewRepository(db, logger), passwords, cfg.JWTSigningKey, cfg.JWTExpiration,
+			time.Duration(cfg.Auth.ImpersonationTTL)*time.Minute, verifier, mfaService, cfg.Auth.MFARoles,
+			buildOIDCProviders(cfg.Auth.OIDC), sessionService, logger),
+		rateLimiter, authHandler, logger,
+	)
+
+	userService := user.NewService(user.NewRepository(db, logger), db.Transactional, auditRecorder, eventRecorder, verificationService, passwords, policy, logger)
+	user.RegisterHandlers(rg.Group(""), userService, authHandler, logger)
+
+	invitation.RegisterHandlers(rg.Group(""),
+		invitation.NewService(invitation.NewRepository(db, logger), userService, db.Transactional, auditRecorder, notifier,
+			invitation.Options{
+				TTL: time.Duration(cfg.Invitations.TTL) * time.Hour,
+				URL: cfg.Invitations.URL,
+			}, logger),
+		rateLimiter, authHandler, logger,
+	)
+
+	organization.RegisterHandlers(rg.Group(""),
+		organization.NewService(organization.NewRepository(db, logger), db.Transactional, auditRecorder, logger),
+		authHandler, logger,
+	)
+
+	audit.RegisterHandlers(rg.Group(""),
+		audit.NewService(audit.NewRepository(db, logger), logger),
+		authHandler, logger,
+	)
+
+	webhook.RegisterHandlers(rg.Group(""),
+		webhook.NewService(webhook.NewRepository(db, logger), logger),
+		authHandler, logger,
+	)
+
+	job.RegisterHandlers(rg.Group(""),
+		job.NewService(jobs.NewPostgresStore(db), logger),
+		authHandler, logger,
 	)
 
-	user.RegisterHandlers(rg.Group(""),
-		user.NewService(user.NewRepository(db, logger), logger),
+	task.RegisterHandlers(rg.Group(""),
+		task.NewService(scheduler.NewPostgresStore(db), logger),
 		authHandler, logger,
 	)
 
@@ -143,6 +337,235 @@ func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.
 	return router
 }
 
+// buildRateLimiter creates the rate limiting middleware according to the given settings.
+func buildRateLimiter(db *dbcontext.DB, cfg config.RateLimit, logger log.Logger) routing.Handler {
+	var rules []ratelimit.Rule
+	if cfg.Enabled {
+		for _, r := range cfg.Rules {
+			burst := r.Burst
+			if burst == 0 {
+				burst = r.Requests
+			}
+			rules = append(rules, ratelimit.Rule{
+				Name:   r.Name,
+				Prefix: r.Prefix,
+				Limit:  ratelimit.Limit{Rate: float64(r.Requests) / float64(r.Period), Burst: burst},
+			})
+		}
+	}
+	store := ratelimit.NewMemoryStore()
+	if cfg.Store == "postgres" {
+		store = ratelimit.NewPostgresStore(db)
+	}
+	return ratelimit.Handler(store, rules, logger)
+}
+
+// buildMailer creates the mailer sending the email messages with the configured driver.
+func buildMailer(cfg config.Mail, logger log.Logger) notify.Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		return notify.NewSMTPMailer(notify.SMTPOptions{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.From,
+		})
+	case "file":
+		return notify.NewFileMailer(cfg.Dir, cfg.From)
+	default:
+		return notify.NewLogMailer(logger)
+	}
+}
+
+// buildOIDCProviders creates the external identity providers of the configuration. Their endpoints are
+// discovered when the first user logs in with them.
+func buildOIDCProviders(cfg map[string]config.OIDCProvider) map[string]auth.OIDCProvider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	providers := map[string]auth.OIDCProvider{}
+	for name, p := range cfg {
+		providers[name] = auth.OIDCProvider{
+			Provider: oidc.NewProvider(oidc.Config{
+				Issuer:       p.Issuer,
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				RedirectURL:  p.RedirectURL,
+				Scopes:       p.Scopes,
+			}, client),
+			RolesClaim:  p.RolesClaim,
+			RoleMapping: p.RoleMapping,
+		}
+	}
+	return providers
+}
+
+// buildScheduler creates the scheduler running the maintenance tasks whose cron expressions are configured.
+func buildScheduler(db *dbcontext.DB, cfg *config.Config, logger log.Logger) (*scheduler.Scheduler, error) {
+	tasks := map[string]func(ctx context.Context) error{
+		"purge_deleted": func(ctx context.Context) error {
+			if cfg.SoftDeleteRetention == 0 {
+				return nil
+			}
+			// the deleted records of all the organizations are purged
+			return softdelete.Purge(dbcontext.Unscoped(ctx), time.Duration(cfg.SoftDeleteRetention)*24*time.Hour, map[string]softdelete.Purger{
+				"albums": softdelete.Transactional(album.NewRepository(db, logger), db.Transactional),
+				"users":  softdelete.Transactional(user.NewRepository(db, logger), db.Transactional),
+			}, logger)
+		},
+		"purge_idempotency_keys": func(ctx context.Context) error {
+			_, err := idempotency.NewRepository(db).Purge(ctx, time.Now().Add(-time.Duration(cfg.IdempotencyKeyTTL)*time.Hour))
+			return err
+		},
+		"purge_rate_limit_buckets": func(ctx context.Context) error {
+			if cfg.RateLimit.Store != "postgres" {
+				return nil
+			}
+			// a day is long enough for the buckets of any sensible limit to be refilled
+			_, err := ratelimit.PurgeBuckets(ctx, db, time.Now().Add(-24*time.Hour))
+			return err
+		},
+		"purge_sessions": func(ctx context.Context) error {
+			_, err := session.NewRepository(db, logger).Purge(ctx, time.Now())
+			return err
+		},
+		"analyze": func(ctx context.Context) error {
+			// the tables the role of the DSN does not own, such as the ones of the migrations, are skipped
+			// with a warning: they are left to the autovacuum daemon
+			_, err := db.With(ctx).NewQuery("ANALYZE").Execute()
+			return err
+		},
+	}
+
+	sched := scheduler.New(scheduler.NewPostgresStore(db), scheduler.NewPostgresLocker(db), logger)
+	for name, expr := range cfg.Scheduler.Tasks {
+		if expr == "" {
+			continue
+		}
+		run, ok := tasks[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown scheduled task %q", name)
+		}
+		if err := sched.Add(name, expr, run); err != nil {
+			return nil, err
+		}
+	}
+	return sched, nil
+}
+
+// buildDispatcher creates the dispatcher delivering the domain events to the webhook subscriptions
+// and to the sinks enabled by the given settings.
+func buildDispatcher(db *dbcontext.DB, cfg config.Events, logger log.Logger) *events.Dispatcher {
+	sinks := []events.Sink{webhook.NewSink(webhook.NewRepository(db, logger))}
+	if cfg.Log {
+		sinks = append(sinks, events.NewLogSink(logger))
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, url := range cfg.WebhookURLs {
+		sinks = append(sinks, events.NewWebhookSink(url, client))
+	}
+	return events.NewDispatcher(events.NewRepository(db, logger), db.Transactional, sinks, events.Options{
+		BatchSize:   cfg.BatchSize,
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff:     time.Duration(cfg.RetryBackoff) * time.Second,
+	}, logger)
+}
+
+// chain combines several handlers into one so that they can be passed where a single handler is expected.
+// The handlers are called in order until one of them fails. Only the last handler may call Context.Next().
+func chain(handlers ...routing.Handler) routing.Handler {
+	return func(c *routing.Context) error {
+		for _, h := range handlers {
+			if err := h(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// gracefulShutdown shuts down the given HTTP server when receiving an os.Interrupt or syscall.SIGTERM signal.
+// The server first stops reporting readiness and keeps serving requests during the drain period, so that
+// the load balancers stop sending it new requests. It then waits for the in-flight requests up to the timeout.
+func gracefulShutdown(hs *http.Server, readiness *healthcheck.Readiness, drain, timeout time.Duration, logger log.Logger) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	readiness.SetReady(false)
+	if drain > 0 {
+		logger.Infof("draining the server for %s", drain)
+		time.Sleep(drain)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	logger.Infof("shutting down server with %s timeout", timeout)
+	if err := hs.Shutdown(ctx); err != nil {
+		logger.Infof("error while shutting down server: %v", err)
+	} else {
+		logger.Infof("server was shut down gracefully")
+	}
+}
+
+// buildTLSConfig sets up the TLS configuration of the server according to the given settings.
+// It also returns the handler to be served by the plain HTTP listener, which redirects requests to HTTPS
+// and, when ACME is enabled, answers the HTTP-01 challenges. The certificate files are watched until ctx is cancelled.
+func buildTLSConfig(ctx context.Context, cfg config.TLS, port int, logger log.Logger) (*tls.Config, http.Handler, error) {
+	minVersion, err := tlsconfig.ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	cipherSuites, err := tlsconfig.ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}
+	redirect := tlsconfig.RedirectHandler(port)
+
+	if cfg.ACME.Enabled {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACME.Hosts...),
+			Cache:      autocert.DirCache(cfg.ACME.CacheDir),
+			Email:      cfg.ACME.Email,
+		}
+		if cfg.ACME.DirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: cfg.ACME.DirectoryURL}
+		}
+		tlsConfig.GetCertificate = manager.GetCertificate
+		tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+		return tlsConfig, manager.HTTPHandler(redirect), nil
+	}
+
+	reloader, err := tlsconfig.NewCertReloader(cfg.CertFile, cfg.KeyFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	go reloader.Watch(ctx, time.Duration(cfg.ReloadInterval)*time.Second)
+	tlsConfig.GetCertificate = reloader.GetCertificate
+	return tlsConfig, redirect, nil
+}
+
+// startRedirectServer starts a plain HTTP server on the given port which is shut down together with the main server.
+func startRedirectServer(hs *http.Server, port int, handler http.Handler, logger log.Logger) {
+	rs := &http.Server{
+		Addr:    fmt.Sprintf(":%v", port),
+		Handler: handler,
+	}
+	hs.RegisterOnShutdown(func() {
+		_ = rs.Close()
+	})
+	go func() {
+		logger.Infof("HTTP to HTTPS redirection is running at %v", rs.Addr)
+		if err := rs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error(err)
+		}
+	}()
+}
+
 // logDBQuery returns a logging function that can be used to log SQL queries.
 func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
@@ -1,10 +1,14 @@
 package album
 
 import (
-	"github.com/go-ozzo/ozzo-routing/v2"
+	"backend/internal/auth"
+	"backend/internal/entity"
 	"backend/internal/errors"
+	"backend/pkg/etag"
 	"backend/pkg/log"
 	"backend/pkg/pagination"
+	"backend/pkg/patch"
+	"github.com/go-ozzo/ozzo-routing/v2"
 	"net/http"
 )
 
@@ -12,15 +16,16 @@ import (
 func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
 	res := resource{service, logger}
 
-	r.Get("/albums/<id>", res.get)
-	r.Get("/albums", res.query)
-
 	r.Use(authHandler)
 
-	// the following endpoints require a valid JWT
+	// the following endpoints require a valid JWT, so that the albums are scoped to the organization of the user
+	r.Get("/albums/<id>", res.get)
+	r.Get("/albums", res.query)
 	r.Post("/albums", res.create)
 	r.Put("/albums/<id>", res.update)
+	r.Patch("/albums/<id>", res.patch)
 	r.Delete("/albums/<id>", res.delete)
+	r.Post("/albums/<id>/restore", auth.RequireRole(entity.RoleAdministrator), res.restore)
 }
 
 type resource struct {
@@ -33,18 +38,25 @@ func (r resource) get(c *routing.Context) error {
 	if err != nil {
 		return err
 	}
+	if etag.Fresh(c, etag.FromVersion(album.Version)) {
+		return nil
+	}
 
 	return c.Write(album)
 }
 
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	includeDeleted, err := includeDeleted(c)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.Count(ctx, includeDeleted)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	albums, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	albums, err := r.service.Query(ctx, pages.Offset(), pages.Limit(), includeDeleted)
 	if err != nil {
 		return err
 	}
@@ -63,6 +75,7 @@ func (r resource) create(c *routing.Context) error {
 		return err
 	}
 
+	c.Response.Header().Set("ETag", etag.FromVersion(album.Version))
 	return c.WriteWithStatus(album, http.StatusCreated)
 }
 
@@ -73,19 +86,83 @@ func (r resource) update(c *routing.Context) error {
 		return errors.BadRequest("")
 	}
 
-	album, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	version, err := r.checkIfMatch(c)
+	if err != nil {
+		return err
+	}
+	album, err := r.service.Update(c.Request.Context(), c.Param("id"), version, input)
 	if err != nil {
 		return err
 	}
 
+	c.Response.Header().Set("ETag", etag.FromVersion(album.Version))
+	return c.Write(album)
+}
+
+func (r resource) patch(c *routing.Context) error {
+	album, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if err := etag.CheckIfMatch(c.Request, etag.FromVersion(album.Version)); err != nil {
+		return err
+	}
+	input := UpdateAlbumRequest{Name: album.Name}
+	if err := patch.Read(c, input, &input); err != nil {
+		return err
+	}
+	album, err = r.service.Update(c.Request.Context(), album.ID, album.Version, input)
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag.FromVersion(album.Version))
 	return c.Write(album)
 }
 
 func (r resource) delete(c *routing.Context) error {
-	album, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	version, err := r.checkIfMatch(c)
+	if err != nil {
+		return err
+	}
+	album, err := r.service.Delete(c.Request.Context(), c.Param("id"), version)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(album)
+}
+
+func (r resource) restore(c *routing.Context) error {
+	album, err := r.service.Restore(c.Request.Context(), c.Param("id"))
 	if err != nil {
 		return err
 	}
 
+	c.Response.Header().Set("ETag", etag.FromVersion(album.Version))
 	return c.Write(album)
 }
+
+// includeDeleted reports whether deleted albums are requested. Only administrators may request them.
+func includeDeleted(c *routing.Context) (bool, error) {
+	if c.Query("include_deleted") != "true" {
+		return false, nil
+	}
+	if !auth.HasRole(c.Request.Context(), entity.RoleAdministrator) {
+		return false, errors.Forbidden("")
+	}
+	return true, nil
+}
+
+// checkIfMatch verifies the If-Match header against the current version of the requested album.
+// It returns the version the modification must be based on.
+func (r resource) checkIfMatch(c *routing.Context) (int, error) {
+	album, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return 0, err
+	}
+	if err := etag.CheckIfMatch(c.Request, etag.FromVersion(album.Version)); err != nil {
+		return 0, err
+	}
+	return album.Version, nil
+}
@@ -1,6 +1,7 @@
 package album
 
 import (
+	"backend/internal/audit"
 	"backend/internal/auth"
 	"backend/internal/entity"
 	"backend/internal/test"
@@ -14,25 +15,57 @@ func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
 	repo := &mockRepository{items: []entity.Album{
-		{"123", "album123", time.Now(), time.Now()},
+		{"123", "album123", time.Now(), time.Now(), 1, nil, nil},
 	}}
-	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	RegisterHandlers(router.Group(""), NewService(repo, test.MockTransactional, &audit.MockRecorder{}, logger), auth.MockAuthHandler, logger)
 	header := auth.MockAuthHeader()
+	ifMatch := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
+	ifNoneMatch := auth.MockAuthHeader()
+	ifNoneMatch.Set("If-None-Match", `"2"`)
+	patchHeader := func(tag, contentType string) http.Header {
+		h := ifMatch(tag)
+		h.Set("Content-Type", contentType)
+		return h
+	}
 
 	tests := []test.APITestCase{
-		{"get all", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":1*`},
-		{"get 123", "GET", "/albums/123", "", nil, http.StatusOK, `*album123*`},
-		{"get unknown", "GET", "/albums/1234", "", nil, http.StatusNotFound, ""},
+		{"get all", "GET", "/albums", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get 123", "GET", "/albums/123", "", header, http.StatusOK, `*album123*`},
+		{"get auth error", "GET", "/albums/123", "", nil, http.StatusUnauthorized, ""},
+		{"get all auth error", "GET", "/albums", "", nil, http.StatusUnauthorized, ""},
+		{"get unknown", "GET", "/albums/1234", "", header, http.StatusNotFound, ""},
 		{"create ok", "POST", "/albums", `{"name":"test"}`, header, http.StatusCreated, "*test*"},
-		{"create ok count", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"create ok count", "GET", "/albums", "", header, http.StatusOK, `*"total_count":2*`},
 		{"create auth error", "POST", "/albums", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
 		{"create input error", "POST", "/albums", `"name":"test"}`, header, http.StatusBadRequest, ""},
-		{"update ok", "PUT", "/albums/123", `{"name":"albumxyz"}`, header, http.StatusOK, "*albumxyz*"},
-		{"update verify", "GET", "/albums/123", "", nil, http.StatusOK, `*albumxyz*`},
+		{"update ok", "PUT", "/albums/123", `{"name":"albumxyz"}`, ifMatch(`"1"`), http.StatusOK, `*"version":2*`},
+		{"update verify", "GET", "/albums/123", "", header, http.StatusOK, `*albumxyz*`},
+		{"update not modified", "GET", "/albums/123", "", ifNoneMatch, http.StatusNotModified, ""},
 		{"update auth error", "PUT", "/albums/123", `{"name":"albumxyz"}`, nil, http.StatusUnauthorized, ""},
-		{"update input error", "PUT", "/albums/123", `"name":"albumxyz"}`, header, http.StatusBadRequest, ""},
-		{"delete ok", "DELETE", "/albums/123", ``, header, http.StatusOK, "*albumxyz*"},
-		{"delete verify", "DELETE", "/albums/123", ``, header, http.StatusNotFound, ""},
+		{"update input error", "PUT", "/albums/123", `"name":"albumxyz"}`, ifMatch(`"2"`), http.StatusBadRequest, ""},
+		{"update without if-match", "PUT", "/albums/123", `{"name":"albumxyz"}`, header, http.StatusPreconditionRequired, ""},
+		{"update stale version", "PUT", "/albums/123", `{"name":"albumxyz"}`, ifMatch(`"1"`), http.StatusPreconditionFailed, ""},
+		{"patch merge ok", "PATCH", "/albums/123", `{"name":"albumabc"}`, patchHeader(`"2"`, "application/merge-patch+json"), http.StatusOK, `*"version":3*`},
+		{"patch json ok", "PATCH", "/albums/123", `[{"op":"replace","path":"/name","value":"albumxyz"}]`, patchHeader(`"3"`, "application/json-patch+json"), http.StatusOK, "*albumxyz*"},
+		{"patch auth error", "PATCH", "/albums/123", `{"name":"albumabc"}`, nil, http.StatusUnauthorized, ""},
+		{"patch unsupported type", "PATCH", "/albums/123", `{"name":"albumabc"}`, ifMatch(`"4"`), http.StatusUnsupportedMediaType, ""},
+		{"patch validation error", "PATCH", "/albums/123", `{"name":null}`, patchHeader(`"4"`, "application/merge-patch+json"), http.StatusBadRequest, "*name*"},
+		{"patch stale version", "PATCH", "/albums/123", `{"name":"albumabc"}`, patchHeader(`"3"`, "application/merge-patch+json"), http.StatusPreconditionFailed, ""},
+		{"delete stale version", "DELETE", "/albums/123", ``, ifMatch(`"1"`), http.StatusPreconditionFailed, ""},
+		{"delete ok", "DELETE", "/albums/123", ``, ifMatch(`"4"`), http.StatusOK, "*albumxyz*"},
+		{"delete verify", "DELETE", "/albums/123", ``, ifMatch(`"4"`), http.StatusNotFound, ""},
+		{"delete get", "GET", "/albums/123", "", header, http.StatusNotFound, ""},
+		{"delete list", "GET", "/albums", "", header, http.StatusOK, `*"total_count":1*`},
+		{"delete list deleted", "GET", "/albums?include_deleted=true", "", header, http.StatusOK, `*"total_count":2*`},
+		{"delete list deleted auth error", "GET", "/albums?include_deleted=true", "", nil, http.StatusUnauthorized, ""},
+		{"restore ok", "POST", "/albums/123/restore", "", header, http.StatusOK, `*"version":6*`},
+		{"restore verify", "GET", "/albums/123", "", header, http.StatusOK, "*albumxyz*"},
+		{"restore not deleted", "POST", "/albums/123/restore", "", header, http.StatusNotFound, ""},
+		{"restore auth error", "POST", "/albums/123/restore", "", nil, http.StatusUnauthorized, ""},
 		{"delete auth error", "DELETE", "/albums/123", ``, nil, http.StatusUnauthorized, ""},
 	}
 	for _, tc := range tests {
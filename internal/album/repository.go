@@ -1,29 +1,42 @@
 package album
 
 import (
-	"context"
 	"backend/internal/entity"
+	"backend/internal/errors"
 	"backend/pkg/dbcontext"
 	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 // Repository encapsulates the logic to access albums from the data source.
+// Deleted albums are kept in the data source until they are purged. They are excluded unless stated otherwise.
+// The albums are scoped to the tenant of the context: the albums of the other tenants are not found.
 type Repository interface {
 	// Get returns the album with the specified album ID.
 	Get(ctx context.Context, id string) (entity.Album, error)
-	// Count returns the number of albums.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of albums with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.Album, error)
+	// Count returns the number of albums, including the deleted ones if requested.
+	Count(ctx context.Context, includeDeleted bool) (int, error)
+	// Query returns the list of albums with the given offset and limit, including the deleted ones if requested.
+	Query(ctx context.Context, offset, limit int, includeDeleted bool) ([]entity.Album, error)
 	// Create saves a new album in the storage.
 	Create(ctx context.Context, album entity.Album) error
-	// Update updates the album with given ID in the storage.
+	// Update updates the album with given ID in the storage if its version is unchanged.
 	Update(ctx context.Context, album entity.Album) error
-	// Delete removes the album with given ID from the storage.
-	Delete(ctx context.Context, id string) error
+	// Delete marks the album with given ID and version as deleted.
+	Delete(ctx context.Context, id string, version int) error
+	// Restore undoes the deletion of the album with given ID.
+	Restore(ctx context.Context, id string) error
+	// Purge permanently removes the albums deleted before the given time and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
 
-// repository persists albums in database
+// repository persists albums in database.
+// Its methods run in the transaction of the context, or in one they start, since the row level security
+// policies of the database only let the transactions scoped by dbcontext find the albums.
 type repository struct {
 	db     *dbcontext.DB
 	logger log.Logger
@@ -34,48 +47,137 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 	return repository{db, logger}
 }
 
+// notDeleted selects the albums that have not been deleted.
+var notDeleted = dbx.HashExp{"deleted_at": nil}
+
+// scope selects the albums of the tenant of the context, if any.
+func scope(ctx context.Context) dbx.Expression {
+	return dbcontext.Scope(ctx, "organization_id = {:tenant}")
+}
+
 // Get reads the album with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string) (entity.Album, error) {
 	var album entity.Album
-	err := r.db.With(ctx).Select().Model(id, &album)
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select().Where(dbx.And(notDeleted, scope(ctx))).Model(id, &album)
+	})
 	return album, err
 }
 
-// Create saves a new album record in the database.
+// Create saves a new album record in the database, owned by the tenant of the context if any.
 // It returns the ID of the newly inserted album record.
 func (r repository) Create(ctx context.Context, album entity.Album) error {
-	return r.db.With(ctx).Model(&album).Insert()
+	if tenantID := dbcontext.Tenant(ctx); tenantID != "" {
+		album.OrganizationID = &tenantID
+	}
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Model(&album).Insert()
+	})
 }
 
-// Update saves the changes to an album in the database.
+// Update saves the changes to an album in the database and increments its version.
+// The album.Version must be the version that was read. If the album has been modified since then,
+// nothing is saved and a precondition failure is returned.
 func (r repository) Update(ctx context.Context, album entity.Album) error {
-	return r.db.With(ctx).Model(&album).Update()
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		res, err := r.db.With(ctx).Update("album", dbx.Params{
+			"name":       album.Name,
+			"updated_at": album.UpdatedAt,
+			"version":    album.Version + 1,
+		}, dbx.And(dbx.HashExp{"id": album.ID, "version": album.Version, "deleted_at": nil}, scope(ctx))).Execute()
+		return checkVersion(res, err)
+	})
+}
+
+// Delete marks an album with the specified ID and version as deleted and increments its version.
+// A precondition failure is returned if the album has been modified since the version was read.
+func (r repository) Delete(ctx context.Context, id string, version int) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if _, err := r.Get(ctx, id); err != nil {
+			return err
+		}
+		res, err := r.db.With(ctx).Update("album", dbx.Params{
+			"deleted_at": time.Now(),
+			"version":    version + 1,
+		}, dbx.And(dbx.HashExp{"id": id, "version": version, "deleted_at": nil}, scope(ctx))).Execute()
+		return checkVersion(res, err)
+	})
+}
+
+// Restore clears the deletion mark of the album with the specified ID and increments its version.
+// sql.ErrNoRows is returned if there is no such deleted album.
+func (r repository) Restore(ctx context.Context, id string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		res, err := r.db.With(ctx).Update("album", dbx.Params{
+			"deleted_at": nil,
+			"version":    dbx.NewExp("version + 1"),
+		}, dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("deleted_at IS NOT NULL"), scope(ctx))).Execute()
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// Purge hard-deletes the albums that were deleted before the given time.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		res, err := r.db.With(ctx).Delete("album", dbx.And(dbx.NewExp("deleted_at < {:before}", dbx.Params{"before": before}), scope(ctx))).Execute()
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
 }
 
-// Delete deletes an album with the specified ID from the database.
-func (r repository) Delete(ctx context.Context, id string) error {
-	album, err := r.Get(ctx, id)
+// checkVersion turns a write that affected no rows into a precondition failure.
+func checkVersion(res sql.Result, err error) error {
 	if err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&album).Delete()
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.PreconditionFailed("")
+	}
+	return nil
 }
 
 // Count returns the number of the album records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+func (r repository) Count(ctx context.Context, includeDeleted bool) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("album").Row(&count)
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		q := r.db.With(ctx).Select("COUNT(*)").From("album").Where(scope(ctx))
+		if !includeDeleted {
+			q.AndWhere(notDeleted)
+		}
+		return q.Row(&count)
+	})
 	return count, err
 }
 
 // Query retrieves the album records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Album, error) {
+func (r repository) Query(ctx context.Context, offset, limit int, includeDeleted bool) ([]entity.Album, error) {
 	var albums []entity.Album
-	err := r.db.With(ctx).
-		Select().
-		OrderBy("id").
-		Offset(int64(offset)).
-		Limit(int64(limit)).
-		All(&albums)
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		q := r.db.With(ctx).
+			Select().
+			Where(scope(ctx)).
+			OrderBy("id").
+			Offset(int64(offset)).
+			Limit(int64(limit))
+		if !includeDeleted {
+			q.AndWhere(notDeleted)
+		}
+		return q.All(&albums)
+	})
 	return albums, err
 }
@@ -1,26 +1,31 @@
 package album
 
 import (
-	"context"
-	"database/sql"
 	"backend/internal/entity"
+	"backend/internal/errors"
 	"backend/internal/test"
+	"backend/pkg/dbcontext"
 	"backend/pkg/log"
+	"context"
+	"database/sql"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "album")
+	test.ResetTables(t, db, "album", "organizations")
 	repo := NewRepository(db, logger)
 
-	ctx := context.Background()
+	// the tests connect as a role subject to the row level security policies of the database
+	ctx := dbcontext.Unscoped(context.Background())
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.Count(ctx, false)
 	assert.Nil(t, err)
 
 	// create
@@ -29,9 +34,10 @@ func TestRepository(t *testing.T) {
 		Name:      "album1",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+		Version:   1,
 	})
 	assert.Nil(t, err)
-	count2, _ := repo.Count(ctx)
+	count2, _ := repo.Count(ctx, false)
 	assert.Equal(t, 1, count2-count)
 
 	// get
@@ -47,21 +53,130 @@ func TestRepository(t *testing.T) {
 		Name:      "album1 updated",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+		Version:   1,
 	})
 	assert.Nil(t, err)
 	album, _ = repo.Get(ctx, "test1")
 	assert.Equal(t, "album1 updated", album.Name)
+	assert.Equal(t, 2, album.Version)
+
+	// update with a stale version
+	err = repo.Update(ctx, entity.Album{ID: "test1", Name: "album1 stale", Version: 1})
+	assert.Equal(t, errors.PreconditionFailed(""), err)
 
 	// query
-	albums, err := repo.Query(ctx, 0, count2)
+	albums, err := repo.Query(ctx, 0, count2, false)
 	assert.Nil(t, err)
 	assert.Equal(t, count2, len(albums))
 
 	// delete
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, "test1", 1)
+	assert.Equal(t, errors.PreconditionFailed(""), err)
+	err = repo.Delete(ctx, "test1", 2)
 	assert.Nil(t, err)
 	_, err = repo.Get(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, "test1", 3)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count3, _ := repo.Count(ctx, true)
+	assert.Equal(t, count2, count3)
+
+	// restore
+	err = repo.Restore(ctx, "test1")
+	assert.Nil(t, err)
+	album, _ = repo.Get(ctx, "test1")
+	assert.Equal(t, 4, album.Version)
+	err = repo.Restore(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
+
+	// purge
+	err = repo.Delete(ctx, "test1", 4)
+	assert.Nil(t, err)
+	n, err := repo.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = repo.Purge(ctx, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	count3, _ = repo.Count(ctx, true)
+	assert.Equal(t, count, count3)
+
+	// the albums of a tenant are only found by it
+	_, err = db.With(ctx).Insert("organizations", dbx.Params{"id": "org1", "name": "Acme", "created_at": time.Now(), "updated_at": time.Now()}).Execute()
+	assert.Nil(t, err)
+	tenant := dbcontext.WithTenant(ctx, "org1")
+	err = repo.Create(tenant, entity.Album{ID: "test2", Name: "album2", CreatedAt: time.Now(), UpdatedAt: time.Now(), Version: 1})
+	assert.Nil(t, err)
+	album, err = repo.Get(tenant, "test2")
+	if assert.Nil(t, err) && assert.NotNil(t, album.OrganizationID) {
+		assert.Equal(t, "org1", *album.OrganizationID)
+	}
+	_, err = repo.Get(dbcontext.WithTenant(ctx, "org2"), "test2")
+	assert.Equal(t, sql.ErrNoRows, err)
+	count4, _ := repo.Count(dbcontext.WithTenant(ctx, "org2"), false)
+	assert.Equal(t, 0, count4)
+
+	// the methods called outside a transaction run in one scoped to the context, so that the row level security
+	// policies hide all the albums when there is neither a tenant nor an explicit Unscoped
+	count5, _ := repo.Count(context.Background(), true)
+	assert.Equal(t, 0, count5)
+	_, err = repo.Get(context.Background(), "test2")
+	assert.Equal(t, sql.ErrNoRows, err)
+	// as they do from a user who is a member of no organization
+	outsider := dbcontext.WithUser(context.Background(), "100")
+	albums, err = repo.Query(outsider, 0, 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(albums))
+	count5, _ = repo.Count(outsider, true)
+	assert.Equal(t, 0, count5)
+	// as they do from the queries built by dbcontext outside a transaction, which are never scoped
+	var count6 int
+	assert.Nil(t, db.With(tenant).Select("COUNT(*)").From("album").Row(&count6))
+	assert.Equal(t, 0, count6)
+
+	// the row level security policies hide the albums of the other tenants from the unscoped queries
+	err = db.Transactional(dbcontext.WithTenant(ctx, "org2"), func(ctx context.Context) error {
+		var count int
+		assert.Nil(t, db.With(ctx).Select("COUNT(*)").From("album").Row(&count))
+		assert.Equal(t, 0, count)
+		_, err := db.With(ctx).Update("album", dbx.Params{"name": "album3"}, nil).Execute()
+		assert.Nil(t, err)
+		return nil
+	})
+	assert.Nil(t, err)
+	album, _ = repo.Get(ctx, "test2")
+	assert.Equal(t, "album2", album.Name)
+	err = db.Transactional(tenant, func(ctx context.Context) error {
+		var count int
+		assert.Nil(t, db.With(ctx).Select("COUNT(*)").From("album").Row(&count))
+		assert.Equal(t, 1, count)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// the policies fail closed: the queries that are neither scoped to a tenant nor explicitly unscoped
+	// find no album, including the ones of a transaction whose settings were never set
+	err = db.Transactional(context.Background(), func(ctx context.Context) error {
+		var count int
+		assert.Nil(t, db.With(ctx).Select("COUNT(*)").From("album").Row(&count))
+		assert.Equal(t, 0, count)
+		return nil
+	})
+	assert.Nil(t, err)
+	tx, err := db.DB().Begin()
+	if assert.Nil(t, err) {
+		defer func() {
+			_ = tx.Rollback()
+		}()
+		var count int
+		assert.Nil(t, tx.Select("COUNT(*)").From("album").Row(&count))
+		assert.Equal(t, 0, count)
+	}
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		var count int
+		assert.Nil(t, db.With(ctx).Select("COUNT(*)").From("album").Row(&count))
+		assert.Equal(t, 1, count)
+		return nil
+	})
+	assert.Nil(t, err)
 }
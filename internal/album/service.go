@@ -1,21 +1,25 @@
 package album
 
 import (
-	"context"
-	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"backend/internal/audit"
 	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
 	"backend/pkg/log"
+	"context"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"time"
 )
 
 // Service encapsulates usecase logic for albums.
 type Service interface {
 	Get(ctx context.Context, id string) (Album, error)
-	Query(ctx context.Context, offset, limit int) ([]Album, error)
-	Count(ctx context.Context) (int, error)
+	Query(ctx context.Context, offset, limit int, includeDeleted bool) ([]Album, error)
+	Count(ctx context.Context, includeDeleted bool) (int, error)
 	Create(ctx context.Context, input CreateAlbumRequest) (Album, error)
-	Update(ctx context.Context, id string, input UpdateAlbumRequest) (Album, error)
-	Delete(ctx context.Context, id string) (Album, error)
+	Update(ctx context.Context, id string, version int, input UpdateAlbumRequest) (Album, error)
+	Delete(ctx context.Context, id string, version int) (Album, error)
+	Restore(ctx context.Context, id string) (Album, error)
 }
 
 // Album represents the data about an album.
@@ -47,14 +51,20 @@ func (m UpdateAlbumRequest) Validate() error {
 	)
 }
 
+// entityType identifies albums in the audit log.
+const entityType = "album"
+
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	logger        log.Logger
 }
 
 // NewService creates a new album service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The changes are recorded in the audit log within the transactions started by transactional.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, recorder audit.Recorder, logger log.Logger) Service {
+	return service{repo, transactional, recorder, logger}
 }
 
 // Get returns the album with the specified the album ID.
@@ -71,59 +81,104 @@ func (s service) Create(ctx context.Context, req CreateAlbumRequest) (Album, err
 	if err := req.Validate(); err != nil {
 		return Album{}, err
 	}
-	id := entity.GenerateID()
-	now := time.Now()
-	err := s.repo.Create(ctx, entity.Album{
-		ID:        id,
+	album := entity.Album{
+		ID:        entity.GenerateID(),
 		Name:      req.Name,
-		CreatedAt: now,
-		UpdatedAt: now,
+		CreatedAt: time.Now(),
+		Version:   1,
+	}
+	album.UpdatedAt = album.CreatedAt
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, album); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionCreate, entityType, album.ID, nil, album)
 	})
 	if err != nil {
 		return Album{}, err
 	}
-	return s.Get(ctx, id)
+	return s.Get(ctx, album.ID)
 }
 
 // Update updates the album with the specified ID.
-func (s service) Update(ctx context.Context, id string, req UpdateAlbumRequest) (Album, error) {
+// The version is the one the client has read. The update fails if the album has been modified since then.
+func (s service) Update(ctx context.Context, id string, version int, req UpdateAlbumRequest) (Album, error) {
 	if err := req.Validate(); err != nil {
 		return Album{}, err
 	}
 
-	album, err := s.Get(ctx, id)
+	var album Album
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before.Version != version {
+			return errors.PreconditionFailed("")
+		}
+		album = before
+		album.Name = req.Name
+		album.UpdatedAt = time.Now()
+		if err := s.repo.Update(ctx, album.Album); err != nil {
+			return err
+		}
+		album.Version++
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, before.Album, album.Album)
+	})
 	if err != nil {
-		return album, err
-	}
-	album.Name = req.Name
-	album.UpdatedAt = time.Now()
-
-	if err := s.repo.Update(ctx, album.Album); err != nil {
-		return album, err
+		return Album{}, err
 	}
 	return album, nil
 }
 
-// Delete deletes the album with the specified ID.
-func (s service) Delete(ctx context.Context, id string) (Album, error) {
-	album, err := s.Get(ctx, id)
+// Delete deletes the album with the specified ID. The album can be restored until it is purged.
+// The version is the one the client has read. The deletion fails if the album has been modified since then.
+func (s service) Delete(ctx context.Context, id string, version int) (Album, error) {
+	var album Album
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if album, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		if album.Version != version {
+			return errors.PreconditionFailed("")
+		}
+		if err = s.repo.Delete(ctx, id, version); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionDelete, entityType, id, album.Album, nil)
+	})
 	if err != nil {
 		return Album{}, err
 	}
-	if err = s.repo.Delete(ctx, id); err != nil {
+	return album, nil
+}
+
+// Restore undoes the deletion of the album with the specified ID.
+func (s service) Restore(ctx context.Context, id string) (Album, error) {
+	var album Album
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if err = s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+		if album, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionRestore, entityType, id, nil, album.Album)
+	})
+	if err != nil {
 		return Album{}, err
 	}
 	return album, nil
 }
 
 // Count returns the number of albums.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+func (s service) Count(ctx context.Context, includeDeleted bool) (int, error) {
+	return s.repo.Count(ctx, includeDeleted)
 }
 
 // Query returns the albums with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]Album, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+func (s service) Query(ctx context.Context, offset, limit int, includeDeleted bool) ([]Album, error) {
+	items, err := s.repo.Query(ctx, offset, limit, includeDeleted)
 	if err != nil {
 		return nil, err
 	}
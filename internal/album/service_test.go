@@ -1,16 +1,20 @@
 package album
 
 import (
-	"context"
-	"database/sql"
-	"errors"
+	"backend/internal/audit"
 	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
 	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
-var errCRUD = errors.New("error crud")
+var errCRUD = fmt.Errorf("error crud")
 
 func TestCreateAlbumRequest_Validate(t *testing.T) {
 	tests := []struct {
@@ -50,12 +54,13 @@ func TestUpdateAlbumRequest_Validate(t *testing.T) {
 
 func Test_service_CRUD(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	recorder := &audit.MockRecorder{}
+	s := NewService(&mockRepository{}, test.MockTransactional, recorder, logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, _ := s.Count(ctx)
+	count, _ := s.Count(ctx, false)
 	assert.Equal(t, 0, count)
 
 	// successful creation
@@ -66,40 +71,45 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, "test", album.Name)
 	assert.NotEmpty(t, album.CreatedAt)
 	assert.NotEmpty(t, album.UpdatedAt)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, false)
 	assert.Equal(t, 1, count)
 
 	// validation error in creation
 	_, err = s.Create(ctx, CreateAlbumRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, false)
 	assert.Equal(t, 1, count)
 
 	// unexpected error in creation
 	_, err = s.Create(ctx, CreateAlbumRequest{Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, false)
 	assert.Equal(t, 1, count)
 
 	_, _ = s.Create(ctx, CreateAlbumRequest{Name: "test2"})
 
 	// update
-	album, err = s.Update(ctx, id, UpdateAlbumRequest{Name: "test updated"})
+	album, err = s.Update(ctx, id, 1, UpdateAlbumRequest{Name: "test updated"})
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", album.Name)
-	_, err = s.Update(ctx, "none", UpdateAlbumRequest{Name: "test updated"})
+	assert.Equal(t, 2, album.Version)
+	_, err = s.Update(ctx, "none", 1, UpdateAlbumRequest{Name: "test updated"})
 	assert.NotNil(t, err)
 
+	// stale version in update
+	_, err = s.Update(ctx, id, 1, UpdateAlbumRequest{Name: "test stale"})
+	assert.Equal(t, errors.PreconditionFailed(""), err)
+
 	// validation error in update
-	_, err = s.Update(ctx, id, UpdateAlbumRequest{Name: ""})
+	_, err = s.Update(ctx, id, 2, UpdateAlbumRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, false)
 	assert.Equal(t, 2, count)
 
 	// unexpected error in update
-	_, err = s.Update(ctx, id, UpdateAlbumRequest{Name: "error"})
+	_, err = s.Update(ctx, id, 2, UpdateAlbumRequest{Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, false)
 	assert.Equal(t, 2, count)
 
 	// get
@@ -111,17 +121,42 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, id, album.ID)
 
 	// query
-	albums, _ := s.Query(ctx, 0, 0)
+	albums, _ := s.Query(ctx, 0, 0, false)
 	assert.Equal(t, 2, len(albums))
 
 	// delete
-	_, err = s.Delete(ctx, "none")
+	_, err = s.Delete(ctx, "none", 1)
 	assert.NotNil(t, err)
-	album, err = s.Delete(ctx, id)
+	_, err = s.Delete(ctx, id, 1)
+	assert.Equal(t, errors.PreconditionFailed(""), err)
+	album, err = s.Delete(ctx, id, 2)
 	assert.Nil(t, err)
 	assert.Equal(t, id, album.ID)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, false)
 	assert.Equal(t, 1, count)
+	count, _ = s.Count(ctx, true)
+	assert.Equal(t, 2, count)
+	_, err = s.Get(ctx, id)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// restore
+	album, err = s.Restore(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, id, album.ID)
+	assert.Equal(t, 4, album.Version)
+	count, _ = s.Count(ctx, false)
+	assert.Equal(t, 2, count)
+	_, err = s.Restore(ctx, id)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// audit log
+	var actions []string
+	for _, entry := range recorder.Entries {
+		assert.Equal(t, "album", entry.EntityType)
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{"create", "create", "update", "delete", "restore"}, actions)
+	assert.Contains(t, string(recorder.Entries[2].Changes), `"name":{"old":"test","new":"test updated"}`)
 }
 
 type mockRepository struct {
@@ -130,19 +165,26 @@ type mockRepository struct {
 
 func (m mockRepository) Get(ctx context.Context, id string) (entity.Album, error) {
 	for _, item := range m.items {
-		if item.ID == id {
+		if item.ID == id && item.DeletedAt == nil {
 			return item, nil
 		}
 	}
 	return entity.Album{}, sql.ErrNoRows
 }
 
-func (m mockRepository) Count(ctx context.Context) (int, error) {
-	return len(m.items), nil
+func (m mockRepository) Count(ctx context.Context, includeDeleted bool) (int, error) {
+	items, _ := m.Query(ctx, 0, 0, includeDeleted)
+	return len(items), nil
 }
 
-func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Album, error) {
-	return m.items, nil
+func (m mockRepository) Query(ctx context.Context, offset, limit int, includeDeleted bool) ([]entity.Album, error) {
+	var items []entity.Album
+	for _, item := range m.items {
+		if includeDeleted || item.DeletedAt == nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
 }
 
 func (m *mockRepository) Create(ctx context.Context, album entity.Album) error {
@@ -159,6 +201,10 @@ func (m *mockRepository) Update(ctx context.Context, album entity.Album) error {
 	}
 	for i, item := range m.items {
 		if item.ID == album.ID {
+			if item.Version != album.Version {
+				return errors.PreconditionFailed("")
+			}
+			album.Version++
 			m.items[i] = album
 			break
 		}
@@ -166,13 +212,40 @@ func (m *mockRepository) Update(ctx context.Context, album entity.Album) error {
 	return nil
 }
 
-func (m *mockRepository) Delete(ctx context.Context, id string) error {
+func (m *mockRepository) Delete(ctx context.Context, id string, version int) error {
 	for i, item := range m.items {
-		if item.ID == id {
-			m.items[i] = m.items[len(m.items)-1]
-			m.items = m.items[:len(m.items)-1]
+		if item.ID == id && item.DeletedAt == nil {
+			if item.Version != version {
+				return errors.PreconditionFailed("")
+			}
+			now := time.Now()
+			m.items[i].DeletedAt = &now
+			m.items[i].Version++
 			break
 		}
 	}
 	return nil
 }
+
+func (m *mockRepository) Restore(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id && item.DeletedAt != nil {
+			m.items[i].DeletedAt = nil
+			m.items[i].Version++
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var kept []entity.Album
+	for _, item := range m.items {
+		if item.DeletedAt == nil || !item.DeletedAt.Before(before) {
+			kept = append(kept, item)
+		}
+	}
+	n := int64(len(m.items) - len(kept))
+	m.items = kept
+	return n, nil
+}
@@ -0,0 +1,92 @@
+package apikey
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/log"
+	"backend/pkg/pagination"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler, auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant, auth.DenyImpersonation)
+
+	// the following endpoints require a valid JWT of an administrator who is not scoped to an organization.
+	// The impersonated administrators cannot manage the API keys, which are long-lived credentials
+	r.Get("/api-keys/<id>", res.get)
+	r.Get("/api-keys", res.query)
+	r.Post("/api-keys", res.create)
+	r.Put("/api-keys/<id>", res.update)
+	r.Post("/api-keys/<id>/revoke", res.revoke)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	key, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(key)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	keys, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = keys
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateAPIKeyRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	key, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(key, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input UpdateAPIKeyRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	key, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(key)
+}
+
+func (r resource) revoke(c *routing.Context) error {
+	key, err := r.service.Revoke(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(key)
+}
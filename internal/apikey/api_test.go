@@ -0,0 +1,156 @@
+package apikey
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errCRUD = errors.InternalServerError("error crud")
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	now := time.Now()
+	repo := &mockRepository{items: []entity.APIKey{
+		{ID: "123", Name: "billing", Prefix: "ak_abcdefgh", Roles: []string{"financial"}, CreatedBy: "100", CreatedAt: now, UpdatedAt: now},
+		{ID: "124", Name: "old", Prefix: "ak_ijklmnop", Roles: []string{}, CreatedBy: "100", RevokedAt: &now, CreatedAt: now, UpdatedAt: now},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, test.MockTransactional, &audit.MockRecorder{}, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/api-keys", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get 123", "GET", "/api-keys/123", "", header, http.StatusOK, `*"status":"active"*`},
+		{"get unknown", "GET", "/api-keys/1234", "", header, http.StatusNotFound, ""},
+		{"auth error", "GET", "/api-keys", "", nil, http.StatusUnauthorized, ""},
+		{"create impersonated", "POST", "/api-keys", `{"name":"crm","roles":["financial"]}`, auth.MockImpersonationHeader(), http.StatusForbidden, ""},
+		{"create ok", "POST", "/api-keys", `{"name":"crm","roles":["financial"]}`, header, http.StatusCreated, `*"key":"ak_*`},
+		{"create unknown role", "POST", "/api-keys", `{"name":"crm","roles":["unknown"]}`, header, http.StatusBadRequest, ""},
+		{"create past expiry", "POST", "/api-keys", `{"name":"crm","expires_at":"2020-01-01T00:00:00Z"}`, header, http.StatusBadRequest, ""},
+		{"create input error", "POST", "/api-keys", `"name"`, header, http.StatusBadRequest, ""},
+		{"update ok", "PUT", "/api-keys/123", `{"name":"billing","roles":[],"expires_at":"2100-01-01T00:00:00Z"}`, header, http.StatusOK, `*"expires_at":"2100-01-01T00:00:00Z"*`},
+		{"update revoked", "PUT", "/api-keys/124", `{"name":"old","roles":[]}`, header, http.StatusConflict, ""},
+		{"update validation error", "PUT", "/api-keys/123", `{"name":""}`, header, http.StatusBadRequest, ""},
+		{"revoke ok", "POST", "/api-keys/123/revoke", "", header, http.StatusOK, `*"status":"revoked"*`},
+		{"revoke again", "POST", "/api-keys/123/revoke", "", header, http.StatusConflict, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestService_AuthenticateAPIKey(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	recorder := &audit.MockRecorder{}
+	s := NewService(repo, test.MockTransactional, recorder, logger)
+	ctx := auth.WithUser(context.Background(), "100", "tester", "tester@test.test", []string{entity.RoleAdministrator}, true)
+
+	created, err := s.Create(ctx, CreateAPIKeyRequest{Name: "crm", Roles: []string{"financial"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, created.Key[:prefixLength], created.Prefix)
+	assert.NotEqual(t, created.Key, repo.items[0].KeyHash)
+	assert.Equal(t, "100", created.CreatedBy)
+
+	identity, err := s.AuthenticateAPIKey(ctx, created.Key)
+	if assert.Nil(t, err) {
+		assert.Equal(t, created.ID, identity.GetID())
+		assert.Equal(t, "crm", identity.GetUsername())
+		assert.True(t, identity.HasRole("financial"))
+		assert.False(t, identity.HasRole(entity.RoleAdministrator))
+	}
+	assert.NotNil(t, repo.items[0].LastUsedAt)
+
+	// the actor of the changes made with the key is the key
+	_, err = s.Revoke(auth.WithIdentity(ctx, identity), created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID, recorder.Entries[1].EntityID)
+	_, err = s.AuthenticateAPIKey(ctx, created.Key)
+	assert.Equal(t, errors.Unauthorized(""), err)
+	_, err = s.AuthenticateAPIKey(ctx, "ak_unknown")
+	assert.Equal(t, errors.Unauthorized(""), err)
+
+	// expired keys are rejected
+	past := time.Now().Add(-time.Minute)
+	repo.items = append(repo.items, entity.APIKey{ID: "200", KeyHash: hashKey("ak_expired"), ExpiresAt: &past})
+	_, err = s.AuthenticateAPIKey(ctx, "ak_expired")
+	assert.Equal(t, errors.Unauthorized(""), err)
+}
+
+type mockRepository struct {
+	items []entity.APIKey
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.APIKey, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.APIKey{}, sql.ErrNoRows
+}
+
+func (m mockRepository) GetByHash(ctx context.Context, keyHash string) (entity.APIKey, error) {
+	for _, item := range m.items {
+		if item.KeyHash == keyHash {
+			return item, nil
+		}
+	}
+	return entity.APIKey{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.APIKey, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, key entity.APIKey) error {
+	if key.Name == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, key)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, key entity.APIKey) error {
+	for i, item := range m.items {
+		if item.ID == key.ID {
+			m.items[i] = key
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i].LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) CheckRoles(ctx context.Context, roles []string) error {
+	for _, role := range roles {
+		if role == "unknown" {
+			return errors.BadRequest("role \"unknown\" does not exist")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package apikey
+
+import (
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"fmt"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access API keys from the data source.
+type Repository interface {
+	// Get returns the API key with the specified ID.
+	Get(ctx context.Context, id string) (entity.APIKey, error)
+	// GetByHash returns the API key with the given hash.
+	GetByHash(ctx context.Context, keyHash string) (entity.APIKey, error)
+	// Count returns the number of API keys.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of API keys with the given offset and limit, the newest first.
+	Query(ctx context.Context, offset, limit int) ([]entity.APIKey, error)
+	// Create saves a new API key in the storage.
+	Create(ctx context.Context, key entity.APIKey) error
+	// Update updates the API key with given ID in the storage.
+	Update(ctx context.Context, key entity.APIKey) error
+	// Touch sets the time the API key with the specified ID was last used.
+	Touch(ctx context.Context, id string, at time.Time) error
+	// CheckRoles returns a bad request error if one of the roles with the given names does not exist.
+	CheckRoles(ctx context.Context, roles []string) error
+}
+
+// repository persists API keys in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new API key repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the API key with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.APIKey, error) {
+	var key entity.APIKey
+	err := r.db.With(ctx).Select().Model(id, &key)
+	return key, err
+}
+
+// GetByHash reads the API key with the specified hash from the database.
+func (r repository) GetByHash(ctx context.Context, keyHash string) (entity.APIKey, error) {
+	var key entity.APIKey
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"key_hash": keyHash}).One(&key)
+	return key, err
+}
+
+// Count returns the number of the API key records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("api_keys").Row(&count)
+	return count, err
+}
+
+// Query retrieves the API key records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	err := r.db.With(ctx).
+		Select().
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&keys)
+	return keys, err
+}
+
+// Create saves a new API key record in the database.
+func (r repository) Create(ctx context.Context, key entity.APIKey) error {
+	return r.db.With(ctx).Model(&key).Insert()
+}
+
+// Update saves the changes to an API key in the database.
+func (r repository) Update(ctx context.Context, key entity.APIKey) error {
+	return r.db.With(ctx).Model(&key).Update()
+}
+
+// Touch updates the last used time of an API key record in the database.
+func (r repository) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("api_keys", dbx.Params{"last_used_at": at}, dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// CheckRoles looks up the roles with the given names in the database.
+func (r repository) CheckRoles(ctx context.Context, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	names := make([]interface{}, len(roles))
+	for i, role := range roles {
+		names[i] = role
+	}
+	var found []string
+	if err := r.db.With(ctx).Select("name").From("roles").Where(dbx.In("name", names...)).Column(&found); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if !contains(found, role) {
+			return errors.BadRequest(fmt.Sprintf("role %q does not exist", role))
+		}
+	}
+	return nil
+}
+
+// contains reports whether the value is among the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package apikey
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "api_keys")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// create
+	err := repo.Create(ctx, entity.APIKey{
+		ID:        "test1",
+		Name:      "crm",
+		Prefix:    "ak_abcdefgh",
+		KeyHash:   hashKey("ak_abcdefgh"),
+		Roles:     []string{entity.RoleFinancial},
+		CreatedBy: "100",
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	assert.Nil(t, err)
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// get
+	key, err := repo.Get(ctx, "test1")
+	assert.Nil(t, err)
+	assert.Equal(t, "crm", key.Name)
+	assert.Equal(t, []string{entity.RoleFinancial}, []string(key.Roles))
+	key, err = repo.GetByHash(ctx, hashKey("ak_abcdefgh"))
+	assert.Nil(t, err)
+	assert.Equal(t, "test1", key.ID)
+	_, err = repo.GetByHash(ctx, hashKey("unknown"))
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	key.RevokedAt = &now
+	assert.Nil(t, repo.Update(ctx, key))
+	assert.Nil(t, repo.Touch(ctx, "test1", now))
+	key, _ = repo.Get(ctx, "test1")
+	assert.NotNil(t, key.RevokedAt)
+	assert.NotNil(t, key.LastUsedAt)
+
+	// query
+	keys, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(keys))
+
+	// roles
+	assert.Nil(t, repo.CheckRoles(ctx, []string{entity.RoleAdministrator}))
+	assert.NotNil(t, repo.CheckRoles(ctx, []string{"unknown"}))
+}
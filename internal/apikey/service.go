@@ -0,0 +1,290 @@
+// Package apikey manages the API keys that services use to call the API without logging in as a user.
+//
+// The requests made with a key are sent with an "Authorization: ApiKey <key>" header. They are granted the roles
+// of the key, and the key is their actor. Only the hash of a key is stored: the key is returned once, when it is created.
+package apikey
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// keyPrefix starts all the keys, so that they are easy to recognize, e.g. by secret scanners.
+	keyPrefix = "ak_"
+	// prefixLength is the number of the first characters of a key that are stored and displayed.
+	prefixLength = len(keyPrefix) + 8
+	// touchInterval is the minimum delay between two updates of the last used time of a key.
+	touchInterval = time.Minute
+)
+
+// Service encapsulates usecase logic for API keys.
+type Service interface {
+	Get(ctx context.Context, id string) (APIKey, error)
+	Query(ctx context.Context, offset, limit int) ([]APIKey, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateAPIKeyRequest) (CreatedAPIKey, error)
+	Update(ctx context.Context, id string, input UpdateAPIKeyRequest) (APIKey, error)
+	Revoke(ctx context.Context, id string) (APIKey, error)
+	// AuthenticateAPIKey returns the identity of the requests made with the given key.
+	// An unauthorized error is returned if the key does not exist, has expired or has been revoked.
+	AuthenticateAPIKey(ctx context.Context, key string) (auth.Identity, error)
+}
+
+// APIKey represents the data about an API key.
+type APIKey struct {
+	entity.APIKey
+	Status string `json:"status"`
+}
+
+// CreatedAPIKey represents a new API key, including the key itself.
+type CreatedAPIKey struct {
+	APIKey
+	// the key. It cannot be retrieved later
+	Key string `json:"key"`
+}
+
+// CreateAPIKeyRequest represents an API key creation request.
+type CreateAPIKeyRequest struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+	// the key never expires if ExpiresAt is nil
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Validate validates the CreateAPIKeyRequest fields.
+func (m CreateAPIKeyRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 100)),
+		validation.Field(&m.Roles, validation.Each(validation.Required, validation.Length(0, 50))),
+		validation.Field(&m.ExpiresAt, validation.By(validateFuture)),
+	)
+}
+
+// UpdateAPIKeyRequest represents an API key update request.
+type UpdateAPIKeyRequest struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+	// the key never expires if ExpiresAt is nil
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Validate validates the UpdateAPIKeyRequest fields.
+func (m UpdateAPIKeyRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 100)),
+		validation.Field(&m.Roles, validation.NotNil, validation.Each(validation.Required, validation.Length(0, 50))),
+		validation.Field(&m.ExpiresAt, validation.By(validateFuture)),
+	)
+}
+
+// validateFuture checks that the time, if any, is in the future.
+func validateFuture(value interface{}) error {
+	if t, ok := value.(*time.Time); ok && t != nil && !t.After(time.Now()) {
+		return validation.NewError("validation_future", "must be in the future")
+	}
+	return nil
+}
+
+// entityType identifies API keys in the audit log.
+const entityType = "api_key"
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	logger        log.Logger
+	now           func() time.Time
+}
+
+// NewService creates a new API key service.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, recorder audit.Recorder, logger log.Logger) Service {
+	return service{repo, transactional, recorder, logger, time.Now}
+}
+
+// Get returns the API key with the specified ID.
+func (s service) Get(ctx context.Context, id string) (APIKey, error) {
+	key, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return s.newAPIKey(key), nil
+}
+
+// Count returns the number of API keys.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the API keys with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]APIKey, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []APIKey{}
+	for _, item := range items {
+		result = append(result, s.newAPIKey(item))
+	}
+	return result, nil
+}
+
+// Create creates an API key on behalf of the current user.
+func (s service) Create(ctx context.Context, req CreateAPIKeyRequest) (CreatedAPIKey, error) {
+	if err := req.Validate(); err != nil {
+		return CreatedAPIKey{}, err
+	}
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return CreatedAPIKey{}, errors.Unauthorized("")
+	}
+	secret, hash, err := generateKey()
+	if err != nil {
+		return CreatedAPIKey{}, err
+	}
+	now := s.now()
+	key := entity.APIKey{
+		ID:        entity.GenerateID(),
+		Name:      req.Name,
+		Prefix:    secret[:prefixLength],
+		KeyHash:   hash,
+		Roles:     req.Roles,
+		CreatedBy: identity.GetID(),
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if key.Roles == nil {
+		key.Roles = []string{}
+	}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.CheckRoles(ctx, req.Roles); err != nil {
+			return err
+		}
+		if err := s.repo.Create(ctx, key); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionCreate, entityType, key.ID, nil, key)
+	})
+	if err != nil {
+		return CreatedAPIKey{}, err
+	}
+	return CreatedAPIKey{s.newAPIKey(key), secret}, nil
+}
+
+// Update updates the name, roles and expiry of the API key with the specified ID.
+// A conflict error is returned if the key has been revoked.
+func (s service) Update(ctx context.Context, id string, req UpdateAPIKeyRequest) (APIKey, error) {
+	if err := req.Validate(); err != nil {
+		return APIKey{}, err
+	}
+	var key entity.APIKey
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before.RevokedAt != nil {
+			return errors.Conflict("the API key is revoked")
+		}
+		if err := s.repo.CheckRoles(ctx, req.Roles); err != nil {
+			return err
+		}
+		key = before
+		key.Name = req.Name
+		key.Roles = req.Roles
+		key.ExpiresAt = req.ExpiresAt
+		key.UpdatedAt = s.now()
+		if err := s.repo.Update(ctx, key); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, before, key)
+	})
+	if err != nil {
+		return APIKey{}, err
+	}
+	return s.newAPIKey(key), nil
+}
+
+// Revoke revokes the API key with the specified ID so that it can no longer be used.
+// A conflict error is returned if the key is already revoked.
+func (s service) Revoke(ctx context.Context, id string) (APIKey, error) {
+	var key entity.APIKey
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before.RevokedAt != nil {
+			return errors.Conflict("the API key is already revoked")
+		}
+		key = before
+		now := s.now()
+		key.RevokedAt = &now
+		key.UpdatedAt = now
+		if err := s.repo.Update(ctx, key); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, before, key)
+	})
+	if err != nil {
+		return APIKey{}, err
+	}
+	return s.newAPIKey(key), nil
+}
+
+// AuthenticateAPIKey looks up the active key and records its use, at most once per touchInterval.
+func (s service) AuthenticateAPIKey(ctx context.Context, secret string) (auth.Identity, error) {
+	key, err := s.repo.GetByHash(ctx, hashKey(secret))
+	if err == sql.ErrNoRows {
+		return nil, errors.Unauthorized("")
+	} else if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if key.Status(now) != entity.APIKeyActive {
+		s.logger.With(ctx, "api_key", key.ID).Infof("authentication failed: the API key is %v", key.Status(now))
+		return nil, errors.Unauthorized("")
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		if err := s.repo.Touch(ctx, key.ID, now); err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// newAPIKey returns the data about the API key, including its current status.
+func (s service) newAPIKey(key entity.APIKey) APIKey {
+	return APIKey{key, key.Status(s.now())}
+}
+
+// generateKey returns a random API key and its hash.
+func generateKey() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, hashKey(key), nil
+}
+
+// hashKey returns the hash under which the given API key is stored.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
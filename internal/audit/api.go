@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/log"
+	"backend/pkg/pagination"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"time"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+	r.Use(authHandler, auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant)
+	// the following endpoints require a valid JWT of an administrator who is not scoped to an organization
+	r.Get("/audit", res.query)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) query(c *routing.Context) error {
+	filter := Filter{
+		ActorID:        c.Query("actor_id"),
+		ImpersonatedID: c.Query("impersonated_id"),
+		Action:         c.Query("action"),
+		EntityType:     c.Query("entity_type"),
+		EntityID:       c.Query("entity_id"),
+	}
+	var err error
+	if filter.From, err = parseTime(c.Query("from")); err != nil {
+		return errors.BadRequest("The from parameter must be a RFC 3339 time.")
+	}
+	if filter.To, err = parseTime(c.Query("to")); err != nil {
+		return errors.BadRequest("The to parameter must be a RFC 3339 time.")
+	}
+
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	entries, err := r.service.Query(ctx, filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = entries
+	return c.Write(pages)
+}
+
+// parseTime parses an optional RFC 3339 time.
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
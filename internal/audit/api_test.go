@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.AuditEntry{
+		{"1", "100", "", ActionCreate, "album", "123", []byte(`{}`), "", "", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"2", "100", "102", ActionUpdate, "album", "123", []byte(`{}`), "", "", time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{"3", "101", "", ActionCreate, "user", "456", []byte(`{}`), "", "", time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC)},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/audit", "", header, http.StatusOK, `*"total_count":3*`},
+		{"filter entity", "GET", "/audit?entity_type=album&entity_id=123", "", header, http.StatusOK, `*"total_count":2*`},
+		{"filter actor and action", "GET", "/audit?actor_id=100&action=update", "", header, http.StatusOK, `*"total_count":1*`},
+		{"filter impersonated user", "GET", "/audit?impersonated_id=102", "", header, http.StatusOK, `*"total_count":1*`},
+		{"filter time", "GET", "/audit?from=2026-10-02T00:00:00Z&to=2026-10-03T00:00:00Z", "", header, http.StatusOK, `*"total_count":1*`},
+		{"invalid time", "GET", "/audit?from=yesterday", "", header, http.StatusBadRequest, ""},
+		{"auth error", "GET", "/audit", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+type mockRepository struct {
+	items []entity.AuditEntry
+}
+
+func (m mockRepository) Count(ctx context.Context, filter Filter) (int, error) {
+	items, err := m.Query(ctx, filter, 0, 0)
+	return len(items), err
+}
+
+func (m mockRepository) Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.AuditEntry, error) {
+	var items []entity.AuditEntry
+	for _, item := range m.items {
+		if filter.ActorID != "" && item.ActorID != filter.ActorID ||
+			filter.ImpersonatedID != "" && item.ImpersonatedID != filter.ImpersonatedID ||
+			filter.Action != "" && item.Action != filter.Action ||
+			filter.EntityType != "" && item.EntityType != filter.EntityType ||
+			filter.EntityID != "" && item.EntityID != filter.EntityID ||
+			filter.From != nil && item.CreatedAt.Before(*filter.From) ||
+			filter.To != nil && !item.CreatedAt.Before(*filter.To) {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, entry entity.AuditEntry) error {
+	if entry.EntityID == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, entry)
+	return nil
+}
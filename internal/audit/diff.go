@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// redactedFields lists the JSON fields whose values are never written to the audit log.
+var redactedFields = map[string]bool{
+	"password": true,
+}
+
+// redacted replaces the value of a redacted field in the audit log.
+const redacted = "[REDACTED]"
+
+// Change describes how a field of an entity was changed.
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Diff compares the JSON representations of an entity before and after a change and returns the changed fields.
+// Before is nil for created entities and after is nil for deleted ones. The values of sensitive fields are redacted.
+func Diff(before, after interface{}) (map[string]Change, error) {
+	prev, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	next, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]Change{}
+	for field := range prev {
+		if _, ok := next[field]; !ok {
+			next[field] = nil
+		}
+	}
+	for field, value := range next {
+		if reflect.DeepEqual(prev[field], value) {
+			continue
+		}
+		change := Change{prev[field], value}
+		if redactedFields[field] {
+			change = Change{redact(change.Old), redact(change.New)}
+		}
+		changes[field] = change
+	}
+	return changes, nil
+}
+
+// toMap converts a value into the map of its JSON fields.
+func toMap(value interface{}) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil() {
+		return result, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// redact hides a non-empty value.
+func redact(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return redacted
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type model struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+		Count    int    `json:"count"`
+	}
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   map[string]Change
+	}{
+		{"create", nil, model{"a", "secret", 1}, map[string]Change{
+			"name":     {nil, "a"},
+			"password": {nil, redacted},
+			"count":    {nil, float64(1)},
+		}},
+		{"update", model{"a", "secret", 1}, model{"b", "secret", 1}, map[string]Change{
+			"name": {"a", "b"},
+		}},
+		{"update password", model{"a", "secret", 1}, model{"a", "other", 1}, map[string]Change{
+			"password": {redacted, redacted},
+		}},
+		{"delete", &model{"a", "", 1}, (*model)(nil), map[string]Change{
+			"name":     {"a", nil},
+			"password": {"", nil},
+			"count":    {float64(1), nil},
+		}},
+		{"unchanged", model{"a", "secret", 1}, model{"a", "secret", 1}, map[string]Change{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.before, tt.after)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Package audit records who changed which entity, when and how, and lets administrators browse these records.
+package audit
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/pkg/log"
+	"backend/pkg/realip"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Recorder records changes made to entities in the audit log.
+type Recorder interface {
+	// Record records an action performed on an entity by the current user.
+	// Before and after are the states of the entity before and after the change. Before is nil for
+	// created entities and after is nil for deleted ones. If the context carries a transaction,
+	// the entry is saved as part of it so that it is only kept if the change is committed.
+	Record(ctx context.Context, action, entityType, entityID string, before, after interface{}) error
+}
+
+type recorder struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewRecorder creates a new audit recorder.
+func NewRecorder(repo Repository, logger log.Logger) Recorder {
+	return recorder{repo, logger}
+}
+
+// Record saves an audit entry describing the action. The actor, request ID and client IP are taken from the context.
+// The actor of the changes made by impersonating a user is the user who is impersonating.
+func (r recorder) Record(ctx context.Context, action, entityType, entityID string, before, after interface{}) error {
+	diff, err := Diff(before, after)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	entry := entity.AuditEntry{
+		ID:         entity.GenerateID(),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    changes,
+		RequestID:  log.RequestID(ctx),
+		IP:         realip.FromContext(ctx),
+		CreatedAt:  time.Now(),
+	}
+	entry.ActorID, entry.ImpersonatedID = actor(ctx)
+	return r.repo.Create(ctx, entry)
+}
+
+// actor returns the ID of the current user, and the ID of the impersonated user if the current user is impersonated.
+func actor(ctx context.Context) (string, string) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return "", ""
+	}
+	if impersonator := auth.Impersonator(ctx); impersonator != nil {
+		return impersonator.GetID(), identity.GetID()
+	}
+	return identity.GetID(), ""
+}
+
+// MockRecorder is a Recorder that keeps the entries in memory, for testing purpose.
+type MockRecorder struct {
+	Entries []entity.AuditEntry
+}
+
+// Record appends an entry describing the action to Entries.
+func (m *MockRecorder) Record(ctx context.Context, action, entityType, entityID string, before, after interface{}) error {
+	diff, err := Diff(before, after)
+	if err != nil {
+		return err
+	}
+	changes, _ := json.Marshal(diff)
+	m.Entries = append(m.Entries, entity.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    changes,
+	})
+	return nil
+}
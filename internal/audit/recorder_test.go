@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/pkg/log"
+	"backend/pkg/realip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecorder_Record(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	r := NewRecorder(repo, logger)
+
+	ctx := auth.WithUser(context.Background(), "100", "tester", "tester@test.test", nil, true)
+	ctx = realip.WithIP(ctx, "10.0.0.1")
+	err := r.Record(ctx, ActionUpdate, "album", "123", entity.Album{Name: "a"}, entity.Album{Name: "b"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(repo.items)) {
+		entry := repo.items[0]
+		assert.NotEmpty(t, entry.ID)
+		assert.Equal(t, "100", entry.ActorID)
+		assert.Equal(t, ActionUpdate, entry.Action)
+		assert.Equal(t, "album", entry.EntityType)
+		assert.Equal(t, "123", entry.EntityID)
+		assert.JSONEq(t, `{"name":{"old":"a","new":"b"}}`, string(entry.Changes))
+		assert.Equal(t, "10.0.0.1", entry.IP)
+		assert.NotEmpty(t, entry.CreatedAt)
+	}
+
+	// changes made without an authenticated user
+	err = r.Record(context.Background(), ActionCreate, "album", "124", nil, entity.Album{Name: "c"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(repo.items)) {
+		assert.Equal(t, "", repo.items[1].ActorID)
+	}
+
+	// the actor of the changes made by impersonating a user is the user who is impersonating
+	impersonated := auth.WithIdentity(ctx, auth.Impersonation{Identity: entity.User{ID: "101"}, Actor: auth.CurrentUser(ctx)})
+	err = r.Record(impersonated, ActionUpdate, "album", "124", entity.Album{Name: "c"}, entity.Album{Name: "d"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(repo.items)) {
+		assert.Equal(t, "100", repo.items[2].ActorID)
+		assert.Equal(t, "101", repo.items[2].ImpersonatedID)
+	}
+
+	// the repository error is returned so that the change can be rolled back
+	err = r.Record(ctx, ActionDelete, "album", "error", entity.Album{Name: "c"}, nil)
+	assert.Equal(t, errCRUD, err)
+}
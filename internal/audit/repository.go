@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Filter represents the conditions that the audit entries returned by a query must meet.
+// Empty conditions are ignored.
+type Filter struct {
+	ActorID string
+	// the user the actor was impersonating
+	ImpersonatedID string
+	Action         string
+	EntityType     string
+	EntityID       string
+	// the entries must have been created at or after this time
+	From *time.Time
+	// the entries must have been created before this time
+	To *time.Time
+}
+
+// Repository encapsulates the logic to access audit entries from the data source.
+type Repository interface {
+	// Count returns the number of audit entries matching the filter.
+	Count(ctx context.Context, filter Filter) (int, error)
+	// Query returns the audit entries matching the filter with the given offset and limit, the newest first.
+	Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.AuditEntry, error)
+	// Create saves a new audit entry in the storage.
+	Create(ctx context.Context, entry entity.AuditEntry) error
+}
+
+// repository persists audit entries in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new audit repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Count returns the number of the audit records matching the filter in the database.
+func (r repository) Count(ctx context.Context, filter Filter) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("audit_log").Where(filter.condition()).Row(&count)
+	return count, err
+}
+
+// Query retrieves the audit records matching the filter with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.AuditEntry, error) {
+	var entries []entity.AuditEntry
+	err := r.db.With(ctx).
+		Select().
+		Where(filter.condition()).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&entries)
+	return entries, err
+}
+
+// Create saves a new audit record in the database.
+// When the context carries a transaction, the record is saved as part of it.
+func (r repository) Create(ctx context.Context, entry entity.AuditEntry) error {
+	// the changes are sent as text because the driver would send a byte slice as binary data
+	_, err := r.db.With(ctx).Insert("audit_log", dbx.Params{
+		"id":              entry.ID,
+		"actor_id":        entry.ActorID,
+		"impersonated_id": entry.ImpersonatedID,
+		"action":          entry.Action,
+		"entity_type":     entry.EntityType,
+		"entity_id":       entry.EntityID,
+		"changes":         string(entry.Changes),
+		"request_id":      entry.RequestID,
+		"ip":              entry.IP,
+		"created_at":      entry.CreatedAt,
+	}).Execute()
+	return err
+}
+
+// condition builds the WHERE condition of the filter.
+func (f Filter) condition() dbx.Expression {
+	hash := dbx.HashExp{}
+	for column, value := range map[string]string{
+		"actor_id":        f.ActorID,
+		"impersonated_id": f.ImpersonatedID,
+		"action":          f.Action,
+		"entity_type":     f.EntityType,
+		"entity_id":       f.EntityID,
+	} {
+		if value != "" {
+			hash[column] = value
+		}
+	}
+	exps := []dbx.Expression{hash}
+	if f.From != nil {
+		exps = append(exps, dbx.NewExp("created_at >= {:from}", dbx.Params{"from": *f.From}))
+	}
+	if f.To != nil {
+		exps = append(exps, dbx.NewExp("created_at < {:to}", dbx.Params{"to": *f.To}))
+	}
+	return dbx.And(exps...)
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "audit_log")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	now := time.Now()
+	for i, id := range []string{"1", "2", "3"} {
+		err := repo.Create(ctx, entity.AuditEntry{
+			ID:         id,
+			ActorID:    "100",
+			Action:     ActionUpdate,
+			EntityType: "album",
+			EntityID:   "123",
+			Changes:    []byte(`{"name":{"old":"a","new":"b"}}`),
+			CreatedAt:  now.Add(time.Duration(i) * time.Minute),
+		})
+		assert.Nil(t, err)
+	}
+
+	// count
+	count, err := repo.Count(ctx, Filter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	count, _ = repo.Count(ctx, Filter{EntityType: "user"})
+	assert.Equal(t, 0, count)
+	from := now.Add(time.Minute)
+	count, _ = repo.Count(ctx, Filter{ActorID: "100", From: &from})
+	assert.Equal(t, 2, count)
+
+	// query
+	entries, err := repo.Query(ctx, Filter{EntityType: "album", EntityID: "123"}, 0, 2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, "3", entries[0].ID)
+		assert.JSONEq(t, `{"name":{"old":"a","new":"b"}}`, string(entries[0].Changes))
+	}
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/log"
+	"context"
+)
+
+// Service encapsulates usecase logic for browsing the audit log.
+type Service interface {
+	Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.AuditEntry, error)
+	Count(ctx context.Context, filter Filter) (int, error)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new audit service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Count returns the number of audit entries matching the filter.
+func (s service) Count(ctx context.Context, filter Filter) (int, error) {
+	return s.repo.Count(ctx, filter)
+}
+
+// Query returns the audit entries matching the filter with the specified offset and limit, the newest first.
+func (s service) Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.AuditEntry, error) {
+	items, err := s.repo.Query(ctx, filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []entity.AuditEntry{}
+	}
+	return items, nil
+}
@@ -1,14 +1,25 @@
 package auth
 
 import (
+	"backend/internal/entity"
 	"backend/internal/errors"
 	"backend/pkg/log"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
 )
 
 // RegisterHandlers registers handlers for different HTTP requests.
-func RegisterHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
-	rg.Post("/login", login(service, logger))  // /v1/login
+// The public endpoints are handled by publicHandler first (e.g. to rate limit them per client IP), the others by authHandler.
+func RegisterHandlers(rg *routing.RouteGroup, service Service, publicHandler, authHandler routing.Handler, logger log.Logger) {
+	rg.Post("/login", publicHandler, login(service, logger))        // /v1/login
+	rg.Post("/login/mfa", publicHandler, loginMFA(service, logger)) // /v1/login/mfa
+	rg.Get("/login/oidc/<provider>", publicHandler, loginOIDC(service))
+	rg.Get("/login/oidc/<provider>/callback", publicHandler, oidcCallback(service, logger))
+
+	// the following endpoint requires a valid JWT of a member of the staff
+	rg.Post("/admin/users/<id>/impersonate", authHandler,
+		RequireRole(entity.RoleAdministrator, entity.RoleClientSupport, entity.RoleDriverSupport), DenyImpersonation,
+		impersonate(service))
 }
 
 // login returns a handler that handles user login request.
@@ -17,6 +28,30 @@ func login(service Service, logger log.Logger) routing.Handler {
 		var req struct {
 			Username string `json:"username"`
 			Password string `json:"password"`
+			// the ID of the organization to log in to. It can be omitted by the members of a single organization
+			Organization string `json:"organization"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		ctx := withOrganization(withUserAgent(c.Request.Context(), c.Request.UserAgent()), req.Organization)
+		result, err := service.Login(ctx, req.Username, req.Password)
+		if err != nil {
+			return err
+		}
+		return c.Write(result)
+	}
+}
+
+// loginMFA returns a handler that exchanges the MFA token returned by login and a one-time code for a JWT token.
+func loginMFA(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			MFAToken string `json:"mfa_token"`
+			Code     string `json:"code"`
 		}
 
 		if err := c.Read(&req); err != nil {
@@ -24,7 +59,53 @@ func login(service Service, logger log.Logger) routing.Handler {
 			return errors.BadRequest("")
 		}
 
-		token, err := service.Login(c.Request.Context(), req.Username, req.Password)
+		token, err := service.VerifyMFA(withUserAgent(c.Request.Context(), c.Request.UserAgent()), req.MFAToken, req.Code)
+		if err != nil {
+			return err
+		}
+		return c.Write(struct {
+			Token string `json:"access_token"`
+		}{token})
+	}
+}
+
+// loginOIDC returns a handler that redirects the user to the login page of an external identity provider.
+func loginOIDC(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		url, err := service.OIDCLogin(c.Request.Context(), c.Param("provider"))
+		if err != nil {
+			return err
+		}
+		http.Redirect(c.Response, c.Request, url, http.StatusFound)
+		return nil
+	}
+}
+
+// oidcCallback returns a handler that completes the login of a user redirected back by an external identity provider.
+func oidcCallback(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		if reason := c.Query("error"); reason != "" {
+			logger.With(c.Request.Context()).Infof("the identity provider returned an error: %v %v", reason, c.Query("error_description"))
+			return errors.Unauthorized("")
+		}
+		if c.Query("code") == "" || c.Query("state") == "" {
+			return errors.BadRequest("the code or the state is missing")
+		}
+
+		ctx := withUserAgent(c.Request.Context(), c.Request.UserAgent())
+		result, err := service.OIDCCallback(ctx, c.Param("provider"), c.Query("code"), c.Query("state"))
+		if err != nil {
+			return err
+		}
+		return c.Write(result)
+	}
+}
+
+// impersonate returns a handler that generates a JWT token impersonating a user on behalf of the current user.
+func impersonate(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		ctx := withUserAgent(c.Request.Context(), c.Request.UserAgent())
+		token, err := service.Impersonate(ctx, c.Param("id"))
 		if err != nil {
 			return err
 		}
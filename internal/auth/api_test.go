@@ -1,32 +1,76 @@
 package auth
 
 import (
-	"context"
 	"backend/internal/errors"
 	"backend/internal/test"
 	"backend/pkg/log"
+	"context"
 	"net/http"
 	"testing"
 )
 
 type mockService struct{}
 
-func (m mockService) Login(ctx context.Context, username, password string) (string, error) {
+func (m mockService) Login(ctx context.Context, username, password string) (LoginResult, error) {
 	if username == "test" && password == "pass" {
-		return "token-100", nil
+		return LoginResult{Token: "token-100"}, nil
+	}
+	if username == "mfa" && password == "pass" {
+		return LoginResult{MFARequired: true, MFAToken: "mfa-101"}, nil
+	}
+	return LoginResult{}, errors.Unauthorized("")
+}
+
+func (m mockService) VerifyMFA(ctx context.Context, mfaToken, code string) (string, error) {
+	if mfaToken == "mfa-101" && code == "123456" {
+		return "token-101", nil
 	}
 	return "", errors.Unauthorized("")
 }
 
+func (m mockService) OIDCLogin(ctx context.Context, provider string) (string, error) {
+	if provider == "corp" {
+		return "https://login.corp.test/authorize?state=abc", nil
+	}
+	return "", errors.NotFound("")
+}
+
+func (m mockService) OIDCCallback(ctx context.Context, provider, code, state string) (LoginResult, error) {
+	if provider == "corp" && code == "code" && state == "abc" {
+		return LoginResult{Token: "token-102"}, nil
+	}
+	return LoginResult{}, errors.Unauthorized("")
+}
+
+func (m mockService) Impersonate(ctx context.Context, userID string) (string, error) {
+	if userID == "101" {
+		return "token-101-as-100", nil
+	}
+	return "", errors.NotFound("")
+}
+
 func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
-	RegisterHandlers(router.Group(""), mockService{}, logger)
+	RegisterHandlers(router.Group(""), mockService{}, test.MockHandler, MockAuthHandler, logger)
 
 	tests := []test.APITestCase{
-		{"success", "POST", "/login", `{"username":"test","password":"pass"}`, nil, http.StatusOK, `{"token":"token-100"}`},
+		{"success", "POST", "/login", `{"username":"test","password":"pass"}`, nil, http.StatusOK, `{"access_token":"token-100"}`},
 		{"bad credential", "POST", "/login", `{"username":"test","password":"wrong pass"}`, nil, http.StatusUnauthorized, ""},
 		{"bad json", "POST", "/login", `"username":"test","password":"wrong pass"}`, nil, http.StatusBadRequest, ""},
+		{"mfa required", "POST", "/login", `{"username":"mfa","password":"pass"}`, nil, http.StatusOK, `{"mfa_required":true,"mfa_token":"mfa-101"}`},
+		{"mfa success", "POST", "/login/mfa", `{"mfa_token":"mfa-101","code":"123456"}`, nil, http.StatusOK, `{"access_token":"token-101"}`},
+		{"mfa bad code", "POST", "/login/mfa", `{"mfa_token":"mfa-101","code":"000000"}`, nil, http.StatusUnauthorized, ""},
+		{"oidc login", "GET", "/login/oidc/corp", "", nil, http.StatusFound, ""},
+		{"oidc unknown provider", "GET", "/login/oidc/other", "", nil, http.StatusNotFound, ""},
+		{"oidc callback", "GET", "/login/oidc/corp/callback?code=code&state=abc", "", nil, http.StatusOK, `{"access_token":"token-102"}`},
+		{"oidc callback bad state", "GET", "/login/oidc/corp/callback?code=code&state=xyz", "", nil, http.StatusUnauthorized, ""},
+		{"oidc callback missing code", "GET", "/login/oidc/corp/callback?state=abc", "", nil, http.StatusBadRequest, ""},
+		{"oidc callback error", "GET", "/login/oidc/corp/callback?error=access_denied", "", nil, http.StatusUnauthorized, ""},
+		{"mfa bad json", "POST", "/login/mfa", `"mfa_token":"mfa-101"}`, nil, http.StatusBadRequest, ""},
+		{"impersonate", "POST", "/admin/users/101/impersonate", "", MockAuthHeader(), http.StatusOK, `{"access_token":"token-101-as-100"}`},
+		{"impersonate unknown", "POST", "/admin/users/999/impersonate", "", MockAuthHeader(), http.StatusNotFound, ""},
+		{"impersonate auth error", "POST", "/admin/users/101/impersonate", "", nil, http.StatusUnauthorized, ""},
 	}
 	for _, tc := range tests {
 		test.Endpoint(t, router, tc)
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"backend/internal/errors"
+	"context"
+	"database/sql"
+	"fmt"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// Impersonation represents the identity of a user impersonated by a member of the staff.
+// It is the identity returned by CurrentUser for the requests made with an impersonation token.
+type Impersonation struct {
+	// the impersonated user
+	Identity
+	// the user who is impersonating, i.e. the real actor of the requests
+	Actor Identity
+}
+
+// Impersonate generates a short-lived JWT token of the user with the specified ID, whose "act" claim identifies
+// the current user. The current user cannot impersonate themselves, nor a user having a role they do not have.
+// If the current user acts in an organization, they can only impersonate its members, within it.
+func (s service) Impersonate(ctx context.Context, userID string) (string, error) {
+	actor := CurrentUser(ctx)
+	if actor == nil {
+		return "", errors.Unauthorized("")
+	}
+	if IsImpersonated(ctx) {
+		return "", errors.Forbidden("A user cannot be impersonated while impersonating another one.")
+	}
+	if userID == actor.GetID() {
+		return "", errors.BadRequest("You cannot impersonate yourself.")
+	}
+	user, err := s.repo.GetUser(ctx, userID)
+	if err == sql.ErrNoRows {
+		return "", errors.NotFound("")
+	} else if err != nil {
+		return "", err
+	}
+	if organizationID := actor.GetOrganizationID(); organizationID != "" {
+		organizations, err := s.repo.GetOrganizations(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		if !isMember(organizations, organizationID) {
+			return "", errors.NotFound("")
+		}
+		ctx = withOrganization(ctx, organizationID)
+	}
+	identity, err := s.identity(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	for _, role := range identity.GetRoles() {
+		if !actor.HasRole(role) {
+			return "", errors.Forbidden(fmt.Sprintf("You cannot impersonate a user with the role %q.", role))
+		}
+	}
+	s.logger.With(ctx, "actor", actor.GetID(), "user", userID).Infof("impersonation started")
+	return s.startSession(ctx, Impersonation{identity, actor})
+}
+
+// Impersonator returns the user who is impersonating the current user, or nil if the current user
+// is not impersonated.
+func Impersonator(ctx context.Context) Identity {
+	if impersonation, ok := CurrentUser(ctx).(Impersonation); ok {
+		return impersonation.Actor
+	}
+	return nil
+}
+
+// IsImpersonated reports whether the current user is impersonated.
+func IsImpersonated(ctx context.Context) bool {
+	return Impersonator(ctx) != nil
+}
+
+// DenyImpersonation is a middleware that rejects the requests of the impersonated users, protecting
+// the sensitive endpoints such as the password or 2FA changes. It must run after the authentication handler.
+func DenyImpersonation(c *routing.Context) error {
+	if IsImpersonated(c.Request.Context()) {
+		return errors.Forbidden("This action cannot be performed while impersonating a user.")
+	}
+	return nil
+}
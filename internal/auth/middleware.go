@@ -3,20 +3,69 @@ package auth
 import (
 	"backend/internal/entity"
 	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
 	"context"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/auth"
 	"net/http"
+	"strings"
 )
 
-// Handler returns a JWT-based authentication middleware.
-func Handler(verificationKey string) routing.Handler {
-	return auth.JWT(verificationKey, auth.JWTOptions{TokenHandler: handleToken})
+// apiKeyScheme is the authorization scheme of the requests made with an API key.
+const apiKeyScheme = "ApiKey "
+
+// APIKeyAuthenticator authenticates the requests made with an API key.
+type APIKeyAuthenticator interface {
+	// AuthenticateAPIKey returns the identity of the requests made with the given key.
+	AuthenticateAPIKey(ctx context.Context, key string) (Identity, error)
+}
+
+// Handler returns an authentication middleware accepting JWTs ("Authorization: Bearer <token>"), and API keys
+// ("Authorization: ApiKey <key>") if an API key authenticator is given.
+// If sessions is given, the JWTs must belong to a session that has not been revoked.
+// The requests made by impersonating a user are logged.
+func Handler(verificationKey string, keys APIKeyAuthenticator, sessions Sessions, logger log.Logger) routing.Handler {
+	jwtHandler := auth.JWT(verificationKey, auth.JWTOptions{TokenHandler: func(c *routing.Context, token *jwt.Token) error {
+		if err := handleToken(c, token); err != nil {
+			return err
+		}
+		ctx := c.Request.Context()
+		if sessions != nil {
+			sessionID := CurrentSession(ctx)
+			if sessionID == "" {
+				return errors.Unauthorized("")
+			}
+			if err := sessions.Check(ctx, sessionID, CurrentUser(ctx).GetID()); err != nil {
+				return err
+			}
+		}
+		if actor := Impersonator(ctx); actor != nil {
+			logger.With(ctx, "actor", actor.GetID(), "user", CurrentUser(ctx).GetID()).
+				Infof("impersonated request: %s %s", c.Request.Method, c.Request.URL.Path)
+		}
+		return nil
+	}})
+	return func(c *routing.Context) error {
+		header := c.Request.Header.Get("Authorization")
+		if keys == nil || !strings.HasPrefix(header, apiKeyScheme) {
+			return jwtHandler(c)
+		}
+		identity, err := keys.AuthenticateAPIKey(c.Request.Context(), strings.TrimSpace(header[len(apiKeyScheme):]))
+		if err != nil {
+			return err
+		}
+		// the API keys are managed by the staff, and act across the organizations
+		c.Request = c.Request.WithContext(dbcontext.Unscoped(WithIdentity(c.Request.Context(), identity)))
+		return nil
+	}
 }
 
 // handleToken stores the user identity in the request context so that it can be accessed elsewhere.
+// The queries of the request are scoped to the organization of the user. They are only explicitly unscoped
+// for the staff: the other users who are a member of no organization find none of the data of the organizations.
 func handleToken(c *routing.Context, token *jwt.Token) error {
 	var roles []string
 	interfaceRoles := token.Claims.(jwt.MapClaims)["roles"].([]interface{})
@@ -34,6 +83,25 @@ func handleToken(c *routing.Context, token *jwt.Token) error {
 		token.Claims.(jwt.MapClaims)["status"].(bool),
 	)
 
+	if organizationID, ok := token.Claims.(jwt.MapClaims)["tid"].(string); ok && organizationID != "" {
+		ctx = WithTenant(ctx, organizationID)
+	} else if CurrentUser(ctx).HasRole(entity.RoleStaff) {
+		ctx = dbcontext.Unscoped(ctx)
+	}
+
+	if sessionID, ok := token.Claims.(jwt.MapClaims)["sid"].(string); ok {
+		ctx = WithSession(ctx, sessionID)
+	}
+
+	if act, ok := token.Claims.(jwt.MapClaims)["act"].(map[string]interface{}); ok {
+		actorID, _ := act["sub"].(string)
+		actorName, _ := act["username"].(string)
+		ctx = WithIdentity(ctx, Impersonation{
+			Identity: CurrentUser(ctx),
+			Actor:    entity.User{ID: actorID, Username: actorName, IsActive: true},
+		})
+	}
+
 	c.Request = c.Request.WithContext(ctx)
 	return nil
 }
@@ -42,32 +110,125 @@ type contextKey int
 
 const (
 	userKey contextKey = iota
+	sessionKey
+	userAgentKey
+	organizationKey
 )
 
 // WithUser returns a context that contains the user identity from the given JWT.
 func WithUser(ctx context.Context, id, username, email string, roles []string, isActive bool) context.Context {
-	return context.WithValue(ctx, userKey, entity.User{ID: id, Username: username, Email: email, Roles: roles, IsActive: isActive})
+	return WithIdentity(ctx, entity.User{ID: id, Username: username, Email: email, Roles: roles, IsActive: isActive})
+}
+
+// WithIdentity returns a context that contains the given identity, such as the identity of an API key.
+// The transactions of the context are scoped to it.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return dbcontext.WithUser(context.WithValue(ctx, userKey, identity), identity.GetID())
+}
+
+// WithTenant returns a context in which the current user acts in the organization with the given ID,
+// and the queries are scoped to it.
+func WithTenant(ctx context.Context, organizationID string) context.Context {
+	if user, ok := CurrentUser(ctx).(entity.User); ok {
+		user.OrganizationID = organizationID
+		ctx = WithIdentity(ctx, user)
+	}
+	return dbcontext.WithTenant(ctx, organizationID)
 }
 
 // CurrentUser returns the user identity from the given context.
 // Nil is returned if no user identity is found in the context.
 func CurrentUser(ctx context.Context) Identity {
-	if user, ok := ctx.Value(userKey).(entity.User); ok {
-		return user
+	if identity, ok := ctx.Value(userKey).(Identity); ok {
+		return identity
+	}
+
+	return nil
+}
+
+// WithSession returns a context that contains the ID of the session of the current user.
+func WithSession(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionKey, sessionID)
+}
+
+// CurrentSession returns the ID of the session of the JWT that authenticated the request, if any.
+func CurrentSession(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionKey).(string)
+	return sessionID
+}
+
+// withUserAgent returns a context that contains the user agent of the client logging in.
+func withUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentKey, userAgent)
+}
+
+// userAgent returns the user agent of the client logging in, from the given context.
+func userAgent(ctx context.Context) string {
+	ua, _ := ctx.Value(userAgentKey).(string)
+	return ua
+}
+
+// withOrganization returns a context that contains the ID of the organization the user logs in to.
+func withOrganization(ctx context.Context, organizationID string) context.Context {
+	return context.WithValue(ctx, organizationKey, organizationID)
+}
+
+// requestedOrganization returns the ID of the organization the user logs in to, from the given context.
+// It is empty if the user did not specify one.
+func requestedOrganization(ctx context.Context) string {
+	organizationID, _ := ctx.Value(organizationKey).(string)
+	return organizationID
+}
+
+// HasRole reports whether the user identity in the given context has at least one of the given roles.
+func HasRole(ctx context.Context, roles ...string) bool {
+	identity := CurrentUser(ctx)
+	return identity != nil && identity.HasRole(roles...)
+}
+
+// RequireRole returns a middleware that only lets through the users having at least one of the given roles.
+// It must run after the authentication handler.
+func RequireRole(roles ...string) routing.Handler {
+	return func(c *routing.Context) error {
+		if !HasRole(c.Request.Context(), roles...) {
+			return errors.Forbidden("")
+		}
+		return nil
 	}
+}
 
+// DenyTenant is a middleware that only lets through the requests explicitly unscoped, i.e. the ones of the staff
+// and of the API keys, protecting the endpoints managing the data of all the organizations, such as the audit log.
+// It must run after the authentication handler.
+func DenyTenant(c *routing.Context) error {
+	ctx := c.Request.Context()
+	if dbcontext.Tenant(ctx) != "" {
+		return errors.Forbidden("This action cannot be performed from within an organization.")
+	}
+	if !dbcontext.IsUnscoped(ctx) {
+		return errors.Forbidden("")
+	}
 	return nil
 }
 
 // MockAuthHandler creates a mock authentication middleware for testing purpose.
 // If the request contains an Authorization header whose value is "TEST", then
-// it considers the user is authenticated as "Tester" whose ID is "100".
+// it considers the user is authenticated as "Tester" whose ID is "100" and who is an administrator
+// of no organization, acting across the organizations as the staff do.
+// If the value is "TEST-IMPERSONATED", "Tester" is impersonated by the user whose ID is "200".
 // It fails the authentication otherwise.
 func MockAuthHandler(c *routing.Context) error {
-	if c.Request.Header.Get("Authorization") != "TEST" {
+	authorization := c.Request.Header.Get("Authorization")
+	if authorization != "TEST" && authorization != "TEST-IMPERSONATED" {
 		return errors.Unauthorized("")
 	}
-	ctx := WithUser(c.Request.Context(), "100", "Tester", "tester@test.test", []string{"admin"}, true)
+	ctx := WithUser(dbcontext.Unscoped(c.Request.Context()), "100", "Tester", "tester@test.test", []string{entity.RoleAdministrator}, true)
+	if authorization == "TEST-IMPERSONATED" {
+		ctx = WithIdentity(ctx, Impersonation{
+			Identity: CurrentUser(ctx),
+			Actor:    entity.User{ID: "200", Username: "Support", IsActive: true},
+		})
+	}
 	c.Request = c.Request.WithContext(ctx)
 	return nil
 }
@@ -78,3 +239,11 @@ func MockAuthHeader() http.Header {
 	header.Add("Authorization", "TEST")
 	return header
 }
+
+// MockImpersonationHeader returns an HTTP header that passes the authentication check by MockAuthHandler
+// as the impersonated "Tester".
+func MockImpersonationHeader() http.Header {
+	header := http.Header{}
+	header.Add("Authorization", "TEST-IMPERSONATED")
+	return header
+}
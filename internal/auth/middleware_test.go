@@ -1,27 +1,98 @@
 package auth
 
 import (
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
 	"context"
 	"github.com/dgrijalva/jwt-go"
-	"backend/internal/test"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"testing"
+	"time"
 )
 
 func TestCurrentUser(t *testing.T) {
 	ctx := context.Background()
 	assert.Nil(t, CurrentUser(ctx))
-	ctx = WithUser(ctx, "100", "test")
+	ctx = WithUser(ctx, "100", "test", "test@test.test", []string{"admin"}, true)
 	identity := CurrentUser(ctx)
 	if assert.NotNil(t, identity) {
 		assert.Equal(t, "100", identity.GetID())
-		assert.Equal(t, "test", identity.GetName())
+		assert.Equal(t, "test@test.test", identity.GetEmail())
+		assert.True(t, identity.HasRole("admin"))
 	}
 }
 
 func TestHandler(t *testing.T) {
-	assert.NotNil(t, Handler("test"))
+	logger, _ := log.NewForTest()
+	assert.NotNil(t, Handler("test", nil, nil, logger))
+}
+
+func TestHandler_APIKey(t *testing.T) {
+	logger, _ := log.NewForTest()
+	handler := Handler("test", mockAPIKeys{}, nil, logger)
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Authorization", "ApiKey ak_valid")
+	ctx, _ := test.MockRoutingContext(req)
+	assert.Nil(t, handler(ctx))
+	identity := CurrentUser(ctx.Request.Context())
+	if assert.NotNil(t, identity) {
+		assert.Equal(t, "key-100", identity.GetID())
+		assert.True(t, identity.HasRole("admin"))
+	}
+	assert.True(t, dbcontext.IsUnscoped(ctx.Request.Context()))
+
+	req.Header.Set("Authorization", "ApiKey ak_invalid")
+	ctx, _ = test.MockRoutingContext(req)
+	assert.Equal(t, errors.Unauthorized(""), handler(ctx))
+	assert.Nil(t, CurrentUser(ctx.Request.Context()))
+
+	// the keys are not accepted without an authenticator
+	req.Header.Set("Authorization", "ApiKey ak_valid")
+	ctx, _ = test.MockRoutingContext(req)
+	assert.NotNil(t, Handler("test", nil, nil, logger)(ctx))
+}
+
+func TestHandler_Sessions(t *testing.T) {
+	logger, _ := log.NewForTest()
+	sessions := &mockSessions{}
+	handler := Handler("test", nil, sessions, logger)
+	s := service{signingKey: "test", tokenExpiration: 1, sessions: sessions}
+	request := func(token string) (*routing.Context, error) {
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		ctx, _ := test.MockRoutingContext(req)
+		return ctx, handler(ctx)
+	}
+
+	token, err := s.startSession(context.Background(), entity.User{ID: "100", Roles: []string{}, IsActive: true})
+	assert.Nil(t, err)
+	ctx, err := request(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "session-1", CurrentSession(ctx.Request.Context()))
+
+	sessions.revoked = true
+	_, err = request(token)
+	assert.NotNil(t, err)
+
+	// the tokens without a session are rejected
+	token, _ = s.generateJWT(entity.User{ID: "100", Roles: []string{}, IsActive: true}, "", time.Now().Add(time.Hour))
+	_, err = request(token)
+	assert.NotNil(t, err)
+}
+
+type mockAPIKeys struct{}
+
+func (m mockAPIKeys) AuthenticateAPIKey(ctx context.Context, key string) (Identity, error) {
+	if key == "ak_valid" {
+		return entity.APIKey{ID: "key-100", Name: "test", Roles: []string{"admin"}}, nil
+	}
+	return nil, errors.Unauthorized("")
 }
 
 func Test_handleToken(t *testing.T) {
@@ -31,16 +102,90 @@ func Test_handleToken(t *testing.T) {
 
 	err := handleToken(ctx, &jwt.Token{
 		Claims: jwt.MapClaims{
-			"id":   "100",
-			"name": "test",
+			"id":       "100",
+			"username": "test",
+			"email":    "test@test.test",
+			"roles":    []interface{}{"admin"},
+			"status":   true,
 		},
 	})
 	assert.Nil(t, err)
 	identity := CurrentUser(ctx.Request.Context())
 	if assert.NotNil(t, identity) {
 		assert.Equal(t, "100", identity.GetID())
-		assert.Equal(t, "test", identity.GetName())
+		assert.Equal(t, []string{"admin"}, identity.GetRoles())
+		assert.True(t, identity.IsUserActive())
+		assert.Equal(t, "", identity.GetOrganizationID())
+	}
+	// a user who is a member of no organization accesses the data of none of them
+	assert.Equal(t, "", dbcontext.Tenant(ctx.Request.Context()))
+	assert.False(t, dbcontext.IsUnscoped(ctx.Request.Context()))
+	assert.Equal(t, errors.Forbidden(""), DenyTenant(ctx))
+
+	// the staff access the data of all the organizations
+	ctx, _ = test.MockRoutingContext(req)
+	err = handleToken(ctx, &jwt.Token{
+		Claims: jwt.MapClaims{
+			"id":       "100",
+			"username": "test",
+			"email":    "test@test.test",
+			"roles":    []interface{}{"admin", entity.RoleStaff},
+			"status":   true,
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "", dbcontext.Tenant(ctx.Request.Context()))
+	assert.True(t, dbcontext.IsUnscoped(ctx.Request.Context()))
+
+	// the queries are scoped to the organization of the user
+	ctx, _ = test.MockRoutingContext(req)
+	err = handleToken(ctx, &jwt.Token{
+		Claims: jwt.MapClaims{
+			"id":       "100",
+			"username": "test",
+			"email":    "test@test.test",
+			"roles":    []interface{}{"admin"},
+			"status":   true,
+			"tid":      "org1",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "org1", CurrentUser(ctx.Request.Context()).GetOrganizationID())
+	assert.Equal(t, "org1", dbcontext.Tenant(ctx.Request.Context()))
+	assert.False(t, dbcontext.IsUnscoped(ctx.Request.Context()))
+}
+
+func Test_handleToken_Impersonation(t *testing.T) {
+	s := service{signingKey: "test"}
+	token, err := s.generateJWT(Impersonation{
+		Identity: entity.User{ID: "101", Roles: []string{}, IsActive: true},
+		Actor:    entity.User{ID: "100"},
+	}, "", time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("test"), nil
+	})
+	assert.Nil(t, err)
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	ctx, _ := test.MockRoutingContext(req)
+	assert.Nil(t, handleToken(ctx, &jwt.Token{Claims: claims}))
+	assert.Equal(t, "101", CurrentUser(ctx.Request.Context()).GetID())
+	if actor := Impersonator(ctx.Request.Context()); assert.NotNil(t, actor) {
+		assert.Equal(t, "100", actor.GetID())
 	}
+	assert.Equal(t, errors.Forbidden("This action cannot be performed while impersonating a user."), DenyImpersonation(ctx))
+}
+
+func TestDenyTenant(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	ctx, _ := test.MockRoutingContext(req)
+	assert.Equal(t, errors.Forbidden(""), DenyTenant(ctx))
+	ctx.Request = ctx.Request.WithContext(dbcontext.Unscoped(ctx.Request.Context()))
+	assert.Nil(t, DenyTenant(ctx))
+	ctx.Request = ctx.Request.WithContext(WithTenant(ctx.Request.Context(), "org1"))
+	assert.Equal(t, errors.Forbidden("This action cannot be performed from within an organization."), DenyTenant(ctx))
 }
 
 func TestMocks(t *testing.T) {
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/oidc"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// oidcLoginExpiration is how long a user has to log in with an external identity provider.
+const oidcLoginExpiration = 10 * time.Minute
+
+// OIDCProvider represents an external identity provider the users can log in with.
+type OIDCProvider struct {
+	*oidc.Provider
+	// the claim of the ID tokens listing the groups of the user at the provider, e.g. "groups"
+	RolesClaim string
+	// the roles granted to the members of each group, in addition to the roles of the user
+	RoleMapping map[string][]string
+}
+
+// roles returns the roles mapped to the groups listed in the claims.
+func (p OIDCProvider) roles(claims oidc.Claims) []string {
+	var roles []string
+	if p.RolesClaim == "" {
+		return roles
+	}
+	for _, group := range claims.Strings(p.RolesClaim) {
+		roles = append(roles, p.RoleMapping[group]...)
+	}
+	return roles
+}
+
+// OIDCLogin saves the state, nonce and PKCE verifier of a new login, and returns the authorization URL of the provider.
+func (s service) OIDCLogin(ctx context.Context, name string) (string, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return "", errors.NotFound("The identity provider does not exist.")
+	}
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = s.repo.CreateOIDCLogin(ctx, entity.OIDCLogin{
+		ID:           entity.GenerateID(),
+		Provider:     name,
+		StateHash:    hashState(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    now.Add(oidcLoginExpiration),
+		CreatedAt:    now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(ctx, state, nonce, oidc.Challenge(verifier))
+}
+
+// OIDCCallback exchanges the code for an ID token and logs in the user linked to the identity of the token.
+// An identity that is not linked yet is linked to the user with the same email address, if both the provider and
+// the user verified it. An unauthorized error is returned if the login is invalid or has expired, and a forbidden
+// error if no user can be linked to the identity or if the user must verify their email address first.
+func (s service) OIDCCallback(ctx context.Context, name, code, state string) (LoginResult, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return LoginResult{}, errors.NotFound("The identity provider does not exist.")
+	}
+	logger := s.logger.With(ctx, "provider", name)
+	login, err := s.repo.TakeOIDCLogin(ctx, hashState(state))
+	if err == sql.ErrNoRows || (err == nil && (login.Provider != name || !time.Now().Before(login.ExpiresAt))) {
+		return LoginResult{}, errors.Unauthorized("The login is invalid or has expired.")
+	} else if err != nil {
+		return LoginResult{}, err
+	}
+	claims, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		logger.Infof("authentication failed: %v", err)
+		return LoginResult{}, errors.Unauthorized("")
+	}
+
+	user, err := s.linkedUser(ctx, name, claims)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if err := s.checkVerified(ctx, user); err != nil {
+		return LoginResult{}, err
+	}
+	identity, err := s.identity(ctx, user)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if roles := provider.roles(claims); len(roles) > 0 {
+		identity = withRoles(identity, roles)
+	}
+	logger.With(ctx, "user", user.Username).Infof("authentication successful")
+	return s.issue(ctx, identity)
+}
+
+// linkedUser returns the user linked to the identity of the claims, linking the user with the same verified
+// email address if there is none. The email address must have been verified by the user as well, since
+// anyone can register an account with an address they do not own.
+func (s service) linkedUser(ctx context.Context, provider string, claims oidc.Claims) (entity.User, error) {
+	external, err := s.repo.GetExternalIdentity(ctx, provider, claims.Subject())
+	if err == nil {
+		user, err := s.repo.GetUser(ctx, external.UserID)
+		if err == sql.ErrNoRows {
+			return entity.User{}, errors.Forbidden("The account linked to this identity is disabled.")
+		}
+		return user, err
+	} else if err != sql.ErrNoRows {
+		return entity.User{}, err
+	}
+
+	if claims.Email() == "" || !claims.EmailVerified() {
+		return entity.User{}, errors.Forbidden("No account is linked to this identity.")
+	}
+	user, err := s.repo.GetUserByEmail(ctx, claims.Email())
+	if err == sql.ErrNoRows {
+		return entity.User{}, errors.Forbidden("No account is linked to this identity.")
+	} else if err != nil {
+		return entity.User{}, err
+	}
+	if user.EmailVerifiedAt == nil {
+		s.logger.With(ctx, "provider", provider, "user", user.Username).Infof("the unverified email address of the user cannot be linked")
+		return entity.User{}, errors.Forbidden("No account is linked to this identity.")
+	}
+	err = s.repo.CreateExternalIdentity(ctx, entity.ExternalIdentity{
+		ID:        entity.GenerateID(),
+		Provider:  provider,
+		Subject:   claims.Subject(),
+		UserID:    user.ID,
+		Email:     claims.Email(),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return entity.User{}, err
+	}
+	s.logger.With(ctx, "provider", provider, "user", user.Username).Infof("external identity linked")
+	return user, nil
+}
+
+// withRoles returns the identity with the given roles added.
+func withRoles(identity Identity, roles []string) Identity {
+	all := identity.GetRoles()
+	for _, role := range roles {
+		if !(entity.User{Roles: all}).HasRole(role) {
+			all = append(all, role)
+		}
+	}
+	return entity.User{ID: identity.GetID(), Username: identity.GetUsername(), Email: identity.GetEmail(), Roles: all, IsActive: identity.IsUserActive(), OrganizationID: identity.GetOrganizationID()}
+}
+
+// randomString returns a random URL-safe string.
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashState returns the hash under which the OIDC login with the given state is stored.
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
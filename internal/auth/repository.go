@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access the users and their external identities from the data source.
+type Repository interface {
+	// GetUserByUsername returns the active user with the given username, unless it has been deleted.
+	GetUserByUsername(ctx context.Context, username string) (entity.User, error)
+	// GetUser returns the active user with the specified ID, unless it has been deleted.
+	GetUser(ctx context.Context, id string) (entity.User, error)
+	// GetUserByEmail returns the active user with the given email address, unless it has been deleted.
+	GetUserByEmail(ctx context.Context, email string) (entity.User, error)
+	// GetRoles returns the names of the roles of the user with the specified ID within the organization with
+	// the specified ID, including the roles granted in all the organizations.
+	GetRoles(ctx context.Context, userID, organizationID string) ([]string, error)
+	// GetOrganizations returns the IDs of the organizations the user with the specified ID is a member of.
+	GetOrganizations(ctx context.Context, userID string) ([]string, error)
+	// UpdatePassword replaces the password hash of the user with the specified ID.
+	UpdatePassword(ctx context.Context, userID, hash string) error
+	// CreateOIDCLogin saves a new OIDC login in the storage, and removes the expired ones.
+	CreateOIDCLogin(ctx context.Context, login entity.OIDCLogin) error
+	// TakeOIDCLogin removes the OIDC login whose state has the given hash from the storage and returns it,
+	// so that it cannot be completed twice.
+	TakeOIDCLogin(ctx context.Context, stateHash string) (entity.OIDCLogin, error)
+	// GetExternalIdentity returns the identity with the given subject at the given provider.
+	GetExternalIdentity(ctx context.Context, provider, subject string) (entity.ExternalIdentity, error)
+	// CreateExternalIdentity saves a new external identity in the storage.
+	CreateExternalIdentity(ctx context.Context, identity entity.ExternalIdentity) error
+}
+
+// repository persists the authentication data in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new authentication repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// unscoped runs f in a transaction that is not scoped to an organization, as the users are looked up before
+// they choose the organization they log in to. Within the transaction of a request, f runs in it and keeps its scope.
+func (r repository) unscoped(ctx context.Context, f func(ctx context.Context) error) error {
+	return r.db.Transactional(dbcontext.Unscoped(ctx), f)
+}
+
+// GetUserByUsername reads the user with the given username from the database.
+func (r repository) GetUserByUsername(ctx context.Context, username string) (entity.User, error) {
+	var user entity.User
+	err := r.unscoped(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select().From("users as u").Where(dbx.HashExp{"u.username": username, "u.is_active": true, "u.deleted_at": nil}).One(&user)
+	})
+	return user, err
+}
+
+// GetUser reads the user with the specified ID from the database.
+func (r repository) GetUser(ctx context.Context, id string) (entity.User, error) {
+	var user entity.User
+	err := r.unscoped(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select().From("users as u").Where(dbx.HashExp{"u.id": id, "u.is_active": true, "u.deleted_at": nil}).One(&user)
+	})
+	return user, err
+}
+
+// GetUserByEmail reads the user with the given email address from the database, ignoring the case.
+func (r repository) GetUserByEmail(ctx context.Context, email string) (entity.User, error) {
+	var user entity.User
+	err := r.unscoped(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select().From("users as u").Where(dbx.And(
+			dbx.NewExp("LOWER(u.email) = LOWER({:email})", dbx.Params{"email": email}),
+			dbx.HashExp{"u.is_active": true, "u.deleted_at": nil},
+		)).One(&user)
+	})
+	return user, err
+}
+
+// GetRoles reads the names of the roles of a user within an organization from the database.
+func (r repository) GetRoles(ctx context.Context, userID, organizationID string) ([]string, error) {
+	var roles []string
+	organization := dbx.Expression(dbx.HashExp{"ru.organization_id": nil})
+	if organizationID != "" {
+		organization = dbx.Or(organization, dbx.HashExp{"ru.organization_id": organizationID})
+	}
+	err := r.db.With(ctx).Select("r.name as name").
+		Distinct(true).
+		From("roles as r").
+		LeftJoin("role_user as ru", dbx.NewExp("r.id = ru.role_id")).
+		Where(dbx.And(dbx.HashExp{"ru.user_id": userID}, organization)).
+		Column(&roles)
+	return roles, err
+}
+
+// GetOrganizations reads the IDs of the organizations of a user from the database, sorted.
+func (r repository) GetOrganizations(ctx context.Context, userID string) ([]string, error) {
+	var organizations []string
+	err := r.db.With(ctx).Select("organization_id").
+		From("organization_user").
+		Where(dbx.HashExp{"user_id": userID}).
+		OrderBy("organization_id").
+		Column(&organizations)
+	return organizations, err
+}
+
+// UpdatePassword updates the password hash of a user record in the database. The version of the record is
+// unchanged since the password is the same.
+func (r repository) UpdatePassword(ctx context.Context, userID, hash string) error {
+	return r.unscoped(ctx, func(ctx context.Context) error {
+		_, err := r.db.With(ctx).Update("users", dbx.Params{"password": hash}, dbx.HashExp{"id": userID}).Execute()
+		return err
+	})
+}
+
+// CreateOIDCLogin deletes the expired OIDC login records and saves a new one in the database.
+func (r repository) CreateOIDCLogin(ctx context.Context, login entity.OIDCLogin) error {
+	if _, err := r.db.With(ctx).Delete("oidc_logins", dbx.NewExp("expires_at < {:now}", dbx.Params{"now": time.Now()})).Execute(); err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&login).Insert()
+}
+
+// TakeOIDCLogin deletes the OIDC login record with the specified state hash from the database and returns it.
+func (r repository) TakeOIDCLogin(ctx context.Context, stateHash string) (entity.OIDCLogin, error) {
+	var login entity.OIDCLogin
+	err := r.db.With(ctx).NewQuery("DELETE FROM oidc_logins WHERE state_hash = {:hash} RETURNING *").
+		Bind(dbx.Params{"hash": stateHash}).
+		One(&login)
+	return login, err
+}
+
+// GetExternalIdentity reads the external identity with the given provider and subject from the database.
+func (r repository) GetExternalIdentity(ctx context.Context, provider, subject string) (entity.ExternalIdentity, error) {
+	var identity entity.ExternalIdentity
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"provider": provider, "subject": subject}).One(&identity)
+	return identity, err
+}
+
+// CreateExternalIdentity saves a new external identity record in the database.
+func (r repository) CreateExternalIdentity(ctx context.Context, identity entity.ExternalIdentity) error {
+	return r.db.With(ctx).Model(&identity).Insert()
+}
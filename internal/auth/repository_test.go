@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "users", "oidc_logins")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+	// the users are subject to the row level security policies of the database
+	err := db.Transactional(dbcontext.Unscoped(ctx), func(ctx context.Context) error {
+		return db.With(ctx).Model(&entity.User{
+			ID:        "100",
+			Username:  "tester",
+			Password:  "secret",
+			Email:     "tester@test.test",
+			IsActive:  true,
+			CreatedAt: now,
+			UpdatedAt: &now,
+			Version:   1,
+		}).Insert()
+	})
+	assert.Nil(t, err)
+
+	// users
+	user, err := repo.GetUserByUsername(ctx, "tester")
+	assert.Nil(t, err)
+	assert.Equal(t, "100", user.ID)
+	user, err = repo.GetUserByEmail(ctx, "TESTER@test.test")
+	assert.Nil(t, err)
+	assert.Equal(t, "100", user.ID)
+	_, err = repo.GetUser(ctx, "101")
+	assert.Equal(t, sql.ErrNoRows, err)
+	roles, err := repo.GetRoles(ctx, "100", "")
+	assert.Nil(t, err)
+	assert.Empty(t, roles)
+	organizations, err := repo.GetOrganizations(ctx, "100")
+	assert.Nil(t, err)
+	assert.Empty(t, organizations)
+	assert.Nil(t, repo.UpdatePassword(ctx, "100", "rehashed"))
+	user, _ = repo.GetUser(ctx, "100")
+	assert.Equal(t, "rehashed", user.Password)
+	assert.Equal(t, 1, user.Version)
+
+	// OIDC logins
+	err = repo.CreateOIDCLogin(ctx, entity.OIDCLogin{
+		ID:           "login1",
+		Provider:     "corp",
+		StateHash:    hashState("state"),
+		CodeVerifier: "verifier",
+		Nonce:        "nonce",
+		ExpiresAt:    now.Add(time.Minute),
+		CreatedAt:    now,
+	})
+	assert.Nil(t, err)
+	login, err := repo.TakeOIDCLogin(ctx, hashState("state"))
+	assert.Nil(t, err)
+	assert.Equal(t, "verifier", login.CodeVerifier)
+	_, err = repo.TakeOIDCLogin(ctx, hashState("state"))
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// external identities
+	err = repo.CreateExternalIdentity(ctx, entity.ExternalIdentity{ID: "id1", Provider: "corp", Subject: "u1", UserID: "100", CreatedAt: now})
+	assert.Nil(t, err)
+	identity, err := repo.GetExternalIdentity(ctx, "corp", "u1")
+	assert.Nil(t, err)
+	assert.Equal(t, "100", identity.UserID)
+	_, err = repo.GetExternalIdentity(ctx, "other", "u1")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
@@ -3,21 +3,49 @@ package auth
 import (
 	"backend/internal/entity"
 	"backend/internal/errors"
-	"backend/pkg/dbcontext"
 	"backend/pkg/log"
+	"backend/pkg/password"
+	"backend/pkg/realip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
-	dbx "github.com/go-ozzo/ozzo-dbx"
-	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
+// mfaTokenExpiration is how long the one-time code of a user can be given after their password.
+const mfaTokenExpiration = 5 * time.Minute
+
 // Service encapsulates the authentication logic.
 type Service interface {
 	// Login authenticate authenticates a user using username and password.
-	// It returns a JWT token if authentication succeeds. Otherwise, an error is returned.
-	Login(ctx context.Context, username, password string) (string, error)
+	// It returns a JWT token if authentication succeeds, or an MFA token if the user must also give
+	// a one-time code. Otherwise, an error is returned.
+	Login(ctx context.Context, username, password string) (LoginResult, error)
+	// VerifyMFA exchanges an MFA token returned by Login and a one-time code of the user for a JWT token.
+	VerifyMFA(ctx context.Context, mfaToken, code string) (string, error)
+	// OIDCLogin starts a login with the external identity provider of the given name. It returns the URL
+	// of the provider the user must be redirected to.
+	OIDCLogin(ctx context.Context, provider string) (string, error)
+	// OIDCCallback completes a login with an external identity provider, which redirected the user back
+	// with the given code and state. It returns the same result as Login.
+	OIDCCallback(ctx context.Context, provider, code, state string) (LoginResult, error)
+	// Impersonate generates a short-lived JWT token of the user with the specified ID on behalf of the current user.
+	Impersonate(ctx context.Context, userID string) (string, error)
+}
+
+// LoginResult represents the result of a successful login.
+type LoginResult struct {
+	// the JWT token. It is empty if a one-time code is required
+	Token string `json:"access_token,omitempty"`
+	// whether the user must give a one-time code, along with MFAToken, to get the JWT token
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+	// whether the user has roles that require two-factor authentication. These roles are not granted
+	// by the JWT token until the user enables it
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
 }
 
 // Identity represents an authenticated user identity.
@@ -34,68 +62,331 @@ type Identity interface {
 	HasRole(...string) bool
 	// IsUserActive returns the user status
 	IsUserActive() bool
+	// GetOrganizationID returns the ID of the organization the user acts in, i.e. the tenant, if any.
+	GetOrganizationID() string
+}
+
+// EmailVerifier sends the links verifying the email addresses of the users.
+type EmailVerifier interface {
+	// RequestVerification emails a verification link for the given address of the user with the specified ID.
+	RequestVerification(ctx context.Context, userID, email string) error
+}
+
+// MFA checks the one-time codes of the users who enabled two-factor authentication.
+type MFA interface {
+	// Enabled reports whether the user with the specified ID has enabled two-factor authentication.
+	Enabled(ctx context.Context, userID string) (bool, error)
+	// Verify checks a one-time code of the user with the specified ID.
+	Verify(ctx context.Context, userID, code string) error
+}
+
+// Sessions records the sessions started by the logins, and checks that they have not been revoked.
+type Sessions interface {
+	// Create records a new session of the user with the specified ID, started from the given user agent
+	// and IP address, and returns the session ID.
+	Create(ctx context.Context, userID, userAgent, ip string, expiresAt time.Time) (string, error)
+	// Check returns an unauthorized error unless the session with the specified ID belongs to the user
+	// and is active. It records that the session was seen.
+	Check(ctx context.Context, id, userID string) error
 }
 
 type service struct {
-	db              *dbcontext.DB
+	repo            Repository
+	passwords       *password.Hasher
 	signingKey      string
 	tokenExpiration int
-	logger          log.Logger
+	// how long the impersonation tokens are valid
+	impersonationExpiration time.Duration
+	verifier                EmailVerifier
+	mfa                     MFA
+	mfaRoles                []string
+	providers               map[string]OIDCProvider
+	sessions                Sessions
+	logger                  log.Logger
 }
 
-// NewService creates a new authentication service.
-func NewService(db *dbcontext.DB, signingKey string, tokenExpiration int, logger log.Logger) Service {
-	return service{db, signingKey, tokenExpiration, logger}
+// NewService creates a new authentication service. The passwords are checked by the hasher, and their hashes
+// are upgraded when they are outdated.
+// If a verifier is given, the users cannot log in until their email address is verified, and a new verification
+// link is sent to them when they try to. Otherwise, the email addresses are not checked.
+// If mfa is given, the users who enabled two-factor authentication must give a one-time code after their password,
+// and the roles in mfaRoles are only granted to them.
+// The users can also log in with the external identity providers, by name.
+// If sessions is given, each JWT token belongs to a new session recorded by it.
+// The tokens impersonating users expire after impersonationExpiration.
+func NewService(repo Repository, passwords *password.Hasher, signingKey string, tokenExpiration int, impersonationExpiration time.Duration, verifier EmailVerifier, mfa MFA, mfaRoles []string, providers map[string]OIDCProvider, sessions Sessions, logger log.Logger) Service {
+	return service{repo, passwords, signingKey, tokenExpiration, impersonationExpiration, verifier, mfa, mfaRoles, providers, sessions, logger}
 }
 
-// Login authenticates a user and generates a JWT token if authentication succeeds.
-// Otherwise, an error is returned.
-func (s service) Login(ctx context.Context, username, password string) (string, error) {
-	if identity := s.authenticate(ctx, username, password); identity != nil {
-		return s.generateJWT(identity)
+// Login authenticates a user and generates a JWT token if authentication succeeds, or an MFA token
+// if the user enabled two-factor authentication. Otherwise, an error is returned.
+func (s service) Login(ctx context.Context, username, password string) (LoginResult, error) {
+	identity, err := s.authenticate(ctx, username, password)
+	if err != nil {
+		return LoginResult{}, err
 	}
-	return "", errors.Unauthorized("")
+	return s.issue(ctx, identity)
+}
+
+// issue generates the JWT token of an authenticated user, or an MFA token if the user enabled two-factor
+// authentication.
+func (s service) issue(ctx context.Context, identity Identity) (LoginResult, error) {
+	var err error
+	var result LoginResult
+	if s.mfa != nil {
+		enabled, err := s.mfa.Enabled(ctx, identity.GetID())
+		if err != nil {
+			return LoginResult{}, err
+		}
+		if enabled {
+			result.MFARequired = true
+			result.MFAToken, err = s.generateMFAToken(identity.GetID(), identity.GetOrganizationID())
+			return result, err
+		}
+		if identity.HasRole(s.mfaRoles...) {
+			result.MFAEnrollmentRequired = true
+			identity = withoutRoles(identity, s.mfaRoles)
+		}
+	}
+	result.Token, err = s.startSession(ctx, identity)
+	return result, err
+}
+
+// VerifyMFA checks the one-time code of the user the MFA token was issued to, and generates a JWT token
+// if it is valid. Otherwise, an unauthorized error is returned.
+func (s service) VerifyMFA(ctx context.Context, mfaToken, code string) (string, error) {
+	if s.mfa == nil {
+		return "", errors.Unauthorized("")
+	}
+	userID, organizationID, err := s.parseMFAToken(mfaToken)
+	if err != nil {
+		s.logger.With(ctx).Infof("invalid MFA token: %v", err)
+		return "", errors.Unauthorized("The MFA token is invalid or has expired.")
+	}
+	ctx = withOrganization(ctx, organizationID)
+	if err := s.mfa.Verify(ctx, userID, code); err != nil {
+		return "", err
+	}
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return "", errors.Unauthorized("")
+	}
+	identity, err := s.identity(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	s.logger.With(ctx, "user", user.Username).Infof("two-factor authentication successful")
+	return s.startSession(ctx, identity)
 }
 
 // authenticate authenticates a user using username and password.
-// If username and password are correct, an identity is returned. Otherwise, nil is returned.
-func (s service) authenticate(ctx context.Context, username, password string) Identity {
+// If username and password are correct, an identity is returned. Otherwise, an unauthorized error is returned,
+// or a forbidden error if the email address of the user must be verified first.
+func (s service) authenticate(ctx context.Context, username, password string) (Identity, error) {
 	logger := s.logger.With(ctx, "user", username)
 
-	user := entity.User{}
-
-	if err := s.db.With(ctx).Select().From("users as u").Where(dbx.HashExp{"u.username": username, "u.is_active": true}).One(&user); err != nil {
-		fmt.Println(err)
-		return nil
+	user, err := s.repo.GetUserByUsername(ctx, username)
+	if err != nil {
+		// a password is checked anyway so that the unknown usernames cannot be told by the response time
+		s.passwords.Fake(password)
+		logger.Infof("authentication failed: %v", err)
+		return nil, errors.Unauthorized("")
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		fmt.Println(err)
+	ok, rehash, err := s.passwords.Verify(user.Password, password)
+	if err != nil {
+		logger.Errorf("authentication failed: %v", err)
+		return nil, errors.Unauthorized("")
+	}
+	if !ok {
 		logger.Infof("authentication failed")
-		return nil
+		return nil, errors.Unauthorized("")
+	}
+	if rehash {
+		s.rehash(ctx, user.ID, password)
 	}
 
-	/* if err := s.db.With(ctx).Select("r.name as name").
-		From("roles as r").
-		LeftJoin("role_user as ru", dbx.NewExp("r.id = ru.role_id")).
-		Where(dbx.HashExp{"ru.user_id": user.ID}).
-		Column(&user.Roles); err != nil {
-		fmt.Println(err)
-		return nil
-	} */
+	if err := s.checkVerified(ctx, user); err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identity(ctx, user)
+	if err != nil {
+		return nil, err
+	}
 
 	logger.Infof("authentication successful")
-	return entity.User{ID: user.GetID(), Username: user.GetUsername(), Email: user.GetEmail(), Roles: user.GetRoles(), IsActive: user.IsActive}
+	return identity, nil
+}
+
+// checkVerified returns a forbidden error, and sends a new verification link, if the users must verify their
+// email address before they can log in and the user has not.
+func (s service) checkVerified(ctx context.Context, user entity.User) error {
+	if s.verifier == nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+	s.logger.With(ctx, "user", user.Username).Infof("authentication failed: the email address is not verified")
+	if err := s.verifier.RequestVerification(ctx, user.ID, user.Email); err != nil {
+		return err
+	}
+	return errors.Forbidden("The email address has not been verified. A verification link has been sent to it.")
 }
 
-// generateJWT generates a JWT that encodes an identity.
-func (s service) generateJWT(identity Identity) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// rehash replaces the outdated password hash of the user with a hash of the current policy.
+// The login goes on if it fails since the outdated hash is still valid.
+func (s service) rehash(ctx context.Context, userID, password string) {
+	logger := s.logger.With(ctx, "user", userID)
+	hash, err := s.passwords.Hash(password)
+	if err == nil {
+		err = s.repo.UpdatePassword(ctx, userID, hash)
+	}
+	if err != nil {
+		logger.Errorf("failed to upgrade the password hash: %v", err)
+		return
+	}
+	logger.Infof("the password hash has been upgraded")
+}
+
+// identity returns the identity of the given user in the organization they log in to, with their roles in it.
+func (s service) identity(ctx context.Context, user entity.User) (Identity, error) {
+	organizationID, err := s.organization(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.repo.GetRoles(ctx, user.ID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	user.Roles = roles
+	return entity.User{ID: user.GetID(), Username: user.GetUsername(), Email: user.GetEmail(), Roles: user.GetRoles(), IsActive: user.IsActive, OrganizationID: organizationID}, nil
+}
+
+// organization returns the ID of the organization the user with the given ID logs in to: the organization
+// requested, which they must be a member of, or else the only organization they are a member of.
+// It is empty if they are a member of none.
+func (s service) organization(ctx context.Context, userID string) (string, error) {
+	organizations, err := s.repo.GetOrganizations(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if requested := requestedOrganization(ctx); requested != "" {
+		if !isMember(organizations, requested) {
+			return "", errors.Forbidden("You are not a member of the organization.")
+		}
+		return requested, nil
+	}
+	switch len(organizations) {
+	case 0:
+		return "", nil
+	case 1:
+		return organizations[0], nil
+	}
+	return "", errors.BadRequest("You are a member of several organizations. Please specify the organization to log in to.")
+}
+
+// isMember reports whether the organization with the given ID is among the organizations of a user.
+func isMember(organizations []string, organizationID string) bool {
+	for _, id := range organizations {
+		if id == organizationID {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutRoles returns the identity without the given roles.
+func withoutRoles(identity Identity, roles []string) Identity {
+	var kept []string
+	for _, role := range identity.GetRoles() {
+		if !(entity.User{Roles: roles}).HasRole(role) {
+			kept = append(kept, role)
+		}
+	}
+	return entity.User{ID: identity.GetID(), Username: identity.GetUsername(), Email: identity.GetEmail(), Roles: kept, IsActive: identity.IsUserActive(), OrganizationID: identity.GetOrganizationID()}
+}
+
+// startSession records a new session of the user if sessions are enabled, and generates the JWT of the session.
+func (s service) startSession(ctx context.Context, identity Identity) (string, error) {
+	expiresAt := time.Now().Add(time.Duration(s.tokenExpiration) * time.Hour)
+	if _, ok := identity.(Impersonation); ok {
+		expiresAt = time.Now().Add(s.impersonationExpiration)
+	}
+	sessionID := ""
+	if s.sessions != nil {
+		var err error
+		if sessionID, err = s.sessions.Create(ctx, identity.GetID(), userAgent(ctx), realip.FromContext(ctx), expiresAt); err != nil {
+			return "", err
+		}
+	}
+	return s.generateJWT(identity, sessionID, expiresAt)
+}
+
+// generateJWT generates a JWT that encodes an identity and the ID of its session, if any.
+// The organization of the identity is encoded in the "tid" claim, and the actor of an impersonation
+// in the "act" claim.
+func (s service) generateJWT(identity Identity, sessionID string, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
 		"id":       identity.GetID(),
 		"username": identity.GetUsername(),
-		"email":	identity.GetEmail(),
+		"email":    identity.GetEmail(),
 		"roles":    identity.GetRoles(),
 		"status":   identity.IsUserActive(),
-		"exp":      time.Now().Add(time.Duration(s.tokenExpiration) * time.Hour).Unix(),
-	}).SignedString([]byte(s.signingKey))
+		"exp":      expiresAt.Unix(),
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+	if organizationID := identity.GetOrganizationID(); organizationID != "" {
+		claims["tid"] = organizationID
+	}
+	if impersonation, ok := identity.(Impersonation); ok {
+		claims["act"] = map[string]interface{}{
+			"sub":      impersonation.Actor.GetID(),
+			"username": impersonation.Actor.GetUsername(),
+		}
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.signingKey))
+}
+
+// mfaClaims represents the claims of an MFA token.
+type mfaClaims struct {
+	jwt.StandardClaims
+	// the ID of the organization the user logs in to, if any
+	OrganizationID string `json:"tid,omitempty"`
+}
+
+// generateMFAToken generates a short-lived token proving that the user with the given ID gave their password
+// to log in to the given organization.
+// It is signed with a key derived from the signing key of the JWT tokens, so that it cannot be used as one.
+func (s service) generateMFAToken(userID, organizationID string) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, mfaClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   userID,
+			ExpiresAt: time.Now().Add(mfaTokenExpiration).Unix(),
+		},
+		OrganizationID: organizationID,
+	}).SignedString(s.mfaSigningKey())
+}
+
+// parseMFAToken returns the IDs of the user an MFA token was issued to and of the organization they log in to,
+// or an error if the token is invalid or has expired.
+func (s service) parseMFAToken(mfaToken string) (string, string, error) {
+	claims := &mfaClaims{}
+	_, err := jwt.ParseWithClaims(mfaToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return s.mfaSigningKey(), nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return claims.Subject, claims.OrganizationID, nil
+}
+
+// mfaSigningKey returns the key signing the MFA tokens.
+func (s service) mfaSigningKey() []byte {
+	mac := hmac.New(sha256.New, []byte(s.signingKey))
+	mac.Write([]byte("mfa"))
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
 }
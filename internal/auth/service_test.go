@@ -1,39 +1,465 @@
 package auth
 
 import (
-	"context"
 	"backend/internal/entity"
 	"backend/internal/errors"
 	"backend/pkg/log"
+	"backend/pkg/oidc"
+	"backend/pkg/oidc/oidctest"
+	"backend/pkg/password"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
-func Test_service_Authenticate(t *testing.T) {
+func Test_service_GenerateJWT(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService("test", 100, logger)
-	_, err := s.Login(context.Background(), "unknown", "bad")
+	s := service{signingKey: "test", tokenExpiration: 100, logger: logger}
+	token, err := s.generateJWT(entity.User{
+		ID:       "100",
+		Username: "demo",
+	}, "session-100", time.Now().Add(time.Hour))
+	if assert.Nil(t, err) {
+		assert.NotEmpty(t, token)
+	}
+}
+
+func Test_service_MFAToken(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := service{signingKey: "test", tokenExpiration: 100, logger: logger}
+	token, err := s.generateMFAToken("100", "org1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	userID, organizationID, err := s.parseMFAToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "100", userID)
+	assert.Equal(t, "org1", organizationID)
+
+	// the MFA tokens are not access tokens
+	_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte("test"), nil })
+	assert.NotNil(t, err)
+	// and the access tokens are not MFA tokens
+	jwtToken, _ := s.generateJWT(entity.User{ID: "100"}, "", time.Now().Add(time.Hour))
+	_, _, err = s.parseMFAToken(jwtToken)
+	assert.NotNil(t, err)
+	_, _, err = (service{signingKey: "other"}).parseMFAToken(token)
+	assert.NotNil(t, err)
+}
+
+func Test_service_VerifyMFA(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := service{signingKey: "test", tokenExpiration: 100, mfa: mockMFA{}, repo: &mockRepository{}, logger: logger}
+	_, err := s.VerifyMFA(context.Background(), "invalid", "123456")
+	assert.Equal(t, errors.Unauthorized("The MFA token is invalid or has expired."), err)
+
+	token, _ := s.generateMFAToken("100", "")
+	_, err = s.VerifyMFA(context.Background(), token, "000000")
+	assert.Equal(t, errors.Unauthorized(""), err)
+}
+
+func Test_withoutRoles(t *testing.T) {
+	identity := withoutRoles(entity.User{ID: "100", Roles: []string{"admin", "user", "financial"}, IsActive: true}, []string{"admin", "financial"})
+	assert.Equal(t, "100", identity.GetID())
+	assert.Equal(t, []string{"user"}, identity.GetRoles())
+	assert.True(t, identity.IsUserActive())
+}
+
+type mockMFA struct {
+	// the ID of the user who enabled two-factor authentication
+	enabled string
+}
+
+func (m mockMFA) Enabled(ctx context.Context, userID string) (bool, error) {
+	return userID == m.enabled, nil
+}
+
+func (m mockMFA) Verify(ctx context.Context, userID, code string) error {
+	if code != "123456" {
+		return errors.Unauthorized("")
+	}
+	return nil
+}
+
+func Test_service_Login(t *testing.T) {
+	logger, _ := log.NewForTest()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	now := time.Now()
+	repo := &mockRepository{
+		users: []entity.User{
+			{ID: "100", Username: "demo", Password: string(hash), Email: "demo@test.test", EmailVerifiedAt: &now, IsActive: true},
+			{ID: "101", Username: "admin", Password: string(hash), Email: "admin@test.test", EmailVerifiedAt: &now, IsActive: true},
+			{ID: "102", Username: "mfa", Password: string(hash), Email: "mfa@test.test", EmailVerifiedAt: &now, IsActive: true},
+		},
+		roles: map[string][]string{"101": {"admin", "user"}},
+	}
+	sessions := &mockSessions{}
+	s := NewService(repo, newTestHasher(t), "test", 100, 15*time.Minute, nil, mockMFA{enabled: "102"}, []string{"admin"}, nil, sessions, logger)
+
+	_, err := s.Login(context.Background(), "unknown", "pass")
+	assert.Equal(t, errors.Unauthorized(""), err)
+	_, err = s.Login(context.Background(), "demo", "bad")
 	assert.Equal(t, errors.Unauthorized(""), err)
-	token, err := s.Login(context.Background(), "demo", "pass")
+
+	result, err := s.Login(context.Background(), "demo", "pass")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, result.Token)
+	assert.False(t, result.MFARequired)
+	assert.Equal(t, "session-1", claimsOf(t, result.Token)["sid"])
+
+	// the outdated bcrypt hash is upgraded, and the password still works
+	assert.True(t, strings.HasPrefix(repo.users[0].Password, "$argon2id$"))
+	_, err = s.Login(context.Background(), "demo", "pass")
+	assert.Nil(t, err)
+
+	// the roles requiring two-factor authentication are not granted without it
+	result, err = s.Login(context.Background(), "admin", "pass")
+	assert.Nil(t, err)
+	assert.True(t, result.MFAEnrollmentRequired)
+	assert.Equal(t, []interface{}{"user"}, claimsOf(t, result.Token)["roles"])
+
+	result, err = s.Login(context.Background(), "mfa", "pass")
+	assert.Nil(t, err)
+	assert.True(t, result.MFARequired)
+	assert.Empty(t, result.Token)
+	token, err := s.VerifyMFA(context.Background(), result.MFAToken, "123456")
 	assert.Nil(t, err)
-	assert.NotEmpty(t, token)
+	assert.Equal(t, "102", claimsOf(t, token)["id"])
 }
 
-func Test_service_authenticate(t *testing.T) {
+func Test_service_Login_Organizations(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := service{"test", 100, logger}
-	assert.Nil(t, s.authenticate(context.Background(), "unknown", "bad"))
-	assert.NotNil(t, s.authenticate(context.Background(), "demo", "pass"))
+	now := time.Now()
+	repo := &mockRepository{
+		users: []entity.User{
+			{ID: "100", Username: "solo", Password: mustHash(t, "pass"), EmailVerifiedAt: &now, IsActive: true},
+			{ID: "101", Username: "multi", Password: mustHash(t, "pass"), EmailVerifiedAt: &now, IsActive: true},
+			{ID: "102", Username: "mfa", Password: mustHash(t, "pass"), EmailVerifiedAt: &now, IsActive: true},
+		},
+		roles: map[string][]string{
+			"100":      {"user"},
+			"100@org1": {entity.RoleAdministrator},
+			"102@org2": {entity.RoleFinancial},
+		},
+		organizations: map[string][]string{"100": {"org1"}, "101": {"org1", "org2"}, "102": {"org2"}},
+	}
+	s := NewService(repo, newTestHasher(t), "test", 100, 15*time.Minute, nil, mockMFA{enabled: "102"}, nil, nil, nil, logger)
+	ctx := context.Background()
+
+	// the members of a single organization log in to it, with their roles within it
+	result, err := s.Login(ctx, "solo", "pass")
+	if assert.Nil(t, err) {
+		claims := claimsOf(t, result.Token)
+		assert.Equal(t, "org1", claims["tid"])
+		assert.Equal(t, []interface{}{"user", entity.RoleAdministrator}, claims["roles"])
+	}
+	_, err = s.Login(withOrganization(ctx, "org2"), "solo", "pass")
+	assert.Equal(t, errors.Forbidden("You are not a member of the organization."), err)
+
+	// the members of several organizations must specify one
+	_, err = s.Login(ctx, "multi", "pass")
+	assert.Equal(t, errors.BadRequest("You are a member of several organizations. Please specify the organization to log in to."), err)
+	result, err = s.Login(withOrganization(ctx, "org2"), "multi", "pass")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "org2", claimsOf(t, result.Token)["tid"])
+	}
+
+	// the organization is kept until the one-time code is given
+	result, err = s.Login(ctx, "mfa", "pass")
+	assert.Nil(t, err)
+	token, err := s.VerifyMFA(ctx, result.MFAToken, "123456")
+	if assert.Nil(t, err) {
+		claims := claimsOf(t, token)
+		assert.Equal(t, "org2", claims["tid"])
+		assert.Equal(t, []interface{}{entity.RoleFinancial}, claims["roles"])
+	}
 }
 
-func Test_service_GenerateJWT(t *testing.T) {
+func Test_service_Impersonate(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := service{"test", 100, logger}
-	token, err := s.generateJWT(entity.User{
-		ID:   "100",
-		Name: "demo",
-	})
+	repo := &mockRepository{
+		users: []entity.User{
+			{ID: "100", Username: "support", IsActive: true},
+			{ID: "101", Username: "driver", IsActive: true},
+			{ID: "102", Username: "admin", IsActive: true},
+		},
+		roles: map[string][]string{"102": {entity.RoleAdministrator}},
+	}
+	sessions := &mockSessions{}
+	s := NewService(repo, newTestHasher(t), "test", 100, 15*time.Minute, nil, nil, nil, nil, sessions, logger)
+	ctx := WithUser(context.Background(), "100", "support", "support@test.test", []string{entity.RoleDriverSupport}, true)
+
+	token, err := s.Impersonate(ctx, "101")
 	if assert.Nil(t, err) {
-		assert.NotEmpty(t, token)
+		claims := claimsOf(t, token)
+		assert.Equal(t, "101", claims["id"])
+		assert.Equal(t, "100", claims["act"].(map[string]interface{})["sub"])
+		assert.Equal(t, "session-1", claims["sid"])
+		assert.InDelta(t, time.Now().Add(15*time.Minute).Unix(), claims["exp"], 5)
+	}
+
+	// the users with more privileges, the actor themselves and unknown users cannot be impersonated
+	_, err = s.Impersonate(ctx, "102")
+	assert.Equal(t, errors.Forbidden(`You cannot impersonate a user with the role "administrator".`), err)
+	_, err = s.Impersonate(ctx, "100")
+	assert.NotNil(t, err)
+	_, err = s.Impersonate(ctx, "103")
+	assert.Equal(t, errors.NotFound(""), err)
+
+	// impersonations cannot be chained
+	ctx = WithIdentity(ctx, Impersonation{entity.User{ID: "101"}, CurrentUser(ctx)})
+	_, err = s.Impersonate(ctx, "101")
+	assert.NotNil(t, err)
+
+	// the staff of an organization only impersonate its members, within it
+	repo.organizations = map[string][]string{"100": {"org1"}, "101": {"org1", "org2"}, "102": {"org2"}}
+	ctx = WithTenant(WithUser(context.Background(), "100", "support", "support@test.test", []string{entity.RoleAdministrator}, true), "org1")
+	token, err = s.Impersonate(ctx, "101")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "org1", claimsOf(t, token)["tid"])
+	}
+	_, err = s.Impersonate(ctx, "102")
+	assert.Equal(t, errors.NotFound(""), err)
+}
+
+func Test_service_OIDC(t *testing.T) {
+	logger, _ := log.NewForTest()
+	issuer, server, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	now := time.Now()
+	repo := &mockRepository{
+		users: []entity.User{
+			{ID: "100", Username: "ann", Email: "ann@corp.test", EmailVerifiedAt: &now, IsActive: true},
+			{ID: "101", Username: "bob", Email: "bob@corp.test", IsActive: true},
+		},
+		roles: map[string][]string{"100": {"user"}},
+	}
+	providers := map[string]OIDCProvider{"corp": {
+		Provider: oidc.NewProvider(oidc.Config{
+			Issuer:       issuer.URL,
+			ClientID:     "client",
+			ClientSecret: "secret",
+			RedirectURL:  "http://api.test/v1/login/oidc/corp/callback",
+		}, http.DefaultClient),
+		RolesClaim:  "groups",
+		RoleMapping: map[string][]string{"finance": {"financial"}},
+	}}
+	s := NewService(repo, newTestHasher(t), "test", 100, 15*time.Minute, nil, nil, nil, providers, nil, logger)
+	ctx := context.Background()
+
+	login := func() (string, string) {
+		authURL, err := s.OIDCLogin(ctx, "corp")
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+		redirect, err := issuer.Authorize(authURL)
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+		return redirect.Query().Get("code"), redirect.Query().Get("state")
+	}
+
+	_, err = s.OIDCLogin(ctx, "unknown")
+	assert.Equal(t, errors.NotFound("The identity provider does not exist."), err)
+
+	// an identity without a verified email address cannot be linked
+	issuer.SetClaims(map[string]interface{}{"sub": "u1", "email": "ann@corp.test"})
+	code, state := login()
+	_, err = s.OIDCCallback(ctx, "corp", code, state)
+	assert.Equal(t, errors.Forbidden("No account is linked to this identity."), err)
+
+	issuer.SetClaims(map[string]interface{}{"sub": "u1", "email": "ANN@corp.test", "email_verified": true, "groups": []string{"finance"}})
+	code, state = login()
+	result, err := s.OIDCCallback(ctx, "corp", code, state)
+	if assert.Nil(t, err) {
+		claims := claimsOf(t, result.Token)
+		assert.Equal(t, "100", claims["id"])
+		assert.Equal(t, []interface{}{"user", "financial"}, claims["roles"])
+	}
+	assert.Equal(t, 1, len(repo.identities))
+
+	// the state can be used once
+	_, err = s.OIDCCallback(ctx, "corp", code, state)
+	assert.Equal(t, errors.Unauthorized("The login is invalid or has expired."), err)
+
+	// the linked identity logs in even if its email address changed
+	issuer.SetClaims(map[string]interface{}{"sub": "u1", "email": "other@corp.test"})
+	code, state = login()
+	result, err = s.OIDCCallback(ctx, "corp", code, state)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []interface{}{"user"}, claimsOf(t, result.Token)["roles"])
+	}
+	_, err = s.OIDCCallback(ctx, "corp", "bad code", state)
+	assert.NotNil(t, err)
+
+	// an identity is not linked to a user who has not verified the email address
+	issuer.SetClaims(map[string]interface{}{"sub": "u2", "email": "bob@corp.test", "email_verified": true})
+	code, state = login()
+	_, err = s.OIDCCallback(ctx, "corp", code, state)
+	assert.Equal(t, errors.Forbidden("No account is linked to this identity."), err)
+	assert.Equal(t, 1, len(repo.identities))
+
+	// the users must verify their email address before they log in with a linked identity, as with a password
+	repo.identities = append(repo.identities, entity.ExternalIdentity{ID: "i2", Provider: "corp", Subject: "u2", UserID: "101"})
+	verifier := &mockVerifier{}
+	s = NewService(repo, newTestHasher(t), "test", 100, 15*time.Minute, verifier, nil, nil, providers, nil, logger)
+	code, state = login()
+	_, err = s.OIDCCallback(ctx, "corp", code, state)
+	assert.Equal(t, errors.Forbidden("The email address has not been verified. A verification link has been sent to it."), err)
+	assert.Equal(t, []string{"bob@corp.test"}, verifier.requested)
+	issuer.SetClaims(map[string]interface{}{"sub": "u1", "email": "ann@corp.test"})
+	code, state = login()
+	_, err = s.OIDCCallback(ctx, "corp", code, state)
+	assert.Nil(t, err)
+}
+
+// mustHash returns the bcrypt hash of the password with the lowest cost.
+func mustHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+// newTestHasher returns a password hasher with the lowest costs.
+func newTestHasher(t *testing.T) *password.Hasher {
+	hasher, err := password.New(password.Options{BcryptCost: bcrypt.MinCost, Argon2Memory: 64, Argon2Iterations: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hasher
+}
+
+// claimsOf returns the claims of a JWT signed with the test key.
+func claimsOf(t *testing.T, token string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return []byte("test"), nil }); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+type mockRepository struct {
+	users []entity.User
+	// the roles by user ID, and the roles within an organization by "<user ID>@<organization ID>"
+	roles map[string][]string
+	// the IDs of the organizations by user ID
+	organizations map[string][]string
+	logins        []entity.OIDCLogin
+	identities    []entity.ExternalIdentity
+}
+
+func (m *mockRepository) GetUserByUsername(ctx context.Context, username string) (entity.User, error) {
+	for _, user := range m.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetUser(ctx context.Context, id string) (entity.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetUserByEmail(ctx context.Context, email string) (entity.User, error) {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetRoles(ctx context.Context, userID, organizationID string) ([]string, error) {
+	roles := append([]string{}, m.roles[userID]...)
+	if organizationID != "" {
+		roles = append(roles, m.roles[userID+"@"+organizationID]...)
+	}
+	return roles, nil
+}
+
+func (m *mockRepository) GetOrganizations(ctx context.Context, userID string) ([]string, error) {
+	return append([]string{}, m.organizations[userID]...), nil
+}
+
+func (m *mockRepository) UpdatePassword(ctx context.Context, userID, hash string) error {
+	for i, user := range m.users {
+		if user.ID == userID {
+			m.users[i].Password = hash
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateOIDCLogin(ctx context.Context, login entity.OIDCLogin) error {
+	m.logins = append(m.logins, login)
+	return nil
+}
+
+func (m *mockRepository) TakeOIDCLogin(ctx context.Context, stateHash string) (entity.OIDCLogin, error) {
+	for i, login := range m.logins {
+		if login.StateHash == stateHash {
+			m.logins = append(m.logins[:i], m.logins[i+1:]...)
+			return login, nil
+		}
+	}
+	return entity.OIDCLogin{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetExternalIdentity(ctx context.Context, provider, subject string) (entity.ExternalIdentity, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return entity.ExternalIdentity{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateExternalIdentity(ctx context.Context, identity entity.ExternalIdentity) error {
+	m.identities = append(m.identities, identity)
+	return nil
+}
+
+type mockVerifier struct {
+	requested []string
+}
+
+func (m *mockVerifier) RequestVerification(ctx context.Context, userID, email string) error {
+	m.requested = append(m.requested, email)
+	return nil
+}
+
+type mockSessions struct {
+	created []string
+	revoked bool
+}
+
+func (m *mockSessions) Create(ctx context.Context, userID, userAgent, ip string, expiresAt time.Time) (string, error) {
+	m.created = append(m.created, userID)
+	return fmt.Sprintf("session-%v", len(m.created)), nil
+}
+
+func (m *mockSessions) Check(ctx context.Context, id, userID string) error {
+	if m.revoked {
+		return errors.Unauthorized("")
 	}
+	return nil
 }
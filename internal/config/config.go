@@ -1,16 +1,48 @@
 package config
 
 import (
+	"backend/pkg/log"
+	"backend/pkg/realip"
+	"backend/pkg/scheduler"
 	"github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-env"
-	"backend/pkg/log"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"net/mail"
+	"net/url"
 )
 
 const (
-	defaultServerPort         = 8080
-	defaultJWTExpirationHours = 72
+	defaultServerPort          = 8080
+	defaultJWTExpirationHours  = 72
+	defaultReadHeaderTimeout   = 5
+	defaultReadTimeout         = 15
+	defaultWriteTimeout        = 30
+	defaultIdleTimeout         = 120
+	defaultMaxHeaderBytes      = 1 << 20
+	defaultMaxBodyBytes        = 1 << 20
+	defaultRequestTimeout      = 20
+	defaultShutdownTimeout     = 10
+	defaultDrainPeriod         = 5
+	defaultIdempotencyKeyTTL   = 24
+	defaultSoftDeleteRetention = 30
+	defaultEventPollInterval   = 5
+	defaultEventBatchSize      = 100
+	defaultEventMaxAttempts    = 10
+	defaultEventRetryBackoff   = 30
+	defaultWebhookMaxAttempts  = 8
+	defaultWebhookRetryBackoff = 60
+	defaultWebhookTimeout      = 10
+	defaultJobConcurrency      = 4
+	defaultJobPollInterval     = 1
+	defaultJobVisibility       = 300
+	defaultJobRetryBackoff     = 10
+	defaultSMTPPort            = 587
+	defaultInvitationTTL       = 72
+	defaultVerificationTTL     = 24
+	defaultImpersonationTTL    = 15
+	defaultTLSReloadInterval   = 60
+	defaultACMECacheDir        = "certs"
 )
 
 // Config represents an application configuration.
@@ -23,6 +55,284 @@ type Config struct {
 	JWTSigningKey string `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY,secret"`
 	// JWT expiration in hours. Defaults to 72 hours (3 days)
 	JWTExpiration int `yaml:"jwt_expiration" env:"JWT_EXPIRATION"`
+	// HTTP server limits and timeouts
+	HTTP HTTP `yaml:"http" env:"HTTP"`
+	// TLS settings of the server. TLS is disabled by default
+	TLS TLS `yaml:"tls" env:"TLS"`
+	// the CORS policy. Cross-origin requests are rejected unless allowed here
+	CORS CORS `yaml:"cors" env:"CORS"`
+	// the IP addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For header is trusted
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	// rate limiting of the API. Disabled by default
+	RateLimit RateLimit `yaml:"rate_limit" env:"RATE_LIMIT"`
+	// how long (in hours) the responses of requests made with an Idempotency-Key are kept. Defaults to 24
+	IdempotencyKeyTTL int `yaml:"idempotency_key_ttl" env:"IDEMPOTENCY_KEY_TTL"`
+	// how long (in days) deleted users and albums are kept before they are purged. 0 keeps them forever. Defaults to 30
+	SoftDeleteRetention int `yaml:"soft_delete_retention" env:"SOFT_DELETE_RETENTION"`
+	// delivery of the domain events recorded in the outbox
+	Events Events `yaml:"events" env:"EVENTS"`
+	// delivery of the webhooks to the subscribed URLs
+	Webhooks Webhooks `yaml:"webhooks" env:"WEBHOOKS"`
+	// the worker pool running the background jobs
+	Jobs Jobs `yaml:"jobs" env:"JOBS"`
+	// the periodic maintenance tasks
+	Scheduler Scheduler `yaml:"scheduler" env:"SCHEDULER"`
+	// the outgoing email
+	Mail Mail `yaml:"mail" env:"MAIL"`
+	// the invitations sent to new users
+	Invitations Invitations `yaml:"invitations" env:"INVITATIONS"`
+	// the authentication of the users
+	Auth Auth `yaml:"auth" env:"AUTH"`
+}
+
+// Auth represents the authentication settings.
+type Auth struct {
+	// whether the users must verify their email address before they can log in
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+	// how long (in hours) an email verification link is valid. Defaults to 24
+	VerificationTTL int `yaml:"verification_ttl"`
+	// the URL of the endpoint confirming the email addresses, linked to in the verification emails.
+	// Defaults to "http://localhost:8080/v1/email/confirm"
+	VerificationURL string `yaml:"verification_url"`
+	// the roles only granted to the users who enabled two-factor authentication (e.g. ["administrator"])
+	MFARoles []string `yaml:"mfa_roles"`
+	// the issuer displayed by the authenticator apps. Defaults to "Backend"
+	MFAIssuer string `yaml:"mfa_issuer"`
+	// how long (in minutes) the tokens of the staff impersonating users are valid. Defaults to 15
+	ImpersonationTTL int `yaml:"impersonation_ttl"`
+	// the hashing policy of the passwords and the rules the new passwords must follow
+	Password Password `yaml:"password"`
+	// the external OpenID Connect identity providers the users can log in with, by name.
+	// A user logs in with the provider "corp" at /v1/login/oidc/corp
+	OIDC map[string]OIDCProvider `yaml:"oidc"`
+}
+
+// Password represents the hashing policy of the passwords and the rules the new passwords must follow.
+// The hashes of another algorithm or cost are upgraded when the users log in.
+type Password struct {
+	// the algorithm of the new hashes: "argon2id" or "bcrypt". Defaults to "argon2id"
+	Algorithm string `yaml:"algorithm"`
+	// the cost of the bcrypt hashes, between 4 and 31. Defaults to 10
+	BcryptCost int `yaml:"bcrypt_cost"`
+	// the memory (in KiB) of the argon2id hashes. Defaults to 19456
+	Argon2Memory int `yaml:"argon2_memory"`
+	// the number of iterations of the argon2id hashes. Defaults to 2
+	Argon2Iterations int `yaml:"argon2_iterations"`
+	// the parallelism of the argon2id hashes. Defaults to 1
+	Argon2Parallelism int `yaml:"argon2_parallelism"`
+	// the minimum and maximum number of characters of the new passwords. Default to 8 and 150
+	MinLength int `yaml:"min_length"`
+	MaxLength int `yaml:"max_length"`
+	// the character classes the new passwords must contain
+	RequireLowercase bool `yaml:"require_lowercase"`
+	RequireUppercase bool `yaml:"require_uppercase"`
+	RequireDigit     bool `yaml:"require_digit"`
+	RequireSymbol    bool `yaml:"require_symbol"`
+	// whether the new passwords containing the username or email address of the user are rejected. Defaults to true
+	RejectPersonal bool `yaml:"reject_personal"`
+	// the file of SHA-1 hashes of breached passwords, in the format of the Have I Been Pwned password files,
+	// which are rejected. No password is rejected as breached if it is empty
+	BreachedList string `yaml:"breached_list"`
+}
+
+// OIDCProvider represents an external OpenID Connect identity provider and the registration of the server as its client.
+type OIDCProvider struct {
+	// the issuer URL, from which the endpoints are discovered. required.
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// the callback URL registered at the provider, e.g. "http://localhost:8080/v1/login/oidc/corp/callback". required.
+	RedirectURL string `yaml:"redirect_url"`
+	// the requested scopes. Defaults to openid, email and profile
+	Scopes []string `yaml:"scopes"`
+	// the claim of the ID tokens listing the groups of the user (e.g. "groups"), and the roles granted to the members of each group
+	RolesClaim  string              `yaml:"roles_claim"`
+	RoleMapping map[string][]string `yaml:"role_mapping"`
+}
+
+// Invitations represents the settings of the invitations sent to new users.
+type Invitations struct {
+	// how long (in hours) an invitation can be accepted. Defaults to 72
+	TTL int `yaml:"ttl"`
+	// the page of the frontend where the invitations are accepted. The token is added as the "token" query parameter.
+	// Defaults to "http://localhost:3000/invitations"
+	URL string `yaml:"url"`
+}
+
+// Mail represents the settings of the outgoing email.
+type Mail struct {
+	// how the messages are sent: "smtp", "file" (.eml files written to Dir) or "log". Defaults to "log"
+	Driver string `yaml:"driver"`
+	// the sender address of the messages (e.g. "App <noreply@example.com>"). required by the "smtp" driver.
+	From string `yaml:"from"`
+	// the locale of the messages sent to users whose locale has no templates. Defaults to "en"
+	DefaultLocale string `yaml:"default_locale"`
+	// the directory the "file" driver writes to. Defaults to "mail"
+	Dir string `yaml:"dir"`
+	// the SMTP server of the "smtp" driver
+	SMTP SMTP `yaml:"smtp"`
+}
+
+// SMTP represents the settings of an SMTP server.
+type SMTP struct {
+	// the host name of the server. required by the "smtp" driver.
+	Host string `yaml:"host"`
+	// the port of the server. Defaults to 587
+	Port int `yaml:"port"`
+	// the credentials of the server, if it requires authentication
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Scheduler represents the settings of the periodic maintenance tasks.
+type Scheduler struct {
+	// whether the tasks are run by this server
+	Enabled bool `yaml:"enabled"`
+	// the cron expressions of the tasks by name (purge_deleted, purge_idempotency_keys, purge_rate_limit_buckets,
+	// purge_sessions and analyze). A task with an empty expression is disabled
+	Tasks map[string]string `yaml:"tasks"`
+}
+
+// Jobs represents the settings of the worker pool running the background jobs.
+type Jobs struct {
+	// the maximum number of jobs run at the same time. Defaults to 4
+	Concurrency int `yaml:"concurrency"`
+	// how often (in seconds) the queue is polled. Defaults to 1
+	PollInterval int `yaml:"poll_interval"`
+	// how long (in seconds) a job may run before it is cancelled and claimed again by another worker. Defaults to 300
+	VisibilityTimeout int `yaml:"visibility_timeout"`
+	// the delay (in seconds) before the first retry of a job, doubled after each failed attempt. Defaults to 10
+	RetryBackoff int `yaml:"retry_backoff"`
+}
+
+// Events represents the delivery settings of the domain events.
+type Events struct {
+	// how often (in seconds) the outbox is polled. Defaults to 5
+	PollInterval int `yaml:"poll_interval"`
+	// the maximum number of events delivered per poll. Defaults to 100
+	BatchSize int `yaml:"batch_size"`
+	// the number of failed deliveries after which an event is dead-lettered. Defaults to 10
+	MaxAttempts int `yaml:"max_attempts"`
+	// the delay (in seconds) before the first retry of an event, doubled after each failed attempt. Defaults to 30
+	RetryBackoff int `yaml:"retry_backoff"`
+	// whether the events are written to the log
+	Log bool `yaml:"log"`
+	// the URLs the events are posted to
+	WebhookURLs []string `yaml:"webhook_urls"`
+}
+
+// Webhooks represents the delivery settings of the webhook subscriptions.
+type Webhooks struct {
+	// how often (in seconds) the pending deliveries are polled. Defaults to 5
+	PollInterval int `yaml:"poll_interval"`
+	// the maximum number of requests sent per poll. Defaults to 100
+	BatchSize int `yaml:"batch_size"`
+	// the number of failed attempts after which a delivery is given up. Defaults to 8
+	MaxAttempts int `yaml:"max_attempts"`
+	// the delay (in seconds) before the first retry of a delivery, doubled after each failed attempt. Defaults to 60
+	RetryBackoff int `yaml:"retry_backoff"`
+	// the time (in seconds) allowed for a receiver to respond. Defaults to 10
+	Timeout int `yaml:"timeout"`
+}
+
+// RateLimit represents the rate limiting settings.
+type RateLimit struct {
+	// whether requests are rate limited
+	Enabled bool `yaml:"enabled"`
+	// where the limits are kept: "memory" for a single server or "postgres" to share them between servers. Defaults to "memory"
+	Store string `yaml:"store"`
+	// the limits. A request is limited by the rule with the longest matching prefix
+	Rules []RateLimitRule `yaml:"rules"`
+}
+
+// RateLimitRule represents the limit of a group of routes.
+type RateLimitRule struct {
+	// the name of the rule. required.
+	Name string `yaml:"name"`
+	// the route path prefix the rule applies to (e.g. "/v1/login")
+	Prefix string `yaml:"prefix"`
+	// the number of requests allowed per period. required.
+	Requests int `yaml:"requests"`
+	// the period in seconds. required.
+	Period int `yaml:"period"`
+	// the number of requests that can be sent at once. Defaults to Requests
+	Burst int `yaml:"burst"`
+}
+
+// CORS represents the cross-origin resource sharing policy of the API.
+type CORS struct {
+	// the allowed origins, either exact (e.g. "https://example.com") or wildcard subdomains (e.g. "https://*.example.com").
+	// "*" allows any origin and cannot be combined with AllowCredentials.
+	AllowOrigins []string `yaml:"allow_origins"`
+	// the allowed HTTP methods
+	AllowMethods []string `yaml:"allow_methods"`
+	// the allowed request headers
+	AllowHeaders []string `yaml:"allow_headers"`
+	// the response headers exposed to browsers
+	ExposeHeaders []string `yaml:"expose_headers"`
+	// how long (in seconds) browsers may cache preflight responses
+	MaxAge int `yaml:"max_age"`
+	// whether requests may carry credentials (cookies, Authorization header)
+	AllowCredentials bool `yaml:"allow_credentials"`
+}
+
+// HTTP represents the limits and timeouts of the HTTP server. All timeouts are in seconds.
+type HTTP struct {
+	// the time allowed to read the request headers. Defaults to 5
+	ReadHeaderTimeout int `yaml:"read_header_timeout"`
+	// the time allowed to read the entire request, including the body. Defaults to 15
+	ReadTimeout int `yaml:"read_timeout"`
+	// the time allowed to write the response. Defaults to 30
+	WriteTimeout int `yaml:"write_timeout"`
+	// the time a keep-alive connection may stay idle. Defaults to 120
+	IdleTimeout int `yaml:"idle_timeout"`
+	// the maximum size of the request headers in bytes. Defaults to 1MB
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+	// the maximum size of a request body in bytes. Defaults to 1MB
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// the maximum size of request bodies for specific route path prefixes (e.g. "/v1/login"), overriding MaxBodyBytes
+	RouteMaxBodyBytes map[string]int64 `yaml:"route_max_body_bytes"`
+	// the deadline of a request, including its DB queries. Defaults to 20
+	RequestTimeout int `yaml:"request_timeout"`
+	// the time allowed for in-flight requests to complete when shutting down. Defaults to 10
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+	// the time the server keeps serving requests after it stopped reporting readiness when shutting down,
+	// so that the load balancers stop sending it new requests. Defaults to 5
+	DrainPeriod int `yaml:"drain_period"`
+}
+
+// TLS represents the HTTPS settings of the server.
+type TLS struct {
+	// whether the server should serve HTTPS on ServerPort
+	Enabled bool `yaml:"enabled"`
+	// the PEM encoded certificate file. required unless ACME is enabled.
+	CertFile string `yaml:"cert_file"`
+	// the PEM encoded private key file. required unless ACME is enabled.
+	KeyFile string `yaml:"key_file"`
+	// how often (in seconds) the certificate files are checked for renewal. Must be positive. Defaults to 60
+	ReloadInterval int `yaml:"reload_interval"`
+	// the minimum TLS version, either "1.2" or "1.3". Defaults to "1.2"
+	MinVersion string `yaml:"min_version"`
+	// the cipher suites allowed for TLS 1.2 connections. Defaults to the Go defaults
+	CipherSuites []string `yaml:"cipher_suites"`
+	// the port of a plain HTTP listener that redirects to HTTPS. The listener is disabled if 0
+	RedirectPort int `yaml:"redirect_port"`
+	// automatic certificate management via ACME (e.g. Let's Encrypt)
+	ACME ACME `yaml:"acme"`
+}
+
+// ACME represents the settings of automatic certificate management.
+type ACME struct {
+	// whether certificates should be obtained via ACME instead of CertFile and KeyFile
+	Enabled bool `yaml:"enabled"`
+	// the host names the server is allowed to obtain certificates for. required if enabled.
+	Hosts []string `yaml:"hosts"`
+	// the directory used to cache certificates. Defaults to "certs"
+	CacheDir string `yaml:"cache_dir"`
+	// the contact email address of the ACME account
+	Email string `yaml:"email"`
+	// the ACME directory URL. Defaults to the Let's Encrypt production directory
+	DirectoryURL string `yaml:"directory_url"`
 }
 
 // Validate validates the application configuration.
@@ -30,6 +340,209 @@ func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
 		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.HTTP),
+		validation.Field(&c.TLS),
+		validation.Field(&c.CORS),
+		validation.Field(&c.TrustedProxies, validation.By(func(value interface{}) error {
+			_, err := realip.ParseCIDRs(value.([]string))
+			return err
+		})),
+		validation.Field(&c.RateLimit),
+		validation.Field(&c.IdempotencyKeyTTL, validation.Required, validation.Min(1)),
+		validation.Field(&c.SoftDeleteRetention, validation.Min(0)),
+		validation.Field(&c.Events),
+		validation.Field(&c.Webhooks),
+		validation.Field(&c.Jobs),
+		validation.Field(&c.Scheduler),
+		validation.Field(&c.Mail),
+		validation.Field(&c.Invitations),
+		validation.Field(&c.Auth),
+	)
+}
+
+// Validate validates the authentication settings.
+func (a Auth) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.VerificationTTL, validation.Required, validation.Min(1)),
+		validation.Field(&a.VerificationURL, validation.Required, validation.By(validateURL)),
+		validation.Field(&a.MFARoles, validation.Each(validation.Required)),
+		validation.Field(&a.MFAIssuer, validation.Required, validation.Length(0, 100)),
+		validation.Field(&a.ImpersonationTTL, validation.Required, validation.Min(1)),
+		validation.Field(&a.Password),
+		validation.Field(&a.OIDC),
+	)
+}
+
+// Validate validates the password hashing policy.
+func (p Password) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Algorithm, validation.Required, validation.In("argon2id", "bcrypt")),
+		validation.Field(&p.BcryptCost, validation.Required, validation.Min(4), validation.Max(31)),
+		validation.Field(&p.Argon2Memory, validation.Required, validation.Min(8)),
+		validation.Field(&p.Argon2Iterations, validation.Required, validation.Min(1)),
+		validation.Field(&p.Argon2Parallelism, validation.Required, validation.Min(1), validation.Max(255)),
+		validation.Field(&p.MinLength, validation.Required, validation.Min(1)),
+		validation.Field(&p.MaxLength, validation.Required, validation.Min(p.MinLength)),
+	)
+}
+
+// Validate validates the settings of an OpenID Connect identity provider.
+func (p OIDCProvider) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Issuer, validation.Required, validation.By(validateURL)),
+		validation.Field(&p.ClientID, validation.Required),
+		validation.Field(&p.RedirectURL, validation.Required, validation.By(validateURL)),
+		validation.Field(&p.RoleMapping, validation.When(len(p.RoleMapping) > 0, validation.By(func(interface{}) error {
+			if p.RolesClaim == "" {
+				return validation.NewError("validation_roles_claim", "requires roles_claim")
+			}
+			return nil
+		}))),
+	)
+}
+
+// Validate validates the settings of the invitations.
+func (i Invitations) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.TTL, validation.Required, validation.Min(1)),
+		validation.Field(&i.URL, validation.Required, validation.By(validateURL)),
+	)
+}
+
+// Validate validates the settings of the outgoing email.
+func (m Mail) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Driver, validation.In("smtp", "file", "log")),
+		validation.Field(&m.From, validation.When(m.Driver == "smtp", validation.Required), validation.By(func(value interface{}) error {
+			if value.(string) == "" {
+				return nil
+			}
+			if _, err := mail.ParseAddress(value.(string)); err != nil {
+				return validation.NewError("validation_is_email", "must be a valid email address")
+			}
+			return nil
+		})),
+		validation.Field(&m.SMTP, validation.When(m.Driver == "smtp", validation.By(func(value interface{}) error {
+			smtp := value.(SMTP)
+			return validation.ValidateStruct(&smtp,
+				validation.Field(&smtp.Host, validation.Required),
+				validation.Field(&smtp.Port, validation.Required, validation.Min(1), validation.Max(65535)),
+			)
+		}))),
+	)
+}
+
+// Validate validates the delivery settings of the domain events.
+func (e Events) Validate() error {
+	return validation.ValidateStruct(&e,
+		validation.Field(&e.PollInterval, validation.Required, validation.Min(1)),
+		validation.Field(&e.BatchSize, validation.Required, validation.Min(1)),
+		validation.Field(&e.MaxAttempts, validation.Required, validation.Min(1)),
+		validation.Field(&e.RetryBackoff, validation.Required, validation.Min(1)),
+		validation.Field(&e.WebhookURLs, validation.Each(validation.By(validateURL))),
+	)
+}
+
+// validateURL checks that the value is an absolute HTTP(S) URL.
+func validateURL(value interface{}) error {
+	u, err := url.Parse(value.(string))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.NewError("validation_is_url", "must be an absolute HTTP(S) URL")
+	}
+	return nil
+}
+
+// Validate validates the rate limiting settings.
+func (r RateLimit) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Store, validation.In("memory", "postgres")),
+		validation.Field(&r.Rules),
+	)
+}
+
+// Validate validates a rate limiting rule.
+func (r RateLimitRule) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Name, validation.Required),
+		validation.Field(&r.Requests, validation.Required, validation.Min(1)),
+		validation.Field(&r.Period, validation.Required, validation.Min(1)),
+		validation.Field(&r.Burst, validation.Min(0)),
+	)
+}
+
+// Validate validates the limits and timeouts of the HTTP server. The server would never time out with a
+// timeout of 0.
+func (h HTTP) Validate() error {
+	return validation.ValidateStruct(&h,
+		validation.Field(&h.ReadHeaderTimeout, validation.Required, validation.Min(1)),
+		validation.Field(&h.ReadTimeout, validation.Required, validation.Min(1)),
+		validation.Field(&h.WriteTimeout, validation.Required, validation.Min(1)),
+		validation.Field(&h.IdleTimeout, validation.Required, validation.Min(1)),
+		validation.Field(&h.RequestTimeout, validation.Required, validation.Min(1)),
+		validation.Field(&h.ShutdownTimeout, validation.Required, validation.Min(1)),
+		validation.Field(&h.DrainPeriod, validation.Min(0)),
+	)
+}
+
+// Validate validates the CORS policy. Credentials cannot be allowed for every origin.
+func (c CORS) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.AllowOrigins, validation.When(c.AllowCredentials,
+			validation.Each(validation.NotIn("*").Error(`"*" is not allowed when allow_credentials is enabled`)),
+		)),
+	)
+}
+
+// Validate validates the TLS settings.
+func (t TLS) Validate() error {
+	files := t.Enabled && !t.ACME.Enabled
+	return validation.ValidateStruct(&t,
+		validation.Field(&t.CertFile, validation.When(files, validation.Required)),
+		validation.Field(&t.KeyFile, validation.When(files, validation.Required)),
+		validation.Field(&t.ReloadInterval, validation.When(files, validation.Required, validation.Min(1))),
+		validation.Field(&t.MinVersion, validation.In("1.2", "1.3")),
+		validation.Field(&t.ACME),
+	)
+}
+
+// Validate validates the ACME settings.
+func (a ACME) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Hosts, validation.When(a.Enabled, validation.Required)),
+	)
+}
+
+// Validate validates the delivery settings of the webhook subscriptions.
+func (w Webhooks) Validate() error {
+	return validation.ValidateStruct(&w,
+		validation.Field(&w.PollInterval, validation.Required, validation.Min(1)),
+		validation.Field(&w.BatchSize, validation.Required, validation.Min(1)),
+		validation.Field(&w.MaxAttempts, validation.Required, validation.Min(1)),
+		validation.Field(&w.RetryBackoff, validation.Required, validation.Min(1)),
+		validation.Field(&w.Timeout, validation.Required, validation.Min(1)),
+	)
+}
+
+// Validate validates the settings of the worker pool.
+func (j Jobs) Validate() error {
+	return validation.ValidateStruct(&j,
+		validation.Field(&j.Concurrency, validation.Required, validation.Min(1)),
+		validation.Field(&j.PollInterval, validation.Required, validation.Min(1)),
+		validation.Field(&j.VisibilityTimeout, validation.Required, validation.Min(1)),
+		validation.Field(&j.RetryBackoff, validation.Required, validation.Min(1)),
+	)
+}
+
+// Validate validates the settings of the periodic maintenance tasks.
+func (s Scheduler) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Tasks, validation.Each(validation.By(func(value interface{}) error {
+			if value.(string) == "" {
+				return nil
+			}
+			_, err := scheduler.Parse(value.(string))
+			return err
+		}))),
 	)
 }
 
@@ -37,8 +550,93 @@ func (c Config) Validate() error {
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:          defaultServerPort,
+		JWTExpiration:       defaultJWTExpirationHours,
+		IdempotencyKeyTTL:   defaultIdempotencyKeyTTL,
+		SoftDeleteRetention: defaultSoftDeleteRetention,
+		HTTP: HTTP{
+			ReadHeaderTimeout: defaultReadHeaderTimeout,
+			ReadTimeout:       defaultReadTimeout,
+			WriteTimeout:      defaultWriteTimeout,
+			IdleTimeout:       defaultIdleTimeout,
+			MaxHeaderBytes:    defaultMaxHeaderBytes,
+			MaxBodyBytes:      defaultMaxBodyBytes,
+			RequestTimeout:    defaultRequestTimeout,
+			ShutdownTimeout:   defaultShutdownTimeout,
+			DrainPeriod:       defaultDrainPeriod,
+		},
+		CORS: CORS{
+			AllowMethods:  []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+			AllowHeaders:  []string{"Authorization", "Content-Type", "X-Request-ID", "X-Correlation-ID", "If-Match", "If-None-Match", "Idempotency-Key"},
+			ExposeHeaders: []string{"Link", "X-Request-ID", "X-Correlation-ID", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Idempotent-Replayed"},
+			MaxAge:        600,
+		},
+		RateLimit: RateLimit{
+			Store: "memory",
+		},
+		Events: Events{
+			PollInterval: defaultEventPollInterval,
+			BatchSize:    defaultEventBatchSize,
+			MaxAttempts:  defaultEventMaxAttempts,
+			RetryBackoff: defaultEventRetryBackoff,
+		},
+		Webhooks: Webhooks{
+			PollInterval: defaultEventPollInterval,
+			BatchSize:    defaultEventBatchSize,
+			MaxAttempts:  defaultWebhookMaxAttempts,
+			RetryBackoff: defaultWebhookRetryBackoff,
+			Timeout:      defaultWebhookTimeout,
+		},
+		Jobs: Jobs{
+			Concurrency:       defaultJobConcurrency,
+			PollInterval:      defaultJobPollInterval,
+			VisibilityTimeout: defaultJobVisibility,
+			RetryBackoff:      defaultJobRetryBackoff,
+		},
+		Scheduler: Scheduler{
+			Enabled: true,
+			Tasks: map[string]string{
+				"purge_deleted":            "0 3 * * *",
+				"purge_idempotency_keys":   "0 * * * *",
+				"purge_rate_limit_buckets": "*/30 * * * *",
+				"purge_sessions":           "30 3 * * *",
+				"analyze":                  "0 4 * * *",
+			},
+		},
+		Mail: Mail{
+			Driver:        "log",
+			DefaultLocale: "en",
+			Dir:           "mail",
+			SMTP: SMTP{
+				Port: defaultSMTPPort,
+			},
+		},
+		Invitations: Invitations{
+			TTL: defaultInvitationTTL,
+			URL: "http://localhost:3000/invitations",
+		},
+		Auth: Auth{
+			VerificationTTL:  defaultVerificationTTL,
+			VerificationURL:  "http://localhost:8080/v1/email/confirm",
+			MFAIssuer:        "Backend",
+			ImpersonationTTL: defaultImpersonationTTL,
+			Password: Password{
+				Algorithm:         "argon2id",
+				BcryptCost:        10,
+				Argon2Memory:      19456,
+				Argon2Iterations:  2,
+				Argon2Parallelism: 1,
+				MinLength:         8,
+				MaxLength:         150,
+				RejectPersonal:    true,
+			},
+		},
+		TLS: TLS{
+			ReloadInterval: defaultTLSReloadInterval,
+			ACME: ACME{
+				CacheDir: defaultACMECacheDir,
+			},
+		},
 	}
 
 	// load from YAML config file
@@ -6,8 +6,12 @@ import (
 
 // Album represents an album record.
 type Album struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Version   int        `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// the organization owning the album. Nil if it was created outside of any organization
+	OrganizationID *string `json:"organization_id,omitempty"`
 }
@@ -0,0 +1,88 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Statuses of the API keys.
+const (
+	APIKeyActive  = "active"
+	APIKeyRevoked = "revoked"
+	APIKeyExpired = "expired"
+)
+
+// APIKey represents a key that services use to call the API. Only the hash of the key is stored,
+// along with its first characters so that it can be recognized.
+//
+// APIKey implements the identity of the requests made with the key: the key itself is the actor,
+// and it is granted its roles.
+type APIKey struct {
+	ID   string `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// the first characters of the key
+	Prefix  string         `json:"prefix" db:"prefix"`
+	KeyHash string         `json:"-" db:"key_hash"`
+	Roles   pq.StringArray `json:"roles" db:"roles"`
+	// the ID of the administrator who created the key
+	CreatedBy string `json:"created_by" db:"created_by"`
+	// the key never expires if ExpiresAt is nil
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// TableName represents the table name
+func (k APIKey) TableName() string {
+	return "api_keys"
+}
+
+// Status returns the status of the key at the given time.
+func (k APIKey) Status(now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return APIKeyRevoked
+	case k.ExpiresAt != nil && !now.Before(*k.ExpiresAt):
+		return APIKeyExpired
+	default:
+		return APIKeyActive
+	}
+}
+
+// GetID returns the key ID.
+func (k APIKey) GetID() string {
+	return k.ID
+}
+
+// GetUsername returns the key name.
+func (k APIKey) GetUsername() string {
+	return k.Name
+}
+
+// GetEmail returns an empty string, as a key has no email address.
+func (k APIKey) GetEmail() string {
+	return ""
+}
+
+// GetRoles returns the roles granted to the key.
+func (k APIKey) GetRoles() []string {
+	return k.Roles
+}
+
+// HasRole reports whether the key has at least one of the given roles.
+func (k APIKey) HasRole(roles ...string) bool {
+	return User{Roles: k.Roles}.HasRole(roles...)
+}
+
+// GetOrganizationID returns an empty string, as a key is not scoped to an organization.
+func (k APIKey) GetOrganizationID() string {
+	return ""
+}
+
+// IsUserActive reports whether the key has not been revoked.
+func (k APIKey) IsUserActive() bool {
+	return k.RevokedAt == nil
+}
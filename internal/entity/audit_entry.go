@@ -0,0 +1,26 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records who made a change to an entity, and when and how the entity was changed.
+type AuditEntry struct {
+	ID      string `json:"id" db:"id"`
+	ActorID string `json:"actor_id" db:"actor_id"`
+	// the user the actor was impersonating, if any
+	ImpersonatedID string          `json:"impersonated_id,omitempty" db:"impersonated_id"`
+	Action         string          `json:"action" db:"action"`
+	EntityType     string          `json:"entity_type" db:"entity_type"`
+	EntityID       string          `json:"entity_id" db:"entity_id"`
+	Changes        json.RawMessage `json:"changes" db:"changes"`
+	RequestID      string          `json:"request_id" db:"request_id"`
+	IP             string          `json:"ip" db:"ip"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+// TableName represents the table name
+func (e AuditEntry) TableName() string {
+	return "audit_log"
+}
@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+// EmailVerification represents a request to verify the email address of a user.
+// Only the hash of the token sent to the address is stored.
+type EmailVerification struct {
+	ID     string `json:"id" db:"id"`
+	UserID string `json:"user_id" db:"user_id"`
+	// the address being verified. It replaces the address of the user when it is confirmed
+	Email       string     `json:"email" db:"email"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TableName represents the table name
+func (v EmailVerification) TableName() string {
+	return "email_verifications"
+}
+
+// IsPending reports whether the verification can still be confirmed at the given time.
+func (v EmailVerification) IsPending(now time.Time) bool {
+	return v.ConfirmedAt == nil && now.Before(v.ExpiresAt)
+}
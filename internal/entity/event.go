@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Statuses of the events in the outbox.
+const (
+	EventPending   = "pending"
+	EventDelivered = "delivered"
+	EventDead      = "dead"
+)
+
+// Event represents a domain event kept in the outbox until it is delivered.
+type Event struct {
+	ID            string          `json:"id" db:"id"`
+	Type          string          `json:"type" db:"type"`
+	AggregateType string          `json:"aggregate_type" db:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id" db:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Status        string          `json:"-" db:"status"`
+	Attempts      int             `json:"-" db:"attempts"`
+	LastError     string          `json:"-" db:"last_error"`
+	NextAttemptAt time.Time       `json:"-" db:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time      `json:"-" db:"delivered_at"`
+}
+
+// TableName represents the table name
+func (e Event) TableName() string {
+	return "event_outbox"
+}
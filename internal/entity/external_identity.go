@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// ExternalIdentity represents the link between a user and their account at an external identity provider.
+type ExternalIdentity struct {
+	ID string `json:"id" db:"id"`
+	// the name of the provider in the configuration
+	Provider string `json:"provider" db:"provider"`
+	// the identifier of the user at the provider
+	Subject string `json:"subject" db:"subject"`
+	UserID  string `json:"user_id" db:"user_id"`
+	// the email address given by the provider when the identity was linked
+	Email     string    `json:"email" db:"email"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// TableName represents the table name
+func (i ExternalIdentity) TableName() string {
+	return "external_identities"
+}
+
+// OIDCLogin represents a login started with an external identity provider, until the provider redirects
+// the user back. Only the hash of the state sent to the provider is stored.
+type OIDCLogin struct {
+	ID           string    `json:"id" db:"id"`
+	Provider     string    `json:"provider" db:"provider"`
+	StateHash    string    `json:"-" db:"state_hash"`
+	CodeVerifier string    `json:"-" db:"code_verifier"`
+	Nonce        string    `json:"-" db:"nonce"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// TableName represents the table name
+func (l OIDCLogin) TableName() string {
+	return "oidc_logins"
+}
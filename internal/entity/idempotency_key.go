@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+// IdempotencyKey represents a request made with an Idempotency-Key header and, once completed, its response.
+type IdempotencyKey struct {
+	UserID string `json:"user_id" db:"pk,user_id"`
+	// the organization the user acted in, empty if none. The same key can be used in each organization
+	OrganizationID string     `json:"organization_id" db:"pk,organization_id"`
+	Key            string     `json:"key" db:"pk,key"`
+	Fingerprint    string     `json:"fingerprint" db:"fingerprint"`
+	StatusCode     int        `json:"status_code" db:"status_code"`
+	ContentType    string     `json:"content_type" db:"content_type"`
+	ResponseBody   []byte     `json:"-" db:"response_body"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at" db:"completed_at"`
+}
+
+// TableName represents the table name
+func (k IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// IsCompleted returns whether the response of the request has been stored.
+func (k IdempotencyKey) IsCompleted() bool {
+	return k.CompletedAt != nil
+}
@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Statuses of the invitations.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation represents an invitation record. Only the hash of the token sent to the invitee is stored.
+type Invitation struct {
+	ID    string `json:"id" db:"id"`
+	Email string `json:"email" db:"email"`
+	// the roles assigned to the user created when the invitation is accepted
+	Roles pq.StringArray `json:"roles" db:"roles"`
+	// the locale of the invitation email
+	Locale     string     `json:"locale" db:"locale"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	InvitedBy  string     `json:"invited_by" db:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at" db:"accepted_at"`
+	// the ID of the user created when the invitation was accepted
+	UserID    *string    `json:"user_id" db:"user_id"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TableName represents the table name
+func (i Invitation) TableName() string {
+	return "invitations"
+}
+
+// Status returns the status of the invitation at the given time.
+func (i Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
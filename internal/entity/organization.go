@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+// Organization represents a client company, i.e. a tenant. Its members only see the users and resources
+// of the organization they logged in to.
+type Organization struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TableName represents the table name
+func (o Organization) TableName() string {
+	return "organizations"
+}
+
+// Member represents the membership of a user in an organization, with the roles granted to them within it.
+type Member struct {
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	Username       string    `json:"username" db:"username"`
+	Roles          []string  `json:"roles" db:"-"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
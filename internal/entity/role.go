@@ -1,5 +1,16 @@
 package entity
 
+// Names of the roles that are granted special permissions.
+const (
+	RoleAdministrator = "administrator"
+	RoleFinancial     = "financial"
+	RoleClientSupport = "client-support"
+	RoleDriverSupport = "driver-support"
+	// RoleStaff is granted outside of any organization to the staff running the backend, who act across
+	// the organizations. The other users who are a member of no organization access none of their data.
+	RoleStaff = "staff"
+)
+
 // Role represents a product record.
 type Role struct {
 	ID   string `json:"id" db:"id"`
@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+// Session represents a login of a user on a device. The JWT issued at login carries the session ID,
+// and is rejected once the session is revoked.
+type Session struct {
+	ID     string `json:"id" db:"id"`
+	UserID string `json:"user_id" db:"user_id"`
+	// a description of the device derived from the user agent, e.g. "Firefox on Windows"
+	Device     string     `json:"device" db:"device"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	IP         string     `json:"ip" db:"ip"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+// TableName represents the table name
+func (s Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive reports whether the session can be used at the given time.
+func (s Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
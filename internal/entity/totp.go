@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// TOTPEnrollment represents the authenticator app a user set up for two-factor authentication.
+// The codes are only checked once the enrollment is confirmed.
+type TOTPEnrollment struct {
+	UserID      string     `json:"user_id" db:"pk,user_id"`
+	Secret      string     `json:"-" db:"secret"`
+	ConfirmedAt *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	// the time step of the last code used, so that a code cannot be used twice
+	LastUsedStep int64     `json:"-" db:"last_used_step"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// TableName represents the table name
+func (e TOTPEnrollment) TableName() string {
+	return "totp_enrollments"
+}
+
+// IsConfirmed reports whether the enrollment has been confirmed with a first code.
+func (e TOTPEnrollment) IsConfirmed() bool {
+	return e.ConfirmedAt != nil
+}
+
+// RecoveryCode represents a one-time code a user can log in with when they lost their authenticator app.
+// Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        string     `json:"id" db:"id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	CodeHash  string     `json:"-" db:"code_hash"`
+	UsedAt    *time.Time `json:"used_at" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TableName represents the table name
+func (c RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -7,10 +7,11 @@ import (
 
 // User represents a user record.
 type User struct {
-	ID          string       `json:"id" db:"id"`
-	Username    string       `json:"username" db:"username"`
-	Password    string       `json:"password" db:"password"`
-	Email		string 		 `json:"email" db:"email"`
+	ID       string `json:"id" db:"id"`
+	Username string `json:"username" db:"username"`
+	// the password hash, which is never written in the responses
+	Password    string       `json:"-" db:"password"`
+	Email       string       `json:"email" db:"email"`
 	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
 	UpdatedAt   *time.Time   `json:"updated_at" db:"updated_at"`
 	Roles       []string     `json:"roles" db:"-"`
@@ -20,6 +21,12 @@ type User struct {
 	LastName    string       `json:"last_name" db:"last_name"`
 	Account     interface{}  `json:"account" db:"-"`
 	RoleID      string       `json:"role_id" db:"-"`
+	Version     int          `json:"version" db:"version"`
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty" db:"deleted_at"`
+	// when the current email address was verified. Nil if it has not been verified
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	// the organization an authenticated user acts in. Empty if they are not a member of any
+	OrganizationID string `json:"organization_id,omitempty" db:"-"`
 }
 
 // TableName represents the table name
@@ -54,6 +61,11 @@ func (u User) HasRole(roles ...string) bool {
 	return false
 }
 
+// GetOrganizationID returns the ID of the organization the user acts in.
+func (u User) GetOrganizationID() string {
+	return u.OrganizationID
+}
+
 // IsUserActive GetStatus returns the user status.
 func (u User) IsUserActive() bool {
 	return u.IsActive
@@ -0,0 +1,68 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Statuses of the webhook deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription represents a webhook subscription record.
+type WebhookSubscription struct {
+	ID  string `json:"id" db:"id"`
+	URL string `json:"url" db:"url"`
+	// the types of the events sent to the URL. All events are sent if empty
+	EventTypes pq.StringArray `json:"event_types" db:"event_types"`
+	Secret     string         `json:"-" db:"secret"`
+	IsActive   bool           `json:"is_active" db:"is_active"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// TableName represents the table name
+func (s WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// Matches reports whether events of the given type are sent to the subscription.
+func (s WebhookSubscription) Matches(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery represents a webhook delivery record.
+type WebhookDelivery struct {
+	ID             string          `json:"id" db:"id"`
+	SubscriptionID string          `json:"subscription_id" db:"subscription_id"`
+	EventID        string          `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	RedeliveryOf   *string         `json:"redelivery_of" db:"redelivery_of"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	ResponseStatus int             `json:"response_status" db:"response_status"`
+	ResponseBody   string          `json:"response_body" db:"response_body"`
+	LastError      string          `json:"last_error" db:"last_error"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at" db:"delivered_at"`
+}
+
+// TableName represents the table name
+func (d WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -64,5 +65,22 @@ func buildErrorResponse(err error) ErrorResponse {
 	if errors.Is(err, sql.ErrNoRows) {
 		return NotFound("")
 	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ServiceUnavailable("The request took too long to process.")
+	}
+	if isBodyTooLarge(err) {
+		return RequestEntityTooLarge("")
+	}
 	return InternalServerError("")
 }
+
+// isBodyTooLarge reports whether the error, or one it wraps, is the failure to read a request body
+// cut off by http.MaxBytesReader.
+func isBodyTooLarge(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if err.Error() == "http: request body too large" {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
@@ -66,6 +67,12 @@ func Test_buildErrorResponse(t *testing.T) {
 	res = buildErrorResponse(sql.ErrNoRows)
 	assert.Equal(t, http.StatusNotFound, res.Status)
 
+	res = buildErrorResponse(fmt.Errorf("query failed: %w", context.DeadlineExceeded))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Status)
+
+	res = buildErrorResponse(fmt.Errorf("failed reading the body: %w", fmt.Errorf("http: request body too large")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Status)
+
 	res = buildErrorResponse(fmt.Errorf("test"))
 	assert.Equal(t, http.StatusInternalServerError, res.Status)
 }
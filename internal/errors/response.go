@@ -78,6 +78,72 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// Conflict creates a new error response representing a conflict with the current state of a resource (HTTP 409)
+func Conflict(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request conflicts with the current state of the resource."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: msg,
+	}
+}
+
+// PreconditionFailed creates a new error response representing a failed conditional request (HTTP 412)
+func PreconditionFailed(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The resource has been modified since it was retrieved."
+	}
+	return ErrorResponse{
+		Status:  http.StatusPreconditionFailed,
+		Message: msg,
+	}
+}
+
+// UnprocessableEntity creates a new error response representing a well-formed request that cannot be processed (HTTP 422)
+func UnprocessableEntity(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request cannot be processed."
+	}
+	return ErrorResponse{
+		Status:  http.StatusUnprocessableEntity,
+		Message: msg,
+	}
+}
+
+// RequestEntityTooLarge creates a new error response representing a request body over the size limit (HTTP 413)
+func RequestEntityTooLarge(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request body is too large."
+	}
+	return ErrorResponse{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: msg,
+	}
+}
+
+// TooManyRequests creates a new error response representing a rate limit violation (HTTP 429)
+func TooManyRequests(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "You have sent too many requests. Please try again later."
+	}
+	return ErrorResponse{
+		Status:  http.StatusTooManyRequests,
+		Message: msg,
+	}
+}
+
+// ServiceUnavailable creates a new error response representing a temporarily unavailable service (HTTP 503)
+func ServiceUnavailable(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The service is temporarily unable to process your request."
+	}
+	return ErrorResponse{
+		Status:  http.StatusServiceUnavailable,
+		Message: msg,
+	}
+}
+
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
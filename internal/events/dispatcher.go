@@ -0,0 +1,121 @@
+package events
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+)
+
+// maxBackoff is the longest delay between two delivery attempts of an event.
+const maxBackoff = time.Hour
+
+// Sink receives the events delivered by a Dispatcher.
+type Sink interface {
+	// Deliver delivers an event. It must be safe to deliver the same event more than once.
+	Deliver(ctx context.Context, event entity.Event) error
+}
+
+// Options represents the delivery settings of a Dispatcher.
+type Options struct {
+	// the maximum number of events delivered per poll
+	BatchSize int
+	// the number of failed deliveries after which an event is dead-lettered
+	MaxAttempts int
+	// the delay before the first retry of an event, doubled after each failed attempt
+	Backoff time.Duration
+}
+
+// Dispatcher delivers the pending events of the outbox to the sinks.
+type Dispatcher struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	sinks         []Sink
+	opts          Options
+	logger        log.Logger
+	now           func() time.Time
+}
+
+// NewDispatcher creates a new Dispatcher delivering every event to all sinks.
+func NewDispatcher(repo Repository, transactional dbcontext.TransactionFunc, sinks []Sink, opts Options, logger log.Logger) *Dispatcher {
+	return &Dispatcher{repo, transactional, sinks, opts, logger, time.Now}
+}
+
+// Dispatch delivers a batch of pending events and returns the number of events processed.
+//
+// An event is delivered when all sinks accept it. Otherwise it is retried later, after an exponential
+// backoff, and the sinks that accepted it will receive it again. An event is dead-lettered once it
+// has failed MaxAttempts times.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	count := 0
+	err := d.transactional(ctx, func(ctx context.Context) error {
+		events, err := d.repo.Claim(ctx, d.now(), d.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			d.deliver(ctx, &event)
+			if err := d.repo.Update(ctx, event); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Run dispatches the pending events at the given interval until the context is cancelled.
+// Batches are dispatched back to back while the outbox is full.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := d.Dispatch(ctx)
+				if err != nil {
+					d.logger.With(ctx).Errorf("failed to dispatch events: %v", err)
+				}
+				if err != nil || n < d.opts.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// deliver delivers an event to all sinks and updates its delivery state.
+func (d *Dispatcher) deliver(ctx context.Context, event *entity.Event) {
+	event.Attempts++
+	var failure error
+	for _, sink := range d.sinks {
+		if err := sink.Deliver(ctx, *event); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	now := d.now()
+	if failure == nil {
+		event.Status = entity.EventDelivered
+		event.LastError = ""
+		event.DeliveredAt = &now
+		return
+	}
+
+	event.LastError = failure.Error()
+	if event.Attempts >= d.opts.MaxAttempts {
+		event.Status = entity.EventDead
+		d.logger.With(ctx).Errorf("event %v (%v) dead-lettered after %v attempts: %v", event.ID, event.Type, event.Attempts, failure)
+		return
+	}
+	backoff := d.opts.Backoff << uint(event.Attempts-1)
+	if backoff <= 0 || backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	event.NextAttemptAt = now.Add(backoff)
+	d.logger.With(ctx).Infof("event %v (%v) will be retried at %v: %v", event.ID, event.Type, event.NextAttemptAt, failure)
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var errCRUD = errors.New("error crud")
+
+type mockRepository struct {
+	items []entity.Event
+}
+
+func (m *mockRepository) Create(ctx context.Context, event entity.Event) error {
+	if event.AggregateID == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, event)
+	return nil
+}
+
+func (m *mockRepository) Claim(ctx context.Context, now time.Time, limit int) ([]entity.Event, error) {
+	var events []entity.Event
+	for _, item := range m.items {
+		if item.Status == entity.EventPending && !item.NextAttemptAt.After(now) && len(events) < limit {
+			events = append(events, item)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, event entity.Event) error {
+	for i, item := range m.items {
+		if item.ID == event.ID {
+			m.items[i] = event
+		}
+	}
+	return nil
+}
+
+func TestRecorder_Record(t *testing.T) {
+	repo := &mockRepository{}
+	r := NewRecorder(repo)
+
+	err := r.Record(context.Background(), UserCreated, "user", "100", map[string]string{"username": "test"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(repo.items)) {
+		event := repo.items[0]
+		assert.NotEmpty(t, event.ID)
+		assert.Equal(t, UserCreated, event.Type)
+		assert.Equal(t, "user", event.AggregateType)
+		assert.Equal(t, "100", event.AggregateID)
+		assert.JSONEq(t, `{"username":"test"}`, string(event.Payload))
+		assert.Equal(t, entity.EventPending, event.Status)
+	}
+
+	// the repository error is returned so that the change can be rolled back
+	err = r.Record(context.Background(), UserCreated, "user", "error", nil)
+	assert.Equal(t, errCRUD, err)
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	r := NewRecorder(repo)
+	ctx := context.Background()
+	assert.Nil(t, r.Record(ctx, UserCreated, "user", "100", nil))
+	assert.Nil(t, r.Record(ctx, UserDeactivated, "user", "100", nil))
+
+	fail := true
+	var received []string
+	subscriber := NewSubscriber()
+	subscriber.Subscribe(UserCreated, func(ctx context.Context, event entity.Event) error {
+		if fail {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	subscriber.Subscribe("*", func(ctx context.Context, event entity.Event) error {
+		received = append(received, event.Type)
+		return nil
+	})
+
+	d := NewDispatcher(repo, test.MockTransactional, []Sink{subscriber}, Options{BatchSize: 10, MaxAttempts: 2, Backoff: time.Minute}, logger)
+	now := time.Now().Add(time.Second)
+	d.now = func() time.Time { return now }
+
+	// the failed event is retried after the backoff
+	n, err := d.Dispatch(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{UserDeactivated}, received)
+	assert.Equal(t, entity.EventPending, repo.items[0].Status)
+	assert.Equal(t, 1, repo.items[0].Attempts)
+	assert.Equal(t, "unavailable", repo.items[0].LastError)
+	assert.Equal(t, now.Add(time.Minute), repo.items[0].NextAttemptAt)
+	assert.Equal(t, entity.EventDelivered, repo.items[1].Status)
+	assert.Equal(t, &now, repo.items[1].DeliveredAt)
+
+	n, _ = d.Dispatch(ctx)
+	assert.Equal(t, 0, n)
+
+	// the event is dead-lettered once it has failed MaxAttempts times
+	now = now.Add(time.Minute)
+	n, _ = d.Dispatch(ctx)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, entity.EventDead, repo.items[0].Status)
+	assert.Equal(t, 2, repo.items[0].Attempts)
+
+	// a successful retry delivers the event
+	repo.items[0].Status = entity.EventPending
+	fail = false
+	n, _ = d.Dispatch(ctx)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, entity.EventDelivered, repo.items[0].Status)
+	assert.Equal(t, "", repo.items[0].LastError)
+}
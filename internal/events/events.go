@@ -0,0 +1,79 @@
+// Package events records domain events in a transactional outbox and delivers them to sinks in the background.
+//
+// Services record events with a Recorder inside the transaction that changes the data, so an event is published
+// if and only if the change is committed. A Dispatcher then polls the outbox and delivers the events to the sinks,
+// retrying failed deliveries and dead-lettering the events that keep failing. Delivery is at least once.
+package events
+
+import (
+	"backend/internal/entity"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Types of the domain events.
+const (
+	UserCreated       = "user.created"
+	UserDeactivated   = "user.deactivated"
+	UserRolesAssigned = "user.roles_assigned"
+)
+
+// Recorder records domain events.
+type Recorder interface {
+	// Record stores an event about an aggregate in the outbox. If the context carries a transaction,
+	// the event is stored as part of it so that it is only published if the transaction is committed.
+	Record(ctx context.Context, eventType, aggregateType, aggregateID string, payload interface{}) error
+}
+
+type recorder struct {
+	repo Repository
+}
+
+// NewRecorder creates a new event recorder.
+func NewRecorder(repo Repository) Recorder {
+	return recorder{repo}
+}
+
+// Record stores the event in the outbox so that it is delivered as soon as possible.
+func (r recorder) Record(ctx context.Context, eventType, aggregateType, aggregateID string, payload interface{}) error {
+	event, err := newEvent(eventType, aggregateType, aggregateID, payload)
+	if err != nil {
+		return err
+	}
+	return r.repo.Create(ctx, event)
+}
+
+// newEvent creates a pending event.
+func newEvent(eventType, aggregateType, aggregateID string, payload interface{}) (entity.Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return entity.Event{}, err
+	}
+	now := time.Now()
+	return entity.Event{
+		ID:            entity.GenerateID(),
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       data,
+		Status:        entity.EventPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+// MockRecorder is a Recorder that keeps the events in memory, for testing purpose.
+type MockRecorder struct {
+	Events []entity.Event
+}
+
+// Record appends the event to Events.
+func (m *MockRecorder) Record(ctx context.Context, eventType, aggregateType, aggregateID string, payload interface{}) error {
+	event, err := newEvent(eventType, aggregateType, aggregateID, payload)
+	if err != nil {
+		return err
+	}
+	m.Events = append(m.Events, event)
+	return nil
+}
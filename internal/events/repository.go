@@ -0,0 +1,79 @@
+package events
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access the outbox.
+type Repository interface {
+	// Create saves a new event in the outbox.
+	Create(ctx context.Context, event entity.Event) error
+	// Claim locks up to limit pending events which are due at the given time, the oldest first.
+	// Events locked by other dispatchers are skipped. It must be called within a transaction,
+	// which keeps the events locked until it ends.
+	Claim(ctx context.Context, now time.Time, limit int) ([]entity.Event, error)
+	// Update saves the delivery state of an event.
+	Update(ctx context.Context, event entity.Event) error
+}
+
+// repository persists events in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new event repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Create saves a new event record in the database.
+func (r repository) Create(ctx context.Context, event entity.Event) error {
+	// the payload is sent as text because the driver would send a byte slice as binary data
+	_, err := r.db.With(ctx).Insert("event_outbox", dbx.Params{
+		"id":              event.ID,
+		"type":            event.Type,
+		"aggregate_type":  event.AggregateType,
+		"aggregate_id":    event.AggregateID,
+		"payload":         string(event.Payload),
+		"status":          event.Status,
+		"attempts":        event.Attempts,
+		"last_error":      event.LastError,
+		"next_attempt_at": event.NextAttemptAt,
+		"created_at":      event.CreatedAt,
+	}).Execute()
+	return err
+}
+
+// Claim selects the pending events which are due and locks them with FOR UPDATE SKIP LOCKED
+// so that concurrent dispatchers never deliver the same event at the same time.
+func (r repository) Claim(ctx context.Context, now time.Time, limit int) ([]entity.Event, error) {
+	var events []entity.Event
+	err := r.db.With(ctx).NewQuery(`
+		SELECT * FROM event_outbox
+		WHERE status = {:status} AND next_attempt_at <= {:now}
+		ORDER BY created_at
+		LIMIT {:limit}
+		FOR UPDATE SKIP LOCKED`).
+		Bind(dbx.Params{"status": entity.EventPending, "now": now, "limit": limit}).
+		All(&events)
+	return events, err
+}
+
+// Update saves the delivery state of an event record in the database.
+func (r repository) Update(ctx context.Context, event entity.Event) error {
+	_, err := r.db.With(ctx).Update("event_outbox", dbx.Params{
+		"status":          event.Status,
+		"attempts":        event.Attempts,
+		"last_error":      event.LastError,
+		"next_attempt_at": event.NextAttemptAt,
+		"delivered_at":    event.DeliveredAt,
+	}, dbx.HashExp{"id": event.ID}).Execute()
+	return err
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "event_outbox")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	now := time.Now()
+	for i, id := range []string{"1", "2", "3"} {
+		event, err := newEvent(UserCreated, "user", "100", map[string]string{"id": "100"})
+		assert.Nil(t, err)
+		event.ID = id
+		event.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		event.NextAttemptAt = now.Add(time.Duration(i-1) * time.Minute)
+		assert.Nil(t, repo.Create(ctx, event))
+	}
+
+	// claim the due events, the oldest first
+	err := db.Transactional(ctx, func(ctx context.Context) error {
+		events, err := repo.Claim(ctx, now, 10)
+		assert.Nil(t, err)
+		if assert.Equal(t, 2, len(events)) {
+			assert.Equal(t, "1", events[0].ID)
+			assert.JSONEq(t, `{"id":"100"}`, string(events[0].Payload))
+		}
+
+		// update
+		events[0].Status = entity.EventDelivered
+		events[0].Attempts = 1
+		events[0].DeliveredAt = &now
+		return repo.Update(ctx, events[0])
+	})
+	assert.Nil(t, err)
+
+	// delivered events are not claimed again
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		events, err := repo.Claim(ctx, now, 10)
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(events)) {
+			assert.Equal(t, "2", events[0].ID)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/log"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// logSink writes the events to the log.
+type logSink struct {
+	logger log.Logger
+}
+
+// NewLogSink creates a Sink that writes the events to the log.
+func NewLogSink(logger log.Logger) Sink {
+	return logSink{logger}
+}
+
+// Deliver logs the event.
+func (s logSink) Deliver(ctx context.Context, event entity.Event) error {
+	s.logger.With(ctx, "event", event.ID, "payload", string(event.Payload)).
+		Infof("%v %v/%v", event.Type, event.AggregateType, event.AggregateID)
+	return nil
+}
+
+// webhookSink posts the events to a URL.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a Sink that posts every event as JSON to the given URL.
+// A delivery fails unless the receiver responds with a 2xx status code.
+func NewWebhookSink(url string, client *http.Client) Sink {
+	return webhookSink{url, client}
+}
+
+// Deliver posts the event to the URL of the sink.
+func (s webhookSink) Deliver(ctx context.Context, event entity.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook %v responded with status %v", s.url, res.StatusCode)
+	}
+	return nil
+}
+
+// Handler handles an event delivered to a Subscriber.
+type Handler func(ctx context.Context, event entity.Event) error
+
+// Subscriber is a Sink that passes the events to in-process handlers subscribed to their types.
+type Subscriber struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewSubscriber creates a new Subscriber without handlers.
+func NewSubscriber() *Subscriber {
+	return &Subscriber{handlers: map[string][]Handler{}}
+}
+
+// Subscribe registers a handler for the events of the given type. The type "*" matches all events.
+func (s *Subscriber) Subscribe(eventType string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[eventType] = append(s.handlers[eventType], h)
+}
+
+// Deliver calls the handlers subscribed to the event type and returns the first error encountered.
+func (s *Subscriber) Deliver(ctx context.Context, event entity.Event) error {
+	s.mu.RLock()
+	handlers := append(append([]Handler{}, s.handlers[event.Type]...), s.handlers["*"]...)
+	s.mu.RUnlock()
+	for _, h := range handlers {
+		if err := h(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
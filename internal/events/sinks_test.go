@@ -0,0 +1,64 @@
+package events
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/log"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var received entity.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		if received.AggregateID == "error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, server.Client())
+	event, _ := newEvent(UserCreated, "user", "100", map[string]string{"id": "100"})
+	err := sink.Deliver(context.Background(), event)
+	assert.Nil(t, err)
+	assert.Equal(t, event.ID, received.ID)
+	assert.Equal(t, UserCreated, received.Type)
+	assert.JSONEq(t, `{"id":"100"}`, string(received.Payload))
+
+	// the delivery fails unless the receiver accepts the event
+	event.AggregateID = "error"
+	err = sink.Deliver(context.Background(), event)
+	assert.NotNil(t, err)
+}
+
+func TestLogSink(t *testing.T) {
+	logger, entries := log.NewForTest()
+	event, _ := newEvent(UserCreated, "user", "100", nil)
+	err := NewLogSink(logger).Deliver(context.Background(), event)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, entries.Len())
+}
+
+func TestSubscriber(t *testing.T) {
+	s := NewSubscriber()
+	var received []string
+	s.Subscribe(UserCreated, func(ctx context.Context, event entity.Event) error {
+		received = append(received, "created")
+		return nil
+	})
+	s.Subscribe("*", func(ctx context.Context, event entity.Event) error {
+		received = append(received, "all")
+		return nil
+	})
+
+	event, _ := newEvent(UserCreated, "user", "100", nil)
+	assert.Nil(t, s.Deliver(context.Background(), event))
+	event, _ = newEvent(UserDeactivated, "user", "100", nil)
+	assert.Nil(t, s.Deliver(context.Background(), event))
+	assert.Equal(t, []string{"created", "all", "all"}, received)
+}
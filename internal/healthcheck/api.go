@@ -1,10 +1,39 @@
 package healthcheck
 
-import routing "github.com/go-ozzo/ozzo-routing/v2"
+import (
+	"backend/internal/errors"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"sync/atomic"
+)
+
+// Readiness tracks whether the server is ready to accept new traffic.
+type Readiness struct {
+	ready int32
+}
+
+// NewReadiness creates a Readiness which reports the server as ready.
+func NewReadiness() *Readiness {
+	return &Readiness{ready: 1}
+}
+
+// SetReady changes the readiness state.
+func (r *Readiness) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&r.ready, v)
+}
+
+// IsReady returns whether the server is ready to accept new traffic.
+func (r *Readiness) IsReady() bool {
+	return atomic.LoadInt32(&r.ready) == 1
+}
 
 // RegisterHandlers registers the handlers that perform healthchecks.
-func RegisterHandlers(r *routing.Router, version string) {
+func RegisterHandlers(r *routing.Router, version string, readiness *Readiness) {
 	r.To("GET,HEAD", "/healthcheck", healthcheck(version))
+	r.To("GET,HEAD", "/readiness", ready(readiness))
 }
 
 // healthcheck responds to a healthcheck request.
@@ -13,3 +42,13 @@ func healthcheck(version string) routing.Handler {
 		return c.Write("OK " + version)
 	}
 }
+
+// ready responds to a readiness request. It fails with HTTP 503 once the server starts shutting down.
+func ready(readiness *Readiness) routing.Handler {
+	return func(c *routing.Context) error {
+		if !readiness.IsReady() {
+			return errors.ServiceUnavailable("The server is shutting down.")
+		}
+		return c.Write("READY")
+	}
+}
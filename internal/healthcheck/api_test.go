@@ -10,8 +10,16 @@ import (
 func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
-	RegisterHandlers(router, "0.9.0")
+	readiness := NewReadiness()
+	RegisterHandlers(router, "0.9.0", readiness)
 	test.Endpoint(t, router, test.APITestCase{
 		"ok", "GET", "/healthcheck", "", nil, http.StatusOK, `"OK 0.9.0"`,
 	})
+	test.Endpoint(t, router, test.APITestCase{
+		"ready", "GET", "/readiness", "", nil, http.StatusOK, `"READY"`,
+	})
+	readiness.SetReady(false)
+	test.Endpoint(t, router, test.APITestCase{
+		"not ready", "GET", "/readiness", "", nil, http.StatusServiceUnavailable, "",
+	})
 }
@@ -0,0 +1,211 @@
+// Package idempotency provides a middleware that makes POST requests safe to retry by honoring the Idempotency-Key header.
+package idempotency
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+const (
+	// HeaderKey is the request header carrying the idempotency key.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed is the response header set when a stored response is replayed.
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// Handler returns a middleware that makes POST requests with an Idempotency-Key header idempotent.
+//
+// Keys are scoped to the authenticated user and the organization they act in (see dbcontext.Tenant), so the
+// middleware must run after the authentication handler.
+// The first request with a key is processed normally and its response is stored. Repeating the request with
+// the same key replays the stored response. Reusing a key with a different request fails with HTTP 422, and
+// repeating a request while the first one is still being processed fails with HTTP 409. Requests that fail with
+// an error or a server error release the key so that they can be retried. Keys expire after the given TTL.
+//
+// The key is claimed and released in transactions of their own, started by transactional, so that the concurrent
+// requests see it. The request is then handled by the given handler, which usually starts the transaction of the
+// request (see dbcontext.DB.TransactionHandler). It must call Context.Next(), and run the middleware returned by
+// Complete within the transaction of the request to store the response along with the changes of the request.
+func Handler(repo Repository, transactional dbcontext.TransactionFunc, ttl time.Duration, logger log.Logger, handler routing.Handler) routing.Handler {
+	return func(c *routing.Context) error {
+		key := c.Request.Header.Get(HeaderKey)
+		if c.Request.Method != http.MethodPost || key == "" {
+			return handler(c)
+		}
+		ctx := c.Request.Context()
+		identity := auth.CurrentUser(ctx)
+		if identity == nil {
+			return handler(c)
+		}
+		if len(key) > maxKeyLength {
+			return errors.BadRequest("The Idempotency-Key header is too long.")
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return errors.BadRequest("")
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		record := entity.IdempotencyKey{
+			UserID:         identity.GetID(),
+			OrganizationID: dbcontext.Tenant(ctx),
+			Key:            key,
+			Fingerprint:    fingerprint(c.Request, body),
+			CreatedAt:      time.Now(),
+		}
+		var existing *entity.IdempotencyKey
+		err = transactional(ctx, func(ctx context.Context) (err error) {
+			existing, err = claim(ctx, repo, record, ttl)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return replay(c, *existing, record.Fingerprint)
+		}
+
+		p := &pending{record: record, recorder: &responseRecorder{ResponseWriter: c.Response, status: http.StatusOK}}
+		c.Response = p.recorder
+		c.Request = c.Request.WithContext(context.WithValue(ctx, pendingKey, p))
+		err = handler(c)
+		c.Response = p.recorder.ResponseWriter
+
+		if err != nil || !p.completed {
+			// the response has not been stored, or its transaction has been rolled back
+			e := transactional(ctx, func(ctx context.Context) error {
+				return repo.Delete(ctx, record.UserID, record.OrganizationID, key)
+			})
+			if e != nil {
+				logger.With(ctx).Errorf("failed to release idempotency key: %v", e)
+			}
+		}
+		return err
+	}
+}
+
+// Complete returns a middleware that stores the response of a request whose idempotency key has been claimed
+// by the middleware returned by Handler. It must run within the transaction of the request, so that the response
+// is only stored if the changes of the request are committed.
+//
+// The middleware calls Context.Next() to capture the response.
+func Complete(repo Repository, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		p, ok := c.Request.Context().Value(pendingKey).(*pending)
+		if !ok {
+			return nil
+		}
+		if err := c.Next(); err != nil || p.recorder.status >= http.StatusInternalServerError {
+			return err
+		}
+		ctx := c.Request.Context()
+		p.record.StatusCode = p.recorder.status
+		p.record.ContentType = p.recorder.Header().Get("Content-Type")
+		p.record.ResponseBody = p.recorder.body.Bytes()
+		if err := repo.Complete(ctx, p.record); err != nil {
+			logger.With(ctx).Errorf("failed to store idempotent response: %v", err)
+			return nil
+		}
+		p.completed = true
+		return nil
+	}
+}
+
+type contextKey int
+
+const (
+	pendingKey contextKey = iota
+)
+
+// pending is a request whose idempotency key has been claimed, along with its response.
+type pending struct {
+	record    entity.IdempotencyKey
+	recorder  *responseRecorder
+	completed bool
+}
+
+// claim saves the idempotency key of a request. It returns the key saved by a previous request instead,
+// unless it has expired. A conflict error is returned if the key is claimed concurrently.
+func claim(ctx context.Context, repo Repository, record entity.IdempotencyKey, ttl time.Duration) (*entity.IdempotencyKey, error) {
+	created, err := repo.Create(ctx, record)
+	if err != nil || created {
+		return nil, err
+	}
+	existing, err := repo.Get(ctx, record.UserID, record.OrganizationID, record.Key)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && !existing.CreatedAt.Before(record.CreatedAt.Add(-ttl)) {
+		return &existing, nil
+	}
+	// the key was released or has expired in the meantime
+	if err := repo.Delete(ctx, record.UserID, record.OrganizationID, record.Key); err != nil {
+		return nil, err
+	}
+	if created, err = repo.Create(ctx, record); err != nil {
+		return nil, err
+	} else if !created {
+		return nil, errors.Conflict("A request with the same Idempotency-Key is being processed.")
+	}
+	return nil, nil
+}
+
+// replay writes the stored response of a previous request made with the same key.
+func replay(c *routing.Context, existing entity.IdempotencyKey, fingerprint string) error {
+	if existing.Fingerprint != fingerprint {
+		return errors.UnprocessableEntity("The Idempotency-Key has already been used for a different request.")
+	}
+	if !existing.IsCompleted() {
+		return errors.Conflict("A request with the same Idempotency-Key is being processed.")
+	}
+	c.Abort()
+	header := c.Response.Header()
+	if existing.ContentType != "" {
+		header.Set("Content-Type", existing.ContentType)
+	}
+	header.Set(HeaderReplayed, "true")
+	c.Response.WriteHeader(existing.StatusCode)
+	_, err := c.Response.Write(existing.ResponseBody)
+	return err
+}
+
+// fingerprint identifies a request by its method, path and body.
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder captures the status and body of a response while writing it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
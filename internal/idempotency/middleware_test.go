@@ -0,0 +1,267 @@
+package idempotency
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: map[string]entity.IdempotencyKey{}}
+	router := test.MockRouter(logger)
+	calls := 0
+	router.Use(auth.MockAuthHandler, Handler(repo, test.MockTransactional, time.Hour, logger, Complete(repo, logger)))
+	router.Post("/albums", func(c *routing.Context) error {
+		var input struct {
+			Name string `json:"name"`
+		}
+		_ = c.Read(&input)
+		if input.Name == "" {
+			return errors.BadRequest("")
+		}
+		calls++
+		return c.WriteWithStatus(map[string]string{"name": input.Name, "call": fmt.Sprint(calls)}, http.StatusCreated)
+	})
+	router.Get("/albums", func(c *routing.Context) error {
+		return c.Write("ok")
+	})
+
+	header := func(key string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("Idempotency-Key", key)
+		return h
+	}
+	repo.items["100::pending"] = entity.IdempotencyKey{UserID: "100", Key: "pending", Fingerprint: fingerprintOf("POST", "/albums", `{"name":"a"}`), CreatedAt: time.Now()}
+	repo.items["100::expired"] = entity.IdempotencyKey{UserID: "100", Key: "expired", Fingerprint: "old", CreatedAt: time.Now().Add(-2 * time.Hour)}
+
+	tests := []test.APITestCase{
+		{"first request", "POST", "/albums", `{"name":"a"}`, header("k1"), http.StatusCreated, `{"name":"a","call":"1"}`},
+		{"replayed", "POST", "/albums", `{"name":"a"}`, header("k1"), http.StatusCreated, `{"name":"a","call":"1"}`},
+		{"different payload", "POST", "/albums", `{"name":"b"}`, header("k1"), http.StatusUnprocessableEntity, ""},
+		{"new key", "POST", "/albums", `{"name":"a"}`, header("k2"), http.StatusCreated, `{"name":"a","call":"2"}`},
+		{"no key", "POST", "/albums", `{"name":"a"}`, auth.MockAuthHeader(), http.StatusCreated, `{"name":"a","call":"3"}`},
+		{"in progress", "POST", "/albums", `{"name":"a"}`, header("pending"), http.StatusConflict, ""},
+		{"expired", "POST", "/albums", `{"name":"c"}`, header("expired"), http.StatusCreated, `{"name":"c","call":"4"}`},
+		{"failed request", "POST", "/albums", `{"name":""}`, header("k3"), http.StatusBadRequest, ""},
+		{"failed request retried", "POST", "/albums", `{"name":"d"}`, header("k3"), http.StatusCreated, `{"name":"d","call":"5"}`},
+		{"get ignored", "GET", "/albums", "", header("k1"), http.StatusOK, `"ok"`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestHandler_ReplayedHeader(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: map[string]entity.IdempotencyKey{}}
+	router := test.MockRouter(logger)
+	router.Use(auth.MockAuthHandler, Handler(repo, test.MockTransactional, time.Hour, logger, Complete(repo, logger)))
+	router.Post("/albums", func(c *routing.Context) error {
+		return c.WriteWithStatus("created", http.StatusCreated)
+	})
+
+	for i, want := range []string{"", "true"} {
+		req, _ := http.NewRequest("POST", "/albums", bytes.NewBufferString("{}"))
+		req.Header = auth.MockAuthHeader()
+		req.Header.Set("Idempotency-Key", "key")
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusCreated, res.Code, "request %v", i)
+		assert.Equal(t, want, res.Header().Get("Idempotent-Replayed"), "request %v", i)
+		assert.Contains(t, res.Header().Get("Content-Type"), "application/json")
+	}
+}
+
+// TestHandler_Tenants checks that the responses are not replayed to the same user acting in another organization.
+func TestHandler_Tenants(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: map[string]entity.IdempotencyKey{}}
+	router := test.MockRouter(logger)
+	authHandler := func(c *routing.Context) error {
+		ctx := auth.WithUser(c.Request.Context(), "100", "Tester", "", nil, true)
+		if organizationID := c.Request.Header.Get("Authorization"); organizationID != "" {
+			ctx = auth.WithTenant(ctx, organizationID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		return nil
+	}
+	router.Use(authHandler, Handler(repo, test.MockTransactional, time.Hour, logger, Complete(repo, logger)))
+	router.Post("/albums", func(c *routing.Context) error {
+		return c.WriteWithStatus(map[string]string{"tenant": dbcontext.Tenant(c.Request.Context())}, http.StatusCreated)
+	})
+
+	header := func(organizationID string) http.Header {
+		return http.Header{"Authorization": []string{organizationID}, "Idempotency-Key": []string{"k1"}}
+	}
+	tests := []test.APITestCase{
+		{"org1", "POST", "/albums", "{}", header("org1"), http.StatusCreated, `{"tenant":"org1"}`},
+		{"org2", "POST", "/albums", "{}", header("org2"), http.StatusCreated, `{"tenant":"org2"}`},
+		{"no organization", "POST", "/albums", "{}", header(""), http.StatusCreated, `{"tenant":""}`},
+		{"org1 replayed", "POST", "/albums", "{}", header("org1"), http.StatusCreated, `{"tenant":"org1"}`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+	assert.Equal(t, 3, len(repo.items))
+}
+
+// TestHandler_Transaction checks that the requests made with an Idempotency-Key run in the transaction of the
+// request, whose row level security policies hide the albums of the other organizations.
+func TestHandler_Transaction(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "idempotency_keys", "album", "organizations")
+	// the albums are subject to the row level security policies of the database
+	ctx := dbcontext.Unscoped(context.Background())
+	now := time.Now()
+	for _, organizationID := range []string{"org1", "org2"} {
+		_, err := db.With(ctx).Insert("organizations", dbx.Params{"id": organizationID, "name": organizationID, "created_at": now, "updated_at": now}).Execute()
+		assert.Nil(t, err)
+	}
+	// org1 has an album, org2 has two
+	err := db.Transactional(ctx, func(ctx context.Context) error {
+		for i, organizationID := range []string{"org1", "org2", "org2"} {
+			organizationID := organizationID
+			album := entity.Album{ID: fmt.Sprint("album", i), Name: "album", OrganizationID: &organizationID, CreatedAt: now, UpdatedAt: now, Version: 1}
+			if err := db.With(ctx).Model(&album).Insert(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	router := test.MockRouter(logger)
+	authHandler := func(c *routing.Context) error {
+		organizationID := c.Request.Header.Get("Authorization")
+		ctx := auth.WithUser(c.Request.Context(), "user-"+organizationID, organizationID, "", nil, true)
+		c.Request = c.Request.WithContext(auth.WithTenant(ctx, organizationID))
+		return nil
+	}
+	repo := NewRepository(db)
+	router.Use(authHandler, Handler(repo, db.Transactional, time.Hour, logger, db.TransactionHandler(Complete(repo, logger))))
+	router.Post("/albums/count", func(c *routing.Context) error {
+		// the albums are not scoped by the query
+		var count int
+		if err := db.With(c.Request.Context()).Select("COUNT(*)").From("album").Row(&count); err != nil {
+			return err
+		}
+		return c.Write(map[string]int{"count": count})
+	})
+
+	header := func(organizationID, key string) http.Header {
+		h := http.Header{"Authorization": []string{organizationID}}
+		if key != "" {
+			h.Set("Idempotency-Key", key)
+		}
+		return h
+	}
+	tests := []test.APITestCase{
+		{"org1", "POST", "/albums/count", "{}", header("org1", "k1"), http.StatusOK, `{"count":1}`},
+		{"org2", "POST", "/albums/count", "{}", header("org2", "k1"), http.StatusOK, `{"count":2}`},
+		{"org1 replayed", "POST", "/albums/count", "{}", header("org1", "k1"), http.StatusOK, `{"count":1}`},
+		{"org2 without key", "POST", "/albums/count", "{}", header("org2", ""), http.StatusOK, `{"count":2}`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+// TestHandler_Concurrent checks that a request made while another one with the same Idempotency-Key is being
+// processed fails instead of waiting for it, as the key is claimed before the transaction of the request.
+func TestHandler_Concurrent(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "idempotency_keys")
+	repo := NewRepository(db)
+	router := test.MockRouter(logger)
+	started, done := make(chan bool), make(chan bool)
+	router.Use(auth.MockAuthHandler, Handler(repo, db.Transactional, time.Hour, logger, db.TransactionHandler(Complete(repo, logger))))
+	router.Post("/albums", func(c *routing.Context) error {
+		started <- true
+		<-done
+		return c.WriteWithStatus("created", http.StatusCreated)
+	})
+
+	header := auth.MockAuthHeader()
+	header.Set("Idempotency-Key", "k1")
+	first := httptest.NewRecorder()
+	finished := make(chan bool)
+	go func() {
+		req, _ := http.NewRequest("POST", "/albums", bytes.NewBufferString("{}"))
+		req.Header = header
+		router.ServeHTTP(first, req)
+		close(finished)
+	}()
+	<-started
+	test.Endpoint(t, router, test.APITestCase{"concurrent", "POST", "/albums", "{}", header, http.StatusConflict, ""})
+	close(done)
+	<-finished
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	// the response has been stored along with the changes of the request
+	test.Endpoint(t, router, test.APITestCase{"replayed", "POST", "/albums", "{}", header, http.StatusCreated, `"created"`})
+}
+
+func fingerprintOf(method, path, body string) string {
+	req, _ := http.NewRequest(method, path, nil)
+	return fingerprint(req, []byte(body))
+}
+
+type mockRepository struct {
+	items map[string]entity.IdempotencyKey
+}
+
+func (m *mockRepository) Get(ctx context.Context, userID, organizationID, key string) (entity.IdempotencyKey, error) {
+	if item, ok := m.items[userID+":"+organizationID+":"+key]; ok {
+		return item, nil
+	}
+	return entity.IdempotencyKey{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Create(ctx context.Context, key entity.IdempotencyKey) (bool, error) {
+	if _, ok := m.items[key.UserID+":"+key.OrganizationID+":"+key.Key]; ok {
+		return false, nil
+	}
+	m.items[key.UserID+":"+key.OrganizationID+":"+key.Key] = key
+	return true, nil
+}
+
+func (m *mockRepository) Complete(ctx context.Context, key entity.IdempotencyKey) error {
+	now := time.Now()
+	key.CompletedAt = &now
+	m.items[key.UserID+":"+key.OrganizationID+":"+key.Key] = key
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, userID, organizationID, key string) error {
+	delete(m.items, userID+":"+organizationID+":"+key)
+	return nil
+}
+
+func (m *mockRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	for k, item := range m.items {
+		if item.CreatedAt.Before(before) {
+			delete(m.items, k)
+			n++
+		}
+	}
+	return n, nil
+}
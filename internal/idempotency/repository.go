@@ -0,0 +1,88 @@
+package idempotency
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access idempotency keys from the data source.
+type Repository interface {
+	// Get returns the idempotency key of the given user within the given organization.
+	Get(ctx context.Context, userID, organizationID, key string) (entity.IdempotencyKey, error)
+	// Create saves a new idempotency key. It returns false if the key already exists.
+	Create(ctx context.Context, key entity.IdempotencyKey) (bool, error)
+	// Complete stores the response of the request made with the idempotency key.
+	Complete(ctx context.Context, key entity.IdempotencyKey) error
+	// Delete removes the idempotency key so that the request can be made again.
+	Delete(ctx context.Context, userID, organizationID, key string) error
+	// Purge removes the idempotency keys created before the given time and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// repository persists idempotency keys in database
+type repository struct {
+	db *dbcontext.DB
+}
+
+// NewRepository creates a new idempotency key repository
+func NewRepository(db *dbcontext.DB) Repository {
+	return repository{db}
+}
+
+// Get reads the idempotency key of the given user within the given organization from the database.
+func (r repository) Get(ctx context.Context, userID, organizationID, key string) (entity.IdempotencyKey, error) {
+	var k entity.IdempotencyKey
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"user_id": userID, "organization_id": organizationID, "key": key}).One(&k)
+	return k, err
+}
+
+// Create inserts the idempotency key unless the user already used it within the organization.
+func (r repository) Create(ctx context.Context, key entity.IdempotencyKey) (bool, error) {
+	res, err := r.db.With(ctx).NewQuery(
+		"INSERT INTO idempotency_keys (user_id, organization_id, key, fingerprint, created_at) " +
+			"VALUES ({:user_id}, {:organization_id}, {:key}, {:fingerprint}, {:created_at}) " +
+			"ON CONFLICT (user_id, organization_id, key) DO NOTHING",
+	).Bind(dbx.Params{
+		"user_id":         key.UserID,
+		"organization_id": key.OrganizationID,
+		"key":             key.Key,
+		"fingerprint":     key.Fingerprint,
+		"created_at":      key.CreatedAt,
+	}).Execute()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Complete saves the response of the request in the database.
+func (r repository) Complete(ctx context.Context, key entity.IdempotencyKey) error {
+	now := time.Now()
+	_, err := r.db.With(ctx).Update("idempotency_keys", dbx.Params{
+		"status_code":   key.StatusCode,
+		"content_type":  key.ContentType,
+		"response_body": key.ResponseBody,
+		"completed_at":  now,
+	}, dbx.HashExp{"user_id": key.UserID, "organization_id": key.OrganizationID, "key": key.Key}).Execute()
+	return err
+}
+
+// Delete deletes the idempotency key from the database.
+func (r repository) Delete(ctx context.Context, userID, organizationID, key string) error {
+	_, err := r.db.With(ctx).Delete("idempotency_keys", dbx.HashExp{"user_id": userID, "organization_id": organizationID, "key": key}).Execute()
+	return err
+}
+
+// Purge deletes the expired idempotency keys from the database.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.With(ctx).Delete("idempotency_keys", dbx.NewExp("created_at < {:before}", dbx.Params{"before": before})).Execute()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
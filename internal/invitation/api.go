@@ -0,0 +1,95 @@
+package invitation
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/log"
+	"backend/pkg/pagination"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+// The public endpoints are handled by publicHandler first (e.g. to rate limit them per client IP), the others by authHandler.
+func RegisterHandlers(r *routing.RouteGroup, service Service, publicHandler, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the invitee is authenticated by the token of the invitation
+	r.Post("/invitations/<token>/accept", publicHandler, res.accept)
+
+	r.Use(authHandler, auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant)
+
+	// the following endpoints require a valid JWT of an administrator who is not scoped to an organization.
+	// The impersonated administrators cannot invite users
+	r.Get("/invitations/<id>", res.get)
+	r.Get("/invitations", res.query)
+	r.Post("/invitations", auth.DenyImpersonation, res.create)
+	r.Post("/invitations/<id>/revoke", res.revoke)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	invitation, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(invitation)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	invitations, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = invitations
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateInvitationRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	invitation, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(invitation, http.StatusCreated)
+}
+
+func (r resource) revoke(c *routing.Context) error {
+	invitation, err := r.service.Revoke(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(invitation)
+}
+
+func (r resource) accept(c *routing.Context) error {
+	var input AcceptInvitationRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	user, err := r.service.Accept(c.Request.Context(), c.Param("token"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(user, http.StatusCreated)
+}
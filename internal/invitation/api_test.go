@@ -0,0 +1,224 @@
+package invitation
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	internalerrors "backend/internal/errors"
+	"backend/internal/notify"
+	"backend/internal/test"
+	"backend/internal/user"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Invitation{
+		{ID: "123", Email: "ann@test.test", Roles: []string{}, TokenHash: hashToken("t123"), InvitedBy: "100", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()},
+		{ID: "124", Email: "bob@test.test", Roles: []string{}, TokenHash: hashToken("t124"), InvitedBy: "100", ExpiresAt: time.Now().Add(-time.Hour), CreatedAt: time.Now()},
+	}}
+	mailer := &notify.MockMailer{}
+	service := newTestService(t, repo, &mockUserService{}, mailer, logger)
+	RegisterHandlers(router.Group(""), service, test.MockHandler, auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/invitations", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get 123", "GET", "/invitations/123", "", header, http.StatusOK, `*"status":"pending"*`},
+		{"get expired", "GET", "/invitations/124", "", header, http.StatusOK, `*"status":"expired"*`},
+		{"get unknown", "GET", "/invitations/1234", "", header, http.StatusNotFound, ""},
+		{"create impersonated", "POST", "/invitations", `{"email":"new@test.test","roles":["financial"]}`, auth.MockImpersonationHeader(), http.StatusForbidden, ""},
+		{"create ok", "POST", "/invitations", `{"email":"new@test.test","roles":["financial"]}`, header, http.StatusCreated, `*"roles":["financial"]*`},
+		{"create invalid email", "POST", "/invitations", `{"email":"new"}`, header, http.StatusBadRequest, ""},
+		{"create unknown role", "POST", "/invitations", `{"email":"new@test.test","roles":["pilot"]}`, header, http.StatusBadRequest, ""},
+		{"create existing user", "POST", "/invitations", `{"email":"taken@test.test"}`, header, http.StatusConflict, ""},
+		{"create input error", "POST", "/invitations", `"email":"test"}`, header, http.StatusBadRequest, ""},
+		{"revoke ok", "POST", "/invitations/123/revoke", "", header, http.StatusOK, `*"status":"revoked"*`},
+		{"revoke again", "POST", "/invitations/123/revoke", "", header, http.StatusConflict, ""},
+		{"accept revoked", "POST", "/invitations/t123/accept", `{"first_name":"Ann","last_name":"Lee","username":"ann","password":"secret"}`, nil, http.StatusNotFound, ""},
+		{"accept expired", "POST", "/invitations/t124/accept", `{"first_name":"Bob","last_name":"Lee","username":"bob","password":"secret"}`, nil, http.StatusNotFound, ""},
+		{"accept unknown", "POST", "/invitations/t125/accept", `{"first_name":"Bob","last_name":"Lee","username":"bob","password":"secret"}`, nil, http.StatusNotFound, ""},
+		{"auth error", "GET", "/invitations", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+
+	// the invitee accepts the invitation with the token found in the email
+	msg, ok := mailer.Last("new@test.test")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Contains(t, msg.Subject, "Tester Admin")
+	token := regexp.MustCompile(`token=([\w-]+)`).FindStringSubmatch(msg.Text)[1]
+	path := fmt.Sprintf("/invitations/%v/accept", token)
+	tests = []test.APITestCase{
+		{"accept invalid", "POST", path, `{"first_name":"Al","last_name":"Lee","username":"new","password":"secret"}`, nil, http.StatusBadRequest, ""},
+		{"accept input error", "POST", path, `"first_name":"Ann"}`, nil, http.StatusBadRequest, ""},
+		{"accept ok", "POST", path, `{"first_name":"Ann","last_name":"Lee","username":"new","password":"secret"}`, nil, http.StatusCreated, `*"roles":["financial"]*`},
+		{"accept again", "POST", path, `{"first_name":"Ann","last_name":"Lee","username":"new","password":"secret"}`, nil, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestService_Accept(t *testing.T) {
+	logger, _ := log.NewForTest()
+	invitation := entity.Invitation{ID: "123", Email: "ann@test.test", Roles: []string{"financial"}, TokenHash: hashToken("t123"), ExpiresAt: time.Now().Add(time.Hour)}
+	repo := &mockRepository{items: []entity.Invitation{invitation}}
+	users := &mockUserService{}
+	s := newTestService(t, repo, users, &notify.MockMailer{}, logger)
+	ctx := context.Background()
+	req := AcceptInvitationRequest{FirstName: "Ann", LastName: "Lee", Username: "ann", Password: &[]string{"secret"}[0]}
+
+	// a failure to assign the roles fails the acceptance
+	users.err = errCRUD
+	_, err := s.Accept(ctx, "t123", req)
+	assert.Equal(t, errCRUD, err)
+	assert.Nil(t, repo.items[0].AcceptedAt)
+
+	users.err = nil
+	u, err := s.Accept(ctx, "t123", req)
+	assert.Nil(t, err)
+	assert.Equal(t, "ann@test.test", u.Email)
+	assert.Equal(t, []string{"financial"}, u.Roles)
+	if assert.NotNil(t, repo.items[0].AcceptedAt) {
+		assert.Equal(t, u.ID, *repo.items[0].UserID)
+	}
+
+	_, err = s.Accept(ctx, "t123", req)
+	assert.Equal(t, http.StatusNotFound, err.(internalerrors.ErrorResponse).StatusCode())
+}
+
+// newTestService creates a service whose transactions restore the invitations on failure.
+func newTestService(t *testing.T, repo *mockRepository, users user.Service, mailer notify.Mailer, logger log.Logger) Service {
+	templates, err := notify.LoadTemplates("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactional := func(ctx context.Context, f func(ctx context.Context) error) error {
+		items := append([]entity.Invitation(nil), repo.items...)
+		if err := f(ctx); err != nil {
+			repo.items = items
+			return err
+		}
+		return nil
+	}
+	return NewService(repo, users, transactional, &audit.MockRecorder{}, notify.NewNotifier(mailer, templates),
+		Options{TTL: 72 * time.Hour, URL: "https://app.test/invitations"}, logger)
+}
+
+type mockRepository struct {
+	items []entity.Invitation
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Invitation, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Invitation{}, sql.ErrNoRows
+}
+
+func (m mockRepository) GetByToken(ctx context.Context, tokenHash string) (entity.Invitation, error) {
+	for _, item := range m.items {
+		if item.TokenHash == tokenHash {
+			return item, nil
+		}
+	}
+	return entity.Invitation{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Invitation, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, invitation entity.Invitation) error {
+	if invitation.Email == "error@test.test" {
+		return errCRUD
+	}
+	m.items = append(m.items, invitation)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, invitation entity.Invitation) error {
+	for i, item := range m.items {
+		if item.ID == invitation.ID {
+			m.items[i] = invitation
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m mockRepository) EmailTaken(ctx context.Context, email string) (bool, error) {
+	return email == "taken@test.test", nil
+}
+
+func (m mockRepository) CheckRoles(ctx context.Context, roles []string) error {
+	for _, role := range roles {
+		if role != entity.RoleFinancial {
+			return internalerrors.BadRequest(fmt.Sprintf("role %q does not exist", role))
+		}
+	}
+	return nil
+}
+
+// mockUserService creates users in memory. AssignRoles returns err if set.
+type mockUserService struct {
+	user.Service
+	items []user.User
+	err   error
+}
+
+func (m *mockUserService) Get(ctx context.Context, id string) (user.User, error) {
+	if id == "100" {
+		return user.User{User: entity.User{ID: "100", FirstName: "Tester", LastName: "Admin"}}, nil
+	}
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func (m *mockUserService) CreateVerified(ctx context.Context, req user.CreateUserRequest) (user.User, error) {
+	if err := req.Validate(); err != nil {
+		return user.User{}, err
+	}
+	u := user.User{User: entity.User{ID: entity.GenerateID(), Username: req.Username, Email: req.Email, FirstName: req.FirstName, LastName: req.LastName, Roles: []string{}}}
+	m.items = append(m.items, u)
+	return u, nil
+}
+
+func (m *mockUserService) AssignRoles(ctx context.Context, id string, req user.AssignRolesRequest) (user.User, error) {
+	if m.err != nil {
+		return user.User{}, m.err
+	}
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i].Roles = req.Roles
+			return m.items[i], nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
@@ -0,0 +1,132 @@
+package invitation
+
+import (
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"fmt"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access invitations from the data source.
+type Repository interface {
+	// Get returns the invitation with the specified ID.
+	Get(ctx context.Context, id string) (entity.Invitation, error)
+	// GetByToken returns the invitation whose token has the given hash and locks it until the end of the
+	// transaction, so that it cannot be accepted twice. It must be called within a transaction.
+	GetByToken(ctx context.Context, tokenHash string) (entity.Invitation, error)
+	// Count returns the number of invitations.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of invitations with the given offset and limit, the newest first.
+	Query(ctx context.Context, offset, limit int) ([]entity.Invitation, error)
+	// Create saves a new invitation in the storage.
+	Create(ctx context.Context, invitation entity.Invitation) error
+	// Update updates the invitation with given ID in the storage.
+	Update(ctx context.Context, invitation entity.Invitation) error
+	// EmailTaken reports whether a user who has not been deleted has the given email address.
+	EmailTaken(ctx context.Context, email string) (bool, error)
+	// CheckRoles returns a bad request error if one of the roles with the given names does not exist.
+	CheckRoles(ctx context.Context, roles []string) error
+}
+
+// repository persists invitations in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new invitation repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the invitation with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Invitation, error) {
+	var invitation entity.Invitation
+	err := r.db.With(ctx).Select().Model(id, &invitation)
+	return invitation, err
+}
+
+// GetByToken reads the invitation with the specified token hash and locks it with FOR UPDATE.
+func (r repository) GetByToken(ctx context.Context, tokenHash string) (entity.Invitation, error) {
+	var invitation entity.Invitation
+	err := r.db.With(ctx).NewQuery("SELECT * FROM invitations WHERE token_hash = {:hash} FOR UPDATE").
+		Bind(dbx.Params{"hash": tokenHash}).
+		One(&invitation)
+	return invitation, err
+}
+
+// Count returns the number of the invitation records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("invitations").Row(&count)
+	return count, err
+}
+
+// Query retrieves the invitation records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Invitation, error) {
+	var invitations []entity.Invitation
+	err := r.db.With(ctx).
+		Select().
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&invitations)
+	return invitations, err
+}
+
+// Create saves a new invitation record in the database.
+func (r repository) Create(ctx context.Context, invitation entity.Invitation) error {
+	return r.db.With(ctx).Model(&invitation).Insert()
+}
+
+// Update saves the changes to an invitation in the database.
+func (r repository) Update(ctx context.Context, invitation entity.Invitation) error {
+	return r.db.With(ctx).Model(&invitation).Update()
+}
+
+// EmailTaken counts the user records having the email address in the database.
+// It runs in a transaction so that the row level security policies of the database let it find the users.
+func (r repository) EmailTaken(ctx context.Context, email string) (bool, error) {
+	var count int
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select("COUNT(*)").From("users").
+			Where(dbx.And(dbx.NewExp("LOWER(email) = LOWER({:email})", dbx.Params{"email": email}), dbx.HashExp{"deleted_at": nil})).
+			Row(&count)
+	})
+	return count > 0, err
+}
+
+// CheckRoles looks up the roles with the given names in the database.
+func (r repository) CheckRoles(ctx context.Context, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	names := make([]interface{}, len(roles))
+	for i, role := range roles {
+		names[i] = role
+	}
+	var found []string
+	if err := r.db.With(ctx).Select("name").From("roles").Where(dbx.In("name", names...)).Column(&found); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if !contains(found, role) {
+			return errors.BadRequest(fmt.Sprintf("role %q does not exist", role))
+		}
+	}
+	return nil
+}
+
+// contains reports whether the value is among the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
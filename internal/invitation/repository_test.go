@@ -0,0 +1,74 @@
+package invitation
+
+import (
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "invitations")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	now := time.Now()
+	err := repo.Create(ctx, entity.Invitation{
+		ID:        "1",
+		Email:     "ann@test.test",
+		Roles:     []string{"financial"},
+		TokenHash: hashToken("t1"),
+		InvitedBy: "100",
+		ExpiresAt: now.Add(time.Hour),
+		CreatedAt: now,
+	})
+	assert.Nil(t, err)
+	count, _ := repo.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// get by token
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		invitation, err := repo.GetByToken(ctx, hashToken("t1"))
+		assert.Nil(t, err)
+		assert.Equal(t, "1", invitation.ID)
+		assert.Equal(t, []string{"financial"}, []string(invitation.Roles))
+		_, err = repo.GetByToken(ctx, hashToken("t2"))
+		assert.Equal(t, sql.ErrNoRows, err)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// update
+	invitation, _ := repo.Get(ctx, "1")
+	invitation.AcceptedAt = &now
+	assert.Nil(t, repo.Update(ctx, invitation))
+	invitation, _ = repo.Get(ctx, "1")
+	assert.NotNil(t, invitation.AcceptedAt)
+
+	// query
+	invitations, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(invitations))
+
+	// email taken
+	taken, err := repo.EmailTaken(ctx, "nobody@test.test")
+	assert.Nil(t, err)
+	assert.False(t, taken)
+
+	// roles
+	assert.Nil(t, repo.CheckRoles(ctx, nil))
+	err = repo.CheckRoles(ctx, []string{"no-such-role"})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(errors.ErrorResponse).StatusCode())
+	}
+}
@@ -0,0 +1,309 @@
+package invitation
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/notify"
+	"backend/internal/user"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/mail"
+	"net/url"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Service encapsulates usecase logic for invitations.
+type Service interface {
+	Get(ctx context.Context, id string) (Invitation, error)
+	Query(ctx context.Context, offset, limit int) ([]Invitation, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateInvitationRequest) (Invitation, error)
+	Revoke(ctx context.Context, id string) (Invitation, error)
+	Accept(ctx context.Context, token string, input AcceptInvitationRequest) (user.User, error)
+}
+
+// Invitation represents the data about an invitation.
+type Invitation struct {
+	entity.Invitation
+	Status string `json:"status"`
+}
+
+// CreateInvitationRequest represents an invitation creation request.
+type CreateInvitationRequest struct {
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+	// the locale of the invitation email (e.g. "es"). Defaults to the default locale of the templates
+	Locale string `json:"locale"`
+}
+
+// Validate validates the CreateInvitationRequest fields.
+func (m CreateInvitationRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Email, validation.Required, validation.Length(0, 100), validation.By(validateEmail)),
+		validation.Field(&m.Roles, validation.Each(validation.Required, validation.Length(0, 50))),
+		validation.Field(&m.Locale, validation.Length(0, 20)),
+	)
+}
+
+// validateEmail checks that the value is a bare email address.
+func validateEmail(value interface{}) error {
+	if a, err := mail.ParseAddress(value.(string)); err != nil || a.Address != value.(string) {
+		return validation.NewError("validation_is_email", "must be a valid email address")
+	}
+	return nil
+}
+
+// AcceptInvitationRequest represents the request of an invitee creating their account.
+// The email address is the one the invitation was sent to.
+type AcceptInvitationRequest struct {
+	FirstName string  `json:"first_name"`
+	LastName  string  `json:"last_name"`
+	Username  string  `json:"username"`
+	Password  *string `json:"password"`
+}
+
+// createUserRequest returns the request creating the account of the invitee.
+func (m AcceptInvitationRequest) createUserRequest(email string) user.CreateUserRequest {
+	return user.CreateUserRequest{
+		FirstName: m.FirstName,
+		LastName:  m.LastName,
+		Username:  m.Username,
+		Password:  m.Password,
+		Email:     email,
+	}
+}
+
+// Options represents the settings of the invitations.
+type Options struct {
+	// how long an invitation can be accepted
+	TTL time.Duration
+	// the page where the invitations are accepted. The token is added as the "token" query parameter
+	URL string
+}
+
+// entityType identifies invitations in the audit log.
+const entityType = "invitation"
+
+type service struct {
+	repo          Repository
+	users         user.Service
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	notifier      *notify.Notifier
+	opts          Options
+	logger        log.Logger
+	now           func() time.Time
+}
+
+// NewService creates a new invitation service. The invitation emails are sent by the notifier,
+// and the accounts of the invitees are created by the user service, within the transactions started by transactional.
+func NewService(repo Repository, users user.Service, transactional dbcontext.TransactionFunc, recorder audit.Recorder, notifier *notify.Notifier, opts Options, logger log.Logger) Service {
+	return service{repo, users, transactional, recorder, notifier, opts, logger, time.Now}
+}
+
+// Get returns the invitation with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Invitation, error) {
+	invitation, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	return s.newInvitation(invitation), nil
+}
+
+// Count returns the number of invitations.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the invitations with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Invitation, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Invitation{}
+	for _, item := range items {
+		result = append(result, s.newInvitation(item))
+	}
+	return result, nil
+}
+
+// Create creates an invitation sent by the current user, and emails its token to the invitee.
+func (s service) Create(ctx context.Context, req CreateInvitationRequest) (Invitation, error) {
+	if err := req.Validate(); err != nil {
+		return Invitation{}, err
+	}
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return Invitation{}, errors.Unauthorized("")
+	}
+	token, hash, err := generateToken()
+	if err != nil {
+		return Invitation{}, err
+	}
+	link, err := s.link(token)
+	if err != nil {
+		return Invitation{}, err
+	}
+	now := s.now()
+	invitation := entity.Invitation{
+		ID:        entity.GenerateID(),
+		Email:     req.Email,
+		Roles:     req.Roles,
+		Locale:    req.Locale,
+		TokenHash: hash,
+		InvitedBy: identity.GetID(),
+		ExpiresAt: now.Add(s.opts.TTL),
+		CreatedAt: now,
+	}
+	if invitation.Roles == nil {
+		invitation.Roles = []string{}
+	}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.CheckRoles(ctx, req.Roles); err != nil {
+			return err
+		}
+		if err := s.checkEmail(ctx, req.Email); err != nil {
+			return err
+		}
+		inviter, err := s.users.Get(ctx, identity.GetID())
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Create(ctx, invitation); err != nil {
+			return err
+		}
+		if err := s.recorder.Record(ctx, audit.ActionCreate, entityType, invitation.ID, nil, invitation); err != nil {
+			return err
+		}
+		return s.notifier.Notify(ctx, invitation.Email, invitation.Locale, notify.TemplateInvitation, notify.Data{
+			Inviter:   inviter.GetUsername(),
+			URL:       link,
+			ExpiresIn: int(s.opts.TTL / time.Hour),
+		})
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	return s.newInvitation(invitation), nil
+}
+
+// Revoke revokes the pending invitation with the specified ID so that it can no longer be accepted.
+func (s service) Revoke(ctx context.Context, id string) (Invitation, error) {
+	var invitation entity.Invitation
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if status := before.Status(s.now()); status != entity.InvitationPending {
+			return errors.Conflict("the invitation is " + status)
+		}
+		invitation = before
+		now := s.now()
+		invitation.RevokedAt = &now
+		if err := s.repo.Update(ctx, invitation); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, before, invitation)
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	return s.newInvitation(invitation), nil
+}
+
+// Accept creates the account of the invitee with the roles of the invitation, and marks the invitation
+// as accepted, all in one transaction. The request is validated like a user creation request.
+// A not found error is returned if the token does not belong to a pending invitation.
+func (s service) Accept(ctx context.Context, token string, req AcceptInvitationRequest) (user.User, error) {
+	var created user.User
+	// the invitee is not authenticated, and the invitations are not scoped to an organization
+	err := s.transactional(dbcontext.Unscoped(ctx), func(ctx context.Context) error {
+		before, err := s.repo.GetByToken(ctx, hashToken(token))
+		if err == sql.ErrNoRows || (err == nil && before.Status(s.now()) != entity.InvitationPending) {
+			return errors.NotFound("The invitation does not exist or is no longer valid.")
+		} else if err != nil {
+			return err
+		}
+		if err := s.checkEmail(ctx, before.Email); err != nil {
+			return err
+		}
+		// the invitee proves they own the address by accepting the invitation sent to it
+		if created, err = s.users.CreateVerified(ctx, req.createUserRequest(before.Email)); err != nil {
+			return err
+		}
+		if len(before.Roles) > 0 {
+			if created, err = s.users.AssignRoles(ctx, created.ID, user.AssignRolesRequest{Roles: before.Roles}); err != nil {
+				return err
+			}
+		}
+		invitation := before
+		now := s.now()
+		invitation.AcceptedAt = &now
+		invitation.UserID = &created.ID
+		if err := s.repo.Update(ctx, invitation); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, invitation.ID, before, invitation)
+	})
+	if err != nil {
+		return user.User{}, err
+	}
+	return created, nil
+}
+
+// checkEmail returns a conflict error if a user already has the email address.
+func (s service) checkEmail(ctx context.Context, email string) error {
+	taken, err := s.repo.EmailTaken(ctx, email)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.Conflict("a user with this email address already exists")
+	}
+	return nil
+}
+
+// link returns the URL of the page where the invitation with the given token is accepted.
+func (s service) link(token string) (string, error) {
+	u, err := url.Parse(s.opts.URL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// newInvitation returns the data about the invitation, including its current status.
+func (s service) newInvitation(invitation entity.Invitation) Invitation {
+	return Invitation{invitation, invitation.Status(s.now())}
+}
+
+// generateToken returns a random invitation token and its hash.
+func generateToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hash under which the invitation with the given token is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,86 @@
+package job
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/jobs"
+	"backend/pkg/log"
+	"backend/pkg/pagination"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+	r.Use(authHandler, auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant)
+	// the following endpoints require a valid JWT of an administrator who is not scoped to an organization
+	r.Get("/jobs/<id>", res.get)
+	r.Get("/jobs", res.query)
+	r.Post("/jobs/<id>/retry", res.retry)
+	r.Post("/jobs/<id>/cancel", res.cancel)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// statuses are the values accepted by the status filter.
+var statuses = map[string]bool{
+	jobs.StatusPending:   true,
+	jobs.StatusRunning:   true,
+	jobs.StatusSucceeded: true,
+	jobs.StatusFailed:    true,
+	jobs.StatusCancelled: true,
+}
+
+func (r resource) get(c *routing.Context) error {
+	job, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(job)
+}
+
+func (r resource) query(c *routing.Context) error {
+	filter := jobs.Filter{
+		Type:   c.Query("type"),
+		Status: c.Query("status"),
+	}
+	if filter.Status != "" && !statuses[filter.Status] {
+		return errors.BadRequest("The status parameter must be one of pending, running, succeeded, failed and cancelled.")
+	}
+
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	items, err := r.service.Query(ctx, filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = items
+	return c.Write(pages)
+}
+
+func (r resource) retry(c *routing.Context) error {
+	job, err := r.service.Retry(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(job)
+}
+
+func (r resource) cancel(c *routing.Context) error {
+	job, err := r.service.Cancel(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(job)
+}
@@ -0,0 +1,109 @@
+package job
+
+import (
+	"backend/internal/auth"
+	"backend/internal/test"
+	"backend/pkg/jobs"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	store := &mockStore{items: []jobs.Job{
+		{ID: "1", Type: "email", Status: jobs.StatusPending},
+		{ID: "2", Type: "email", Status: jobs.StatusFailed, Attempts: 5, LastError: "unavailable"},
+		{ID: "3", Type: "export", Status: jobs.StatusSucceeded},
+	}}
+	RegisterHandlers(router.Group(""), NewService(store, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/jobs", "", header, http.StatusOK, `*"total_count":3*`},
+		{"filter type", "GET", "/jobs?type=email", "", header, http.StatusOK, `*"total_count":2*`},
+		{"filter status", "GET", "/jobs?status=failed", "", header, http.StatusOK, `*"total_count":1*`},
+		{"invalid status", "GET", "/jobs?status=done", "", header, http.StatusBadRequest, ""},
+		{"get 2", "GET", "/jobs/2", "", header, http.StatusOK, `*"last_error":"unavailable"*`},
+		{"get unknown", "GET", "/jobs/4", "", header, http.StatusNotFound, ""},
+		{"retry failed", "POST", "/jobs/2/retry", "", header, http.StatusOK, `*"status":"pending"*`},
+		{"retry succeeded", "POST", "/jobs/3/retry", "", header, http.StatusConflict, ""},
+		{"cancel pending", "POST", "/jobs/1/cancel", "", header, http.StatusOK, `*"status":"cancelled"*`},
+		{"cancel cancelled", "POST", "/jobs/1/cancel", "", header, http.StatusConflict, ""},
+		{"cancel unknown", "POST", "/jobs/4/cancel", "", header, http.StatusNotFound, ""},
+		{"auth error", "GET", "/jobs", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+type mockStore struct {
+	items []jobs.Job
+}
+
+func (m *mockStore) Create(ctx context.Context, job jobs.Job) error {
+	m.items = append(m.items, job)
+	return nil
+}
+
+func (m *mockStore) Claim(ctx context.Context, types []string, now time.Time, limit int, visibility time.Duration) ([]jobs.Job, error) {
+	return nil, nil
+}
+
+func (m *mockStore) Update(ctx context.Context, job jobs.Job) error {
+	return nil
+}
+
+func (m *mockStore) Get(ctx context.Context, id string) (jobs.Job, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return jobs.Job{}, sql.ErrNoRows
+}
+
+func (m *mockStore) Count(ctx context.Context, filter jobs.Filter) (int, error) {
+	items, err := m.Query(ctx, filter, 0, 0)
+	return len(items), err
+}
+
+func (m *mockStore) Query(ctx context.Context, filter jobs.Filter, offset, limit int) ([]jobs.Job, error) {
+	var items []jobs.Job
+	for _, item := range m.items {
+		if filter.Type != "" && item.Type != filter.Type || filter.Status != "" && item.Status != filter.Status {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (m *mockStore) Retry(ctx context.Context, id string, now time.Time) error {
+	return m.transition(id, jobs.StatusPending, jobs.StatusFailed, jobs.StatusCancelled)
+}
+
+func (m *mockStore) Cancel(ctx context.Context, id string, now time.Time) error {
+	return m.transition(id, jobs.StatusCancelled, jobs.StatusPending)
+}
+
+func (m *mockStore) transition(id, to string, from ...string) error {
+	for i, item := range m.items {
+		if item.ID != id {
+			continue
+		}
+		for _, status := range from {
+			if item.Status == status {
+				m.items[i].Status = to
+				return nil
+			}
+		}
+		return jobs.ErrStatus
+	}
+	return sql.ErrNoRows
+}
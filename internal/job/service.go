@@ -0,0 +1,76 @@
+package job
+
+import (
+	"backend/internal/errors"
+	"backend/pkg/jobs"
+	"backend/pkg/log"
+	"context"
+	"time"
+)
+
+// Service encapsulates usecase logic for managing the background jobs.
+type Service interface {
+	Get(ctx context.Context, id string) (jobs.Job, error)
+	Query(ctx context.Context, filter jobs.Filter, offset, limit int) ([]jobs.Job, error)
+	Count(ctx context.Context, filter jobs.Filter) (int, error)
+	Retry(ctx context.Context, id string) (jobs.Job, error)
+	Cancel(ctx context.Context, id string) (jobs.Job, error)
+}
+
+type service struct {
+	store  jobs.Store
+	logger log.Logger
+}
+
+// NewService creates a new job service.
+func NewService(store jobs.Store, logger log.Logger) Service {
+	return service{store, logger}
+}
+
+// Get returns the job with the specified ID.
+func (s service) Get(ctx context.Context, id string) (jobs.Job, error) {
+	return s.store.Get(ctx, id)
+}
+
+// Count returns the number of jobs matching the filter.
+func (s service) Count(ctx context.Context, filter jobs.Filter) (int, error) {
+	return s.store.Count(ctx, filter)
+}
+
+// Query returns the jobs matching the filter with the specified offset and limit, the newest first.
+func (s service) Query(ctx context.Context, filter jobs.Filter, offset, limit int) ([]jobs.Job, error) {
+	items, err := s.store.Query(ctx, filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []jobs.Job{}
+	}
+	return items, nil
+}
+
+// Retry makes a failed or cancelled job run again as soon as possible.
+func (s service) Retry(ctx context.Context, id string) (jobs.Job, error) {
+	switch err := s.store.Retry(ctx, id, time.Now()); err {
+	case nil:
+		return s.store.Get(ctx, id)
+	case jobs.ErrStatus:
+		return jobs.Job{}, errors.Conflict("Only failed or cancelled jobs can be retried.")
+	case jobs.ErrDuplicate:
+		return jobs.Job{}, errors.Conflict("A job with the same unique key is already queued.")
+	default:
+		return jobs.Job{}, err
+	}
+}
+
+// Cancel cancels a pending job.
+func (s service) Cancel(ctx context.Context, id string) (jobs.Job, error) {
+	switch err := s.store.Cancel(ctx, id, time.Now()); err {
+	case nil:
+		return s.store.Get(ctx, id)
+	case jobs.ErrStatus:
+		return jobs.Job{}, errors.Conflict("Only pending jobs can be cancelled.")
+	default:
+		return jobs.Job{}, err
+	}
+}
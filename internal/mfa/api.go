@@ -0,0 +1,79 @@
+package mfa
+
+import (
+	"backend/internal/auth"
+	"backend/internal/errors"
+	"backend/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT. The impersonated users cannot change their 2FA settings
+	r.Get("/me/2fa", res.status)
+	r.Post("/me/2fa", auth.DenyImpersonation, res.enroll)
+	r.Post("/me/2fa/confirm", auth.DenyImpersonation, res.confirm)
+	r.Post("/me/2fa/disable", auth.DenyImpersonation, res.disable)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// codeRequest represents a request carrying a one-time code.
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+func (r resource) status(c *routing.Context) error {
+	status, err := r.service.Status(c.Request.Context())
+	if err != nil {
+		return err
+	}
+
+	return c.Write(status)
+}
+
+func (r resource) enroll(c *routing.Context) error {
+	enrollment, err := r.service.Enroll(c.Request.Context())
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(enrollment, http.StatusCreated)
+}
+
+func (r resource) confirm(c *routing.Context) error {
+	var input codeRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	codes, err := r.service.Confirm(c.Request.Context(), input.Code)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes})
+}
+
+func (r resource) disable(c *routing.Context) error {
+	var input codeRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	if err := r.service.Disable(c.Request.Context(), input.Code); err != nil {
+		return err
+	}
+
+	return c.Write(Status{})
+}
@@ -0,0 +1,143 @@
+package mfa
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"backend/pkg/totp"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{users: []entity.User{{ID: "100", Username: "tester", Email: "tester@test.test"}}}
+	RegisterHandlers(router.Group(""), NewService(repo, test.MockTransactional, &audit.MockRecorder{}, Options{Issuer: "Backend"}, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"status", "GET", "/me/2fa", "", header, http.StatusOK, `{"enabled":false}`},
+		{"status auth error", "GET", "/me/2fa", "", nil, http.StatusUnauthorized, ""},
+		{"confirm without enrollment", "POST", "/me/2fa/confirm", `{"code":"123456"}`, header, http.StatusNotFound, ""},
+		{"enroll", "POST", "/me/2fa", "", header, http.StatusCreated, `*"uri":"otpauth://totp/Backend:tester@test.test?*`},
+		{"confirm bad code", "POST", "/me/2fa/confirm", `{"code":"abc"}`, header, http.StatusBadRequest, ""},
+		{"confirm bad json", "POST", "/me/2fa/confirm", `"code"`, header, http.StatusBadRequest, ""},
+		{"disable not enabled", "POST", "/me/2fa/disable", `{"code":"123456"}`, header, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{users: []entity.User{{ID: "100", Username: "tester", Email: "tester@test.test"}}}
+	recorder := &audit.MockRecorder{}
+	now := time.Now()
+	s := service{repo, test.MockTransactional, recorder, Options{Issuer: "Backend"}, logger, func() time.Time { return now }}
+	ctx := auth.WithUser(context.Background(), "100", "tester", "tester@test.test", nil, true)
+	code := func(offset int64) string {
+		c, _ := totp.Code(repo.enrollment.Secret, totp.Step(now)+offset)
+		return c
+	}
+
+	enrollment, err := s.Enroll(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, repo.enrollment.Secret, enrollment.Secret)
+	enabled, _ := s.Enabled(ctx, "100")
+	assert.False(t, enabled)
+	assert.Equal(t, errors.Unauthorized(""), s.Verify(ctx, "100", code(0)))
+
+	codes, err := s.Confirm(ctx, code(0))
+	assert.Nil(t, err)
+	assert.Equal(t, recoveryCodeCount, len(codes))
+	assert.Equal(t, recoveryCodeCount, len(repo.codes))
+	assert.Equal(t, 1, len(recorder.Entries))
+	enabled, _ = s.Enabled(ctx, "100")
+	assert.True(t, enabled)
+	status, _ := s.Status(ctx)
+	assert.True(t, status.Enabled)
+	_, err = s.Enroll(ctx)
+	assert.Equal(t, errors.Conflict("two-factor authentication is already enabled"), err)
+
+	// the code that confirmed the enrollment cannot be used again
+	assert.NotNil(t, s.Verify(ctx, "100", code(0)))
+	assert.Nil(t, s.Verify(ctx, "100", code(1)))
+	assert.NotNil(t, s.Verify(ctx, "100", code(1)))
+
+	// the recovery codes can be used once
+	assert.Nil(t, s.Verify(ctx, "100", codes[0]))
+	assert.NotNil(t, s.Verify(ctx, "100", codes[0]))
+	assert.Nil(t, s.Verify(ctx, "100", " "+codes[1][:5]+codes[1][6:]))
+	assert.NotNil(t, s.Verify(ctx, "100", "aaaaa-aaaaa"))
+
+	assert.Equal(t, errors.BadRequest("the code is invalid"), s.Disable(ctx, "aaaaa-aaaaa"))
+	assert.Nil(t, s.Disable(ctx, codes[2]))
+	enabled, _ = s.Enabled(ctx, "100")
+	assert.False(t, enabled)
+	assert.Equal(t, 0, len(repo.codes))
+}
+
+type mockRepository struct {
+	users      []entity.User
+	enrollment *entity.TOTPEnrollment
+	codes      []entity.RecoveryCode
+}
+
+func (m *mockRepository) GetUser(ctx context.Context, id string) (entity.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Get(ctx context.Context, userID string) (entity.TOTPEnrollment, error) {
+	if m.enrollment == nil || m.enrollment.UserID != userID {
+		return entity.TOTPEnrollment{}, sql.ErrNoRows
+	}
+	return *m.enrollment, nil
+}
+
+func (m *mockRepository) Save(ctx context.Context, enrollment entity.TOTPEnrollment) error {
+	m.enrollment = &enrollment
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, enrollment entity.TOTPEnrollment) error {
+	if m.enrollment == nil || m.enrollment.UserID != enrollment.UserID {
+		return sql.ErrNoRows
+	}
+	m.enrollment = &enrollment
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, userID string) error {
+	m.enrollment = nil
+	m.codes = nil
+	return nil
+}
+
+func (m *mockRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codes []entity.RecoveryCode) error {
+	m.codes = codes
+	return nil
+}
+
+func (m *mockRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string, at time.Time) (bool, error) {
+	for i, code := range m.codes {
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			m.codes[i].UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
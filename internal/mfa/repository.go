@@ -0,0 +1,104 @@
+package mfa
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access the two-factor authentication settings from the data source.
+type Repository interface {
+	// GetUser returns the user with the specified ID, unless it has been deleted.
+	GetUser(ctx context.Context, id string) (entity.User, error)
+	// Get returns the TOTP enrollment of the user with the specified ID and locks it until the end of the
+	// transaction, so that the same code cannot be used by concurrent requests. It must be called within a transaction.
+	Get(ctx context.Context, userID string) (entity.TOTPEnrollment, error)
+	// Save saves the enrollment in the storage, replacing the previous enrollment of the user.
+	Save(ctx context.Context, enrollment entity.TOTPEnrollment) error
+	// Update updates the enrollment of the user in the storage.
+	Update(ctx context.Context, enrollment entity.TOTPEnrollment) error
+	// Delete removes the enrollment and the recovery codes of the user with the specified ID.
+	Delete(ctx context.Context, userID string) error
+	// ReplaceRecoveryCodes replaces the recovery codes of the user with the specified ID.
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codes []entity.RecoveryCode) error
+	// UseRecoveryCode marks the unused recovery code with the given hash as used at the given time.
+	// It reports whether such a code was found.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string, at time.Time) (bool, error)
+}
+
+// repository persists two-factor authentication settings in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new two-factor authentication repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetUser reads the user with the specified ID from the database.
+func (r repository) GetUser(ctx context.Context, id string) (entity.User, error) {
+	var user entity.User
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"deleted_at": nil}).Model(id, &user)
+	return user, err
+}
+
+// Get reads the enrollment of a user and locks it with FOR UPDATE.
+func (r repository) Get(ctx context.Context, userID string) (entity.TOTPEnrollment, error) {
+	var enrollment entity.TOTPEnrollment
+	err := r.db.With(ctx).NewQuery("SELECT * FROM totp_enrollments WHERE user_id = {:id} FOR UPDATE").
+		Bind(dbx.Params{"id": userID}).
+		One(&enrollment)
+	return enrollment, err
+}
+
+// Save deletes the enrollment record of a user and inserts the new one in the database.
+func (r repository) Save(ctx context.Context, enrollment entity.TOTPEnrollment) error {
+	if _, err := r.db.With(ctx).Delete("totp_enrollments", dbx.HashExp{"user_id": enrollment.UserID}).Execute(); err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&enrollment).Insert()
+}
+
+// Update saves the changes to an enrollment in the database.
+func (r repository) Update(ctx context.Context, enrollment entity.TOTPEnrollment) error {
+	return r.db.With(ctx).Model(&enrollment).Update()
+}
+
+// Delete deletes the enrollment and recovery code records of a user from the database.
+func (r repository) Delete(ctx context.Context, userID string) error {
+	if _, err := r.db.With(ctx).Delete("recovery_codes", dbx.HashExp{"user_id": userID}).Execute(); err != nil {
+		return err
+	}
+	_, err := r.db.With(ctx).Delete("totp_enrollments", dbx.HashExp{"user_id": userID}).Execute()
+	return err
+}
+
+// ReplaceRecoveryCodes deletes the recovery code records of a user and inserts the new ones in the database.
+func (r repository) ReplaceRecoveryCodes(ctx context.Context, userID string, codes []entity.RecoveryCode) error {
+	if _, err := r.db.With(ctx).Delete("recovery_codes", dbx.HashExp{"user_id": userID}).Execute(); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if err := r.db.With(ctx).Model(&code).Insert(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode sets the time a recovery code record was used in the database.
+func (r repository) UseRecoveryCode(ctx context.Context, userID, codeHash string, at time.Time) (bool, error) {
+	res, err := r.db.With(ctx).Update("recovery_codes", dbx.Params{"used_at": at},
+		dbx.HashExp{"user_id": userID, "code_hash": codeHash, "used_at": nil}).Execute()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,73 @@
+package mfa
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "users")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+	// the users are subject to the row level security policies of the database
+	err := db.Transactional(dbcontext.Unscoped(ctx), func(ctx context.Context) error {
+		return db.With(ctx).Model(&entity.User{
+			ID:        "100",
+			Username:  "tester",
+			Password:  "secret",
+			Email:     "tester@test.test",
+			CreatedAt: now,
+			UpdatedAt: &now,
+			Version:   1,
+		}).Insert()
+	})
+	assert.Nil(t, err)
+
+	// save
+	_, err = repo.Get(ctx, "100")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, repo.Save(ctx, entity.TOTPEnrollment{UserID: "100", Secret: "first", CreatedAt: now}))
+	assert.Nil(t, repo.Save(ctx, entity.TOTPEnrollment{UserID: "100", Secret: "second", CreatedAt: now}))
+	enrollment, err := repo.Get(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", enrollment.Secret)
+
+	// update
+	enrollment.ConfirmedAt = &now
+	enrollment.LastUsedStep = 42
+	assert.Nil(t, repo.Update(ctx, enrollment))
+	enrollment, _ = repo.Get(ctx, "100")
+	assert.True(t, enrollment.IsConfirmed())
+	assert.Equal(t, int64(42), enrollment.LastUsedStep)
+
+	// recovery codes
+	assert.Nil(t, repo.ReplaceRecoveryCodes(ctx, "100", []entity.RecoveryCode{
+		{ID: "1", UserID: "100", CodeHash: hashCode("a"), CreatedAt: now},
+		{ID: "2", UserID: "100", CodeHash: hashCode("b"), CreatedAt: now},
+	}))
+	ok, err := repo.UseRecoveryCode(ctx, "100", hashCode("a"), now)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, _ = repo.UseRecoveryCode(ctx, "100", hashCode("a"), now)
+	assert.False(t, ok)
+	ok, _ = repo.UseRecoveryCode(ctx, "101", hashCode("b"), now)
+	assert.False(t, ok)
+
+	// delete
+	assert.Nil(t, repo.Delete(ctx, "100"))
+	_, err = repo.Get(ctx, "100")
+	assert.Equal(t, sql.ErrNoRows, err)
+	ok, _ = repo.UseRecoveryCode(ctx, "100", hashCode("b"), now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,293 @@
+// Package mfa manages the two-factor authentication of the users with the time-based one-time codes
+// of an authenticator app, and the recovery codes replacing the app when it is lost.
+//
+// A user enrolls by scanning the otpauth URI of a new secret, then confirms the enrollment with a first code.
+// The recovery codes are returned once, when the enrollment is confirmed, and only their hashes are stored.
+package mfa
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"backend/pkg/totp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes generated when an enrollment is confirmed.
+	recoveryCodeCount = 10
+	// skew is the number of time steps of clock drift tolerated between the server and the authenticator apps.
+	skew = 1
+)
+
+// Service encapsulates usecase logic for two-factor authentication.
+type Service interface {
+	// Status returns the two-factor authentication status of the current user.
+	Status(ctx context.Context) (Status, error)
+	// Enroll generates a new TOTP secret for the current user. It replaces any unconfirmed enrollment.
+	Enroll(ctx context.Context) (Enrollment, error)
+	// Confirm enables two-factor authentication for the current user with a first code of the authenticator app.
+	// It returns the recovery codes.
+	Confirm(ctx context.Context, code string) ([]string, error)
+	// Disable disables two-factor authentication for the current user, who must give a valid code.
+	Disable(ctx context.Context, code string) error
+	// Enabled reports whether the user with the specified ID has enabled two-factor authentication.
+	Enabled(ctx context.Context, userID string) (bool, error)
+	// Verify checks a code of the authenticator app or an unused recovery code of the user with the specified ID.
+	// The code cannot be used again.
+	Verify(ctx context.Context, userID, code string) error
+}
+
+// Status represents the two-factor authentication status of a user.
+type Status struct {
+	Enabled     bool       `json:"enabled"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// Enrollment represents a new TOTP secret, to be added to an authenticator app.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	// the otpauth URI of the secret, usually displayed as a QR code
+	URI string `json:"uri"`
+}
+
+// Options represents the settings of the two-factor authentication.
+type Options struct {
+	// the issuer displayed by the authenticator apps
+	Issuer string
+}
+
+// entityType identifies the TOTP enrollments in the audit log.
+const entityType = "totp_enrollment"
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	opts          Options
+	logger        log.Logger
+	now           func() time.Time
+}
+
+// NewService creates a new two-factor authentication service.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, recorder audit.Recorder, opts Options, logger log.Logger) Service {
+	return service{repo, transactional, recorder, opts, logger, time.Now}
+}
+
+// Status returns whether the current user has a confirmed enrollment.
+func (s service) Status(ctx context.Context) (Status, error) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return Status{}, errors.Unauthorized("")
+	}
+	enrollment, err := s.repo.Get(ctx, identity.GetID())
+	if err == sql.ErrNoRows || (err == nil && !enrollment.IsConfirmed()) {
+		return Status{}, nil
+	} else if err != nil {
+		return Status{}, err
+	}
+	return Status{Enabled: true, ConfirmedAt: enrollment.ConfirmedAt}, nil
+}
+
+// Enroll saves a new unconfirmed enrollment. A conflict error is returned if two-factor authentication
+// is already enabled.
+func (s service) Enroll(ctx context.Context) (Enrollment, error) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return Enrollment{}, errors.Unauthorized("")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+	var user entity.User
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if user, err = s.repo.GetUser(ctx, identity.GetID()); err != nil {
+			return err
+		}
+		current, err := s.repo.Get(ctx, user.ID)
+		if err == nil && current.IsConfirmed() {
+			return errors.Conflict("two-factor authentication is already enabled")
+		} else if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		return s.repo.Save(ctx, entity.TOTPEnrollment{
+			UserID:    user.ID,
+			Secret:    secret,
+			CreatedAt: s.now(),
+		})
+	})
+	if err != nil {
+		return Enrollment{}, err
+	}
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+	return Enrollment{Secret: secret, URI: totp.URI(s.opts.Issuer, account, secret)}, nil
+}
+
+// Confirm confirms the pending enrollment of the current user and generates new recovery codes.
+// A not found error is returned if the user has no pending enrollment, and a bad request error if the code is invalid.
+func (s service) Confirm(ctx context.Context, code string) ([]string, error) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return nil, errors.Unauthorized("")
+	}
+	var codes []string
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.repo.Get(ctx, identity.GetID())
+		if err == sql.ErrNoRows || (err == nil && before.IsConfirmed()) {
+			return errors.NotFound("There is no pending two-factor authentication enrollment.")
+		} else if err != nil {
+			return err
+		}
+		now := s.now()
+		step, ok := totp.Validate(before.Secret, code, now, skew, before.LastUsedStep)
+		if !ok {
+			return errors.BadRequest("the code is invalid")
+		}
+		enrollment := before
+		enrollment.ConfirmedAt = &now
+		enrollment.LastUsedStep = step
+		if err := s.repo.Update(ctx, enrollment); err != nil {
+			return err
+		}
+		var records []entity.RecoveryCode
+		if codes, records, err = s.generateRecoveryCodes(enrollment.UserID); err != nil {
+			return err
+		}
+		if err := s.repo.ReplaceRecoveryCodes(ctx, enrollment.UserID, records); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, enrollment.UserID, before, enrollment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable deletes the enrollment and the recovery codes of the current user.
+// A not found error is returned if two-factor authentication is not enabled, and a bad request error
+// if the code is invalid.
+func (s service) Disable(ctx context.Context, code string) error {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	return s.transactional(ctx, func(ctx context.Context) error {
+		enrollment, err := s.repo.Get(ctx, identity.GetID())
+		if err == sql.ErrNoRows || (err == nil && !enrollment.IsConfirmed()) {
+			return errors.NotFound("Two-factor authentication is not enabled.")
+		} else if err != nil {
+			return err
+		}
+		if ok, err := s.verify(ctx, enrollment, code); err != nil {
+			return err
+		} else if !ok {
+			return errors.BadRequest("the code is invalid")
+		}
+		if err := s.repo.Delete(ctx, enrollment.UserID); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionDelete, entityType, enrollment.UserID, enrollment, nil)
+	})
+}
+
+// Enabled reports whether the user has a confirmed enrollment.
+func (s service) Enabled(ctx context.Context, userID string) (bool, error) {
+	enrollment, err := s.repo.Get(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return enrollment.IsConfirmed(), nil
+}
+
+// Verify checks the code in a transaction. An unauthorized error is returned if the code is invalid
+// or if the user has not enabled two-factor authentication.
+func (s service) Verify(ctx context.Context, userID, code string) error {
+	logger := s.logger.With(ctx, "user", userID)
+	return s.transactional(ctx, func(ctx context.Context) error {
+		enrollment, err := s.repo.Get(ctx, userID)
+		if err == sql.ErrNoRows || (err == nil && !enrollment.IsConfirmed()) {
+			return errors.Unauthorized("")
+		} else if err != nil {
+			return err
+		}
+		ok, err := s.verify(ctx, enrollment, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logger.Infof("two-factor authentication failed")
+			return errors.Unauthorized("the code is invalid")
+		}
+		return nil
+	})
+}
+
+// verify checks a TOTP code, then a recovery code, and records the use of the valid code.
+func (s service) verify(ctx context.Context, enrollment entity.TOTPEnrollment, code string) (bool, error) {
+	now := s.now()
+	if step, ok := totp.Validate(enrollment.Secret, code, now, skew, enrollment.LastUsedStep); ok {
+		enrollment.LastUsedStep = step
+		return true, s.repo.Update(ctx, enrollment)
+	}
+	if normalized := normalizeRecoveryCode(code); normalized != "" {
+		ok, err := s.repo.UseRecoveryCode(ctx, enrollment.UserID, hashCode(normalized), now)
+		if ok {
+			s.logger.With(ctx, "user", enrollment.UserID).Infof("recovery code used")
+		}
+		return ok, err
+	}
+	return false, nil
+}
+
+// recoveryEncoding is the alphabet of the recovery codes.
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns new recovery codes formatted as "xxxxx-xxxxx", and the records storing their hashes.
+func (s service) generateRecoveryCodes(userID string) ([]string, []entity.RecoveryCode, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]entity.RecoveryCode, recoveryCodeCount)
+	now := s.now()
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryEncoding.EncodeToString(buf)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		records[i] = entity.RecoveryCode{
+			ID:        entity.GenerateID(),
+			UserID:    userID,
+			CodeHash:  hashCode(code),
+			CreatedAt: now,
+		}
+	}
+	return codes, records, nil
+}
+
+// normalizeRecoveryCode removes the separators of a recovery code and lowercases it.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// hashCode returns the hash under which the given normalized recovery code is stored.
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
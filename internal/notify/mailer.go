@@ -0,0 +1,118 @@
+// Package notify sends the email notifications of the application, such as invitations and password resets.
+//
+// The messages are rendered from the localized templates embedded in the package and sent by a Mailer:
+// SMTP in production, the log or a directory of .eml files in development, and MockMailer in tests.
+package notify
+
+import (
+	"backend/pkg/log"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message represents an email message. At least one of Text and HTML must be set.
+type Message struct {
+	// the sender address. Mailers use their default sender if empty
+	From    string   `json:"from,omitempty"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text,omitempty"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	// Send sends the message. It returns an error if the message could not be handed over for delivery.
+	Send(ctx context.Context, msg Message) error
+}
+
+// logMailer writes the messages to the log instead of sending them.
+type logMailer struct {
+	logger log.Logger
+}
+
+// NewLogMailer creates a Mailer that writes the messages to the log, for local development.
+func NewLogMailer(logger log.Logger) Mailer {
+	return logMailer{logger}
+}
+
+// Send logs the message and its text body.
+func (m logMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.With(ctx, "to", strings.Join(msg.To, ", "), "body", msg.Text).Infof("email: %v", msg.Subject)
+	return nil
+}
+
+// fileMailer writes the messages as .eml files.
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a Mailer that writes every message as an .eml file to the given directory,
+// so that it can be opened with an email client during local development.
+func NewFileMailer(dir, from string) Mailer {
+	return fileMailer{dir, from}
+}
+
+// Send writes the message to a new file named after the current time.
+func (m fileMailer) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = m.from
+	}
+	data, err := encode(msg, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%v-%v.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String()[:8])
+	return ioutil.WriteFile(filepath.Join(m.dir, name), data, 0644)
+}
+
+// MockMailer is a Mailer that keeps the messages in memory, for testing purpose.
+type MockMailer struct {
+	mu       sync.Mutex
+	messages []Message
+	// the error returned by Send, if any
+	Err error
+}
+
+// Send records the message unless Err is set.
+func (m *MockMailer) Send(ctx context.Context, msg Message) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *MockMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the last message sent to the given address, and whether there is one.
+func (m *MockMailer) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		for _, addr := range m.messages[i].To {
+			if strings.EqualFold(addr, to) {
+				return m.messages[i], true
+			}
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"backend/pkg/jobs"
+	"context"
+)
+
+// the names of the messages that can be rendered
+const (
+	TemplateWelcome       = "welcome"
+	TemplatePasswordReset = "password_reset"
+	TemplateInvitation    = "invitation"
+	TemplateVerification  = "email_verification"
+)
+
+// JobType is the type of the background jobs sending the messages queued by a queue mailer.
+const JobType = "notify.send"
+
+// Data represents the values the templates are rendered with. Each message uses a subset of the fields.
+type Data struct {
+	// the name of the recipient
+	Name string
+	// the link the recipient is asked to open
+	URL string
+	// the name of the user who sent an invitation
+	Inviter string
+	// the number of hours before URL expires
+	ExpiresIn int
+}
+
+// Notifier renders localized messages and sends them.
+type Notifier struct {
+	mailer    Mailer
+	templates *Templates
+}
+
+// NewNotifier creates a new Notifier.
+func NewNotifier(mailer Mailer, templates *Templates) *Notifier {
+	return &Notifier{mailer, templates}
+}
+
+// Notify renders the message of the given name in the given locale and sends it to the given address.
+func (n *Notifier) Notify(ctx context.Context, to, locale, name string, data Data) error {
+	msg, err := n.templates.Render(locale, name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{to}
+	return n.mailer.Send(ctx, msg)
+}
+
+// queueMailer enqueues the messages as background jobs.
+type queueMailer struct {
+	client *jobs.Client
+}
+
+// NewQueueMailer creates a Mailer that enqueues the messages as background jobs, so that requests
+// do not wait for the mail server and failed sends are retried. If the context carries a transaction,
+// the message is only sent if the transaction is committed. The jobs are run by SendHandler.
+func NewQueueMailer(client *jobs.Client) Mailer {
+	return queueMailer{client}
+}
+
+// Send enqueues the message.
+func (m queueMailer) Send(ctx context.Context, msg Message) error {
+	_, err := m.client.Enqueue(ctx, JobType, msg)
+	return err
+}
+
+// SendHandler returns the handler of the jobs enqueued by a queue mailer, which sends the messages with the given mailer.
+func SendHandler(mailer Mailer) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var msg Message
+		if err := job.Decode(&msg); err != nil {
+			return err
+		}
+		return mailer.Send(ctx, msg)
+	}
+}
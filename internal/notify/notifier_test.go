@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"backend/pkg/jobs"
+	"backend/pkg/log"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	templates, err := LoadTemplates("en")
+	if !assert.Nil(t, err) {
+		return
+	}
+	mailer := &MockMailer{}
+	n := NewNotifier(mailer, templates)
+
+	err = n.Notify(context.Background(), "ann@test.test", "es", TemplateInvitation, Data{Inviter: "Bob", URL: "https://example.com/i", ExpiresIn: 72})
+	assert.Nil(t, err)
+	msg, ok := mailer.Last("Ann@Test.test")
+	if assert.True(t, ok) {
+		assert.Equal(t, []string{"ann@test.test"}, msg.To)
+		assert.Equal(t, "Bob te ha invitado", msg.Subject)
+		assert.Contains(t, msg.Text, "72 horas")
+	}
+	_, ok = mailer.Last("bob@test.test")
+	assert.False(t, ok)
+
+	assert.NotNil(t, n.Notify(context.Background(), "ann@test.test", "en", "unknown", Data{}))
+	mailer.Err = errors.New("unavailable")
+	assert.Equal(t, mailer.Err, n.Notify(context.Background(), "ann@test.test", "en", TemplateWelcome, Data{}))
+	assert.Equal(t, 1, len(mailer.Messages()))
+}
+
+func TestSendHandler(t *testing.T) {
+	mailer := &MockMailer{}
+	msg := Message{To: []string{"ann@test.test"}, Subject: "Hi", Text: "text"}
+	payload, _ := json.Marshal(msg)
+
+	err := SendHandler(mailer)(context.Background(), jobs.Job{Type: JobType, Payload: payload})
+	assert.Nil(t, err)
+	assert.Equal(t, []Message{msg}, mailer.Messages())
+
+	err = SendHandler(mailer)(context.Background(), jobs.Job{Type: JobType, Payload: []byte("{")})
+	assert.NotNil(t, err)
+}
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(filepath.Join(dir, "mail"), "noreply@app.test")
+	err := m.Send(context.Background(), Message{To: []string{"ann@test.test"}, Subject: "Hi", Text: "text"})
+	assert.Nil(t, err)
+	files, _ := filepath.Glob(filepath.Join(dir, "mail", "*.eml"))
+	if assert.Equal(t, 1, len(files)) {
+		data, _ := ioutil.ReadFile(files[0])
+		assert.True(t, strings.HasPrefix(string(data), "From: noreply@app.test\r\n"))
+	}
+}
+
+func TestLogMailer_Send(t *testing.T) {
+	logger, entries := log.NewForTest()
+	err := NewLogMailer(logger).Send(context.Background(), Message{To: []string{"ann@test.test"}, Subject: "Hi", Text: "text"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, "email: Hi", entries.All()[0].Message)
+	}
+}
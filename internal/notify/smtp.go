@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPOptions represents the settings of an SMTP server.
+type SMTPOptions struct {
+	Host string
+	Port int
+	// the credentials for PLAIN authentication. No authentication is done if Username is empty
+	Username string
+	Password string
+	// the default sender address
+	From string
+}
+
+// smtpMailer sends the messages through an SMTP server.
+type smtpMailer struct {
+	opts SMTPOptions
+	// send is smtp.SendMail, replaced in tests
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPMailer creates a Mailer that sends the messages through the given SMTP server.
+// The connection is upgraded with STARTTLS if the server supports it.
+func NewSMTPMailer(opts SMTPOptions) Mailer {
+	return smtpMailer{opts, smtp.SendMail}
+}
+
+// Send sends the message as a multipart/alternative email.
+func (m smtpMailer) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = m.opts.From
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", msg.From, err)
+	}
+	to := make([]string, len(msg.To))
+	for i, addr := range msg.To {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		to[i] = a.Address
+	}
+	data, err := encode(msg, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.opts.Username != "" {
+		auth = smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+	}
+	addr := net.JoinHostPort(m.opts.Host, strconv.Itoa(m.opts.Port))
+
+	// smtp.SendMail does not take a context, so the send is abandoned instead when the context is done
+	done := make(chan error, 1)
+	go func() {
+		done <- m.send(addr, auth, from.Address, to, data)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// encode encodes the message in the RFC 5322 format, with a quoted-printable text and HTML alternative.
+func encode(msg Message, date time.Time) ([]byte, error) {
+	if len(msg.To) == 0 {
+		return nil, errors.New("the message has no recipient")
+	}
+	if msg.Text == "" && msg.HTML == "" {
+		return nil, errors.New("the message has no body")
+	}
+	var b bytes.Buffer
+	// newlines would allow injecting headers
+	crlf := strings.NewReplacer("\r", "", "\n", "")
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%v: %v\r\n", name, crlf.Replace(value))
+	}
+	header("From", msg.From)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", crlf.Replace(msg.Subject)))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	part := func(contentType, body string) error {
+		header("Content-Type", contentType+"; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		w := quotedprintable.NewWriter(&b)
+		if _, err := w.Write([]byte(body)); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		b.WriteString("\r\n")
+		return nil
+	}
+	if msg.Text == "" || msg.HTML == "" {
+		contentType, body := "text/plain", msg.Text
+		if msg.HTML != "" {
+			contentType, body = "text/html", msg.HTML
+		}
+		if err := part(contentType, body); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	header("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", boundary))
+	b.WriteString("\r\n")
+	for _, p := range []struct{ contentType, body string }{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+		fmt.Fprintf(&b, "--%v\r\n", boundary)
+		if err := part(p.contentType, p.body); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintf(&b, "--%v--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// newBoundary returns a random MIME boundary.
+func newBoundary() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
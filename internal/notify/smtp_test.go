@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPMailer_Send(t *testing.T) {
+	var addr, from string
+	var to []string
+	var data []byte
+	var auth smtp.Auth
+	m := smtpMailer{
+		opts: SMTPOptions{Host: "smtp.test", Port: 587, Username: "user", Password: "pass", From: "App <noreply@app.test>"},
+		send: func(a string, au smtp.Auth, f string, t []string, d []byte) error {
+			addr, auth, from, to, data = a, au, f, t, d
+			return nil
+		},
+	}
+	err := m.Send(context.Background(), Message{To: []string{"Ann <ann@test.test>"}, Subject: "Hi", Text: "text", HTML: "<p>html</p>"})
+	assert.Nil(t, err)
+	assert.Equal(t, "smtp.test:587", addr)
+	assert.NotNil(t, auth)
+	assert.Equal(t, "noreply@app.test", from)
+	assert.Equal(t, []string{"ann@test.test"}, to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "App <noreply@app.test>", msg.Header.Get("From"))
+		assert.Equal(t, "Ann <ann@test.test>", msg.Header.Get("To"))
+	}
+
+	err = m.Send(context.Background(), Message{To: []string{"invalid"}, Subject: "Hi", Text: "text"})
+	assert.NotNil(t, err)
+
+	m.send = func(string, smtp.Auth, string, []string, []byte) error { return errors.New("unavailable") }
+	err = m.Send(context.Background(), Message{To: []string{"ann@test.test"}, Subject: "Hi", Text: "text"})
+	assert.EqualError(t, err, "unavailable")
+}
+
+func TestEncode(t *testing.T) {
+	date := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	data, err := encode(Message{
+		From:    "noreply@app.test",
+		To:      []string{"ann@test.test", "bob@test.test"},
+		Subject: "Contraseña\r\nBcc: eve@test.test",
+		Text:    "Hola, ¿qué tal?",
+		HTML:    "<p>Hola</p>",
+	}, date)
+	if !assert.Nil(t, err) {
+		return
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "", msg.Header.Get("Bcc"))
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.Equal(t, "ContraseñaBcc: eve@test.test", subject)
+	assert.Equal(t, "ann@test.test, bob@test.test", msg.Header.Get("To"))
+	d, _ := msg.Header.Date()
+	assert.True(t, date.Equal(d))
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Equal(t, "multipart/alternative", mediaType)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		buf := new(bytes.Buffer)
+		_, _ = buf.ReadFrom(p)
+		parts = append(parts, p.Header.Get("Content-Type")+": "+buf.String())
+	}
+	assert.Equal(t, []string{"text/plain; charset=utf-8: Hola, ¿qué tal?", "text/html; charset=utf-8: <p>Hola</p>"}, parts)
+
+	// a single body
+	data, err = encode(Message{To: []string{"ann@test.test"}, Subject: "Hi", Text: "text"}, date)
+	assert.Nil(t, err)
+	msg, _ = mail.ReadMessage(strings.NewReader(string(data)))
+	assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+
+	_, err = encode(Message{Subject: "Hi", Text: "text"}, date)
+	assert.NotNil(t, err)
+	_, err = encode(Message{To: []string{"ann@test.test"}, Subject: "Hi"}, date)
+	assert.NotNil(t, err)
+}
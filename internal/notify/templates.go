@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// the templates are stored as templates/<locale>/<name>.txt and templates/<locale>/<name>.html.
+// The text template defines the subject of the message as {{define "subject"}}...{{end}}.
+//
+//go:embed templates
+var templateFS embed.FS
+
+// Templates renders localized messages from templates.
+type Templates struct {
+	defaultLocale string
+	text          map[string]*texttemplate.Template
+	html          map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parses the templates embedded in the package. Messages in locales without templates
+// are rendered in defaultLocale, which must have a template for every message.
+func LoadTemplates(defaultLocale string) (*Templates, error) {
+	return ParseTemplates(templateFS, defaultLocale)
+}
+
+// ParseTemplates parses the templates found in the "templates" directory of fsys.
+func ParseTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: strings.ToLower(defaultLocale),
+		text:          map[string]*texttemplate.Template{},
+		html:          map[string]*htmltemplate.Template{},
+	}
+	files, err := fs.Glob(fsys, "templates/*/*")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		locale := strings.ToLower(path.Base(path.Dir(file)))
+		ext := path.Ext(file)
+		key := locale + "/" + strings.TrimSuffix(path.Base(file), ext)
+		switch ext {
+		case ".txt":
+			tmpl, err := texttemplate.ParseFS(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			if tmpl.Lookup("subject") == nil {
+				return nil, fmt.Errorf("template %v does not define the subject", file)
+			}
+			t.text[key] = tmpl
+		case ".html":
+			tmpl, err := htmltemplate.ParseFS(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			t.html[key] = tmpl
+		}
+	}
+	for key := range t.html {
+		if _, ok := t.text[key]; !ok {
+			return nil, fmt.Errorf("template %v has no text version", key)
+		}
+	}
+	for key := range t.text {
+		name := key[strings.Index(key, "/")+1:]
+		if _, ok := t.text[t.defaultLocale+"/"+name]; !ok {
+			return nil, fmt.Errorf("template %v is missing in the default locale %v", name, t.defaultLocale)
+		}
+	}
+	return t, nil
+}
+
+// Render renders the message of the given name in the given locale (e.g. "es" or "es-MX").
+// It falls back to the language of the locale, then to the default locale.
+// The recipients of the returned message are not set.
+func (t *Templates) Render(locale, name string, data interface{}) (Message, error) {
+	key := t.resolve(locale, name)
+	if key == "" {
+		return Message{}, fmt.Errorf("template %q does not exist", name)
+	}
+	var msg Message
+	var b bytes.Buffer
+	if err := t.text[key].ExecuteTemplate(&b, "subject", data); err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(b.String())
+	b.Reset()
+	if err := t.text[key].Execute(&b, data); err != nil {
+		return msg, err
+	}
+	msg.Text = strings.TrimSpace(b.String()) + "\n"
+	if tmpl, ok := t.html[key]; ok {
+		b.Reset()
+		if err := tmpl.Execute(&b, data); err != nil {
+			return msg, err
+		}
+		msg.HTML = b.String()
+	}
+	return msg, nil
+}
+
+// resolve returns the key of the template used for the given locale, or "" if the template does not exist.
+func (t *Templates) resolve(locale, name string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, t.defaultLocale)
+	for _, c := range candidates {
+		if _, ok := t.text[c+"/"+name]; ok {
+			return c + "/" + name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	templates, err := LoadTemplates("en")
+	if !assert.Nil(t, err) {
+		return
+	}
+	for _, locale := range []string{"en", "es"} {
+		for _, name := range []string{TemplateWelcome, TemplatePasswordReset, TemplateInvitation, TemplateVerification} {
+			msg, err := templates.Render(locale, name, Data{Name: "Ann", URL: "https://example.com/x", Inviter: "Bob", ExpiresIn: 72})
+			assert.Nil(t, err, "%v/%v", locale, name)
+			assert.NotEmpty(t, msg.Subject, "%v/%v", locale, name)
+			assert.Contains(t, msg.Text, "https://example.com/x", "%v/%v", locale, name)
+			assert.Contains(t, msg.HTML, `href="https://example.com/x"`, "%v/%v", locale, name)
+		}
+	}
+}
+
+func TestTemplates_Render(t *testing.T) {
+	templates, err := LoadTemplates("en")
+	if !assert.Nil(t, err) {
+		return
+	}
+	data := Data{Name: "<Ann>", URL: "https://example.com/reset?token=a&b"}
+
+	msg, err := templates.Render("en", TemplateWelcome, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "Welcome, <Ann>", msg.Subject)
+	assert.Contains(t, msg.Text, "Hi <Ann>,")
+	assert.Contains(t, msg.HTML, "Hi &lt;Ann&gt;,")
+	assert.Contains(t, msg.HTML, `href="https://example.com/reset?token=a&amp;b"`)
+
+	// the language of a regional locale
+	msg, _ = templates.Render("es-MX", TemplateWelcome, data)
+	assert.Equal(t, "Bienvenido, <Ann>", msg.Subject)
+	msg, _ = templates.Render("ES_es", TemplateWelcome, data)
+	assert.Equal(t, "Bienvenido, <Ann>", msg.Subject)
+
+	// the default locale
+	msg, _ = templates.Render("fr", TemplateWelcome, data)
+	assert.Equal(t, "Welcome, <Ann>", msg.Subject)
+	msg, _ = templates.Render("", TemplateWelcome, data)
+	assert.Equal(t, "Welcome, <Ann>", msg.Subject)
+
+	_, err = templates.Render("en", "unknown", data)
+	assert.NotNil(t, err)
+}
+
+func TestParseTemplates(t *testing.T) {
+	_, err := ParseTemplates(fstest.MapFS{
+		"templates/en/a.txt": {Data: []byte("no subject")},
+	}, "en")
+	assert.NotNil(t, err)
+
+	_, err = ParseTemplates(fstest.MapFS{
+		"templates/en/a.txt": {Data: []byte(`{{define "subject"}}a{{end}}a`)},
+		"templates/es/b.txt": {Data: []byte(`{{define "subject"}}b{{end}}b`)},
+	}, "en")
+	assert.NotNil(t, err, "b is missing in the default locale")
+
+	_, err = ParseTemplates(fstest.MapFS{
+		"templates/en/a.html": {Data: []byte(`a`)},
+	}, "en")
+	assert.NotNil(t, err, "a has no text version")
+
+	templates, err := ParseTemplates(fstest.MapFS{
+		"templates/en/a.txt": {Data: []byte(`{{define "subject"}} A {{end}}text`)},
+	}, "en")
+	if assert.Nil(t, err) {
+		msg, err := templates.Render("en", "a", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, Message{Subject: "A", Text: "text\n"}, msg)
+	}
+}
@@ -0,0 +1,128 @@
+package organization
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/log"
+	"backend/pkg/pagination"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler, auth.RequireRole(entity.RoleAdministrator))
+
+	// the following endpoints require a valid JWT of an administrator. Only the staff add users to the organizations:
+	// the administrators of an organization only replace the roles of its members, or remove them, as the users of
+	// the other organizations are out of reach
+	r.Get("/organizations/<id>", res.get)
+	r.Get("/organizations", res.query)
+	r.Post("/organizations", res.create)
+	r.Put("/organizations/<id>", res.update)
+	r.Delete("/organizations/<id>", res.delete)
+	r.Get("/organizations/<id>/members", res.members)
+	r.Put("/organizations/<id>/members/<userID>", res.saveMember)
+	r.Delete("/organizations/<id>/members/<userID>", res.removeMember)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	organization, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(organization)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	organizations, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = organizations
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input OrganizationRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	organization, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(organization, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input OrganizationRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	organization, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(organization)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	organization, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(organization)
+}
+
+func (r resource) members(c *routing.Context) error {
+	members, err := r.service.Members(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(members)
+}
+
+func (r resource) saveMember(c *routing.Context) error {
+	var input MemberRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	member, err := r.service.SaveMember(c.Request.Context(), c.Param("id"), c.Param("userID"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(member)
+}
+
+func (r resource) removeMember(c *routing.Context) error {
+	member, err := r.service.RemoveMember(c.Request.Context(), c.Param("id"), c.Param("userID"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(member)
+}
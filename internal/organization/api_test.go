@@ -0,0 +1,198 @@
+package organization
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	now := time.Now()
+	repo := &mockRepository{
+		items: []entity.Organization{
+			{ID: "org1", Name: "Acme", CreatedAt: now, UpdatedAt: now},
+			{ID: "org2", Name: "Globex", CreatedAt: now, UpdatedAt: now},
+		},
+		users: []string{"100", "101"},
+	}
+	RegisterHandlers(router.Group(""), NewService(repo, test.MockTransactional, &audit.MockRecorder{}, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/organizations", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get org1", "GET", "/organizations/org1", "", header, http.StatusOK, `*"name":"Acme"*`},
+		{"get unknown", "GET", "/organizations/org3", "", header, http.StatusNotFound, ""},
+		{"auth error", "GET", "/organizations", "", nil, http.StatusUnauthorized, ""},
+		{"create ok", "POST", "/organizations", `{"name":"Initech"}`, header, http.StatusCreated, `*"name":"Initech"*`},
+		{"create duplicate", "POST", "/organizations", `{"name":"Acme"}`, header, http.StatusConflict, ""},
+		{"create validation error", "POST", "/organizations", `{"name":""}`, header, http.StatusBadRequest, ""},
+		{"create input error", "POST", "/organizations", `"name"`, header, http.StatusBadRequest, ""},
+		{"update ok", "PUT", "/organizations/org2", `{"name":"Globex Corporation"}`, header, http.StatusOK, `*"name":"Globex Corporation"*`},
+		{"update unknown", "PUT", "/organizations/org3", `{"name":"Umbrella"}`, header, http.StatusNotFound, ""},
+		{"add member", "PUT", "/organizations/org1/members/100", `{"roles":["administrator"]}`, header, http.StatusOK, `*"roles":["administrator"]*`},
+		{"add unknown role", "PUT", "/organizations/org1/members/101", `{"roles":["unknown"]}`, header, http.StatusBadRequest, ""},
+		{"add unknown user", "PUT", "/organizations/org1/members/102", `{"roles":[]}`, header, http.StatusNotFound, ""},
+		{"get members", "GET", "/organizations/org1/members", "", header, http.StatusOK, `[{"organization_id":"org1","user_id":"100"*`},
+		{"remove member", "DELETE", "/organizations/org1/members/100", "", header, http.StatusOK, `*"user_id":"100"*`},
+		{"remove unknown member", "DELETE", "/organizations/org1/members/100", "", header, http.StatusNotFound, ""},
+		{"delete ok", "DELETE", "/organizations/org2", "", header, http.StatusOK, `*"id":"org2"*`},
+		{"delete unknown", "DELETE", "/organizations/org2", "", header, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestService_Tenant(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		items:   []entity.Organization{{ID: "org1", Name: "Acme"}, {ID: "org2", Name: "Initech"}},
+		members: []entity.Member{{OrganizationID: "org1", UserID: "101", Roles: []string{}}, {OrganizationID: "org2", UserID: "102", Roles: []string{}}},
+		users:   []string{"101", "102", "103"},
+	}
+	s := NewService(repo, test.MockTransactional, &audit.MockRecorder{}, logger)
+	ctx := dbcontext.WithTenant(context.Background(), "org1")
+
+	// the organizations are only created and deleted, and the users added to them, outside of any organization
+	_, err := s.Create(ctx, OrganizationRequest{Name: "Initech"})
+	assert.Equal(t, errors.Forbidden("Organizations cannot be created from within an organization."), err)
+	_, err = s.Delete(ctx, "org1")
+	assert.Equal(t, errors.Forbidden("Organizations cannot be deleted from within an organization."), err)
+	assert.Equal(t, 2, len(repo.items))
+	_, err = s.SaveMember(ctx, "org1", "103", MemberRequest{Roles: []string{}})
+	assert.Equal(t, errors.Forbidden("Users cannot be added to an organization from within an organization."), err)
+	_, err = s.SaveMember(ctx, "org1", "102", MemberRequest{Roles: []string{}})
+	assert.Equal(t, errors.Forbidden("Users cannot be added to an organization from within an organization."), err)
+
+	// the roles of the members are replaced, and the members removed, only within the organization
+	member, err := s.SaveMember(ctx, "org1", "101", MemberRequest{Roles: []string{entity.RoleFinancial}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{entity.RoleFinancial}, member.Roles)
+	_, err = s.SaveMember(ctx, "org2", "102", MemberRequest{Roles: []string{entity.RoleFinancial}})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.RemoveMember(ctx, "org2", "102")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.RemoveMember(ctx, "org1", "101")
+	assert.Nil(t, err)
+	assert.Equal(t, []entity.Member{{OrganizationID: "org2", UserID: "102", Roles: []string{}}}, repo.members)
+
+	// but they can be renamed
+	organization, err := s.Update(ctx, "org1", OrganizationRequest{Name: "Acme Corporation"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme Corporation", organization.Name)
+}
+
+type mockRepository struct {
+	items   []entity.Organization
+	members []entity.Member
+	// the IDs of the existing users
+	users []string
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Organization, error) {
+	if tenantID := dbcontext.Tenant(ctx); tenantID != "" && tenantID != id {
+		return entity.Organization{}, sql.ErrNoRows
+	}
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Organization{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Organization, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, organization entity.Organization) error {
+	for _, item := range m.items {
+		if item.Name == organization.Name {
+			return errors.Conflict("An organization with this name already exists.")
+		}
+	}
+	m.items = append(m.items, organization)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, organization entity.Organization) error {
+	for i, item := range m.items {
+		if item.ID == organization.ID {
+			m.items[i] = organization
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items = append(m.items[:i], m.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) GetMembers(ctx context.Context, id string) ([]entity.Member, error) {
+	members := []entity.Member{}
+	for _, member := range m.members {
+		if member.OrganizationID == id {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (m mockRepository) GetMember(ctx context.Context, id, userID string) (entity.Member, error) {
+	for _, member := range m.members {
+		if member.OrganizationID == id && member.UserID == userID {
+			return member, nil
+		}
+	}
+	return entity.Member{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) SaveMember(ctx context.Context, member entity.Member) error {
+	found := false
+	for _, id := range m.users {
+		found = found || id == member.UserID
+	}
+	if !found {
+		return sql.ErrNoRows
+	}
+	for _, role := range member.Roles {
+		if role == "unknown" {
+			return errors.BadRequest(`role "unknown" does not exist`)
+		}
+	}
+	_ = m.RemoveMember(ctx, member.OrganizationID, member.UserID)
+	m.members = append(m.members, member)
+	return nil
+}
+
+func (m *mockRepository) RemoveMember(ctx context.Context, id, userID string) error {
+	for i, member := range m.members {
+		if member.OrganizationID == id && member.UserID == userID {
+			m.members = append(m.members[:i], m.members[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
@@ -0,0 +1,274 @@
+package organization
+
+import (
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/lib/pq"
+)
+
+// Repository encapsulates the logic to access organizations and their members from the data source.
+// The organizations are scoped to the tenant of the context: only its own organization is found.
+type Repository interface {
+	// Get returns the organization with the specified ID.
+	Get(ctx context.Context, id string) (entity.Organization, error)
+	// Count returns the number of organizations.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of organizations with the given offset and limit, sorted by name.
+	Query(ctx context.Context, offset, limit int) ([]entity.Organization, error)
+	// Create saves a new organization in the storage.
+	Create(ctx context.Context, organization entity.Organization) error
+	// Update updates the organization with given ID in the storage.
+	Update(ctx context.Context, organization entity.Organization) error
+	// Delete removes the organization with given ID and its memberships from the storage.
+	Delete(ctx context.Context, id string) error
+	// GetMembers returns the members of the organization with the specified ID, with their roles within it.
+	GetMembers(ctx context.Context, id string) ([]entity.Member, error)
+	// GetMember returns the membership of the user with the specified ID in the organization with the specified ID.
+	GetMember(ctx context.Context, id, userID string) (entity.Member, error)
+	// SaveMember adds the user to the organization if they are not a member yet, and replaces their roles within it.
+	SaveMember(ctx context.Context, member entity.Member) error
+	// RemoveMember removes the user with the specified ID from the organization with the specified ID,
+	// along with their roles within it.
+	RemoveMember(ctx context.Context, id, userID string) error
+}
+
+// repository persists organizations in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new organization repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// scope selects the organization of the tenant of the context, if any.
+func scope(ctx context.Context) dbx.Expression {
+	return dbcontext.Scope(ctx, "organizations.id = {:tenant}")
+}
+
+// Get reads the organization with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Organization, error) {
+	var organization entity.Organization
+	err := r.db.With(ctx).Select().Where(scope(ctx)).Model(id, &organization)
+	return organization, err
+}
+
+// Count returns the number of the organization records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("organizations").Where(scope(ctx)).Row(&count)
+	return count, err
+}
+
+// Query retrieves the organization records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Organization, error) {
+	var organizations []entity.Organization
+	err := r.db.With(ctx).
+		Select().
+		Where(scope(ctx)).
+		OrderBy("name", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&organizations)
+	return organizations, err
+}
+
+// Create saves a new organization record in the database.
+func (r repository) Create(ctx context.Context, organization entity.Organization) error {
+	if err := r.checkName(ctx, organization.ID, organization.Name); err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&organization).Insert()
+}
+
+// Update saves the changes to an organization in the database.
+func (r repository) Update(ctx context.Context, organization entity.Organization) error {
+	if err := r.checkName(ctx, organization.ID, organization.Name); err != nil {
+		return err
+	}
+	_, err := r.db.With(ctx).Update("organizations", dbx.Params{
+		"name":       organization.Name,
+		"updated_at": organization.UpdatedAt,
+	}, dbx.And(dbx.HashExp{"id": organization.ID}, scope(ctx))).Execute()
+	return err
+}
+
+// Delete deletes the organization record with the specified ID from the database. The memberships and roles
+// within it are deleted along with it. A conflict error is returned if the organization still owns resources.
+func (r repository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("organizations", dbx.And(dbx.HashExp{"id": id}, scope(ctx))).Execute()
+	if e, ok := err.(*pq.Error); ok && e.Code == "23503" {
+		return errors.Conflict("The organization still owns resources, such as albums.")
+	}
+	return err
+}
+
+// GetMembers reads the members of an organization from the database, sorted by username.
+func (r repository) GetMembers(ctx context.Context, id string) ([]entity.Member, error) {
+	members := []entity.Member{}
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.members(ctx, dbx.HashExp{"ou.organization_id": id}).All(&members)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var roles []struct {
+		UserID string `db:"user_id"`
+		Name   string `db:"name"`
+	}
+	err = r.db.With(ctx).Select("ru.user_id", "r.name").
+		From("role_user as ru").
+		InnerJoin("roles as r", dbx.NewExp("r.id = ru.role_id")).
+		Where(dbx.HashExp{"ru.organization_id": id}).
+		OrderBy("r.name").
+		All(&roles)
+	if err != nil {
+		return nil, err
+	}
+	for i := range members {
+		members[i].Roles = []string{}
+		for _, role := range roles {
+			if role.UserID == members[i].UserID {
+				members[i].Roles = append(members[i].Roles, role.Name)
+			}
+		}
+	}
+	return members, nil
+}
+
+// GetMember reads the membership of a user in an organization from the database.
+func (r repository) GetMember(ctx context.Context, id, userID string) (entity.Member, error) {
+	var member entity.Member
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.members(ctx, dbx.HashExp{"ou.organization_id": id, "ou.user_id": userID}).One(&member)
+	})
+	if err != nil {
+		return member, err
+	}
+	member.Roles = []string{}
+	err = r.db.With(ctx).Select("r.name").
+		From("role_user as ru").
+		InnerJoin("roles as r", dbx.NewExp("r.id = ru.role_id")).
+		Where(dbx.HashExp{"ru.organization_id": id, "ru.user_id": userID}).
+		OrderBy("r.name").
+		Column(&member.Roles)
+	return member, err
+}
+
+// members returns the query selecting the memberships matching the condition, along with the usernames.
+// It must run in a transaction so that the row level security policies of the database let it find the users.
+func (r repository) members(ctx context.Context, condition dbx.Expression) *dbx.SelectQuery {
+	return r.db.With(ctx).Select("ou.organization_id", "ou.user_id", "u.username", "ou.created_at").
+		From("organization_user as ou").
+		InnerJoin("users as u", dbx.NewExp("u.id = ou.user_id")).
+		Where(dbx.And(condition, dbx.HashExp{"u.deleted_at": nil})).
+		OrderBy("u.username")
+}
+
+// SaveMember saves the membership of a user in an organization in the database, and replaces their roles
+// within it. sql.ErrNoRows is returned if the user does not exist, and a bad request error if one of the roles
+// does not exist.
+func (r repository) SaveMember(ctx context.Context, member entity.Member) error {
+	var count int
+	if err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select("COUNT(*)").From("users").
+			Where(dbx.HashExp{"id": member.UserID, "deleted_at": nil}).
+			Row(&count)
+	}); err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	var found []entity.Role
+	if len(member.Roles) > 0 {
+		names := make([]interface{}, len(member.Roles))
+		for i, role := range member.Roles {
+			names[i] = role
+		}
+		if err := r.db.With(ctx).Select().Where(dbx.In("name", names...)).All(&found); err != nil {
+			return err
+		}
+	}
+	for _, role := range member.Roles {
+		if !hasRole(found, role) {
+			return errors.BadRequest(fmt.Sprintf("role %q does not exist", role))
+		}
+	}
+
+	if _, err := r.db.With(ctx).NewQuery("INSERT INTO organization_user (organization_id, user_id, created_at) " +
+		"VALUES ({:organization}, {:user}, {:now}) ON CONFLICT DO NOTHING").
+		Bind(dbx.Params{"organization": member.OrganizationID, "user": member.UserID, "now": time.Now()}).
+		Execute(); err != nil {
+		return err
+	}
+	if _, err := r.db.With(ctx).Delete("role_user", dbx.HashExp{
+		"organization_id": member.OrganizationID,
+		"user_id":         member.UserID,
+	}).Execute(); err != nil {
+		return err
+	}
+	for _, role := range found {
+		if _, err := r.db.With(ctx).Insert("role_user", dbx.Params{
+			"user_id":         member.UserID,
+			"role_id":         role.ID,
+			"organization_id": member.OrganizationID,
+		}).Execute(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMember deletes the membership of a user in an organization and their roles within it from the database.
+// sql.ErrNoRows is returned if the user is not a member of the organization.
+func (r repository) RemoveMember(ctx context.Context, id, userID string) error {
+	condition := dbx.HashExp{"organization_id": id, "user_id": userID}
+	if _, err := r.db.With(ctx).Delete("role_user", condition).Execute(); err != nil {
+		return err
+	}
+	res, err := r.db.With(ctx).Delete("organization_user", condition).Execute()
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// checkName returns an error if the name is used by an organization other than the one with the given ID.
+func (r repository) checkName(ctx context.Context, id, name string) error {
+	var count int
+	if err := r.db.With(ctx).Select("COUNT(*)").From("organizations").
+		Where(dbx.And(dbx.HashExp{"name": name}, dbx.Not(dbx.HashExp{"id": id}))).
+		Row(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.Conflict("An organization with this name already exists.")
+	}
+	return nil
+}
+
+// hasRole reports whether the role with the given name is among the roles.
+func hasRole(roles []entity.Role, name string) bool {
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
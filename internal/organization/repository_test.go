@@ -0,0 +1,100 @@
+package organization
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "organizations", "users", "roles")
+	repo := NewRepository(db, logger)
+
+	// the users are subject to the row level security policies of the database
+	ctx := dbcontext.Unscoped(context.Background())
+	now := time.Now()
+
+	// create
+	for _, organization := range []entity.Organization{
+		{ID: "org1", Name: "Acme", CreatedAt: now, UpdatedAt: now},
+		{ID: "org2", Name: "Globex", CreatedAt: now, UpdatedAt: now},
+	} {
+		assert.Nil(t, repo.Create(ctx, organization))
+	}
+	err := repo.Create(ctx, entity.Organization{ID: "org3", Name: "Acme", CreatedAt: now, UpdatedAt: now})
+	assert.Equal(t, errors.Conflict("An organization with this name already exists."), err)
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// a tenant only finds its own organization
+	tenant := dbcontext.WithTenant(ctx, "org1")
+	count, _ = repo.Count(tenant)
+	assert.Equal(t, 1, count)
+	_, err = repo.Get(tenant, "org2")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	organization, err := repo.Get(ctx, "org2")
+	assert.Nil(t, err)
+	organization.Name = "Globex Corporation"
+	assert.Nil(t, repo.Update(ctx, organization))
+	organizations, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(organizations)) {
+		assert.Equal(t, "Globex Corporation", organizations[1].Name)
+	}
+
+	// members
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		return db.With(ctx).Model(&entity.User{ID: "100", Username: "ann", IsActive: true, CreatedAt: now, UpdatedAt: &now, Version: 1}).Insert()
+	})
+	assert.Nil(t, err)
+	_, err = db.With(ctx).Insert("roles", dbx.Params{"id": "role1", "name": entity.RoleAdministrator}).Execute()
+	assert.Nil(t, err)
+	assert.Equal(t, sql.ErrNoRows, repo.SaveMember(ctx, entity.Member{OrganizationID: "org1", UserID: "101"}))
+	err = repo.SaveMember(ctx, entity.Member{OrganizationID: "org1", UserID: "100", Roles: []string{"unknown"}})
+	assert.Equal(t, errors.BadRequest(`role "unknown" does not exist`), err)
+	assert.Nil(t, repo.SaveMember(ctx, entity.Member{OrganizationID: "org1", UserID: "100", Roles: []string{entity.RoleAdministrator}}))
+	assert.Nil(t, repo.SaveMember(ctx, entity.Member{OrganizationID: "org2", UserID: "100", Roles: []string{}}))
+	member, err := repo.GetMember(ctx, "org1", "100")
+	assert.Nil(t, err)
+	assert.Equal(t, "ann", member.Username)
+	assert.Equal(t, []string{entity.RoleAdministrator}, member.Roles)
+	members, err := repo.GetMembers(ctx, "org2")
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(members)) {
+		assert.Equal(t, []string{}, members[0].Roles)
+	}
+	assert.Nil(t, repo.RemoveMember(ctx, "org2", "100"))
+	assert.Equal(t, sql.ErrNoRows, repo.RemoveMember(ctx, "org2", "100"))
+
+	// the removed user can no longer log in to the organization, whose administrators no longer find them
+	organizationIDs, err := auth.NewRepository(db, logger).GetOrganizations(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"org1"}, organizationIDs)
+	_, err = repo.GetMember(dbcontext.WithTenant(ctx, "org2"), "org2", "100")
+	assert.Equal(t, sql.ErrNoRows, err)
+	members, err = repo.GetMembers(dbcontext.WithTenant(ctx, "org2"), "org2")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(members))
+
+	// delete
+	assert.Nil(t, repo.Delete(ctx, "org1"))
+	_, err = repo.GetMember(ctx, "org1", "100")
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, _ = repo.Count(ctx)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,246 @@
+// Package organization manages the organizations, i.e. the client companies the backend is run for, and their members.
+//
+// The users log in to one of the organizations they are a member of. Their JWT carries its ID in the "tid" claim,
+// the queries of their requests are scoped to it, and they are granted the roles they have within it, along with
+// the roles granted in all the organizations. Only the staff running the backend, who are granted the staff role
+// outside of any organization, are not scoped: only they can create and delete organizations, and add users to them.
+// Within an organization, its administrators can only manage the roles of its members, or remove them.
+package organization
+
+import (
+	"backend/internal/audit"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Service encapsulates usecase logic for organizations.
+type Service interface {
+	Get(ctx context.Context, id string) (entity.Organization, error)
+	Query(ctx context.Context, offset, limit int) ([]entity.Organization, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input OrganizationRequest) (entity.Organization, error)
+	Update(ctx context.Context, id string, input OrganizationRequest) (entity.Organization, error)
+	Delete(ctx context.Context, id string) (entity.Organization, error)
+	// Members returns the members of the organization with the specified ID, with their roles within it.
+	Members(ctx context.Context, id string) ([]entity.Member, error)
+	// SaveMember adds a user to the organization with the specified ID, or replaces their roles within it.
+	SaveMember(ctx context.Context, id, userID string, input MemberRequest) (entity.Member, error)
+	// RemoveMember removes a user from the organization with the specified ID.
+	RemoveMember(ctx context.Context, id, userID string) (entity.Member, error)
+}
+
+// OrganizationRequest represents an organization creation or update request.
+type OrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+// Validate validates the OrganizationRequest fields.
+func (m OrganizationRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 100)),
+	)
+}
+
+// MemberRequest represents a request to add a user to an organization, or to replace their roles within it.
+type MemberRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// Validate validates the MemberRequest fields.
+func (m MemberRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Roles, validation.NotNil, validation.Each(validation.Required, validation.Length(0, 50))),
+	)
+}
+
+const (
+	// entityType identifies organizations in the audit log.
+	entityType = "organization"
+	// memberEntityType identifies memberships in the audit log. Their ID is "<organization ID>/<user ID>".
+	memberEntityType = "organization_member"
+)
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	logger        log.Logger
+}
+
+// NewService creates a new organization service.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, recorder audit.Recorder, logger log.Logger) Service {
+	return service{repo, transactional, recorder, logger}
+}
+
+// Get returns the organization with the specified ID.
+func (s service) Get(ctx context.Context, id string) (entity.Organization, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Count returns the number of organizations.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the organizations with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]entity.Organization, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []entity.Organization{}
+	}
+	return items, nil
+}
+
+// Create creates a new organization. The organizations cannot be created from within one.
+func (s service) Create(ctx context.Context, req OrganizationRequest) (entity.Organization, error) {
+	if err := req.Validate(); err != nil {
+		return entity.Organization{}, err
+	}
+	if dbcontext.Tenant(ctx) != "" {
+		return entity.Organization{}, errors.Forbidden("Organizations cannot be created from within an organization.")
+	}
+	now := time.Now()
+	organization := entity.Organization{
+		ID:        entity.GenerateID(),
+		Name:      req.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, organization); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionCreate, entityType, organization.ID, nil, organization)
+	})
+	if err != nil {
+		return entity.Organization{}, err
+	}
+	return organization, nil
+}
+
+// Update renames the organization with the specified ID.
+func (s service) Update(ctx context.Context, id string, req OrganizationRequest) (entity.Organization, error) {
+	if err := req.Validate(); err != nil {
+		return entity.Organization{}, err
+	}
+	var organization entity.Organization
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		organization = before
+		organization.Name = req.Name
+		organization.UpdatedAt = time.Now()
+		if err := s.repo.Update(ctx, organization); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, before, organization)
+	})
+	if err != nil {
+		return entity.Organization{}, err
+	}
+	return organization, nil
+}
+
+// Delete deletes the organization with the specified ID and the memberships in it. The organizations cannot
+// be deleted from within one.
+func (s service) Delete(ctx context.Context, id string) (entity.Organization, error) {
+	if dbcontext.Tenant(ctx) != "" {
+		return entity.Organization{}, errors.Forbidden("Organizations cannot be deleted from within an organization.")
+	}
+	var organization entity.Organization
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if organization, err = s.repo.Get(ctx, id); err != nil {
+			return err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionDelete, entityType, id, organization, nil)
+	})
+	if err != nil {
+		return entity.Organization{}, err
+	}
+	return organization, nil
+}
+
+// Members returns the members of the organization with the specified ID.
+func (s service) Members(ctx context.Context, id string) ([]entity.Member, error) {
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetMembers(ctx, id)
+}
+
+// SaveMember adds the user with the specified ID to the organization with the specified ID if they are not
+// a member yet, and replaces their roles within it. From within an organization, only the roles of its members
+// can be replaced: the users cannot be added to it, which could otherwise reach the users of the other organizations.
+func (s service) SaveMember(ctx context.Context, id, userID string, req MemberRequest) (entity.Member, error) {
+	if err := req.Validate(); err != nil {
+		return entity.Member{}, err
+	}
+	var member entity.Member
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.Get(ctx, id); err != nil {
+			return err
+		}
+		action := audit.ActionUpdate
+		var before interface{}
+		current, err := s.repo.GetMember(ctx, id, userID)
+		if err == sql.ErrNoRows && dbcontext.Tenant(ctx) != "" {
+			return errors.Forbidden("Users cannot be added to an organization from within an organization.")
+		} else if err == sql.ErrNoRows {
+			action = audit.ActionCreate
+		} else if err != nil {
+			return err
+		} else {
+			before = current
+		}
+		if err := s.repo.SaveMember(ctx, entity.Member{OrganizationID: id, UserID: userID, Roles: req.Roles}); err != nil {
+			return err
+		}
+		if member, err = s.repo.GetMember(ctx, id, userID); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, action, memberEntityType, id+"/"+userID, before, member)
+	})
+	if err != nil {
+		return entity.Member{}, err
+	}
+	return member, nil
+}
+
+// RemoveMember removes the user with the specified ID from the organization with the specified ID,
+// along with their roles within it.
+func (s service) RemoveMember(ctx context.Context, id, userID string) (entity.Member, error) {
+	var member entity.Member
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.Get(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		if member, err = s.repo.GetMember(ctx, id, userID); err != nil {
+			return err
+		}
+		if err := s.repo.RemoveMember(ctx, id, userID); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionDelete, memberEntityType, id+"/"+userID, member, nil)
+	})
+	if err != nil {
+		return entity.Member{}, err
+	}
+	return member, nil
+}
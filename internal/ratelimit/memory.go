@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store removes the buckets that are full again.
+const sweepInterval = time.Minute
+
+// memoryStore keeps token buckets in memory. It is only suitable for a single server instance.
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+// NewMemoryStore creates a Store which keeps the token buckets in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: map[string]*memoryBucket{}, now: time.Now}
+}
+
+// Take takes a token from the bucket identified by the given key.
+func (s *memoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: newBucket(limit, now)}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	return b.take(limit, now), nil
+}
+
+// sweep removes the buckets which have been refilled completely.
+func (s *memoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.full(b.limit, now) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,94 @@
+// Package ratelimit provides a token-bucket rate limiting middleware.
+package ratelimit
+
+import (
+	"backend/internal/auth"
+	"backend/internal/errors"
+	"backend/pkg/log"
+	"backend/pkg/realip"
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// Rule applies a limit to the requests whose path starts with Prefix.
+type Rule struct {
+	// the name of the rule. Requests matching different rules are counted separately
+	Name string
+	// the route path prefix (e.g. "/v1/login") the rule applies to
+	Prefix string
+	Limit
+}
+
+type contextKey int
+
+const (
+	appliedKey contextKey = iota
+)
+
+// Handler returns a middleware that limits the rate of requests according to the rule with the longest
+// matching path prefix. Requests matching no rule are not limited.
+//
+// Requests are counted per authenticated user if the identity is known (see auth.CurrentUser), and per client IP
+// (see realip.FromContext) otherwise. The middleware can be installed several times along a route; only the first
+// one counts the request.
+//
+// The current state of the limit is reported with the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers. Requests over the limit fail with HTTP 429. If the store fails, the request is let through.
+func Handler(store Store, rules []Rule, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		ctx := c.Request.Context()
+		if applied, _ := ctx.Value(appliedKey).(bool); applied {
+			return nil
+		}
+		rule, ok := match(rules, c.Request.URL.Path)
+		if !ok {
+			return nil
+		}
+		c.Request = c.Request.WithContext(context.WithValue(ctx, appliedKey, true))
+
+		res, err := store.Take(ctx, rule.Name+":"+clientKey(ctx), rule.Limit)
+		if err != nil {
+			logger.With(ctx).Errorf("failed to check rate limit: %v", err)
+			return nil
+		}
+
+		header := c.Response.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(rule.Burst))
+		header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+		if !res.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			return errors.TooManyRequests("")
+		}
+		return nil
+	}
+}
+
+// match returns the rule with the longest prefix matching the given path.
+func match(rules []Rule, path string) (Rule, bool) {
+	var matched Rule
+	found := false
+	for _, rule := range rules {
+		if strings.HasPrefix(path, rule.Prefix) && (!found || len(rule.Prefix) > len(matched.Prefix)) {
+			matched, found = rule, true
+		}
+	}
+	return matched, found
+}
+
+// clientKey identifies the client a request is counted against.
+func clientKey(ctx context.Context) string {
+	if identity := auth.CurrentUser(ctx); identity != nil {
+		return "user:" + identity.GetID()
+	}
+	return "ip:" + realip.FromContext(ctx)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
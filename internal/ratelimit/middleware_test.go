@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"backend/internal/auth"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"backend/pkg/realip"
+	"context"
+	"errors"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	limiter := Handler(NewMemoryStore(), []Rule{
+		{Name: "api", Prefix: "/v1", Limit: Limit{Rate: 0.001, Burst: 2}},
+		{Name: "login", Prefix: "/v1/login", Limit: Limit{Rate: 0.001, Burst: 1}},
+	}, logger)
+	router.Use(realip.Handler(nil))
+	ok := func(c *routing.Context) error { return c.Write("ok") }
+	// the public routes are limited before their handlers, and the authenticated ones after the authentication,
+	// as set up by the server
+	authenticate := func(c *routing.Context) error {
+		username := c.Request.Header.Get("Authorization")
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), "id-"+username, username, "", nil, true))
+		return nil
+	}
+	router.Post("/v1/login", limiter, ok)
+	router.Get("/v1/albums", authenticate, limiter, ok)
+	router.Get("/v1/users", limiter, limiter, ok)
+	router.Get("/healthcheck", limiter, ok)
+
+	ann := http.Header{"Authorization": []string{"ann"}}
+	bob := http.Header{"Authorization": []string{"bob"}}
+	tests := []test.APITestCase{
+		{"login ok", "POST", "/v1/login", "", nil, http.StatusOK, ""},
+		{"login limited", "POST", "/v1/login", "", nil, http.StatusTooManyRequests, "*too many requests*"},
+		{"per user", "GET", "/v1/albums", "", ann, http.StatusOK, ""},
+		{"per user again", "GET", "/v1/albums", "", ann, http.StatusOK, ""},
+		{"per user limited", "GET", "/v1/albums", "", ann, http.StatusTooManyRequests, ""},
+		{"other user from the same ip", "GET", "/v1/albums", "", bob, http.StatusOK, ""},
+		{"counted once", "GET", "/v1/users", "", nil, http.StatusOK, ""},
+		{"counted once again", "GET", "/v1/users", "", nil, http.StatusOK, ""},
+		{"ip limited", "GET", "/v1/users", "", nil, http.StatusTooManyRequests, ""},
+		{"no rule", "GET", "/healthcheck", "", nil, http.StatusOK, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestHandler_Headers(t *testing.T) {
+	logger, _ := log.NewForTest()
+	limiter := Handler(NewMemoryStore(), []Rule{{Name: "api", Prefix: "/", Limit: Limit{Rate: 1, Burst: 1}}}, logger)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	assert.Nil(t, limiter(routing.NewContext(res, req)))
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Reset"))
+
+	res = httptest.NewRecorder()
+	assert.NotNil(t, limiter(routing.NewContext(res, req)))
+	assert.Equal(t, "1", res.Header().Get("Retry-After"))
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("store failure")
+}
+
+func TestHandler_StoreFailure(t *testing.T) {
+	logger, entries := log.NewForTest()
+	limiter := Handler(failingStore{}, []Rule{{Name: "api", Prefix: "/", Limit: Limit{Rate: 1, Burst: 1}}}, logger)
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	assert.Nil(t, limiter(routing.NewContext(httptest.NewRecorder(), req)))
+	assert.Equal(t, 1, entries.Len())
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"backend/pkg/dbcontext"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// postgresStore keeps token buckets in the rate_limit_buckets table so that the limits are shared by all server instances.
+type postgresStore struct {
+	db *dbcontext.DB
+}
+
+// NewPostgresStore creates a Store which keeps the token buckets in the database.
+func NewPostgresStore(db *dbcontext.DB) Store {
+	return postgresStore{db}
+}
+
+// Take takes a token from the bucket identified by the given key.
+// The bucket row is locked for the duration of the update so that concurrent requests are counted correctly.
+func (s postgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	var res Result
+	err := s.db.Transactional(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		b := newBucket(limit, now)
+		if _, err := s.db.With(ctx).NewQuery(
+			"INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES ({:key}, {:tokens}, {:now}) ON CONFLICT (key) DO NOTHING",
+		).Bind(dbx.Params{"key": key, "tokens": b.tokens, "now": now}).Execute(); err != nil {
+			return err
+		}
+		if err := s.db.With(ctx).NewQuery(
+			"SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = {:key} FOR UPDATE",
+		).Bind(dbx.Params{"key": key}).Row(&b.tokens, &b.updatedAt); err != nil {
+			return err
+		}
+		res = b.take(limit, now)
+		_, err := s.db.With(ctx).Update("rate_limit_buckets",
+			dbx.Params{"tokens": b.tokens, "updated_at": b.updatedAt},
+			dbx.HashExp{"key": key},
+		).Execute()
+		return err
+	})
+	return res, err
+}
+
+// PurgeBuckets deletes the token buckets of the Postgres store that have not been used since the given time.
+// A bucket left unused long enough to be refilled is equivalent to a missing one.
+func PurgeBuckets(ctx context.Context, db *dbcontext.DB, before time.Time) (int64, error) {
+	res, err := db.With(ctx).Delete("rate_limit_buckets", dbx.NewExp("updated_at < {:before}", dbx.Params{"before": before})).Execute()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit represents the capacity of a token bucket.
+type Limit struct {
+	// the number of tokens added to the bucket per second
+	Rate float64
+	// the maximum number of tokens the bucket can hold, i.e. the size of a burst of requests
+	Burst int
+}
+
+// Result represents the outcome of taking a token from a bucket.
+type Result struct {
+	// whether a token was available
+	Allowed bool
+	// the number of tokens left in the bucket
+	Remaining int
+	// the time until the bucket is full again
+	ResetAfter time.Duration
+	// the time until the next token is available. Zero if the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of the token buckets.
+type Store interface {
+	// Take takes a token from the bucket identified by the given key, creating the bucket if it does not exist.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is the state of a token bucket.
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// newBucket returns a full bucket.
+func newBucket(limit Limit, now time.Time) bucket {
+	return bucket{tokens: float64(limit.Burst), updatedAt: now}
+}
+
+// take refills the bucket according to the time elapsed since its last update and takes a token if one is available.
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	if elapsed := now.Sub(b.updatedAt).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	}
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	res := Result{
+		Allowed:    allowed,
+		Remaining:  int(b.tokens),
+		ResetAfter: secondsToDuration((float64(limit.Burst) - b.tokens) / limit.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / limit.Rate)
+	}
+	return res
+}
+
+// full reports whether the bucket would be full at the given time, in which case it is safe to forget it.
+func (b *bucket) full(limit Limit, now time.Time) bool {
+	return b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate >= float64(limit.Burst)
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
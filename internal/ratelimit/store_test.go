@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_bucket_take(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+	b := newBucket(limit, now)
+
+	res := b.take(limit, now)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1, ResetAfter: time.Second}, res)
+	res = b.take(limit, now)
+	assert.Equal(t, Result{Allowed: true, Remaining: 0, ResetAfter: 2 * time.Second}, res)
+	res = b.take(limit, now.Add(500*time.Millisecond))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	// refilled after one second
+	res = b.take(limit, now.Add(time.Second))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// never more than the burst
+	assert.True(t, b.full(limit, now.Add(time.Hour)))
+	res = b.take(limit, now.Add(time.Hour))
+	assert.Equal(t, 1, res.Remaining)
+}
+
+func Test_memoryStore(t *testing.T) {
+	s := NewMemoryStore().(*memoryStore)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	res, err := s.Take(ctx, "a", limit)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	res, _ = s.Take(ctx, "a", limit)
+	assert.False(t, res.Allowed)
+	res, _ = s.Take(ctx, "b", limit)
+	assert.True(t, res.Allowed)
+	assert.Len(t, s.buckets, 2)
+
+	// full buckets are removed by the sweep
+	now = now.Add(2 * sweepInterval)
+	res, _ = s.Take(ctx, "a", limit)
+	assert.True(t, res.Allowed)
+	assert.Len(t, s.buckets, 1)
+}
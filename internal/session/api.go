@@ -0,0 +1,83 @@
+package session
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// othersID is the session ID that stands for all the sessions of the current user but the session of the request.
+const othersID = "others"
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Get("/me/sessions", res.list)
+	r.Delete("/me/sessions/<id>", auth.DenyImpersonation, res.revoke)
+	r.Get("/users/<id>/sessions", auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant, res.listUser)
+	r.Delete("/users/<id>/sessions/<sid>", auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant, res.revokeUser)
+	r.Delete("/users/<id>/sessions", auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant, res.revokeAll)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) list(c *routing.Context) error {
+	sessions, err := r.service.List(c.Request.Context())
+	if err != nil {
+		return err
+	}
+
+	return c.Write(sessions)
+}
+
+// revoke revokes a session of the current user, or all their other sessions if the ID is "others".
+func (r resource) revoke(c *routing.Context) error {
+	if c.Param("id") == othersID {
+		sessions, err := r.service.RevokeOthers(c.Request.Context())
+		if err != nil {
+			return err
+		}
+		return c.Write(sessions)
+	}
+	session, err := r.service.Revoke(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(session)
+}
+
+func (r resource) listUser(c *routing.Context) error {
+	sessions, err := r.service.ListUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(sessions)
+}
+
+func (r resource) revokeUser(c *routing.Context) error {
+	session, err := r.service.RevokeUser(c.Request.Context(), c.Param("id"), c.Param("sid"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(session)
+}
+
+func (r resource) revokeAll(c *routing.Context) error {
+	sessions, err := r.service.RevokeAll(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(sessions)
+}
@@ -0,0 +1,154 @@
+package session
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	repo := &mockRepository{items: []entity.Session{
+		{ID: "1", UserID: "100", Device: "Firefox on Linux", LastSeenAt: now, ExpiresAt: expiresAt},
+		{ID: "2", UserID: "100", Device: "Safari on iOS", LastSeenAt: now, ExpiresAt: expiresAt},
+		{ID: "3", UserID: "100", Device: "Chrome on Windows", LastSeenAt: now, ExpiresAt: expiresAt},
+		{ID: "4", UserID: "101", Device: "Edge on Windows", LastSeenAt: now, ExpiresAt: expiresAt},
+		{ID: "5", UserID: "101", Device: "Chrome on Android", LastSeenAt: now, ExpiresAt: expiresAt},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, test.MockTransactional, &audit.MockRecorder{}, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"list", "GET", "/me/sessions", "", header, http.StatusOK, `*"device":"Safari on iOS"*`},
+		{"list auth error", "GET", "/me/sessions", "", nil, http.StatusUnauthorized, ""},
+		{"revoke", "DELETE", "/me/sessions/2", "", header, http.StatusOK, `*"revoked_at":"*`},
+		{"revoke again", "DELETE", "/me/sessions/2", "", header, http.StatusConflict, ""},
+		{"revoke of another user", "DELETE", "/me/sessions/4", "", header, http.StatusNotFound, ""},
+		{"revoke others", "DELETE", "/me/sessions/others", "", header, http.StatusOK, `*"id":"3"*`},
+		{"list user", "GET", "/users/101/sessions", "", header, http.StatusOK, `*"device":"Edge on Windows"*`},
+		{"revoke user session", "DELETE", "/users/101/sessions/4", "", header, http.StatusOK, `*"id":"4"*`},
+		{"revoke session of another user", "DELETE", "/users/101/sessions/1", "", header, http.StatusNotFound, ""},
+		{"revoke all", "DELETE", "/users/101/sessions", "", header, http.StatusOK, `*"id":"5"*`},
+		{"list user after revoke", "GET", "/users/101/sessions", "", header, http.StatusOK, `[]`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	recorder := &audit.MockRecorder{}
+	s := NewService(repo, test.MockTransactional, recorder, logger)
+	ctx := auth.WithUser(context.Background(), "100", "tester", "tester@test.test", nil, true)
+	expiresAt := time.Now().Add(time.Hour)
+
+	current, err := s.Create(ctx, "100", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0", "10.0.0.1", expiresAt)
+	assert.Nil(t, err)
+	other, err := s.Create(ctx, "100", "curl/8.4.0", "10.0.0.2", expiresAt)
+	assert.Nil(t, err)
+	assert.Equal(t, "Firefox on Linux", repo.items[0].Device)
+	assert.Equal(t, "curl", repo.items[1].Device)
+
+	// the session of the request is marked as current, and is kept when the others are revoked
+	ctx = auth.WithSession(ctx, current)
+	sessions, err := s.List(ctx)
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(sessions)) {
+		assert.True(t, sessions[0].Current)
+		assert.False(t, sessions[1].Current)
+	}
+	assert.Nil(t, s.Check(ctx, other, "100"))
+	revoked, err := s.RevokeOthers(ctx)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(revoked)) {
+		assert.Equal(t, other, revoked[0].ID)
+	}
+	assert.Equal(t, 1, len(recorder.Entries))
+
+	// revoked, expired and foreign sessions are rejected
+	assert.Equal(t, errors.Unauthorized(""), s.Check(ctx, other, "100"))
+	assert.Equal(t, errors.Unauthorized(""), s.Check(ctx, current, "101"))
+	assert.Equal(t, errors.Unauthorized(""), s.Check(ctx, "unknown", "100"))
+	assert.Nil(t, s.Check(ctx, current, "100"))
+	repo.items[0].ExpiresAt = time.Now().Add(-time.Minute)
+	assert.Equal(t, errors.Unauthorized(""), s.Check(ctx, current, "100"))
+}
+
+func TestDevice(t *testing.T) {
+	tests := []struct {
+		userAgent, device string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46", "Edge on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36", "Chrome on macOS"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"", "Unknown device"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.device, device(tc.userAgent), tc.userAgent)
+	}
+}
+
+type mockRepository struct {
+	items []entity.Session
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Session, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Session{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Query(ctx context.Context, userID string, now time.Time) ([]entity.Session, error) {
+	var items []entity.Session
+	for _, item := range m.items {
+		if item.UserID == userID && item.IsActive(now) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, session entity.Session) error {
+	m.items = append(m.items, session)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, session entity.Session) error {
+	for i, item := range m.items {
+		if item.ID == session.ID {
+			m.items[i] = session
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i].LastSeenAt = at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access sessions from the data source.
+type Repository interface {
+	// Get returns the session with the specified ID.
+	Get(ctx context.Context, id string) (entity.Session, error)
+	// Query returns the sessions of the user with the specified ID that are active at the given time,
+	// the most recently seen first.
+	Query(ctx context.Context, userID string, now time.Time) ([]entity.Session, error)
+	// Create saves a new session in the storage.
+	Create(ctx context.Context, session entity.Session) error
+	// Update updates the session with given ID in the storage.
+	Update(ctx context.Context, session entity.Session) error
+	// Touch sets the time the session with the specified ID was last seen.
+	Touch(ctx context.Context, id string, at time.Time) error
+	// Purge removes the sessions that expired before the given time and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// repository persists sessions in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new session repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the session with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Session, error) {
+	var session entity.Session
+	err := r.db.With(ctx).Select().Model(id, &session)
+	return session, err
+}
+
+// Query retrieves the active session records of a user from the database.
+func (r repository) Query(ctx context.Context, userID string, now time.Time) ([]entity.Session, error) {
+	var sessions []entity.Session
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"user_id": userID, "revoked_at": nil}).
+		AndWhere(dbx.NewExp("expires_at > {:now}", dbx.Params{"now": now})).
+		OrderBy("last_seen_at DESC", "id").
+		All(&sessions)
+	return sessions, err
+}
+
+// Create saves a new session record in the database.
+func (r repository) Create(ctx context.Context, session entity.Session) error {
+	return r.db.With(ctx).Model(&session).Insert()
+}
+
+// Update saves the changes to a session in the database.
+func (r repository) Update(ctx context.Context, session entity.Session) error {
+	return r.db.With(ctx).Model(&session).Update()
+}
+
+// Touch updates the last seen time of a session record in the database.
+func (r repository) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("sessions", dbx.Params{"last_seen_at": at}, dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// Purge deletes the expired sessions from the database.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.With(ctx).Delete("sessions", dbx.NewExp("expires_at < {:before}", dbx.Params{"before": before})).Execute()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "users")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+	// the users are subject to the row level security policies of the database
+	err := db.Transactional(dbcontext.Unscoped(ctx), func(ctx context.Context) error {
+		return db.With(ctx).Model(&entity.User{
+			ID:        "100",
+			Username:  "tester",
+			Password:  "secret",
+			Email:     "tester@test.test",
+			CreatedAt: now,
+			UpdatedAt: &now,
+			Version:   1,
+		}).Insert()
+	})
+	assert.Nil(t, err)
+
+	// create
+	for _, id := range []string{"test1", "test2", "test3"} {
+		err = repo.Create(ctx, entity.Session{
+			ID:         id,
+			UserID:     "100",
+			Device:     "Firefox on Linux",
+			CreatedAt:  now,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(time.Hour),
+		})
+		assert.Nil(t, err)
+	}
+
+	// get
+	session, err := repo.Get(ctx, "test1")
+	assert.Nil(t, err)
+	assert.Equal(t, "Firefox on Linux", session.Device)
+	_, err = repo.Get(ctx, "unknown")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	session.RevokedAt = &now
+	assert.Nil(t, repo.Update(ctx, session))
+	assert.Nil(t, repo.Touch(ctx, "test3", now.Add(time.Minute)))
+
+	// query
+	sessions, err := repo.Query(ctx, "100", now)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(sessions)) {
+		assert.Equal(t, "test3", sessions[0].ID)
+	}
+	sessions, err = repo.Query(ctx, "100", now.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sessions))
+
+	// purge
+	count, err := repo.Purge(ctx, now.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+}
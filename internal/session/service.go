@@ -0,0 +1,254 @@
+// Package session records the sessions started by the logins of the users, so that they can see where they
+// are logged in and log out other devices.
+//
+// The JWT issued at login carries the ID of its session, and auth.Handler rejects it once the session is revoked.
+package session
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	// touchInterval is the minimum delay between two updates of the last seen time of a session.
+	touchInterval = time.Minute
+	// maxUserAgentLength is the number of the first characters of a user agent that are stored.
+	maxUserAgentLength = 500
+)
+
+// Service encapsulates usecase logic for sessions.
+type Service interface {
+	auth.Sessions
+	// List returns the active sessions of the current user.
+	List(ctx context.Context) ([]Session, error)
+	// Revoke revokes the session of the current user with the specified ID.
+	Revoke(ctx context.Context, id string) (Session, error)
+	// RevokeOthers revokes the active sessions of the current user, except the session of the request.
+	RevokeOthers(ctx context.Context) ([]Session, error)
+	// ListUser returns the active sessions of the user with the specified ID.
+	ListUser(ctx context.Context, userID string) ([]Session, error)
+	// RevokeUser revokes the session with the specified ID of the user with the specified ID.
+	RevokeUser(ctx context.Context, userID, id string) (Session, error)
+	// RevokeAll revokes the active sessions of the user with the specified ID.
+	RevokeAll(ctx context.Context, userID string) ([]Session, error)
+}
+
+// Session represents the data about a session.
+type Session struct {
+	entity.Session
+	// whether the request was made with the JWT of the session
+	Current bool `json:"current"`
+}
+
+// entityType identifies sessions in the audit log.
+const entityType = "session"
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	logger        log.Logger
+	now           func() time.Time
+}
+
+// NewService creates a new session service.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, recorder audit.Recorder, logger log.Logger) Service {
+	return service{repo, transactional, recorder, logger, time.Now}
+}
+
+// Create records a session started by a login.
+func (s service) Create(ctx context.Context, userID, userAgent, ip string, expiresAt time.Time) (string, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := s.now()
+	session := entity.Session{
+		ID:         entity.GenerateID(),
+		UserID:     userID,
+		Device:     device(userAgent),
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// Check checks that the session is active and records that it was seen, at most once per touchInterval.
+func (s service) Check(ctx context.Context, id, userID string) error {
+	session, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows {
+		return errors.Unauthorized("")
+	} else if err != nil {
+		return err
+	}
+	now := s.now()
+	if session.UserID != userID || !session.IsActive(now) {
+		s.logger.With(ctx, "session", id).Info("authentication failed: the session is not active")
+		return errors.Unauthorized("")
+	}
+	if now.Sub(session.LastSeenAt) >= touchInterval {
+		return s.repo.Touch(ctx, id, now)
+	}
+	return nil
+}
+
+// List returns the active sessions of the current user.
+func (s service) List(ctx context.Context) ([]Session, error) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return nil, errors.Unauthorized("")
+	}
+	return s.ListUser(ctx, identity.GetID())
+}
+
+// Revoke revokes a session of the current user. A not found error is returned if the session belongs to another user.
+func (s service) Revoke(ctx context.Context, id string) (Session, error) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return Session{}, errors.Unauthorized("")
+	}
+	return s.RevokeUser(ctx, identity.GetID(), id)
+}
+
+// RevokeOthers revokes the active sessions of the current user, except the session of the request.
+func (s service) RevokeOthers(ctx context.Context) ([]Session, error) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return nil, errors.Unauthorized("")
+	}
+	return s.revoke(ctx, identity.GetID(), auth.CurrentSession(ctx))
+}
+
+// ListUser returns the active sessions of a user, the most recently seen first.
+func (s service) ListUser(ctx context.Context, userID string) ([]Session, error) {
+	items, err := s.repo.Query(ctx, userID, s.now())
+	if err != nil {
+		return nil, err
+	}
+	result := []Session{}
+	for _, item := range items {
+		result = append(result, newSession(ctx, item))
+	}
+	return result, nil
+}
+
+// RevokeUser revokes a session of a user. A not found error is returned if the session does not belong to the user,
+// and a conflict error if it is no longer active.
+func (s service) RevokeUser(ctx context.Context, userID, id string) (Session, error) {
+	var session entity.Session
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.repo.Get(ctx, id)
+		if err == sql.ErrNoRows || (err == nil && before.UserID != userID) {
+			return errors.NotFound("")
+		} else if err != nil {
+			return err
+		}
+		now := s.now()
+		if !before.IsActive(now) {
+			return errors.Conflict("the session is no longer active")
+		}
+		session = before
+		session.RevokedAt = &now
+		if err := s.repo.Update(ctx, session); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, before, session)
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return newSession(ctx, session), nil
+}
+
+// RevokeAll revokes the active sessions of a user.
+func (s service) RevokeAll(ctx context.Context, userID string) ([]Session, error) {
+	return s.revoke(ctx, userID, "")
+}
+
+// revoke revokes the active sessions of a user, except the session with the given ID, and returns them.
+func (s service) revoke(ctx context.Context, userID, exceptID string) ([]Session, error) {
+	result := []Session{}
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		now := s.now()
+		items, err := s.repo.Query(ctx, userID, now)
+		if err != nil {
+			return err
+		}
+		for _, before := range items {
+			if before.ID == exceptID {
+				continue
+			}
+			session := before
+			session.RevokedAt = &now
+			if err := s.repo.Update(ctx, session); err != nil {
+				return err
+			}
+			if err := s.recorder.Record(ctx, audit.ActionUpdate, entityType, session.ID, before, session); err != nil {
+				return err
+			}
+			result = append(result, newSession(ctx, session))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// newSession returns the data about the session, marking it as current if the request was made with its JWT.
+func newSession(ctx context.Context, session entity.Session) Session {
+	return Session{session, session.ID == auth.CurrentSession(ctx)}
+}
+
+// the browsers and operating systems recognized in the user agents, in the order they are looked for.
+// Most browsers claim to be others too, e.g. Edge user agents contain "Chrome" and "Safari".
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	}
+	systems = []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	}
+)
+
+// device returns a short description of the device a user agent runs on, e.g. "Firefox on Windows".
+func device(userAgent string) string {
+	browser, system := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, os := range systems {
+		if strings.Contains(userAgent, os.token) {
+			system = os.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
@@ -0,0 +1,55 @@
+// Package softdelete permanently removes the records that have been deleted for longer than a retention period.
+package softdelete
+
+import (
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+)
+
+// Purger permanently removes the records that were deleted before a given time.
+type Purger interface {
+	// Purge removes the records deleted before the given time and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Purge removes the records of every purger that were deleted more than retention ago.
+// It tries all purgers and returns the first error encountered.
+func Purge(ctx context.Context, retention time.Duration, purgers map[string]Purger, logger log.Logger) error {
+	before := time.Now().Add(-retention)
+	var result error
+	for name, p := range purgers {
+		n, err := p.Purge(ctx, before)
+		if err != nil {
+			logger.With(ctx).Errorf("failed to purge deleted %v: %v", name, err)
+			if result == nil {
+				result = err
+			}
+			continue
+		}
+		if n > 0 {
+			logger.With(ctx).Infof("purged %v deleted %v", n, name)
+		}
+	}
+	return result
+}
+
+// Transactional returns a purger that runs the given one in a transaction started by transactional,
+// so that the purgers of Purge fail independently of each other.
+func Transactional(p Purger, transactional dbcontext.TransactionFunc) Purger {
+	return transactionalPurger{p, transactional}
+}
+
+type transactionalPurger struct {
+	Purger
+	transactional dbcontext.TransactionFunc
+}
+
+func (p transactionalPurger) Purge(ctx context.Context, before time.Time) (n int64, err error) {
+	err = p.transactional(ctx, func(ctx context.Context) error {
+		n, err = p.Purger.Purge(ctx, before)
+		return err
+	})
+	return n, err
+}
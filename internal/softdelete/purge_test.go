@@ -0,0 +1,43 @@
+package softdelete
+
+import (
+	"backend/pkg/log"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type mockPurger struct {
+	before time.Time
+	err    error
+}
+
+func (m *mockPurger) Purge(ctx context.Context, before time.Time) (int64, error) {
+	m.before = before
+	return 1, m.err
+}
+
+func TestPurge(t *testing.T) {
+	logger, entries := log.NewForTest()
+	albums, users := &mockPurger{}, &mockPurger{err: errors.New("purge failed")}
+	err := Purge(context.Background(), 24*time.Hour, map[string]Purger{"albums": albums, "users": users}, logger)
+	assert.Equal(t, users.err, err)
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), albums.before, time.Second)
+	assert.Equal(t, albums.before, users.before)
+	assert.Equal(t, 2, entries.Len())
+}
+
+func TestTransactional(t *testing.T) {
+	calls := 0
+	transactional := func(ctx context.Context, f func(ctx context.Context) error) error {
+		calls++
+		return f(ctx)
+	}
+	users := &mockPurger{err: errors.New("purge failed")}
+	n, err := Transactional(users, transactional).Purge(context.Background(), time.Now())
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, users.err, err)
+	assert.Equal(t, 1, calls)
+}
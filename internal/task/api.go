@@ -0,0 +1,40 @@
+package task
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+	r.Use(authHandler, auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant)
+	// the following endpoints require a valid JWT of an administrator who is not scoped to an organization
+	r.Get("/tasks/<name>", res.get)
+	r.Get("/tasks", res.query)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	status, err := r.service.Get(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(status)
+}
+
+func (r resource) query(c *routing.Context) error {
+	statuses, err := r.service.All(c.Request.Context())
+	if err != nil {
+		return err
+	}
+
+	return c.Write(statuses)
+}
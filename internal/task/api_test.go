@@ -0,0 +1,64 @@
+package task
+
+import (
+	"backend/internal/auth"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"backend/pkg/scheduler"
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	finished := time.Date(2026, 10, 18, 3, 0, 2, 0, time.UTC)
+	store := &mockStore{items: []scheduler.Status{
+		{Name: "analyze", Schedule: "0 4 * * *"},
+		{Name: "purge_deleted", Schedule: "0 3 * * *", LastFinishedAt: &finished, LastDurationMS: 2000, LastOutcome: scheduler.OutcomeSucceeded},
+	}}
+	RegisterHandlers(router.Group(""), NewService(store, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/tasks", "", header, http.StatusOK, `*"name":"purge_deleted"*`},
+		{"get purge_deleted", "GET", "/tasks/purge_deleted", "", header, http.StatusOK, `*"last_outcome":"succeeded"*`},
+		{"get unknown", "GET", "/tasks/unknown", "", header, http.StatusNotFound, ""},
+		{"auth error", "GET", "/tasks", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+type mockStore struct {
+	items []scheduler.Status
+}
+
+func (m *mockStore) Register(ctx context.Context, name, schedule string, next time.Time) error {
+	return nil
+}
+
+func (m *mockStore) Claim(ctx context.Context, name string, scheduledAt, startedAt, next time.Time, runner string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) Finish(ctx context.Context, name string, finishedAt time.Time, duration time.Duration, err error) error {
+	return nil
+}
+
+func (m *mockStore) Get(ctx context.Context, name string) (scheduler.Status, error) {
+	for _, item := range m.items {
+		if item.Name == name {
+			return item, nil
+		}
+	}
+	return scheduler.Status{}, sql.ErrNoRows
+}
+
+func (m *mockStore) All(ctx context.Context) ([]scheduler.Status, error) {
+	return m.items, nil
+}
@@ -0,0 +1,40 @@
+package task
+
+import (
+	"backend/pkg/log"
+	"backend/pkg/scheduler"
+	"context"
+)
+
+// Service encapsulates usecase logic for inspecting the scheduled tasks.
+type Service interface {
+	Get(ctx context.Context, name string) (scheduler.Status, error)
+	All(ctx context.Context) ([]scheduler.Status, error)
+}
+
+type service struct {
+	store  scheduler.Store
+	logger log.Logger
+}
+
+// NewService creates a new scheduled task service.
+func NewService(store scheduler.Store, logger log.Logger) Service {
+	return service{store, logger}
+}
+
+// Get returns the status of the scheduled task with the specified name.
+func (s service) Get(ctx context.Context, name string) (scheduler.Status, error) {
+	return s.store.Get(ctx, name)
+}
+
+// All returns the status of all scheduled tasks, sorted by name.
+func (s service) All(ctx context.Context) ([]scheduler.Status, error) {
+	items, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []scheduler.Status{}
+	}
+	return items, nil
+}
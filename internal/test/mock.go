@@ -3,10 +3,11 @@ package test
 import (
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/content"
-	"github.com/go-ozzo/ozzo-routing/v2/cors"
 	"backend/internal/errors"
 	"backend/pkg/accesslog"
+	"backend/pkg/cors"
 	"backend/pkg/log"
+	"context"
 	"net/http"
 	"net/http/httptest"
 )
@@ -29,7 +30,22 @@ func MockRouter(logger log.Logger) *routing.Router {
 		accesslog.Handler(logger),
 		errors.Handler(logger),
 		content.TypeNegotiator(content.JSON),
-		cors.Handler(cors.AllowAll),
+		cors.Handler(cors.Options{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"*"},
+			AllowHeaders: []string{"*"},
+		}),
 	)
 	return router
 }
+
+// MockTransactional is a dbcontext.TransactionFunc for testing services without a database.
+// It calls the given function without starting a transaction.
+func MockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+// MockHandler is a routing handler for the middlewares that are not under test. It lets every request through.
+func MockHandler(c *routing.Context) error {
+	return nil
+}
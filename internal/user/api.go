@@ -1,19 +1,45 @@
 package user
 
 import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/etag"
 	"backend/pkg/log"
 	"backend/pkg/pagination"
+	"backend/pkg/patch"
 	"encoding/json"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
 func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
 	res := resource{service, logger}
 	r.Use(authHandler)
-	// the following endpoints require a valid JWT
+	// the following endpoints require a valid JWT. The users can only be updated by the administrators,
+	// or by the users themselves, and only the administrators can create and delete them
 	r.Get("/users/<id>", res.get)
 	r.Get("/users", res.query)
+	r.Post("/users", auth.RequireRole(entity.RoleAdministrator), res.create)
+	r.Put("/users/<id>", selfOrAdministrator, res.update)
+	r.Patch("/users/<id>", selfOrAdministrator, res.patch)
+	r.Delete("/users/<id>", auth.RequireRole(entity.RoleAdministrator), res.delete)
+	r.Post("/users/<id>/restore", auth.RequireRole(entity.RoleAdministrator), res.restore)
+	r.Put("/users/<id>/roles", auth.RequireRole(entity.RoleAdministrator), res.assignRoles)
+}
+
+// selfOrAdministrator is a middleware that only lets through the administrators, and the users acting on
+// their own account.
+func selfOrAdministrator(c *routing.Context) error {
+	ctx := c.Request.Context()
+	if auth.HasRole(ctx, entity.RoleAdministrator) {
+		return nil
+	}
+	if identity := auth.CurrentUser(ctx); identity != nil && identity.GetID() == c.Param("id") {
+		return nil
+	}
+	return errors.Forbidden("")
 }
 
 type resource struct {
@@ -26,6 +52,9 @@ func (r resource) get(c *routing.Context) error {
 	if err != nil {
 		return err
 	}
+	if etag.Fresh(c, etag.FromVersion(user.Version)) {
+		return nil
+	}
 
 	return c.Write(user)
 }
@@ -38,15 +67,135 @@ func (r resource) query(c *routing.Context) error {
 	_ = json.Unmarshal([]byte(c.Query("filters")), &filters)
 
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	includeDeleted, err := includeDeleted(c)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.Count(ctx, includeDeleted)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	users, err := r.service.Query(ctx, pages.Offset(), pages.Limit(), term, filters)
+	users, err := r.service.Query(ctx, pages.Offset(), pages.Limit(), term, filters, includeDeleted)
 	if err != nil {
 		return err
 	}
 	pages.Items = users
 	return c.Write(pages)
 }
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateUserRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	user, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag.FromVersion(user.Version))
+	return c.WriteWithStatus(user, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input UpdateUserRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	current, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if err := etag.CheckIfMatch(c.Request, etag.FromVersion(current.Version)); err != nil {
+		return err
+	}
+	user, err := r.service.Update(c.Request.Context(), c.Param("id"), current.Version, input)
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag.FromVersion(user.Version))
+	return c.Write(user)
+}
+
+func (r resource) patch(c *routing.Context) error {
+	user, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if err := etag.CheckIfMatch(c.Request, etag.FromVersion(user.Version)); err != nil {
+		return err
+	}
+	input := UpdateUserRequest{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Username:  user.Username,
+		Email:     user.Email,
+		IsActive:  &user.IsActive,
+	}
+	if err := patch.Read(c, input, &input); err != nil {
+		return err
+	}
+	user, err = r.service.Update(c.Request.Context(), user.ID, user.Version, input)
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag.FromVersion(user.Version))
+	return c.Write(user)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	current, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if err := etag.CheckIfMatch(c.Request, etag.FromVersion(current.Version)); err != nil {
+		return err
+	}
+	user, err := r.service.Delete(c.Request.Context(), current.ID, current.Version)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(user)
+}
+
+func (r resource) restore(c *routing.Context) error {
+	user, err := r.service.Restore(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag.FromVersion(user.Version))
+	return c.Write(user)
+}
+
+func (r resource) assignRoles(c *routing.Context) error {
+	var input AssignRolesRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	user, err := r.service.AssignRoles(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag.FromVersion(user.Version))
+	return c.Write(user)
+}
+
+// includeDeleted reports whether deleted users are requested. Only administrators may request them.
+func includeDeleted(c *routing.Context) (bool, error) {
+	if c.Query("include_deleted") != "true" {
+		return false, nil
+	}
+	if !auth.HasRole(c.Request.Context(), entity.RoleAdministrator) {
+		return false, errors.Forbidden("")
+	}
+	return true, nil
+}
@@ -0,0 +1,191 @@
+package user
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/events"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"backend/pkg/password"
+	"context"
+	"database/sql"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	hasher, err := password.New(password.Options{BcryptCost: bcrypt.MinCost, Argon2Memory: 64, Argon2Iterations: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := hasher.Hash("old password")
+	now := time.Now()
+	repo := &mockRepository{items: []entity.User{
+		{ID: "101", Username: "ann", Password: hash, Email: "ann@test.test", FirstName: "Ann", LastName: "Lee", IsActive: true, CreatedAt: now, Version: 1},
+		{ID: "102", Username: "bob", Password: hash, Email: "bob@test.test", FirstName: "Bob", LastName: "Lee", IsActive: true, CreatedAt: now, Version: 1},
+	}, organizations: map[string][]string{"101": {"org1"}, "102": {"org1", "org2"}}}
+	s := NewService(repo, test.MockTransactional, &audit.MockRecorder{}, &events.MockRecorder{}, mockVerifier{}, hasher,
+		password.Policy{MinLength: 8, MaxLength: 150}, logger)
+	RegisterHandlers(router.Group(""), s, mockAuthHandler, logger)
+	admin := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
+	user := func(tag string) http.Header {
+		h := http.Header{"Authorization": []string{"USER"}}
+		h.Set("If-Match", tag)
+		return h
+	}
+	tenantAdmin := func(tag string) http.Header {
+		h := http.Header{"Authorization": []string{"TENANT"}}
+		h.Set("If-Match", tag)
+		return h
+	}
+	userPatch := func(tag string) http.Header {
+		h := user(tag)
+		h.Set("Content-Type", "application/merge-patch+json")
+		return h
+	}
+
+	tests := []test.APITestCase{
+		{"create by user", "POST", "/users", `{"first_name":"Cid","last_name":"Lee","username":"cid","email":"cid@test.test","password":"password"}`, http.Header{"Authorization": []string{"USER"}}, http.StatusForbidden, ""},
+		{"update other user", "PUT", "/users/102", `{"first_name":"Bob","last_name":"Lee","username":"bob","email":"bob@test.test"}`, user(`"1"`), http.StatusForbidden, ""},
+		{"update self", "PUT", "/users/101", `{"first_name":"Anna","last_name":"Lee","username":"ann","email":"ann@test.test"}`, user(`"1"`), http.StatusOK, `*"first_name":"Anna"*`},
+		{"update self deactivate", "PUT", "/users/101", `{"first_name":"Anna","last_name":"Lee","username":"ann","email":"ann@test.test","is_active":false}`, user(`"2"`), http.StatusForbidden, ""},
+		{"update self password without current", "PUT", "/users/101", `{"first_name":"Anna","last_name":"Lee","username":"ann","email":"ann@test.test","password":"new password"}`, user(`"2"`), http.StatusBadRequest, `*current_password*`},
+		{"update self password wrong current", "PUT", "/users/101", `{"first_name":"Anna","last_name":"Lee","username":"ann","email":"ann@test.test","password":"new password","current_password":"wrong"}`, user(`"2"`), http.StatusBadRequest, `*current_password*`},
+		{"update self password", "PUT", "/users/101", `{"first_name":"Anna","last_name":"Lee","username":"ann","email":"ann@test.test","password":"new password","current_password":"old password"}`, user(`"2"`), http.StatusOK, `*"version":3*`},
+		{"patch other user", "PATCH", "/users/102", `{"password":"new password"}`, userPatch(`"1"`), http.StatusForbidden, ""},
+		{"patch self deactivate", "PATCH", "/users/101", `{"is_active":false}`, userPatch(`"3"`), http.StatusForbidden, ""},
+		{"patch self password without current", "PATCH", "/users/101", `{"password":"newer password"}`, userPatch(`"3"`), http.StatusBadRequest, `*current_password*`},
+		{"patch self", "PATCH", "/users/101", `{"first_name":"Ann"}`, userPatch(`"3"`), http.StatusOK, `*"first_name":"Ann"*`},
+		{"delete self", "DELETE", "/users/101", "", user(`"4"`), http.StatusForbidden, ""},
+		{"delete other user", "DELETE", "/users/102", "", user(`"1"`), http.StatusForbidden, ""},
+		{"delete by administrator", "DELETE", "/users/101", "", admin(`"4"`), http.StatusOK, `*"id":"101"*`},
+		{"update by administrator", "PUT", "/users/102", `{"first_name":"Bob","last_name":"Lee","username":"bob","email":"bob@test.test","password":"new password","is_active":false}`, admin(`"1"`), http.StatusOK, `*"is_active":false*`},
+		{"update shared user by tenant administrator", "PUT", "/users/102", `{"first_name":"Bob","last_name":"Lee","username":"bob","email":"bob@evil.test","password":"evil password"}`, tenantAdmin(`"2"`), http.StatusForbidden, ""},
+		{"delete shared user by tenant administrator", "DELETE", "/users/102", "", tenantAdmin(`"2"`), http.StatusForbidden, ""},
+		{"restore member by tenant administrator", "POST", "/users/101/restore", "", tenantAdmin(""), http.StatusOK, `*"id":"101"*`},
+		{"update member by tenant administrator", "PUT", "/users/101", `{"first_name":"Anne","last_name":"Lee","username":"ann","email":"ann@test.test"}`, tenantAdmin(`"6"`), http.StatusOK, `*"first_name":"Anne"*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+// mockAuthHandler authenticates the administrator of auth.MockAuthHandler, the user "101" who has no role
+// if the Authorization header is "USER", and the administrator "103" of the organization "org1" if it is "TENANT".
+func mockAuthHandler(c *routing.Context) error {
+	switch c.Request.Header.Get("Authorization") {
+	case "USER":
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), "101", "ann", "ann@test.test", nil, true))
+		return nil
+	case "TENANT":
+		ctx := auth.WithTenant(c.Request.Context(), "org1")
+		c.Request = c.Request.WithContext(auth.WithUser(ctx, "103", "cid", "cid@test.test", []string{entity.RoleAdministrator}, true))
+		return nil
+	}
+	return auth.MockAuthHandler(c)
+}
+
+type mockVerifier struct{}
+
+func (mockVerifier) RequestVerification(ctx context.Context, userID, email string) error {
+	return nil
+}
+
+type mockRepository struct {
+	items []entity.User
+	// the IDs of the organizations of the users
+	organizations map[string][]string
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.User, error) {
+	for _, item := range m.items {
+		if item.ID == id && item.DeletedAt == nil {
+			return item, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, includeDeleted bool) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}, includeDeleted bool) ([]entity.User, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, user entity.User) error {
+	m.items = append(m.items, user)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, user entity.User) error {
+	for i, item := range m.items {
+		if item.ID == user.ID {
+			if item.Version != user.Version {
+				return errors.PreconditionFailed("")
+			}
+			user.Version++
+			m.items[i] = user
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string, version int) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			if item.Version != version {
+				return errors.PreconditionFailed("")
+			}
+			now := time.Now()
+			m.items[i].DeletedAt = &now
+			m.items[i].Version++
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Restore(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i].DeletedAt = nil
+			m.items[i].Version++
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m mockRepository) GetRoles(ctx context.Context, id string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (m mockRepository) AssignRoles(ctx context.Context, id string, roles []string) error {
+	return nil
+}
+
+func (m mockRepository) InOtherOrganizations(ctx context.Context, id string) (bool, error) {
+	tenantID := dbcontext.Tenant(ctx)
+	for _, organizationID := range m.organizations[id] {
+		if tenantID != "" && organizationID != tenantID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
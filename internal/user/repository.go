@@ -6,24 +6,47 @@ import (
 	"backend/pkg/dbcontext"
 	"backend/pkg/log"
 	"context"
+	"database/sql"
 	"fmt"
+	"time"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/lib/pq"
 )
 
 // Repository encapsulates the logic to access users from the data source.
+// Deleted users are kept in the data source until they are purged. They are excluded unless stated otherwise.
+// The users are scoped to the tenant of the context: only the members of its organization are found,
+// and the roles are the ones granted within it.
 type Repository interface {
 	// Get returns the user with the specified user ID.
 	Get(ctx context.Context, id string) (entity.User, error)
-	// Count returns the number of users.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of users with the given offset and limit.
-	Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}) ([]entity.User, error)
-	// Create saves a new user in the storage.
+	// Count returns the number of users, including the deleted ones if requested.
+	Count(ctx context.Context, includeDeleted bool) (int, error)
+	// Query returns the list of users with the given offset and limit, including the deleted ones if requested.
+	Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}, includeDeleted bool) ([]entity.User, error)
+	// Create saves a new user in the storage, as a member of the organization of the tenant if any.
 	Create(ctx context.Context, user entity.User) error
+	// Update updates the user with given ID in the storage if its version is unchanged.
+	Update(ctx context.Context, user entity.User) error
+	// Delete marks the user with given ID and version as deleted.
+	Delete(ctx context.Context, id string, version int) error
+	// Restore undoes the deletion of the user with given ID.
+	Restore(ctx context.Context, id string) error
+	// Purge permanently removes the users deleted before the given time and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// GetRoles returns the names of the roles of the user with given ID.
+	GetRoles(ctx context.Context, id string) ([]string, error)
+	// AssignRoles replaces the roles of the user with given ID by the roles with the given names.
+	AssignRoles(ctx context.Context, id string, roles []string) error
+	// InOtherOrganizations returns whether the user with given ID is a member of an organization
+	// other than the one of the tenant. It is always false if there is no tenant.
+	InOtherOrganizations(ctx context.Context, id string) (bool, error)
 }
 
-// repository persists users in database
+// repository persists users in database.
+// Its methods run in the transaction of the context, or in one they start, since the row level security
+// policies of the database only let the transactions scoped by dbcontext find the users.
 type repository struct {
 	db     *dbcontext.DB
 	logger log.Logger
@@ -34,66 +57,325 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 	return repository{db, logger}
 }
 
+// notDeleted selects the users that have not been deleted.
+var notDeleted = dbx.HashExp{"users.deleted_at": nil}
+
+// scope selects the members of the organization of the tenant of the context, if any. As in the row level
+// security policy of the table, the user of the context is selected too, even if they are a member of no organization.
+func scope(ctx context.Context) dbx.Expression {
+	condition := dbcontext.Scope(ctx, "users.id IN (SELECT user_id FROM organization_user WHERE organization_id = {:tenant})")
+	if userID := dbcontext.User(ctx); condition != nil && userID != "" {
+		return dbx.Or(condition, dbx.HashExp{"users.id": userID})
+	}
+	return condition
+}
+
+// roleScope selects the roles granted within the organization of the tenant of the context,
+// or the roles granted in all the organizations if there is no tenant.
+func roleScope(ctx context.Context) dbx.Expression {
+	if tenantID := dbcontext.Tenant(ctx); tenantID != "" {
+		return dbx.HashExp{"organization_id": tenantID}
+	}
+	return dbx.HashExp{"organization_id": nil}
+}
+
 // Get reads the user with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string) (entity.User, error) {
 	var user entity.User
-	err := r.db.With(ctx).Select().Model(id, &user)
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select().Where(dbx.And(notDeleted, scope(ctx))).Model(id, &user)
+	})
 	return user, err
 }
 
-// Update saves the changes to an user in the database.
+// Update saves the changes to an user in the database and increments its version.
+// The user.Version must be the version that was read. If the user has been modified since then,
+// nothing is saved and a precondition failure is returned.
 func (r repository) Update(ctx context.Context, user entity.User) error {
-	return r.db.With(ctx).Model(&user).Update()
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.checkUsername(ctx, user.ID, user.Username); err != nil {
+			return err
+		}
+
+		res, err := r.db.With(ctx).Update("users", dbx.Params{
+			"first_name": user.FirstName,
+			"last_name":  user.LastName,
+			"username":   user.Username,
+			"password":   user.Password,
+			"email":      user.Email,
+			"is_active":  user.IsActive,
+			"updated_at": user.UpdatedAt,
+			"version":    user.Version + 1,
+		}, dbx.And(dbx.HashExp{"id": user.ID, "version": user.Version, "deleted_at": nil}, scope(ctx))).Execute()
+		return checkVersion(res, checkUnique(err))
+	})
 }
 
-// Count returns the number of the user records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// Delete marks an user with the specified ID and version as deleted and increments its version.
+// A precondition failure is returned if the user has been modified since the version was read.
+func (r repository) Delete(ctx context.Context, id string, version int) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if _, err := r.Get(ctx, id); err != nil {
+			return err
+		}
+		res, err := r.db.With(ctx).Update("users", dbx.Params{
+			"deleted_at": time.Now(),
+			"version":    version + 1,
+		}, dbx.And(dbx.HashExp{"id": id, "version": version, "deleted_at": nil}, scope(ctx))).Execute()
+		return checkVersion(res, err)
+	})
+}
+
+// Restore clears the deletion mark of the user with the specified ID and increments its version.
+// sql.ErrNoRows is returned if there is no such deleted user. The user cannot be restored
+// if its username or email has been taken by another user in the meantime.
+func (r repository) Restore(ctx context.Context, id string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.restore(ctx, id)
+	})
+}
+
+// restore restores the user with the specified ID within the transaction of the context.
+func (r repository) restore(ctx context.Context, id string) error {
+	var user entity.User
+	err := r.db.With(ctx).Select().Where(dbx.And(dbx.NewExp("deleted_at IS NOT NULL"), scope(ctx))).Model(id, &user)
+	if err != nil {
+		return err
+	}
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("users").Row(&count)
-	return count, err
+	if err := r.db.With(ctx).Select("COUNT(*)").From("users").
+		Where(dbx.And(dbx.Or(dbx.HashExp{"username": user.Username}, dbx.HashExp{"email": user.Email}), notDeleted)).
+		Row(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.Conflict("The username or email of the user is used by another user.")
+	}
+
+	res, err := r.db.With(ctx).Update("users", dbx.Params{
+		"deleted_at": nil,
+		"version":    dbx.NewExp("version + 1"),
+	}, dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("deleted_at IS NOT NULL"), scope(ctx))).Execute()
+	if isUniqueViolation(err) {
+		// the users of the other organizations are hidden from the count above, but not from the indexes
+		return errors.Conflict("The username or email of the user is used by another user.")
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-// Query retrieves the user records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}) ([]entity.User, error) {
-	var users []entity.User
-	if term == "search" {
-		switch filters["role"] {
-		case "owner":
-			query := fmt.Sprintf("%%%v%%", filters["query"])
-			err := r.db.With(ctx).
-				Select("users.first_name", "users.last_name", "users.id as id").
-				InnerJoin("rooms as r", dbx.NewExp("r.user_id = users.id")).
-				Where(dbx.NewExp("CONCAT(users.first_name, ' ', users.last_name) like {:query}", dbx.Params{"query": query})).
-				OrderBy("users.id").
-				Offset(int64(offset)).
-				Limit(int64(limit)).
-				All(&users)
-			return users, err
+// Purge hard-deletes the users that were deleted before the given time.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		res, err := r.db.With(ctx).Delete("users", dbx.And(dbx.NewExp("deleted_at < {:before}", dbx.Params{"before": before}), scope(ctx))).Execute()
+		if err != nil {
+			return err
 		}
-	}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
 
-	err := r.db.With(ctx).
-		Select().
-		OrderBy("id").
-		Offset(int64(offset)).
-		Limit(int64(limit)).
-		All(&users)
-	return users, err
+// GetRoles reads the names of the roles of an user within the organization of the tenant from the database,
+// sorted by name.
+func (r repository) GetRoles(ctx context.Context, id string) ([]string, error) {
+	roles := []string{}
+	err := r.db.With(ctx).Select("r.name").
+		From("roles as r").
+		InnerJoin("role_user as ru", dbx.NewExp("r.id = ru.role_id")).
+		Where(dbx.And(dbx.HashExp{"ru.user_id": id}, roleScope(ctx))).
+		OrderBy("r.name").
+		Column(&roles)
+	return roles, err
 }
-// Create saves a new user record in the database.
-// It returns the ID of the newly inserted user record.
-func (r repository) Create(ctx context.Context, user entity.User) error {
+
+// InOtherOrganizations counts the memberships of a user in the organizations other than the one of the tenant
+// in the database.
+func (r repository) InOtherOrganizations(ctx context.Context, id string) (bool, error) {
+	tenantID := dbcontext.Tenant(ctx)
+	if tenantID == "" {
+		return false, nil
+	}
 	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("organization_user").
+		Where(dbx.And(dbx.HashExp{"user_id": id}, dbx.Not(dbx.HashExp{"organization_id": tenantID}))).
+		Row(&count)
+	return count > 0, err
+}
+
+// AssignRoles replaces the roles of an user within the organization of the tenant in the database.
+// A bad request error is returned if one of the roles does not exist.
+func (r repository) AssignRoles(ctx context.Context, id string, roles []string) error {
+	var found []entity.Role
+	if len(roles) > 0 {
+		names := make([]interface{}, len(roles))
+		for i, role := range roles {
+			names[i] = role
+		}
+		if err := r.db.With(ctx).Select().Where(dbx.In("name", names...)).All(&found); err != nil {
+			return err
+		}
+	}
+	for _, role := range roles {
+		if !hasRole(found, role) {
+			return errors.BadRequest(fmt.Sprintf("role %q does not exist", role))
+		}
+	}
 
-	if err := r.db.With(ctx).Select("COUNT(*)").From("users").Where(dbx.HashExp{"username": user.Username}).Row(&count); err != nil {
+	if _, err := r.db.With(ctx).Delete("role_user", dbx.And(dbx.HashExp{"user_id": id}, roleScope(ctx))).Execute(); err != nil {
 		return err
 	}
+	var organizationID interface{}
+	if tenantID := dbcontext.Tenant(ctx); tenantID != "" {
+		organizationID = tenantID
+	}
+	for _, role := range found {
+		if _, err := r.db.With(ctx).Insert("role_user", dbx.Params{
+			"user_id":         id,
+			"role_id":         role.ID,
+			"organization_id": organizationID,
+		}).Execute(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasRole reports whether the role with the given name is among the roles.
+func hasRole(roles []entity.Role, name string) bool {
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
 
+// checkUsername returns an error if the username is used by a user other than the one with the given ID.
+// Deleted users are not taken into account. The usernames are unique across the tenants since the users
+// log in with them.
+func (r repository) checkUsername(ctx context.Context, id, username string) error {
+	var count int
+	if err := r.db.With(ctx).Select("COUNT(*)").From("users").
+		Where(dbx.And(dbx.HashExp{"username": username}, dbx.Not(dbx.HashExp{"id": id}), notDeleted)).
+		Row(&count); err != nil {
+		return err
+	}
 	if count > 0 {
 		return errors.BadRequest("username already exists")
 	}
+	return nil
+}
+
+// checkUnique turns a violation of the unique username index into the error returned by checkUsername.
+// Within an organization, the users of the other organizations are hidden from checkUsername by the row level
+// security policies of the database, but not from the index.
+func checkUnique(err error) error {
+	if e, ok := err.(*pq.Error); ok && e.Code == "23505" && e.Constraint == "users_username_uindex" {
+		return errors.BadRequest("username already exists")
+	}
+	return err
+}
 
-	user.IsActive = true
+// isUniqueViolation reports whether the error is the violation of a unique index.
+func isUniqueViolation(err error) bool {
+	e, ok := err.(*pq.Error)
+	return ok && e.Code == "23505"
+}
 
-	return r.db.With(ctx).Model(&user).Insert()
+// checkVersion turns a write that affected no rows into a precondition failure.
+func checkVersion(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.PreconditionFailed("")
+	}
+	return nil
+}
+
+// Count returns the number of the user records in the database.
+func (r repository) Count(ctx context.Context, includeDeleted bool) (int, error) {
+	var count int
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		q := r.db.With(ctx).Select("COUNT(*)").From("users").Where(scope(ctx))
+		if !includeDeleted {
+			q.AndWhere(notDeleted)
+		}
+		return q.Row(&count)
+	})
+	return count, err
+}
+
+// Query retrieves the user records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}, includeDeleted bool) ([]entity.User, error) {
+	var users []entity.User
+	deleted := notDeleted
+	if includeDeleted {
+		deleted = nil
+	}
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		if term == "search" {
+			switch filters["role"] {
+			case "owner":
+				query := fmt.Sprintf("%%%v%%", filters["query"])
+				return r.db.With(ctx).
+					Select("users.first_name", "users.last_name", "users.id as id").
+					InnerJoin("rooms as r", dbx.NewExp("r.user_id = users.id")).
+					Where(dbx.NewExp("CONCAT(users.first_name, ' ', users.last_name) like {:query}", dbx.Params{"query": query})).
+					AndWhere(deleted).
+					AndWhere(scope(ctx)).
+					OrderBy("users.id").
+					Offset(int64(offset)).
+					Limit(int64(limit)).
+					All(&users)
+			}
+		}
+
+		return r.db.With(ctx).
+			Select().
+			Where(dbx.And(deleted, scope(ctx))).
+			OrderBy("id").
+			Offset(int64(offset)).
+			Limit(int64(limit)).
+			All(&users)
+	})
+	return users, err
+}
+
+// Create saves a new user record in the database, and the membership of the user in the organization
+// of the tenant if any.
+// It returns the ID of the newly inserted user record.
+func (r repository) Create(ctx context.Context, user entity.User) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.checkUsername(ctx, user.ID, user.Username); err != nil {
+			return err
+		}
+
+		user.IsActive = true
+
+		if err := checkUnique(r.db.With(ctx).Model(&user).Insert()); err != nil {
+			return err
+		}
+		if tenantID := dbcontext.Tenant(ctx); tenantID != "" {
+			_, err := r.db.With(ctx).Insert("organization_user", dbx.Params{
+				"organization_id": tenantID,
+				"user_id":         user.ID,
+				"created_at":      user.CreatedAt,
+			}).Execute()
+			return err
+		}
+		return nil
+	})
 }
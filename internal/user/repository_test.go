@@ -1,10 +1,13 @@
 package user
 
 import (
-	"context"
 	"backend/internal/entity"
+	"backend/internal/errors"
 	"backend/internal/test"
+	"backend/pkg/dbcontext"
 	"backend/pkg/log"
+	"context"
+	"database/sql"
 	"testing"
 	"time"
 
@@ -15,13 +18,14 @@ import (
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "users")
+	test.ResetTables(t, db, "users", "roles", "organizations")
 	repo := NewRepository(db, logger)
 
-	ctx := context.Background()
+	// the tests connect as a role subject to the row level security policies of the database
+	ctx := dbcontext.Unscoped(context.Background())
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.Count(ctx, false)
 	assert.Nil(t, err)
 
 	// create
@@ -38,17 +42,206 @@ func TestRepository(t *testing.T) {
 		IsActive:  true,
 		CreatedAt: now,
 		UpdatedAt: &now,
+		Version:   1,
 	})
 	assert.Nil(t, err)
 
 	// insert role of user
+	_, err = db.With(ctx).Insert("roles", dbx.Params{
+		"id":   roleID,
+		"name": entity.RoleAdministrator,
+	}).Execute()
+	assert.Nil(t, err)
 	_, err = db.With(ctx).Insert("role_user", dbx.Params{
 		"role_id": roleID,
 		"user_id": userID,
 	}).Execute()
 	assert.Nil(t, err)
 
-	count2, _ := repo.Count(ctx)
+	roles, err := repo.GetRoles(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{entity.RoleAdministrator}, roles)
+
+	// assign roles
+	err = repo.AssignRoles(ctx, userID, []string{"unknown"})
+	assert.Equal(t, errors.BadRequest(`role "unknown" does not exist`), err)
+	err = repo.AssignRoles(ctx, userID, nil)
+	assert.Nil(t, err)
+	roles, _ = repo.GetRoles(ctx, userID)
+	assert.Empty(t, roles)
+	err = repo.AssignRoles(ctx, userID, []string{entity.RoleAdministrator})
+	assert.Nil(t, err)
+	roles, _ = repo.GetRoles(ctx, userID)
+	assert.Equal(t, []string{entity.RoleAdministrator}, roles)
+
+	count2, _ := repo.Count(ctx, false)
 	assert.Equal(t, 1, count2-count)
 
+	// update
+	user, err := repo.Get(ctx, userID)
+	assert.Nil(t, err)
+	user.FirstName = "Ilmer"
+	err = repo.Update(ctx, user)
+	assert.Nil(t, err)
+	user, _ = repo.Get(ctx, userID)
+	assert.Equal(t, "Ilmer", user.FirstName)
+	assert.Equal(t, 2, user.Version)
+
+	// update with a stale version
+	user.Version = 1
+	err = repo.Update(ctx, user)
+	assert.Equal(t, errors.PreconditionFailed(""), err)
+
+	// delete
+	err = repo.Delete(ctx, userID, 2)
+	assert.Nil(t, err)
+	_, err = repo.Get(ctx, userID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count3, _ := repo.Count(ctx, false)
+	assert.Equal(t, count, count3)
+
+	// the username of a deleted user can be reused, which prevents the restoration
+	otherID := "0a1f3c9e-8f4e-4d8b-9a59-1d3f2c7e4b21"
+	err = repo.Create(ctx, entity.User{
+		ID:        otherID,
+		FirstName: "Ilmar",
+		LastName:  "López",
+		Username:  "ilmarlopez",
+		Email:     "other@test.test",
+		Password:  "$2a$04$bRTPCB6nl7ddsDoGDMdmxuMzmcd2NZhIjuusbj2JN1mBS4dKIZXem",
+		CreatedAt: now,
+		UpdatedAt: &now,
+		Version:   1,
+	})
+	assert.Nil(t, err)
+	err = repo.Restore(ctx, userID)
+	assert.Equal(t, errors.Conflict("The username or email of the user is used by another user."), err)
+
+	// restore
+	err = repo.Delete(ctx, otherID, 1)
+	assert.Nil(t, err)
+	err = repo.Restore(ctx, userID)
+	assert.Nil(t, err)
+	user, _ = repo.Get(ctx, userID)
+	assert.Equal(t, 4, user.Version)
+
+	// purge
+	n, err := repo.Purge(ctx, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// the users created by a tenant are members of its organization, only found by it,
+	// and their roles are granted within it
+	_, err = db.With(ctx).Insert("organizations", dbx.Params{"id": "org1", "name": "Acme", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	tenant := dbcontext.WithTenant(ctx, "org1")
+	err = repo.Create(tenant, entity.User{
+		ID:        otherID,
+		FirstName: "Ann",
+		LastName:  "Smith",
+		Username:  "annsmith",
+		Email:     "ann@test.test",
+		CreatedAt: now,
+		UpdatedAt: &now,
+		Version:   1,
+	})
+	assert.Nil(t, err)
+	_, err = repo.Get(tenant, otherID)
+	assert.Nil(t, err)
+	_, err = repo.Get(tenant, userID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count4, _ := repo.Count(tenant, false)
+	assert.Equal(t, 1, count4)
+	assert.Nil(t, repo.AssignRoles(tenant, otherID, []string{entity.RoleAdministrator}))
+	roles, _ = repo.GetRoles(tenant, otherID)
+	assert.Equal(t, []string{entity.RoleAdministrator}, roles)
+	roles, _ = repo.GetRoles(ctx, otherID)
+	assert.Empty(t, roles)
+
+	// the memberships of the users in the other organizations are reported to the tenant
+	other, err := repo.InOtherOrganizations(tenant, otherID)
+	assert.Nil(t, err)
+	assert.False(t, other)
+	_, err = db.With(ctx).Insert("organizations", dbx.Params{"id": "org3", "name": "Initech", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	_, err = db.With(ctx).Insert("organization_user", dbx.Params{"organization_id": "org3", "user_id": otherID, "created_at": now}).Execute()
+	assert.Nil(t, err)
+	other, _ = repo.InOtherOrganizations(tenant, otherID)
+	assert.True(t, other)
+	other, _ = repo.InOtherOrganizations(ctx, otherID)
+	assert.False(t, other)
+
+	// the methods called outside a transaction run in one scoped to the context, so that the row level security
+	// policies let them find the users of the tenant, or only the current user if there is neither a tenant
+	// nor an explicit Unscoped
+	_, err = repo.Get(context.Background(), otherID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = repo.Get(dbcontext.WithUser(context.Background(), userID), userID)
+	assert.Nil(t, err)
+	count5, _ := repo.Count(context.Background(), true)
+	assert.Equal(t, 0, count5)
+	// a user who is a member of no organization only finds themselves
+	outsiderID := entity.GenerateID()
+	err = repo.Create(ctx, entity.User{ID: outsiderID, Username: "outsider", Email: "outsider@test.test", CreatedAt: now, UpdatedAt: &now, Version: 1})
+	assert.Nil(t, err)
+	outsider := dbcontext.WithUser(context.Background(), outsiderID)
+	users, err := repo.Query(outsider, 0, 10, "", nil, true)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(users)) {
+		assert.Equal(t, outsiderID, users[0].ID)
+	}
+	count5, _ = repo.Count(outsider, true)
+	assert.Equal(t, 1, count5)
+	_, err = repo.Get(outsider, otherID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	// unlike the queries built by dbcontext outside a transaction, which are never scoped
+	var count6 int
+	assert.Nil(t, db.With(tenant).Select("COUNT(*)").From("users").Row(&count6))
+	assert.Equal(t, 0, count6)
+
+	// the row level security policies hide the users of the other tenants from the unscoped queries,
+	// except for the current user
+	err = db.Transactional(dbcontext.WithUser(tenant, otherID), func(ctx context.Context) error {
+		var ids []string
+		assert.Nil(t, db.With(ctx).Select("id").From("users").Column(&ids))
+		assert.Equal(t, []string{otherID}, ids)
+		return nil
+	})
+	assert.Nil(t, err)
+	err = db.Transactional(dbcontext.WithUser(dbcontext.WithTenant(ctx, "org2"), userID), func(ctx context.Context) error {
+		var ids []string
+		assert.Nil(t, db.With(ctx).Select("id").From("users").Column(&ids))
+		assert.Equal(t, []string{userID}, ids)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// the policies fail closed: the users are hidden from the transactions that are neither scoped to a tenant
+	// nor explicitly unscoped, and cannot be created by them
+	err = db.Transactional(context.Background(), func(ctx context.Context) error {
+		var count int
+		assert.Nil(t, db.With(ctx).Select("COUNT(*)").From("users").Row(&count))
+		assert.Equal(t, 0, count)
+		return repo.Create(ctx, entity.User{ID: entity.GenerateID(), Username: "unscoped", Email: "unscoped@test.test", CreatedAt: now, UpdatedAt: &now, Version: 1})
+	})
+	assert.NotNil(t, err)
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		var ids []string
+		assert.Nil(t, db.With(ctx).Select("id").From("users").OrderBy("id").Column(&ids))
+		assert.ElementsMatch(t, []string{userID, otherID, outsiderID}, ids)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// a user cannot be restored within a tenant when its username has been taken by a user of another tenant,
+	// although that user is hidden
+	assert.Nil(t, repo.Delete(tenant, otherID, 1))
+	err = repo.Create(ctx, entity.User{ID: entity.GenerateID(), Username: "annsmith", Email: "smith@test.test", CreatedAt: now, UpdatedAt: &now, Version: 1})
+	assert.Nil(t, err)
+	err = repo.Restore(tenant, otherID)
+	assert.Equal(t, errors.Conflict("The username or email of the user is used by another user."), err)
+
+	// the usernames are unique across the tenants, although the users of the other tenants are hidden
+	err = repo.Create(tenant, entity.User{ID: entity.GenerateID(), Username: user.Username, Email: "other@test.test", CreatedAt: now, UpdatedAt: &now, Version: 1})
+	assert.Equal(t, errors.BadRequest("username already exists"), err)
 }
@@ -1,19 +1,31 @@
 package user
 
 import (
+	"backend/internal/audit"
+	"backend/internal/auth"
 	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/events"
+	"backend/pkg/dbcontext"
 	"backend/pkg/log"
+	"backend/pkg/password"
 	"context"
-	validation "github.com/go-ozzo/ozzo-validation"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"regexp"
+	"time"
 )
 
 // Service encapsulates usecase logic for users.
 type Service interface {
 	Get(ctx context.Context, id string) (User, error)
-	Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}) ([]User, error)
-	Count(ctx context.Context) (int, error)
-
+	Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}, includeDeleted bool) ([]User, error)
+	Count(ctx context.Context, includeDeleted bool) (int, error)
+	Create(ctx context.Context, input CreateUserRequest) (User, error)
+	CreateVerified(ctx context.Context, input CreateUserRequest) (User, error)
+	Update(ctx context.Context, id string, version int, input UpdateUserRequest) (User, error)
+	Delete(ctx context.Context, id string, version int) (User, error)
+	Restore(ctx context.Context, id string) (User, error)
+	AssignRoles(ctx context.Context, id string, input AssignRolesRequest) (User, error)
 }
 
 // User represents the data about an user.
@@ -21,13 +33,25 @@ type User struct {
 	entity.User
 }
 
+// auditedUser is the representation of a user in the audit log. Unlike the responses, it includes the password
+// hash, which the audit log redacts, so that the password changes are recorded.
+type auditedUser struct {
+	entity.User
+	Password string `json:"password"`
+}
+
+// audited returns the representation of the user in the audit log.
+func audited(user entity.User) auditedUser {
+	return auditedUser{user, user.Password}
+}
+
 // CreateUserRequest represents an user creation request.
 type CreateUserRequest struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Username  string `json:"username"`
+	FirstName string  `json:"first_name"`
+	LastName  string  `json:"last_name"`
+	Username  string  `json:"username"`
 	Password  *string `json:"password"`
-	Email		string `json:"email"`
+	Email     string  `json:"email"`
 }
 
 // Validate validates the CreateUserRequest fields.
@@ -43,12 +67,14 @@ func (m CreateUserRequest) Validate() error {
 
 // UpdateUserRequest represents an user update request.
 type UpdateUserRequest struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Username  string `json:"username"`
+	FirstName string  `json:"first_name"`
+	LastName  string  `json:"last_name"`
+	Username  string  `json:"username"`
 	Password  *string `json:"password"`
-	Email		string `json:"email"`
-	IsActive	*bool `json:"is_active"`
+	Email     string  `json:"email"`
+	IsActive  *bool   `json:"is_active"`
+	// the current password of the user, required when they change their own password
+	CurrentPassword *string `json:"current_password"`
 }
 
 // Validate validates the CreateUserRequest fields.
@@ -62,33 +88,82 @@ func (m UpdateUserRequest) Validate() error {
 	)
 }
 
+// AssignRolesRequest represents a request to replace the roles of an user.
+type AssignRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// Validate validates the AssignRolesRequest fields.
+func (m AssignRolesRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Roles, validation.NotNil, validation.Each(validation.Required, validation.Length(0, 50))),
+	)
+}
+
+// entityType identifies users in the audit log and in the domain events.
+const entityType = "user"
+
+// userEvent is the payload of the domain events about users.
+type userEvent struct {
+	ID        string   `json:"id"`
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	IsActive  bool     `json:"is_active"`
+	Roles     []string `json:"roles"`
+}
+
+// newUserEvent creates the payload of an event about the user, which leaves out the password.
+func newUserEvent(user entity.User) userEvent {
+	return userEvent{user.ID, user.Username, user.Email, user.FirstName, user.LastName, user.IsActive, user.Roles}
+}
+
+// EmailVerifier sends the links verifying the email addresses of the users.
+type EmailVerifier interface {
+	// RequestVerification emails a verification link for the given address of the user with the specified ID.
+	RequestVerification(ctx context.Context, userID, email string) error
+}
+
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	events        events.Recorder
+	verifier      EmailVerifier
+	passwords     *password.Hasher
+	policy        password.Policy
+	logger        log.Logger
 }
 
 // NewService creates a new user service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The changes are recorded in the audit log, and the domain events in the outbox,
+// within the transactions started by transactional. The new email addresses are verified by the verifier,
+// and the new passwords must follow the policy before they are hashed by the hasher.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, recorder audit.Recorder, eventRecorder events.Recorder, verifier EmailVerifier, passwords *password.Hasher, policy password.Policy, logger log.Logger) Service {
+	return service{repo, transactional, recorder, eventRecorder, verifier, passwords, policy, logger}
 }
 
-// Get returns the user with the specified the user ID.
+// Get returns the user with the specified the user ID, including its roles.
 func (s service) Get(ctx context.Context, id string) (User, error) {
 	user, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return User{}, err
 	}
+	if user.Roles, err = s.repo.GetRoles(ctx, id); err != nil {
+		return User{}, err
+	}
 	return User{user}, nil
 }
 
 // Count returns the number of users.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+func (s service) Count(ctx context.Context, includeDeleted bool) (int, error) {
+	return s.repo.Count(ctx, includeDeleted)
 }
 
 // Query returns the users with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}) ([]User, error) {
-	items, err := s.repo.Query(ctx, offset, limit, term, filters)
+func (s service) Query(ctx context.Context, offset, limit int, term string, filters map[string]interface{}, includeDeleted bool) ([]User, error) {
+	items, err := s.repo.Query(ctx, offset, limit, term, filters, includeDeleted)
 	if err != nil {
 		return nil, err
 	}
@@ -98,3 +173,260 @@ func (s service) Query(ctx context.Context, offset, limit int, term string, filt
 	}
 	return result, nil
 }
+
+// Create creates a new user and emails a link verifying their email address.
+func (s service) Create(ctx context.Context, req CreateUserRequest) (User, error) {
+	return s.create(ctx, req, false)
+}
+
+// CreateVerified creates a new user whose email address is known to be theirs, such as an invitee
+// who received the invitation at that address.
+func (s service) CreateVerified(ctx context.Context, req CreateUserRequest) (User, error) {
+	return s.create(ctx, req, true)
+}
+
+// create creates a new user, whose email address is either verified or to be verified.
+func (s service) create(ctx context.Context, req CreateUserRequest, verified bool) (User, error) {
+	if err := req.Validate(); err != nil {
+		return User{}, err
+	}
+	if err := s.checkPassword(*req.Password, req.Username, req.Email); err != nil {
+		return User{}, err
+	}
+	hash, err := s.passwords.Hash(*req.Password)
+	if err != nil {
+		return User{}, err
+	}
+	now := time.Now()
+	user := entity.User{
+		ID:        entity.GenerateID(),
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Username:  req.Username,
+		Password:  hash,
+		Email:     req.Email,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: &now,
+		Version:   1,
+	}
+	if verified {
+		user.EmailVerifiedAt = &now
+	}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, user); err != nil {
+			return err
+		}
+		if err := s.recorder.Record(ctx, audit.ActionCreate, entityType, user.ID, nil, audited(user)); err != nil {
+			return err
+		}
+		if err := s.events.Record(ctx, events.UserCreated, entityType, user.ID, newUserEvent(user)); err != nil {
+			return err
+		}
+		if verified {
+			return nil
+		}
+		return s.verifier.RequestVerification(ctx, user.ID, user.Email)
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return s.Get(ctx, user.ID)
+}
+
+// Update updates the user with the specified ID.
+// The version is the one the client has read. The update fails if the user has been modified since then.
+// The password is changed only if a new one is given. A new email address replaces the current one
+// only once it has been verified with the link emailed to it.
+func (s service) Update(ctx context.Context, id string, version int, req UpdateUserRequest) (User, error) {
+	if err := req.Validate(); err != nil {
+		return User{}, err
+	}
+	if req.Password != nil && *req.Password != "" {
+		if err := s.checkPassword(*req.Password, req.Username, req.Email); err != nil {
+			return User{}, err
+		}
+	}
+
+	var user User
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before.Version != version {
+			return errors.PreconditionFailed("")
+		}
+		if err := s.checkOtherOrganizations(ctx, id); err != nil {
+			return err
+		}
+		if auth.IsImpersonated(ctx) && (req.Password != nil && *req.Password != "" || req.Email != before.Email) {
+			return errors.Forbidden("The password and the email address cannot be changed while impersonating a user.")
+		}
+		if err := s.checkSelfUpdate(ctx, before.User, req); err != nil {
+			return err
+		}
+		user = before
+		user.FirstName = req.FirstName
+		user.LastName = req.LastName
+		user.Username = req.Username
+		if req.IsActive != nil {
+			user.IsActive = *req.IsActive
+		}
+		if req.Password != nil && *req.Password != "" {
+			hash, err := s.passwords.Hash(*req.Password)
+			if err != nil {
+				return err
+			}
+			user.Password = hash
+		}
+		now := time.Now()
+		user.UpdatedAt = &now
+
+		if err := s.repo.Update(ctx, user.User); err != nil {
+			return err
+		}
+		user.Version++
+		if err := s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, audited(before.User), audited(user.User)); err != nil {
+			return err
+		}
+		if before.IsActive && !user.IsActive {
+			if err := s.events.Record(ctx, events.UserDeactivated, entityType, id, newUserEvent(user.User)); err != nil {
+				return err
+			}
+		}
+		if req.Email != before.Email {
+			return s.verifier.RequestVerification(ctx, id, req.Email)
+		}
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// checkPassword checks a new password of the user with the given username and email address against the policy.
+// The violated rules are reported as errors of the password field.
+func (s service) checkPassword(password, username, email string) error {
+	if err := s.policy.Check(password, username, email); err != nil {
+		return validation.Errors{"password": err}
+	}
+	return nil
+}
+
+// checkSelfUpdate restricts the changes the users make to their own account: only the administrators can
+// activate or deactivate users, and the users changing their own password must give the current one.
+func (s service) checkSelfUpdate(ctx context.Context, user entity.User, req UpdateUserRequest) error {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return nil
+	}
+	if req.IsActive != nil && *req.IsActive != user.IsActive && !identity.HasRole(entity.RoleAdministrator) {
+		return errors.Forbidden("Only administrators can activate or deactivate users.")
+	}
+	if req.Password == nil || *req.Password == "" || identity.GetID() != user.ID {
+		return nil
+	}
+	if req.CurrentPassword == nil || *req.CurrentPassword == "" {
+		return validation.Errors{"current_password": validation.ErrRequired}
+	}
+	if ok, _, err := s.passwords.Verify(user.Password, *req.CurrentPassword); err != nil {
+		return err
+	} else if !ok {
+		return validation.Errors{"current_password": validation.NewError("validation_current_password", "is incorrect")}
+	}
+	return nil
+}
+
+// checkOtherOrganizations forbids the administrators of an organization to change, delete or restore the users who
+// are also a member of another organization, e.g. to take over their account there: only the staff can. Within the
+// organization, the roles of these users can still be replaced, and the users can still update their own account.
+func (s service) checkOtherOrganizations(ctx context.Context, id string) error {
+	if identity := auth.CurrentUser(ctx); identity != nil && identity.GetID() == id {
+		return nil
+	}
+	other, err := s.repo.InOtherOrganizations(ctx, id)
+	if err != nil {
+		return err
+	}
+	if other {
+		return errors.Forbidden("The user is also a member of other organizations and can only be changed by the staff.")
+	}
+	return nil
+}
+
+// Delete deletes the user with the specified ID. The user can be restored until it is purged.
+// The version is the one the client has read. The deletion fails if the user has been modified since then.
+func (s service) Delete(ctx context.Context, id string, version int) (User, error) {
+	var user User
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if user, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		if user.Version != version {
+			return errors.PreconditionFailed("")
+		}
+		if err = s.checkOtherOrganizations(ctx, id); err != nil {
+			return err
+		}
+		if err = s.repo.Delete(ctx, id, version); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionDelete, entityType, id, audited(user.User), nil)
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// Restore undoes the deletion of the user with the specified ID.
+func (s service) Restore(ctx context.Context, id string) (User, error) {
+	var user User
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if err = s.checkOtherOrganizations(ctx, id); err != nil {
+			return err
+		}
+		if err = s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+		if user, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		return s.recorder.Record(ctx, audit.ActionRestore, entityType, id, nil, audited(user.User))
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// AssignRoles replaces the roles of the user with the specified ID.
+func (s service) AssignRoles(ctx context.Context, id string, req AssignRolesRequest) (User, error) {
+	if err := req.Validate(); err != nil {
+		return User{}, err
+	}
+
+	var user User
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		before, err := s.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.AssignRoles(ctx, id, req.Roles); err != nil {
+			return err
+		}
+		if user, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		if err := s.recorder.Record(ctx, audit.ActionUpdate, entityType, id, audited(before.User), audited(user.User)); err != nil {
+			return err
+		}
+		return s.events.Record(ctx, events.UserRolesAssigned, entityType, id, newUserEvent(user.User))
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
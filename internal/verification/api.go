@@ -0,0 +1,49 @@
+package verification
+
+import (
+	"backend/internal/errors"
+	"backend/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+// The public endpoints are handled by publicHandler first (e.g. to rate limit them per client IP), the others by authHandler.
+func RegisterHandlers(r *routing.RouteGroup, service Service, publicHandler, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the link sent by email is authenticated by its token
+	r.Get("/email/confirm", publicHandler, res.confirm)
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Post("/me/email/verify", res.resend)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) resend(c *routing.Context) error {
+	verification, err := r.service.Resend(c.Request.Context())
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(verification, http.StatusAccepted)
+}
+
+func (r resource) confirm(c *routing.Context) error {
+	token := c.Query("token")
+	if token == "" {
+		return errors.BadRequest("the token is missing")
+	}
+	verification, err := r.service.Confirm(c.Request.Context(), token)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(verification)
+}
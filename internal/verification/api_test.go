@@ -0,0 +1,182 @@
+package verification
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/notify"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{users: []entity.User{
+		{ID: "100", FirstName: "Tester", LastName: "Admin", Email: "tester@test.test"},
+		{ID: "101", Email: "taken@test.test"},
+	}}
+	mailer := &notify.MockMailer{}
+	service := newTestService(t, repo, mailer, logger)
+	RegisterHandlers(router.Group(""), service, test.MockHandler, auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"resend", "POST", "/me/email/verify", "", header, http.StatusAccepted, `*"email":"tester@test.test"*`},
+		{"resend auth error", "POST", "/me/email/verify", "", nil, http.StatusUnauthorized, ""},
+		{"confirm without token", "GET", "/email/confirm", "", nil, http.StatusBadRequest, ""},
+		{"confirm unknown", "GET", "/email/confirm?token=unknown", "", nil, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+	// the link is sent once a minute at most
+	assert.Nil(t, service.RequestVerification(context.Background(), "100", "tester@test.test"))
+	assert.Equal(t, 1, len(mailer.Messages()))
+
+	path := confirmPath(t, mailer, "tester@test.test")
+	tests = []test.APITestCase{
+		{"confirm", "GET", path, "", nil, http.StatusOK, `*"email":"tester@test.test"*`},
+		{"confirm again", "GET", path, "", nil, http.StatusNotFound, ""},
+		{"resend verified", "POST", "/me/email/verify", "", header, http.StatusConflict, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+	assert.NotNil(t, repo.users[0].EmailVerifiedAt)
+}
+
+func TestService_ChangeEmail(t *testing.T) {
+	logger, _ := log.NewForTest()
+	verifiedAt := time.Now().Add(-time.Hour)
+	repo := &mockRepository{users: []entity.User{
+		{ID: "100", Email: "old@test.test", EmailVerifiedAt: &verifiedAt},
+		{ID: "101", Email: "taken@test.test"},
+	}}
+	mailer := &notify.MockMailer{}
+	s := newTestService(t, repo, mailer, logger)
+	ctx := auth.WithUser(context.Background(), "100", "tester", "old@test.test", nil, true)
+
+	assert.NotNil(t, s.RequestVerification(ctx, "100", "taken@test.test"))
+	assert.Nil(t, s.RequestVerification(ctx, "100", "first@test.test"))
+	first := confirmPath(t, mailer, "first@test.test")
+	assert.Nil(t, s.RequestVerification(ctx, "100", "new@test.test"))
+
+	// the address is unchanged until the new one is confirmed
+	assert.Equal(t, "old@test.test", repo.users[0].Email)
+	verification, err := s.Resend(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@test.test", verification.Email)
+
+	// only the last requested address can be confirmed
+	_, err = s.Confirm(ctx, strings.TrimPrefix(first, "/email/confirm?token="))
+	assert.NotNil(t, err)
+	_, err = s.Confirm(ctx, strings.TrimPrefix(confirmPath(t, mailer, "new@test.test"), "/email/confirm?token="))
+	assert.Nil(t, err)
+	assert.Equal(t, "new@test.test", repo.users[0].Email)
+	assert.True(t, repo.users[0].EmailVerifiedAt.After(verifiedAt))
+}
+
+// confirmPath returns the path of the last verification link sent to the address.
+func confirmPath(t *testing.T, mailer *notify.MockMailer, email string) string {
+	msg, ok := mailer.Last(email)
+	if !ok {
+		t.Fatalf("no email sent to %v", email)
+	}
+	token := regexp.MustCompile(`token=([\w-]+)`).FindStringSubmatch(msg.Text)[1]
+	return fmt.Sprintf("/email/confirm?token=%v", token)
+}
+
+func newTestService(t *testing.T, repo *mockRepository, mailer notify.Mailer, logger log.Logger) Service {
+	templates, err := notify.LoadTemplates("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(repo, test.MockTransactional, &audit.MockRecorder{}, notify.NewNotifier(mailer, templates),
+		Options{TTL: 24 * time.Hour, URL: "https://api.test/v1/email/confirm"}, logger)
+}
+
+type mockRepository struct {
+	users         []entity.User
+	verifications []entity.EmailVerification
+}
+
+func (m *mockRepository) GetUser(ctx context.Context, id string) (entity.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Latest(ctx context.Context, userID string) (entity.EmailVerification, error) {
+	for i := len(m.verifications) - 1; i >= 0; i-- {
+		if m.verifications[i].UserID == userID {
+			return m.verifications[i], nil
+		}
+	}
+	return entity.EmailVerification{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetByToken(ctx context.Context, tokenHash string) (entity.EmailVerification, error) {
+	for _, v := range m.verifications {
+		if v.TokenHash == tokenHash {
+			return v, nil
+		}
+	}
+	return entity.EmailVerification{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Create(ctx context.Context, verification entity.EmailVerification) error {
+	m.verifications = append(m.verifications, verification)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, verification entity.EmailVerification) error {
+	for i, v := range m.verifications {
+		if v.ID == verification.ID {
+			m.verifications[i] = verification
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) ExpirePending(ctx context.Context, userID string, now time.Time) error {
+	for i, v := range m.verifications {
+		if v.UserID == userID && v.IsPending(now) {
+			m.verifications[i].ExpiresAt = now
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) EmailTaken(ctx context.Context, email, userID string) (bool, error) {
+	for _, user := range m.users {
+		if user.ID != userID && strings.EqualFold(user.Email, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) ConfirmEmail(ctx context.Context, userID, email string, at time.Time) error {
+	for i, user := range m.users {
+		if user.ID == userID {
+			m.users[i].Email = email
+			m.users[i].EmailVerifiedAt = &at
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
@@ -0,0 +1,133 @@
+package verification
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access email verifications from the data source.
+type Repository interface {
+	// GetUser returns the user with the specified ID, unless it has been deleted.
+	GetUser(ctx context.Context, id string) (entity.User, error)
+	// Latest returns the last verification requested for the user with the specified ID.
+	Latest(ctx context.Context, userID string) (entity.EmailVerification, error)
+	// GetByToken returns the verification whose token has the given hash and locks it until the end of the
+	// transaction, so that it cannot be confirmed twice. It must be called within a transaction.
+	GetByToken(ctx context.Context, tokenHash string) (entity.EmailVerification, error)
+	// Create saves a new verification in the storage.
+	Create(ctx context.Context, verification entity.EmailVerification) error
+	// Update updates the verification with given ID in the storage.
+	Update(ctx context.Context, verification entity.EmailVerification) error
+	// ExpirePending makes the pending verifications of the user with the specified ID expire at the given time.
+	ExpirePending(ctx context.Context, userID string, now time.Time) error
+	// EmailTaken reports whether a user other than the one with the specified ID has the given email address.
+	// Deleted users are not taken into account.
+	EmailTaken(ctx context.Context, email, userID string) (bool, error)
+	// ConfirmEmail sets the email address of the user with the specified ID, verified at the given time,
+	// and increments the version of the user.
+	ConfirmEmail(ctx context.Context, userID, email string, at time.Time) error
+}
+
+// repository persists email verifications in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new email verification repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetUser reads the user with the specified ID from the database.
+// Like the other methods accessing the users, it runs in a transaction so that the row level security
+// policies of the database let it find the user.
+func (r repository) GetUser(ctx context.Context, id string) (entity.User, error) {
+	var user entity.User
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select().Where(dbx.HashExp{"deleted_at": nil}).Model(id, &user)
+	})
+	return user, err
+}
+
+// Latest reads the last verification record of a user from the database.
+func (r repository) Latest(ctx context.Context, userID string) (entity.EmailVerification, error) {
+	var verification entity.EmailVerification
+	err := r.db.With(ctx).Select().
+		Where(dbx.HashExp{"user_id": userID}).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(1).
+		One(&verification)
+	return verification, err
+}
+
+// GetByToken reads the verification with the specified token hash and locks it with FOR UPDATE.
+func (r repository) GetByToken(ctx context.Context, tokenHash string) (entity.EmailVerification, error) {
+	var verification entity.EmailVerification
+	err := r.db.With(ctx).NewQuery("SELECT * FROM email_verifications WHERE token_hash = {:hash} FOR UPDATE").
+		Bind(dbx.Params{"hash": tokenHash}).
+		One(&verification)
+	return verification, err
+}
+
+// Create saves a new verification record in the database.
+func (r repository) Create(ctx context.Context, verification entity.EmailVerification) error {
+	return r.db.With(ctx).Model(&verification).Insert()
+}
+
+// Update saves the changes to a verification in the database.
+func (r repository) Update(ctx context.Context, verification entity.EmailVerification) error {
+	return r.db.With(ctx).Model(&verification).Update()
+}
+
+// ExpirePending updates the expiry of the pending verification records of a user in the database.
+func (r repository) ExpirePending(ctx context.Context, userID string, now time.Time) error {
+	_, err := r.db.With(ctx).Update("email_verifications", dbx.Params{"expires_at": now}, dbx.And(
+		dbx.HashExp{"user_id": userID, "confirmed_at": nil},
+		dbx.NewExp("expires_at > {:now}", dbx.Params{"now": now}),
+	)).Execute()
+	return err
+}
+
+// EmailTaken counts the other user records having the email address in the database.
+func (r repository) EmailTaken(ctx context.Context, email, userID string) (bool, error) {
+	var count int
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.db.With(ctx).Select("COUNT(*)").From("users").
+			Where(dbx.And(
+				dbx.NewExp("LOWER(email) = LOWER({:email})", dbx.Params{"email": email}),
+				dbx.Not(dbx.HashExp{"id": userID}),
+				dbx.HashExp{"deleted_at": nil},
+			)).
+			Row(&count)
+	})
+	return count > 0, err
+}
+
+// ConfirmEmail updates the email address of a user record in the database.
+// sql.ErrNoRows is returned if the user does not exist or has been deleted.
+func (r repository) ConfirmEmail(ctx context.Context, userID, email string, at time.Time) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		res, err := r.db.With(ctx).Update("users", dbx.Params{
+			"email":             email,
+			"email_verified_at": at,
+			"updated_at":        at,
+			"version":           dbx.NewExp("version + 1"),
+		}, dbx.HashExp{"id": userID, "deleted_at": nil}).Execute()
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
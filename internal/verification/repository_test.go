@@ -0,0 +1,78 @@
+package verification
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "users")
+	repo := NewRepository(db, logger)
+
+	// the users are subject to the row level security policies of the database
+	ctx := dbcontext.Unscoped(context.Background())
+	now := time.Now()
+	err := db.Transactional(ctx, func(ctx context.Context) error {
+		return db.With(ctx).Model(&entity.User{
+			ID:        "100",
+			Username:  "tester",
+			Password:  "secret",
+			Email:     "old@test.test",
+			CreatedAt: now,
+			UpdatedAt: &now,
+			Version:   1,
+		}).Insert()
+	})
+	assert.Nil(t, err)
+
+	// create
+	for i, email := range []string{"a@test.test", "b@test.test"} {
+		err := repo.Create(ctx, entity.EmailVerification{
+			ID:        email,
+			UserID:    "100",
+			Email:     email,
+			TokenHash: hashToken(email),
+			ExpiresAt: now.Add(time.Hour),
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+		})
+		assert.Nil(t, err)
+	}
+	latest, err := repo.Latest(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, "b@test.test", latest.Email)
+	_, err = repo.Latest(ctx, "101")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// expire
+	assert.Nil(t, repo.ExpirePending(ctx, "100", now))
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		verification, err := repo.GetByToken(ctx, hashToken("a@test.test"))
+		assert.Nil(t, err)
+		assert.False(t, verification.IsPending(now))
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// confirm
+	taken, err := repo.EmailTaken(ctx, "OLD@test.test", "101")
+	assert.Nil(t, err)
+	assert.True(t, taken)
+	taken, _ = repo.EmailTaken(ctx, "old@test.test", "100")
+	assert.False(t, taken)
+	assert.Nil(t, repo.ConfirmEmail(ctx, "100", "b@test.test", now))
+	user, err := repo.GetUser(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, "b@test.test", user.Email)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.Equal(t, 2, user.Version)
+	assert.Equal(t, sql.ErrNoRows, repo.ConfirmEmail(ctx, "101", "b@test.test", now))
+}
@@ -0,0 +1,233 @@
+// Package verification verifies the email addresses of the users by sending them links with single-use tokens.
+//
+// A new email address does not replace the address of a user until it is confirmed.
+package verification
+
+import (
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/notify"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// resendInterval is the minimum delay between two verification emails sent to the same address.
+const resendInterval = time.Minute
+
+// Service encapsulates usecase logic for email verifications.
+type Service interface {
+	// RequestVerification emails a verification link for the given address of the user with the specified ID.
+	// The pending verifications of the user are cancelled. Nothing is sent if a link was sent to the same
+	// address less than a minute ago.
+	RequestVerification(ctx context.Context, userID, email string) error
+	// Resend emails a new verification link to the current user, for the address they are changing to
+	// or else for their current address.
+	Resend(ctx context.Context) (entity.EmailVerification, error)
+	// Confirm confirms the verification with the given token. The verified address becomes the address of the user.
+	Confirm(ctx context.Context, token string) (entity.EmailVerification, error)
+}
+
+// Options represents the settings of the email verifications.
+type Options struct {
+	// how long a verification link is valid
+	TTL time.Duration
+	// the URL confirming the verifications. The token is added as the "token" query parameter
+	URL string
+}
+
+// entityType identifies users in the audit log.
+const entityType = "user"
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	recorder      audit.Recorder
+	notifier      *notify.Notifier
+	opts          Options
+	logger        log.Logger
+	now           func() time.Time
+}
+
+// NewService creates a new email verification service.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, recorder audit.Recorder, notifier *notify.Notifier, opts Options, logger log.Logger) Service {
+	return service{repo, transactional, recorder, notifier, opts, logger, time.Now}
+}
+
+// RequestVerification creates a verification and emails its token.
+func (s service) RequestVerification(ctx context.Context, userID, email string) error {
+	_, err := s.request(ctx, userID, email)
+	return err
+}
+
+// request creates a verification for the address and emails its token, unless the last verification
+// of the user was created for the same address less than resendInterval ago, in which case it is returned instead.
+func (s service) request(ctx context.Context, userID, email string) (entity.EmailVerification, error) {
+	var verification entity.EmailVerification
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		user, err := s.repo.GetUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkEmail(ctx, email, userID); err != nil {
+			return err
+		}
+		now := s.now()
+		latest, err := s.repo.Latest(ctx, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && latest.IsPending(now) && strings.EqualFold(latest.Email, email) && now.Sub(latest.CreatedAt) < resendInterval {
+			verification = latest
+			return nil
+		}
+
+		token, hash, err := generateToken()
+		if err != nil {
+			return err
+		}
+		link, err := s.link(token)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.ExpirePending(ctx, userID, now); err != nil {
+			return err
+		}
+		verification = entity.EmailVerification{
+			ID:        entity.GenerateID(),
+			UserID:    userID,
+			Email:     email,
+			TokenHash: hash,
+			ExpiresAt: now.Add(s.opts.TTL),
+			CreatedAt: now,
+		}
+		if err := s.repo.Create(ctx, verification); err != nil {
+			return err
+		}
+		return s.notifier.Notify(ctx, email, "", notify.TemplateVerification, notify.Data{
+			Name:      user.GetUsername(),
+			URL:       link,
+			ExpiresIn: int(s.opts.TTL / time.Hour),
+		})
+	})
+	return verification, err
+}
+
+// Resend emails a new verification link to the current user.
+// A conflict error is returned if the address of the user is verified and is not being changed.
+func (s service) Resend(ctx context.Context) (entity.EmailVerification, error) {
+	identity := auth.CurrentUser(ctx)
+	if identity == nil {
+		return entity.EmailVerification{}, errors.Unauthorized("")
+	}
+	user, err := s.repo.GetUser(ctx, identity.GetID())
+	if err != nil {
+		return entity.EmailVerification{}, err
+	}
+	email := user.Email
+	latest, err := s.repo.Latest(ctx, user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return entity.EmailVerification{}, err
+	}
+	if err == nil && latest.IsPending(s.now()) {
+		// a change of address is pending
+		email = latest.Email
+	} else if user.EmailVerifiedAt != nil {
+		return entity.EmailVerification{}, errors.Conflict("the email address is already verified")
+	}
+	return s.request(ctx, user.ID, email)
+}
+
+// Confirm confirms a pending verification. A not found error is returned if the token does not
+// belong to a pending verification.
+func (s service) Confirm(ctx context.Context, token string) (entity.EmailVerification, error) {
+	var verification entity.EmailVerification
+	// the link is opened by a visitor who is not authenticated, so the user is looked up in all the organizations
+	err := s.transactional(dbcontext.Unscoped(ctx), func(ctx context.Context) error {
+		var err error
+		verification, err = s.repo.GetByToken(ctx, hashToken(token))
+		if err == sql.ErrNoRows || (err == nil && !verification.IsPending(s.now())) {
+			return errors.NotFound("The verification link does not exist or has expired.")
+		} else if err != nil {
+			return err
+		}
+		before, err := s.repo.GetUser(ctx, verification.UserID)
+		if err == sql.ErrNoRows {
+			return errors.NotFound("The verification link does not exist or has expired.")
+		} else if err != nil {
+			return err
+		}
+		if err := s.checkEmail(ctx, verification.Email, verification.UserID); err != nil {
+			return err
+		}
+
+		now := s.now()
+		verification.ConfirmedAt = &now
+		if err := s.repo.Update(ctx, verification); err != nil {
+			return err
+		}
+		if err := s.repo.ConfirmEmail(ctx, verification.UserID, verification.Email, now); err != nil {
+			return err
+		}
+		after := before
+		after.Email = verification.Email
+		after.EmailVerifiedAt = &now
+		after.UpdatedAt = &now
+		after.Version++
+		return s.recorder.Record(ctx, audit.ActionUpdate, entityType, before.ID, before, after)
+	})
+	if err != nil {
+		return entity.EmailVerification{}, err
+	}
+	return verification, nil
+}
+
+// checkEmail returns a conflict error if another user has the email address.
+func (s service) checkEmail(ctx context.Context, email, userID string) error {
+	taken, err := s.repo.EmailTaken(ctx, email, userID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.Conflict("a user with this email address already exists")
+	}
+	return nil
+}
+
+// link returns the URL confirming the verification with the given token.
+func (s service) link(token string) (string, error) {
+	u, err := url.Parse(s.opts.URL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// generateToken returns a random verification token and its hash.
+func generateToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hash under which the verification with the given token is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/pkg/log"
+	"backend/pkg/pagination"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+	r.Use(authHandler, auth.RequireRole(entity.RoleAdministrator), auth.DenyTenant)
+	// the following endpoints require a valid JWT of an administrator who is not scoped to an organization.
+	// The impersonated administrators cannot set the secrets of the subscriptions
+	r.Get("/webhooks/<id>", res.get)
+	r.Get("/webhooks", res.query)
+	r.Post("/webhooks", auth.DenyImpersonation, res.create)
+	r.Put("/webhooks/<id>", auth.DenyImpersonation, res.update)
+	r.Delete("/webhooks/<id>", res.delete)
+	r.Get("/webhooks/<id>/deliveries", res.queryDeliveries)
+	r.Get("/webhooks/<id>/deliveries/<deliveryID>", res.getDelivery)
+	r.Post("/webhooks/<id>/deliveries/<deliveryID>/redeliver", res.redeliver)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	subscription, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(subscription)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	subscriptions, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = subscriptions
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateSubscriptionRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	subscription, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(subscription, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input UpdateSubscriptionRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	subscription, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(subscription)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	subscription, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(subscription)
+}
+
+func (r resource) queryDeliveries(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.CountDeliveries(ctx, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	deliveries, err := r.service.QueryDeliveries(ctx, c.Param("id"), pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = deliveries
+	return c.Write(pages)
+}
+
+func (r resource) getDelivery(c *routing.Context) error {
+	delivery, err := r.service.GetDelivery(c.Request.Context(), c.Param("id"), c.Param("deliveryID"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(delivery)
+}
+
+func (r resource) redeliver(c *routing.Context) error {
+	delivery, err := r.service.Redeliver(c.Request.Context(), c.Param("id"), c.Param("deliveryID"))
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(delivery, http.StatusAccepted)
+}
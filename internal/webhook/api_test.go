@@ -0,0 +1,181 @@
+package webhook
+
+import (
+	"backend/internal/auth"
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{
+		items: []entity.WebhookSubscription{
+			{"123", "https://example.com/hook", []string{}, "secret", true, time.Now(), time.Now()},
+			{"124", "https://example.com/inactive", []string{}, "secret", false, time.Now(), time.Now()},
+		},
+		deliveries: []entity.WebhookDelivery{
+			{ID: "d1", SubscriptionID: "123", EventID: "e1", EventType: "user.created", Payload: []byte(`{}`), Status: entity.DeliveryFailed},
+			{ID: "d2", SubscriptionID: "124", EventID: "e1", EventType: "user.created", Payload: []byte(`{}`), Status: entity.DeliveryFailed},
+		},
+	}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/webhooks", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get 123", "GET", "/webhooks/123", "", header, http.StatusOK, `*"url":"https://example.com/hook"*`},
+		{"get unknown", "GET", "/webhooks/1234", "", header, http.StatusNotFound, ""},
+		{"create impersonated", "POST", "/webhooks", `{"url":"https://example.com/new"}`, auth.MockImpersonationHeader(), http.StatusForbidden, ""},
+		{"create ok", "POST", "/webhooks", `{"url":"https://example.com/new","event_types":["user.created"]}`, header, http.StatusCreated, `*"secret":"whsec_*`},
+		{"create with secret", "POST", "/webhooks", `{"url":"https://example.com/new","secret":"0123456789abcdef"}`, header, http.StatusCreated, `*"secret":"0123456789abcdef"*`},
+		{"create invalid url", "POST", "/webhooks", `{"url":"example.com"}`, header, http.StatusBadRequest, ""},
+		{"create invalid event type", "POST", "/webhooks", `{"url":"https://example.com/new","event_types":["album.created"]}`, header, http.StatusBadRequest, ""},
+		{"create input error", "POST", "/webhooks", `"url":"test"}`, header, http.StatusBadRequest, ""},
+		{"update ok", "PUT", "/webhooks/123", `{"url":"https://example.com/updated","is_active":true}`, header, http.StatusOK, `*"url":"https://example.com/updated"*`},
+		{"update verify", "GET", "/webhooks/123", "", header, http.StatusOK, `*"url":"https://example.com/updated"*`},
+		{"update unknown", "PUT", "/webhooks/1234", `{"url":"https://example.com/updated"}`, header, http.StatusNotFound, ""},
+		{"get deliveries", "GET", "/webhooks/123/deliveries", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get deliveries of unknown", "GET", "/webhooks/1234/deliveries", "", header, http.StatusNotFound, ""},
+		{"get delivery", "GET", "/webhooks/123/deliveries/d1", "", header, http.StatusOK, `*"status":"failed"*`},
+		{"get delivery of other subscription", "GET", "/webhooks/123/deliveries/d2", "", header, http.StatusNotFound, ""},
+		{"redeliver", "POST", "/webhooks/123/deliveries/d1/redeliver", "", header, http.StatusAccepted, `*"redelivery_of":"d1"*`},
+		{"redeliver verify", "GET", "/webhooks/123/deliveries", "", header, http.StatusOK, `*"total_count":2*`},
+		{"redeliver inactive", "POST", "/webhooks/124/deliveries/d2/redeliver", "", header, http.StatusBadRequest, ""},
+		{"delete ok", "DELETE", "/webhooks/123", "", header, http.StatusOK, `*"id":"123"*`},
+		{"delete verify", "GET", "/webhooks/123", "", header, http.StatusNotFound, ""},
+		{"auth error", "GET", "/webhooks", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+type mockRepository struct {
+	items      []entity.WebhookSubscription
+	deliveries []entity.WebhookDelivery
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.WebhookSubscription, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.WebhookSubscription{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.WebhookSubscription, error) {
+	return m.items, nil
+}
+
+func (m mockRepository) Active(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	var items []entity.WebhookSubscription
+	for _, item := range m.items {
+		if item.IsActive {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, subscription entity.WebhookSubscription) error {
+	if subscription.URL == "https://example.com/error" {
+		return errCRUD
+	}
+	m.items = append(m.items, subscription)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, subscription entity.WebhookSubscription) error {
+	for i, item := range m.items {
+		if item.ID == subscription.ID {
+			m.items[i] = subscription
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i] = m.items[len(m.items)-1]
+			m.items = m.items[:len(m.items)-1]
+			break
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) GetDelivery(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error) {
+	for _, item := range m.deliveries {
+		if item.ID == id && item.SubscriptionID == subscriptionID {
+			return item, nil
+		}
+	}
+	return entity.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (m mockRepository) CountDeliveries(ctx context.Context, subscriptionID string) (int, error) {
+	items, err := m.QueryDeliveries(ctx, subscriptionID, 0, 0)
+	return len(items), err
+}
+
+func (m mockRepository) QueryDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var items []entity.WebhookDelivery
+	for _, item := range m.deliveries {
+		if item.SubscriptionID == subscriptionID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	for _, item := range m.deliveries {
+		if delivery.RedeliveryOf == nil && item.RedeliveryOf == nil &&
+			item.SubscriptionID == delivery.SubscriptionID && item.EventID == delivery.EventID {
+			return nil
+		}
+	}
+	m.deliveries = append(m.deliveries, delivery)
+	return nil
+}
+
+func (m mockRepository) ClaimDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var items []entity.WebhookDelivery
+	for _, item := range m.deliveries {
+		if item.Status == entity.DeliveryPending && !item.NextAttemptAt.After(now) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (m *mockRepository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	for i, item := range m.deliveries {
+		if item.ID == delivery.ID {
+			m.deliveries[i] = delivery
+		}
+	}
+	return nil
+}
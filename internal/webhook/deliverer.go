@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"backend/internal/entity"
+	"backend/internal/events"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBackoff is the longest delay between two attempts of a delivery.
+	maxBackoff = 6 * time.Hour
+	// maxResponseBody is the number of bytes of the responses kept in the delivery log.
+	maxResponseBody = 1024
+)
+
+// Deliverer sends the pending webhook deliveries to the subscribed URLs.
+type Deliverer struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	client        *http.Client
+	opts          events.Options
+	logger        log.Logger
+	now           func() time.Time
+}
+
+// NewDeliverer creates a new Deliverer. A delivery is retried after an exponential backoff until it has
+// failed opts.MaxAttempts times.
+func NewDeliverer(repo Repository, transactional dbcontext.TransactionFunc, client *http.Client, opts events.Options, logger log.Logger) *Deliverer {
+	return &Deliverer{repo, transactional, client, opts, logger, time.Now}
+}
+
+// Deliver sends a batch of pending deliveries and returns the number of deliveries processed.
+func (d *Deliverer) Deliver(ctx context.Context) (int, error) {
+	count := 0
+	err := d.transactional(ctx, func(ctx context.Context) error {
+		deliveries, err := d.repo.ClaimDeliveries(ctx, d.now(), d.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		subscriptions := map[string]*entity.WebhookSubscription{}
+		for _, delivery := range deliveries {
+			subscription, ok := subscriptions[delivery.SubscriptionID]
+			if !ok {
+				s, err := d.repo.Get(ctx, delivery.SubscriptionID)
+				if err != nil && err != sql.ErrNoRows {
+					return err
+				}
+				if err == nil {
+					subscription = &s
+				}
+				subscriptions[delivery.SubscriptionID] = subscription
+			}
+			d.send(ctx, subscription, &delivery)
+			if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Run sends the pending deliveries at the given interval until the context is cancelled.
+// Batches are sent back to back while there are more pending deliveries.
+func (d *Deliverer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := d.Deliver(ctx)
+				if err != nil {
+					d.logger.With(ctx).Errorf("failed to deliver webhooks: %v", err)
+				}
+				if err != nil || n < d.opts.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// send makes an attempt of a delivery and updates its state.
+// Deliveries to deactivated or removed subscriptions fail without being retried.
+func (d *Deliverer) send(ctx context.Context, subscription *entity.WebhookSubscription, delivery *entity.WebhookDelivery) {
+	if subscription == nil || !subscription.IsActive {
+		delivery.Status = entity.DeliveryFailed
+		delivery.LastError = "the subscription is inactive"
+		return
+	}
+
+	delivery.Attempts++
+	now := d.now()
+	err := d.post(ctx, *subscription, delivery, now)
+	if err == nil {
+		delivery.Status = entity.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.opts.MaxAttempts {
+		delivery.Status = entity.DeliveryFailed
+		d.logger.With(ctx).Errorf("webhook delivery %v to %v failed after %v attempts: %v", delivery.ID, subscription.URL, delivery.Attempts, err)
+		return
+	}
+	backoff := d.opts.Backoff << uint(delivery.Attempts-1)
+	if backoff <= 0 || backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	delivery.NextAttemptAt = now.Add(backoff)
+	d.logger.With(ctx).Infof("webhook delivery %v to %v will be retried at %v: %v", delivery.ID, subscription.URL, delivery.NextAttemptAt, err)
+}
+
+// post sends the signed payload of a delivery to the subscription URL and records the response.
+// The delivery fails unless the receiver responds with a 2xx status code.
+func (d *Deliverer) post(ctx context.Context, subscription entity.WebhookSubscription, delivery *entity.WebhookDelivery, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		delivery.ResponseStatus = 0
+		delivery.ResponseBody = ""
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	delivery.ResponseStatus = res.StatusCode
+	// the body is stored as text, which cannot hold invalid UTF-8 sequences or NUL characters
+	delivery.ResponseBody = strings.ReplaceAll(strings.ToValidUTF8(string(body), "\uFFFD"), "\x00", "")
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("the receiver responded with status %v", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package webhook
+
+import (
+	"backend/internal/entity"
+	"backend/internal/events"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is an httptest server that records the webhook requests with a valid signature.
+type receiver struct {
+	sync.Mutex
+	status   int
+	received []*http.Request
+	bodies   []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	body, _ := ioutil.ReadAll(req.Body)
+	err := Verify("0123456789abcdef", req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body, time.Now(), 5*time.Minute)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.received = append(r.received, req)
+	r.bodies = append(r.bodies, string(body))
+	w.WriteHeader(r.status)
+	_, _ = w.Write([]byte("thanks"))
+}
+
+func TestDeliverer_Deliver(t *testing.T) {
+	logger, _ := log.NewForTest()
+	rec := &receiver{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	now := time.Now()
+	repo := &mockRepository{items: []entity.WebhookSubscription{
+		{"1", server.URL, []string{events.UserCreated}, "0123456789abcdef", true, now, now},
+		{"2", server.URL, []string{events.UserDeactivated}, "0123456789abcdef", true, now, now},
+		{"3", server.URL, []string{}, "0123456789abcdef", false, now, now},
+	}}
+
+	// the events are scheduled for the matching active subscriptions only, once per subscription
+	ctx := context.Background()
+	event := entity.Event{ID: "e1", Type: events.UserCreated, AggregateType: "user", AggregateID: "100", Payload: []byte(`{"id":"100"}`), CreatedAt: now}
+	sink := NewSink(repo)
+	assert.Nil(t, sink.Deliver(ctx, event))
+	assert.Nil(t, sink.Deliver(ctx, event))
+	if !assert.Equal(t, 1, len(repo.deliveries)) {
+		return
+	}
+	assert.Equal(t, "1", repo.deliveries[0].SubscriptionID)
+	createdAt := now
+	now = time.Now()
+
+	d := NewDeliverer(repo, test.MockTransactional, server.Client(), events.Options{BatchSize: 10, MaxAttempts: 2, Backoff: time.Minute}, logger)
+	d.now = func() time.Time { return now }
+
+	// a failed delivery is retried after the backoff
+	n, err := d.Deliver(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	delivery := repo.deliveries[0]
+	assert.Equal(t, entity.DeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseStatus)
+	assert.Equal(t, "thanks", delivery.ResponseBody)
+	assert.Equal(t, now.Add(time.Minute), delivery.NextAttemptAt)
+	if assert.Equal(t, 1, len(rec.received)) {
+		assert.Equal(t, delivery.ID, rec.received[0].Header.Get(HeaderID))
+		assert.Equal(t, events.UserCreated, rec.received[0].Header.Get(HeaderEvent))
+		assert.JSONEq(t, `{"id":"e1","type":"user.created","aggregate_type":"user","aggregate_id":"100","payload":{"id":"100"},"created_at":"`+createdAt.Format(time.RFC3339Nano)+`"}`, rec.bodies[0])
+	}
+	n, _ = d.Deliver(ctx)
+	assert.Equal(t, 0, n)
+
+	// the delivery is given up once it has failed MaxAttempts times
+	now = now.Add(time.Minute)
+	n, _ = d.Deliver(ctx)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, entity.DeliveryFailed, repo.deliveries[0].Status)
+	assert.Equal(t, 2, repo.deliveries[0].Attempts)
+
+	// a redelivery succeeds once the receiver is back
+	rec.status = http.StatusOK
+	redelivery, err := NewService(repo, logger).Redeliver(ctx, "1", delivery.ID)
+	assert.Nil(t, err)
+	n, _ = d.Deliver(ctx)
+	assert.Equal(t, 1, n)
+	if assert.Equal(t, 2, len(repo.deliveries)) {
+		assert.Equal(t, redelivery.ID, repo.deliveries[1].ID)
+		assert.Equal(t, entity.DeliveryDelivered, repo.deliveries[1].Status)
+		assert.Equal(t, http.StatusOK, repo.deliveries[1].ResponseStatus)
+		assert.Equal(t, &now, repo.deliveries[1].DeliveredAt)
+		assert.Equal(t, entity.DeliveryFailed, repo.deliveries[0].Status)
+	}
+
+	// the deliveries to deactivated subscriptions fail without being sent
+	repo.items[0].IsActive = false
+	repo.deliveries[0].Status = entity.DeliveryPending
+	n, _ = d.Deliver(ctx)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, entity.DeliveryFailed, repo.deliveries[0].Status)
+	assert.Equal(t, 3, len(rec.received))
+}
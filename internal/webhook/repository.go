@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"backend/internal/entity"
+	"backend/pkg/dbcontext"
+	"backend/pkg/log"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access webhook subscriptions and deliveries from the data source.
+type Repository interface {
+	// Get returns the subscription with the specified ID.
+	Get(ctx context.Context, id string) (entity.WebhookSubscription, error)
+	// Count returns the number of subscriptions.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of subscriptions with the given offset and limit.
+	Query(ctx context.Context, offset, limit int) ([]entity.WebhookSubscription, error)
+	// Active returns the active subscriptions.
+	Active(ctx context.Context) ([]entity.WebhookSubscription, error)
+	// Create saves a new subscription in the storage.
+	Create(ctx context.Context, subscription entity.WebhookSubscription) error
+	// Update updates the subscription with given ID in the storage.
+	Update(ctx context.Context, subscription entity.WebhookSubscription) error
+	// Delete removes the subscription with given ID, together with its deliveries.
+	Delete(ctx context.Context, id string) error
+
+	// GetDelivery returns the delivery with the specified ID made for the given subscription.
+	GetDelivery(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error)
+	// CountDeliveries returns the number of deliveries made for the given subscription.
+	CountDeliveries(ctx context.Context, subscriptionID string) (int, error)
+	// QueryDeliveries returns the deliveries made for the given subscription with the given offset and limit, the newest first.
+	QueryDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]entity.WebhookDelivery, error)
+	// CreateDelivery saves a new delivery in the storage. An event is delivered once per subscription,
+	// so nothing is saved if the event already has a delivery for the subscription, unless it is a redelivery.
+	CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	// ClaimDeliveries locks up to limit pending deliveries which are due at the given time, the oldest first.
+	// Deliveries locked by other deliverers are skipped. It must be called within a transaction,
+	// which keeps the deliveries locked until it ends.
+	ClaimDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error)
+	// UpdateDelivery saves the state of a delivery.
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+}
+
+// repository persists webhook subscriptions and deliveries in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new webhook repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the subscription with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.WebhookSubscription, error) {
+	var subscription entity.WebhookSubscription
+	err := r.db.With(ctx).Select().Model(id, &subscription)
+	return subscription, err
+}
+
+// Count returns the number of the subscription records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook_subscriptions").Row(&count)
+	return count, err
+}
+
+// Query retrieves the subscription records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.WebhookSubscription, error) {
+	var subscriptions []entity.WebhookSubscription
+	err := r.db.With(ctx).
+		Select().
+		OrderBy("created_at", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&subscriptions)
+	return subscriptions, err
+}
+
+// Active retrieves the active subscription records from the database.
+func (r repository) Active(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	var subscriptions []entity.WebhookSubscription
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"is_active": true}).OrderBy("id").All(&subscriptions)
+	return subscriptions, err
+}
+
+// Create saves a new subscription record in the database.
+func (r repository) Create(ctx context.Context, subscription entity.WebhookSubscription) error {
+	return r.db.With(ctx).Model(&subscription).Insert()
+}
+
+// Update saves the changes to a subscription in the database.
+func (r repository) Update(ctx context.Context, subscription entity.WebhookSubscription) error {
+	return r.db.With(ctx).Model(&subscription).Update()
+}
+
+// Delete deletes a subscription with the specified ID from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	subscription, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&subscription).Delete()
+}
+
+// GetDelivery reads the delivery with the specified ID and subscription from the database.
+func (r repository) GetDelivery(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"subscription_id": subscriptionID}).Model(id, &delivery)
+	return delivery, err
+}
+
+// CountDeliveries returns the number of the delivery records of a subscription in the database.
+func (r repository) CountDeliveries(ctx context.Context, subscriptionID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook_deliveries").
+		Where(dbx.HashExp{"subscription_id": subscriptionID}).
+		Row(&count)
+	return count, err
+}
+
+// QueryDeliveries retrieves the delivery records of a subscription with the specified offset and limit from the database.
+func (r repository) QueryDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"subscription_id": subscriptionID}).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// CreateDelivery saves a new delivery record in the database unless the event has already been delivered
+// to the subscription. The payload is sent as text because the driver would send a byte slice as binary data.
+func (r repository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	_, err := r.db.With(ctx).NewQuery(`
+		INSERT INTO webhook_deliveries
+			(id, subscription_id, event_id, event_type, payload, redelivery_of, status, next_attempt_at, created_at)
+		VALUES
+			({:id}, {:subscription_id}, {:event_id}, {:event_type}, {:payload}, {:redelivery_of}, {:status}, {:next_attempt_at}, {:created_at})
+		ON CONFLICT (subscription_id, event_id) WHERE redelivery_of IS NULL DO NOTHING`).
+		Bind(dbx.Params{
+			"id":              delivery.ID,
+			"subscription_id": delivery.SubscriptionID,
+			"event_id":        delivery.EventID,
+			"event_type":      delivery.EventType,
+			"payload":         string(delivery.Payload),
+			"redelivery_of":   delivery.RedeliveryOf,
+			"status":          delivery.Status,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"created_at":      delivery.CreatedAt,
+		}).
+		Execute()
+	return err
+}
+
+// ClaimDeliveries selects the pending deliveries which are due and locks them with FOR UPDATE SKIP LOCKED
+// so that concurrent deliverers never send the same delivery at the same time.
+func (r repository) ClaimDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).NewQuery(`
+		SELECT * FROM webhook_deliveries
+		WHERE status = {:status} AND next_attempt_at <= {:now}
+		ORDER BY created_at
+		LIMIT {:limit}
+		FOR UPDATE SKIP LOCKED`).
+		Bind(dbx.Params{"status": entity.DeliveryPending, "now": now, "limit": limit}).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// UpdateDelivery saves the state of a delivery record in the database.
+func (r repository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	_, err := r.db.With(ctx).Update("webhook_deliveries", dbx.Params{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"response_status": delivery.ResponseStatus,
+		"response_body":   delivery.ResponseBody,
+		"last_error":      delivery.LastError,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"delivered_at":    delivery.DeliveredAt,
+	}, dbx.HashExp{"id": delivery.ID}).Execute()
+	return err
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"backend/internal/entity"
+	"backend/internal/test"
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "webhook_subscriptions")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	now := time.Now()
+	err := repo.Create(ctx, entity.WebhookSubscription{
+		ID:         "1",
+		URL:        "https://example.com/hook",
+		EventTypes: []string{"user.created"},
+		Secret:     "0123456789abcdef",
+		IsActive:   true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	assert.Nil(t, err)
+	count, _ := repo.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// get
+	subscription, err := repo.Get(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user.created"}, []string(subscription.EventTypes))
+
+	// update
+	subscription.IsActive = false
+	err = repo.Update(ctx, subscription)
+	assert.Nil(t, err)
+	active, _ := repo.Active(ctx)
+	assert.Empty(t, active)
+
+	// an event is delivered once per subscription, except for redeliveries
+	delivery := newDelivery("1", "e1", "user.created", []byte(`{"id":"e1"}`))
+	assert.Nil(t, repo.CreateDelivery(ctx, delivery))
+	assert.Nil(t, repo.CreateDelivery(ctx, newDelivery("1", "e1", "user.created", []byte(`{"id":"e1"}`))))
+	redelivery := newDelivery("1", "e1", "user.created", []byte(`{"id":"e1"}`))
+	redelivery.RedeliveryOf = &delivery.ID
+	assert.Nil(t, repo.CreateDelivery(ctx, redelivery))
+	count, _ = repo.CountDeliveries(ctx, "1")
+	assert.Equal(t, 2, count)
+
+	// claim and update
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		deliveries, err := repo.ClaimDeliveries(ctx, time.Now(), 1)
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(deliveries)) {
+			assert.Equal(t, delivery.ID, deliveries[0].ID)
+			assert.JSONEq(t, `{"id":"e1"}`, string(deliveries[0].Payload))
+		}
+		deliveries[0].Status = entity.DeliveryFailed
+		deliveries[0].Attempts = 1
+		deliveries[0].ResponseStatus = 500
+		return repo.UpdateDelivery(ctx, deliveries[0])
+	})
+	assert.Nil(t, err)
+	delivery, err = repo.GetDelivery(ctx, "1", delivery.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 500, delivery.ResponseStatus)
+	deliveries, _ := repo.QueryDeliveries(ctx, "1", 0, 10)
+	assert.Equal(t, 2, len(deliveries))
+
+	// delete removes the deliveries
+	err = repo.Delete(ctx, "1")
+	assert.Nil(t, err)
+	_, err = repo.GetDelivery(ctx, "1", delivery.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
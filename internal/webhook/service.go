@@ -0,0 +1,246 @@
+package webhook
+
+import (
+	"backend/internal/entity"
+	"backend/internal/errors"
+	"backend/internal/events"
+	"backend/pkg/log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Service encapsulates usecase logic for webhook subscriptions and their deliveries.
+type Service interface {
+	Get(ctx context.Context, id string) (Subscription, error)
+	Query(ctx context.Context, offset, limit int) ([]Subscription, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateSubscriptionRequest) (Subscription, error)
+	Update(ctx context.Context, id string, input UpdateSubscriptionRequest) (Subscription, error)
+	Delete(ctx context.Context, id string) (Subscription, error)
+	GetDelivery(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error)
+	QueryDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]entity.WebhookDelivery, error)
+	CountDeliveries(ctx context.Context, subscriptionID string) (int, error)
+	Redeliver(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error)
+}
+
+// Subscription represents the data about a webhook subscription.
+// The secret is only returned when it is set, so that it cannot be read afterwards.
+type Subscription struct {
+	entity.WebhookSubscription
+	Secret string `json:"secret,omitempty"`
+}
+
+// eventTypes are the event types that can be subscribed to.
+var eventTypes = []interface{}{events.UserCreated, events.UserDeactivated, events.UserRolesAssigned}
+
+// CreateSubscriptionRequest represents a webhook subscription creation request.
+type CreateSubscriptionRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// the secret used to sign the requests. A random secret is generated if empty
+	Secret string `json:"secret"`
+}
+
+// Validate validates the CreateSubscriptionRequest fields.
+func (m CreateSubscriptionRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.URL, validation.Required, validation.Length(0, 2048), validation.By(validateURL)),
+		validation.Field(&m.EventTypes, validation.Each(validation.In(eventTypes...))),
+		validation.Field(&m.Secret, validation.Length(16, 128)),
+	)
+}
+
+// UpdateSubscriptionRequest represents a webhook subscription update request.
+type UpdateSubscriptionRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	IsActive   *bool    `json:"is_active"`
+	// the new secret used to sign the requests. The secret is unchanged if empty
+	Secret string `json:"secret"`
+}
+
+// Validate validates the UpdateSubscriptionRequest fields.
+func (m UpdateSubscriptionRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.URL, validation.Required, validation.Length(0, 2048), validation.By(validateURL)),
+		validation.Field(&m.EventTypes, validation.Each(validation.In(eventTypes...))),
+		validation.Field(&m.Secret, validation.Length(16, 128)),
+	)
+}
+
+// validateURL checks that the value is an absolute HTTP(S) URL.
+func validateURL(value interface{}) error {
+	u, err := url.Parse(value.(string))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.NewError("validation_is_url", "must be an absolute HTTP(S) URL")
+	}
+	return nil
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new webhook service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Get returns the subscription with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Subscription, error) {
+	subscription, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	return Subscription{WebhookSubscription: subscription}, nil
+}
+
+// Count returns the number of subscriptions.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the subscriptions with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Subscription, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Subscription{}
+	for _, item := range items {
+		result = append(result, Subscription{WebhookSubscription: item})
+	}
+	return result, nil
+}
+
+// Create creates a new subscription. The response includes the secret.
+func (s service) Create(ctx context.Context, req CreateSubscriptionRequest) (Subscription, error) {
+	if err := req.Validate(); err != nil {
+		return Subscription{}, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			return Subscription{}, err
+		}
+	}
+	now := time.Now()
+	subscription := entity.WebhookSubscription{
+		ID:         entity.GenerateID(),
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     secret,
+		IsActive:   true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if subscription.EventTypes == nil {
+		subscription.EventTypes = []string{}
+	}
+	if err := s.repo.Create(ctx, subscription); err != nil {
+		return Subscription{}, err
+	}
+	return Subscription{subscription, secret}, nil
+}
+
+// Update updates the subscription with the specified ID. The response includes the secret if it has been changed.
+func (s service) Update(ctx context.Context, id string, req UpdateSubscriptionRequest) (Subscription, error) {
+	if err := req.Validate(); err != nil {
+		return Subscription{}, err
+	}
+	subscription, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	subscription.URL = req.URL
+	subscription.EventTypes = req.EventTypes
+	if subscription.EventTypes == nil {
+		subscription.EventTypes = []string{}
+	}
+	if req.IsActive != nil {
+		subscription.IsActive = *req.IsActive
+	}
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+	subscription.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, subscription); err != nil {
+		return Subscription{}, err
+	}
+	return Subscription{subscription, req.Secret}, nil
+}
+
+// Delete deletes the subscription with the specified ID, together with its delivery log.
+func (s service) Delete(ctx context.Context, id string) (Subscription, error) {
+	subscription, err := s.Get(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if err = s.repo.Delete(ctx, id); err != nil {
+		return Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// GetDelivery returns the delivery with the specified ID made for the given subscription.
+func (s service) GetDelivery(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error) {
+	return s.repo.GetDelivery(ctx, subscriptionID, id)
+}
+
+// CountDeliveries returns the number of deliveries made for the given subscription.
+func (s service) CountDeliveries(ctx context.Context, subscriptionID string) (int, error) {
+	if _, err := s.repo.Get(ctx, subscriptionID); err != nil {
+		return 0, err
+	}
+	return s.repo.CountDeliveries(ctx, subscriptionID)
+}
+
+// QueryDeliveries returns the deliveries made for the given subscription with the specified offset and limit, the newest first.
+func (s service) QueryDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	items, err := s.repo.QueryDeliveries(ctx, subscriptionID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []entity.WebhookDelivery{}
+	}
+	return items, nil
+}
+
+// Redeliver schedules a new delivery of the event sent by the delivery with the specified ID.
+// The original delivery is kept in the log. Inactive subscriptions cannot receive redeliveries.
+func (s service) Redeliver(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error) {
+	subscription, err := s.repo.Get(ctx, subscriptionID)
+	if err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	if !subscription.IsActive {
+		return entity.WebhookDelivery{}, errors.BadRequest("The subscription is inactive.")
+	}
+	original, err := s.repo.GetDelivery(ctx, subscriptionID, id)
+	if err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	delivery := newDelivery(subscriptionID, original.EventID, original.EventType, original.Payload)
+	delivery.RedeliveryOf = &original.ID
+	if err := s.repo.CreateDelivery(ctx, delivery); err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// generateSecret generates a random secret for signing the requests of a subscription.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
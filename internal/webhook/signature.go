@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The headers of the webhook requests.
+const (
+	// HeaderID carries the ID of the delivery, which changes when an event is redelivered.
+	HeaderID = "X-Webhook-ID"
+	// HeaderEvent carries the type of the event.
+	HeaderEvent = "X-Webhook-Event"
+	// HeaderTimestamp carries the Unix time at which the request was signed.
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature carries the signature of the request, in the form "sha256=<hex digest>".
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature of a request body sent at the given Unix time.
+// It is the HMAC-SHA256, keyed with the subscription secret, of the timestamp and the body joined by a dot.
+// Including the timestamp allows receivers to reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and the timestamp headers of a request received at the given time.
+// Requests signed more than tolerance before or after now are rejected.
+func Verify(secret, timestamp, signature string, body []byte, now time.Time, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return errors.New("timestamp outside of the tolerance")
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
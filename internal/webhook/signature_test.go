@@ -0,0 +1,25 @@
+package webhook
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686", Sign("secret", 1700000000, []byte(`{"a":1}`)))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"a":1}`)
+	signature := Sign("secret", now.Unix(), body)
+
+	assert.Nil(t, Verify("secret", "1700000000", signature, body, now.Add(time.Minute), 5*time.Minute))
+	assert.NotNil(t, Verify("other", "1700000000", signature, body, now, 5*time.Minute))
+	assert.NotNil(t, Verify("secret", "1700000000", signature, []byte(`{"a":2}`), now, 5*time.Minute))
+	assert.NotNil(t, Verify("secret", "1700000001", signature, body, now, 5*time.Minute))
+	assert.NotNil(t, Verify("secret", "1700000000", signature, body, now.Add(10*time.Minute), 5*time.Minute))
+	assert.NotNil(t, Verify("secret", "yesterday", signature, body, now, 5*time.Minute))
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"backend/internal/entity"
+	"backend/internal/events"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// sink schedules the deliveries of the domain events to the webhook subscriptions.
+type sink struct {
+	repo Repository
+}
+
+// NewSink creates an events.Sink that schedules a delivery of every event to each active subscription
+// matching its type. The deliveries are made in the background by a Deliverer.
+func NewSink(repo Repository) events.Sink {
+	return sink{repo}
+}
+
+// Deliver schedules the deliveries of the event. It is safe to call it again with the same event,
+// as an event is delivered once per subscription.
+func (s sink) Deliver(ctx context.Context, event entity.Event) error {
+	subscriptions, err := s.repo.Active(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(event.Type) {
+			continue
+		}
+		if err := s.repo.CreateDelivery(ctx, newDelivery(subscription.ID, event.ID, event.Type, payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newDelivery creates a pending delivery of an event to a subscription.
+func newDelivery(subscriptionID, eventID, eventType string, payload []byte) entity.WebhookDelivery {
+	now := time.Now()
+	return entity.WebhookDelivery{
+		ID:             entity.GenerateID(),
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		EventType:      eventType,
+		Payload:        payload,
+		Status:         entity.DeliveryPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+	}
+}
@@ -0,0 +1,12 @@
+CREATE TABLE idempotency_keys
+(
+    user_id       VARCHAR(36) NOT NULL,
+    key           VARCHAR(255) NOT NULL,
+    fingerprint   VARCHAR(64) NOT NULL,
+    status_code   INTEGER DEFAULT 0 NOT NULL,
+    content_type  VARCHAR(100) DEFAULT '' NOT NULL,
+    response_body BYTEA,
+    created_at    TIMESTAMP NOT NULL,
+    completed_at  TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
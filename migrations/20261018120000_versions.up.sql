@@ -0,0 +1,2 @@
+ALTER TABLE album ADD COLUMN version INTEGER DEFAULT 1 NOT NULL;
+ALTER TABLE users ADD COLUMN version INTEGER DEFAULT 1 NOT NULL;
@@ -0,0 +1,12 @@
+DROP INDEX users_deleted_at_index;
+DROP INDEX album_deleted_at_index;
+
+DROP INDEX users_email_uindex;
+DROP INDEX users_username_uindex;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DELETE FROM album WHERE deleted_at IS NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_username_uindex UNIQUE (username);
+ALTER TABLE users ADD CONSTRAINT users_email_uindex UNIQUE (email);
+
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE album DROP COLUMN deleted_at;
@@ -0,0 +1,11 @@
+ALTER TABLE album ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+-- usernames and emails of deleted users can be reused
+ALTER TABLE users DROP CONSTRAINT users_username_uindex;
+ALTER TABLE users DROP CONSTRAINT users_email_uindex;
+CREATE UNIQUE INDEX users_username_uindex ON users (username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_email_uindex ON users (email) WHERE deleted_at IS NULL;
+
+CREATE INDEX album_deleted_at_index ON album (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX users_deleted_at_index ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE audit_log
+(
+    id          VARCHAR(36) PRIMARY KEY,
+    actor_id    VARCHAR(36) DEFAULT '' NOT NULL,
+    action      VARCHAR(50) NOT NULL,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id   VARCHAR(36) NOT NULL,
+    changes     JSONB,
+    request_id  VARCHAR(100) DEFAULT '' NOT NULL,
+    ip          VARCHAR(45) DEFAULT '' NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX audit_log_entity_index ON audit_log (entity_type, entity_id);
+CREATE INDEX audit_log_actor_id_index ON audit_log (actor_id);
+CREATE INDEX audit_log_created_at_index ON audit_log (created_at);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS role_user
+(
+    user_id VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id VARCHAR(36) NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
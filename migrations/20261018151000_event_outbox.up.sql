@@ -0,0 +1,15 @@
+CREATE TABLE event_outbox
+(
+    id              VARCHAR(36) PRIMARY KEY,
+    type            VARCHAR(100) NOT NULL,
+    aggregate_type  VARCHAR(50) NOT NULL,
+    aggregate_id    VARCHAR(36) NOT NULL,
+    payload         JSONB NOT NULL,
+    status          VARCHAR(20) DEFAULT 'pending' NOT NULL,
+    attempts        INTEGER DEFAULT 0 NOT NULL,
+    last_error      TEXT DEFAULT '' NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    delivered_at    TIMESTAMP
+);
+CREATE INDEX event_outbox_pending_index ON event_outbox (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,32 @@
+CREATE TABLE webhook_subscriptions
+(
+    id          VARCHAR(36) PRIMARY KEY,
+    url         VARCHAR(2048) NOT NULL,
+    event_types TEXT[] DEFAULT '{}' NOT NULL,
+    secret      VARCHAR(128) NOT NULL,
+    is_active   BOOLEAN DEFAULT TRUE NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhook_deliveries
+(
+    id              VARCHAR(36) PRIMARY KEY,
+    subscription_id VARCHAR(36) NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id        VARCHAR(36) NOT NULL,
+    event_type      VARCHAR(100) NOT NULL,
+    payload         JSONB NOT NULL,
+    redelivery_of   VARCHAR(36),
+    status          VARCHAR(20) DEFAULT 'pending' NOT NULL,
+    attempts        INTEGER DEFAULT 0 NOT NULL,
+    response_status INTEGER DEFAULT 0 NOT NULL,
+    response_body   TEXT DEFAULT '' NOT NULL,
+    last_error      TEXT DEFAULT '' NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    delivered_at    TIMESTAMP
+);
+-- an event is delivered once per subscription, except when an administrator requests a redelivery
+CREATE UNIQUE INDEX webhook_deliveries_event_uindex ON webhook_deliveries (subscription_id, event_id) WHERE redelivery_of IS NULL;
+CREATE INDEX webhook_deliveries_subscription_index ON webhook_deliveries (subscription_id, created_at);
+CREATE INDEX webhook_deliveries_pending_index ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
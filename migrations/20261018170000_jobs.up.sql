@@ -0,0 +1,20 @@
+CREATE TABLE jobs
+(
+    id           VARCHAR(36) PRIMARY KEY,
+    type         VARCHAR(100) NOT NULL,
+    payload      JSONB NOT NULL,
+    status       VARCHAR(20) DEFAULT 'pending' NOT NULL,
+    attempts     INTEGER DEFAULT 0 NOT NULL,
+    max_attempts INTEGER NOT NULL,
+    last_error   TEXT DEFAULT '' NOT NULL,
+    unique_key   VARCHAR(255),
+    run_at       TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL,
+    updated_at   TIMESTAMP NOT NULL,
+    finished_at  TIMESTAMP
+);
+-- a unique job cannot be queued twice until it has finished
+CREATE UNIQUE INDEX jobs_unique_key_uindex ON jobs (type, unique_key) WHERE status IN ('pending', 'running');
+CREATE INDEX jobs_due_index ON jobs (run_at) WHERE status IN ('pending', 'running');
+CREATE INDEX jobs_created_at_index ON jobs (created_at);
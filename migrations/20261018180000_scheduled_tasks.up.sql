@@ -0,0 +1,13 @@
+CREATE TABLE scheduled_tasks
+(
+    name              VARCHAR(100) PRIMARY KEY,
+    schedule          VARCHAR(100) NOT NULL,
+    next_run_at       TIMESTAMP,
+    last_scheduled_at TIMESTAMP,
+    last_started_at   TIMESTAMP,
+    last_finished_at  TIMESTAMP,
+    last_duration_ms  BIGINT DEFAULT 0 NOT NULL,
+    last_outcome      VARCHAR(20) DEFAULT '' NOT NULL,
+    last_error        TEXT DEFAULT '' NOT NULL,
+    last_run_by       VARCHAR(255) DEFAULT '' NOT NULL
+);
@@ -0,0 +1,17 @@
+CREATE TABLE invitations
+(
+    id          VARCHAR(36) PRIMARY KEY,
+    email       VARCHAR(100) NOT NULL,
+    roles       TEXT[] DEFAULT '{}' NOT NULL,
+    locale      VARCHAR(20) DEFAULT '' NOT NULL,
+    token_hash  VARCHAR(64) NOT NULL,
+    invited_by  VARCHAR(36) NOT NULL,
+    expires_at  TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    user_id     VARCHAR(36),
+    revoked_at  TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL,
+    constraint invitations_token_hash_uindex
+        unique (token_hash)
+);
+CREATE INDEX invitations_created_at_index ON invitations (created_at);
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+CREATE TABLE email_verifications
+(
+    id           VARCHAR(36) PRIMARY KEY,
+    user_id      VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email        VARCHAR(100) NOT NULL,
+    token_hash   VARCHAR(64) NOT NULL,
+    expires_at   TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL,
+    constraint email_verifications_token_hash_uindex
+        unique (token_hash)
+);
+CREATE INDEX email_verifications_user_index ON email_verifications (user_id, created_at);
@@ -0,0 +1,19 @@
+CREATE TABLE totp_enrollments
+(
+    user_id        VARCHAR(36) PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret         VARCHAR(64) NOT NULL,
+    confirmed_at   TIMESTAMP,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at     TIMESTAMP NOT NULL
+);
+
+CREATE TABLE recovery_codes
+(
+    id         VARCHAR(36) PRIMARY KEY,
+    user_id    VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    constraint recovery_codes_user_code_hash_uindex
+        unique (user_id, code_hash)
+);
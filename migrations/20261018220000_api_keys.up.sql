@@ -0,0 +1,17 @@
+CREATE TABLE api_keys
+(
+    id           VARCHAR(36) PRIMARY KEY,
+    name         VARCHAR(100) NOT NULL,
+    prefix       VARCHAR(20) NOT NULL,
+    key_hash     VARCHAR(64) NOT NULL,
+    roles        TEXT[] DEFAULT '{}' NOT NULL,
+    created_by   VARCHAR(36) NOT NULL,
+    expires_at   TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL,
+    updated_at   TIMESTAMP NOT NULL,
+    constraint api_keys_key_hash_uindex
+        unique (key_hash)
+);
+CREATE INDEX api_keys_created_at_index ON api_keys (created_at);
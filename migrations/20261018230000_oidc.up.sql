@@ -0,0 +1,25 @@
+CREATE TABLE oidc_logins
+(
+    id            VARCHAR(36) PRIMARY KEY,
+    provider      VARCHAR(50) NOT NULL,
+    state_hash    VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(100) NOT NULL,
+    nonce         VARCHAR(100) NOT NULL,
+    expires_at    TIMESTAMP NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    constraint oidc_logins_state_hash_uindex
+        unique (state_hash)
+);
+
+CREATE TABLE external_identities
+(
+    id         VARCHAR(36) PRIMARY KEY,
+    provider   VARCHAR(50) NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    user_id    VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      VARCHAR(100) DEFAULT '' NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    constraint external_identities_provider_subject_uindex
+        unique (provider, subject)
+);
+CREATE INDEX external_identities_user_index ON external_identities (user_id);
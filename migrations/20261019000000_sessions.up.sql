@@ -0,0 +1,13 @@
+CREATE TABLE sessions
+(
+    id           VARCHAR(36) PRIMARY KEY,
+    user_id      VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    device       VARCHAR(100) DEFAULT '' NOT NULL,
+    user_agent   VARCHAR(500) DEFAULT '' NOT NULL,
+    ip           VARCHAR(45) DEFAULT '' NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    expires_at   TIMESTAMP NOT NULL,
+    revoked_at   TIMESTAMP
+);
+CREATE INDEX sessions_user_index ON sessions (user_id, last_seen_at);
@@ -0,0 +1 @@
+ALTER TABLE audit_log ADD COLUMN impersonated_id VARCHAR(36) DEFAULT '' NOT NULL;
@@ -0,0 +1,10 @@
+DROP INDEX album_organization_index;
+ALTER TABLE album DROP COLUMN organization_id;
+
+DELETE FROM role_user WHERE organization_id IS NOT NULL;
+DROP INDEX role_user_uindex;
+ALTER TABLE role_user DROP COLUMN organization_id;
+ALTER TABLE role_user ADD PRIMARY KEY (user_id, role_id);
+
+DROP TABLE organization_user;
+DROP TABLE organizations;
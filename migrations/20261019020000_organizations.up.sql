@@ -0,0 +1,28 @@
+CREATE TABLE organizations
+(
+    id         VARCHAR(36) PRIMARY KEY,
+    name       VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    constraint organizations_name_uindex
+        unique (name)
+);
+
+-- the memberships of the users in the organizations
+CREATE TABLE organization_user
+(
+    organization_id VARCHAR(36) NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id         VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at      TIMESTAMP NOT NULL,
+    PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX organization_user_user_index ON organization_user (user_id);
+
+-- the roles are granted within an organization, or in all of them if organization_id is NULL
+ALTER TABLE role_user ADD COLUMN organization_id VARCHAR(36) REFERENCES organizations (id) ON DELETE CASCADE;
+ALTER TABLE role_user DROP CONSTRAINT role_user_pkey;
+CREATE UNIQUE INDEX role_user_uindex ON role_user (user_id, role_id, COALESCE(organization_id, ''));
+
+-- the albums created outside of any organization have no organization_id
+ALTER TABLE album ADD COLUMN organization_id VARCHAR(36) REFERENCES organizations (id);
+CREATE INDEX album_organization_index ON album (organization_id);
@@ -0,0 +1,8 @@
+DROP POLICY users_insert ON users;
+DROP POLICY users_tenant ON users;
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY album_tenant ON album;
+ALTER TABLE album NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE album DISABLE ROW LEVEL SECURITY;
@@ -0,0 +1,26 @@
+-- the transactions of the requests are scoped to the user and their organization by the app.user_id and
+-- app.tenant_id settings, see dbcontext. The policies fail closed: the rows are hidden when no tenant is set,
+-- unless the app.unscoped setting is explicitly on, as for the users who are a member of no organization and
+-- for the background jobs. The policies are forced on the owner of the tables, but they are bypassed by the
+-- superusers and the roles with BYPASSRLS.
+
+-- the albums of the other organizations are hidden, and cannot be created or moved to them
+ALTER TABLE album ENABLE ROW LEVEL SECURITY;
+ALTER TABLE album FORCE ROW LEVEL SECURITY;
+CREATE POLICY album_tenant ON album
+    USING (current_setting('app.unscoped', true) = 'on'
+        OR organization_id = current_setting('app.tenant_id', true));
+
+-- the users are hidden unless they are a member of the organization, or the current user
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+CREATE POLICY users_tenant ON users
+    USING (current_setting('app.unscoped', true) = 'on'
+        OR id = current_setting('app.user_id', true)
+        OR id IN (SELECT user_id
+                  FROM organization_user
+                  WHERE organization_id = current_setting('app.tenant_id', true)));
+-- the users are created before they are added to the organization, so they can be created within any tenant
+CREATE POLICY users_insert ON users FOR INSERT
+    WITH CHECK (current_setting('app.unscoped', true) = 'on'
+        OR current_setting('app.tenant_id', true) <> '');
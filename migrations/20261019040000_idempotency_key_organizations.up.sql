@@ -0,0 +1,4 @@
+-- the idempotency keys are scoped to the organization the user acts in, or to none if organization_id is empty
+ALTER TABLE idempotency_keys ADD COLUMN organization_id VARCHAR(36) DEFAULT '' NOT NULL;
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (user_id, organization_id, key);
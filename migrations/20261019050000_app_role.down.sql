@@ -0,0 +1,5 @@
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON SEQUENCES FROM app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON TABLES FROM app;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM app;
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM app;
+REVOKE USAGE ON SCHEMA public FROM app;
@@ -0,0 +1,19 @@
+-- the server connects as the app role, which is subject to the row level security policies unlike the superusers
+-- running the migrations. The role cannot log in until it is given a password, e.g. with
+-- ALTER ROLE app LOGIN PASSWORD '...', unless it was created beforehand as for the local database.
+DO $$
+BEGIN
+    CREATE ROLE app NOLOGIN NOSUPERUSER NOBYPASSRLS;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END
+$$;
+ALTER ROLE app NOSUPERUSER NOBYPASSRLS;
+
+-- the role does not own the tables, so that it cannot disable the policies or alter the tables.
+-- TRUNCATE is granted for the tests resetting the tables.
+GRANT USAGE ON SCHEMA public TO app;
+GRANT SELECT, INSERT, UPDATE, DELETE, TRUNCATE ON ALL TABLES IN SCHEMA public TO app;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO app;
+-- the same privileges are granted on the tables created by the next migrations
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE, TRUNCATE ON TABLES TO app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO app;
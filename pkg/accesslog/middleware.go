@@ -22,6 +22,8 @@ func Handler(logger log.Logger) routing.Handler {
 		ctx := c.Request.Context()
 		ctx = log.WithRequest(ctx, c.Request)
 		c.Request = c.Request.WithContext(ctx)
+		// echo the request ID so that clients can refer to it when reporting problems
+		c.Response.Header().Set("X-Request-ID", log.RequestID(ctx))
 
 		err := c.Next()
 
@@ -21,4 +21,5 @@ func TestHandler(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 1, entries.Len())
 	assert.Equal(t, "GET /users HTTP/1.1 200 0", entries.All()[0].Message)
+	assert.NotEmpty(t, res.Header().Get("X-Request-ID"))
 }
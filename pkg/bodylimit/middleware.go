@@ -0,0 +1,65 @@
+// Package bodylimit provides a middleware that limits the size of HTTP request bodies.
+package bodylimit
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Handler returns a middleware that rejects requests whose body is larger than the allowed limit.
+//
+// The limit of a request is taken from the longest path prefix in limits that matches the request path.
+// If no prefix matches, defaultLimit is used. A limit of 0 or less means no limit.
+//
+// Requests declaring a larger Content-Length are rejected with HTTP 413 before the body is read.
+// Bodies of unknown length are cut off once the limit is reached, which makes Context.Read() fail.
+// The error the handlers return then is replaced with HTTP 413 too.
+func Handler(defaultLimit int64, limits map[string]int64) routing.Handler {
+	return func(c *routing.Context) error {
+		limit := limitFor(c.Request.URL.Path, defaultLimit, limits)
+		if limit <= 0 || c.Request.Body == nil {
+			return nil
+		}
+		if c.Request.ContentLength > limit {
+			return routing.NewHTTPError(http.StatusRequestEntityTooLarge)
+		}
+		body := &limitedBody{ReadCloser: http.MaxBytesReader(c.Response, c.Request.Body, limit)}
+		c.Request.Body = body
+		// the handlers usually turn the failure to read the body into a bad request
+		if err := c.Next(); err != nil {
+			if body.exceeded {
+				return routing.NewHTTPError(http.StatusRequestEntityTooLarge)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// limitedBody is a request body cut off by http.MaxBytesReader, which remembers whether the limit was exceeded.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+// Read reads from the body, and records the failure caused by the limit.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err.Error() == "http: request body too large" {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// limitFor returns the body size limit that applies to the given request path.
+func limitFor(path string, defaultLimit int64, limits map[string]int64) int64 {
+	limit, matched := defaultLimit, ""
+	for prefix, l := range limits {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(matched) {
+			limit, matched = l, prefix
+		}
+	}
+	return limit
+}
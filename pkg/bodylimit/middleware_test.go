@@ -0,0 +1,66 @@
+package bodylimit
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	handler := Handler(10, map[string]int64{"/v1/albums": 20, "/v1/albums/upload": 0})
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		chunked  bool
+		wantErr  int
+		wantRead bool
+	}{
+		{"default ok", "/v1/users", "0123456789", false, 0, true},
+		{"default too large", "/v1/users", "0123456789a", false, http.StatusRequestEntityTooLarge, false},
+		{"prefix ok", "/v1/albums/1", "0123456789a", false, 0, true},
+		{"unlimited", "/v1/albums/upload", strings.Repeat("a", 100), false, 0, true},
+		{"chunked too large", "/v1/users", "0123456789a", true, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "http://127.0.0.1"+tt.url, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			c := routing.NewContext(httptest.NewRecorder(), req)
+			err := handler(c)
+			if tt.wantErr != 0 {
+				if assert.NotNil(t, err) {
+					assert.Equal(t, tt.wantErr, err.(routing.HTTPError).StatusCode())
+				}
+				return
+			}
+			assert.Nil(t, err)
+			_, err = ioutil.ReadAll(c.Request.Body)
+			assert.Equal(t, tt.wantRead, err == nil)
+		})
+	}
+}
+
+func TestHandler_TooLarge(t *testing.T) {
+	handler := Handler(10, nil)
+	req, _ := http.NewRequest("POST", "http://127.0.0.1/v1/users", strings.NewReader("0123456789a"))
+	req.ContentLength = -1
+
+	// the handlers failing to read a body over the limit are answered with HTTP 413
+	err := routing.NewContext(httptest.NewRecorder(), req, handler, func(c *routing.Context) error {
+		if _, err := ioutil.ReadAll(c.Request.Body); err != nil {
+			return routing.NewHTTPError(http.StatusBadRequest)
+		}
+		return nil
+	}).Next()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, err.(routing.HTTPError).StatusCode())
+	}
+}
@@ -0,0 +1,162 @@
+// Package cors provides a middleware that applies a configurable cross-origin resource sharing (CORS) policy.
+//
+// Unlike the handler shipped with ozzo-routing, allowed origins may contain a wildcard subdomain
+// (e.g. "https://*.example.com") and a wildcard origin can never be combined with credentials.
+package cors
+
+import (
+	"errors"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerOrigin         = "Origin"
+	headerVary           = "Vary"
+	headerRequestMethod  = "Access-Control-Request-Method"
+	headerRequestHeaders = "Access-Control-Request-Headers"
+
+	headerAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAllowMethods     = "Access-Control-Allow-Methods"
+	headerExposeHeaders    = "Access-Control-Expose-Headers"
+	headerMaxAge           = "Access-Control-Max-Age"
+)
+
+// ErrWildcardCredentials is returned when a policy allows credentials from any origin.
+var ErrWildcardCredentials = errors.New(`the "*" origin cannot be allowed when credentials are allowed`)
+
+// Options describes a CORS policy.
+type Options struct {
+	// the allowed origins. An entry is either an exact origin (e.g. "https://example.com"), a wildcard
+	// subdomain (e.g. "https://*.example.com") or "*" to allow any origin.
+	AllowOrigins []string
+	// the allowed HTTP methods. "*" allows any method.
+	AllowMethods []string
+	// the allowed request headers. "*" allows any header.
+	AllowHeaders []string
+	// the response headers that browsers may expose to the calling script
+	ExposeHeaders []string
+	// how long (in seconds) the result of a preflight request may be cached. Not sent if 0.
+	MaxAge int
+	// whether requests may include user credentials such as cookies or the Authorization header
+	AllowCredentials bool
+}
+
+// Validate checks that the policy is safe to use.
+func (o Options) Validate() error {
+	if o.AllowCredentials && contains(o.AllowOrigins, "*") {
+		return ErrWildcardCredentials
+	}
+	return nil
+}
+
+// Handler returns a middleware that adds CORS headers according to the given policy.
+// Preflight requests are answered directly and not passed to the remaining handlers.
+// It panics if the policy is not valid.
+func Handler(opts Options) routing.Handler {
+	if err := opts.Validate(); err != nil {
+		panic(err)
+	}
+	return func(c *routing.Context) error {
+		origin := c.Request.Header.Get(headerOrigin)
+		if origin == "" {
+			// the request is outside the scope of CORS
+			return nil
+		}
+		headers := c.Response.Header()
+		headers.Add(headerVary, headerOrigin)
+
+		if c.Request.Method == http.MethodOptions {
+			method := c.Request.Header.Get(headerRequestMethod)
+			if method == "" {
+				// not a preflight request
+				return nil
+			}
+			opts.setPreflightHeaders(origin, method, c.Request.Header.Get(headerRequestHeaders), headers)
+			c.Abort()
+			c.Response.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		if opts.isOriginAllowed(origin) {
+			opts.setOriginHeaders(origin, headers)
+			if len(opts.ExposeHeaders) > 0 {
+				headers.Set(headerExposeHeaders, strings.Join(opts.ExposeHeaders, ", "))
+			}
+		}
+		return nil
+	}
+}
+
+// isOriginAllowed checks if the given origin matches any of the allowed origins.
+func (o Options) isOriginAllowed(origin string) bool {
+	for _, allowed := range o.AllowOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if i := strings.Index(allowed, "://*."); i >= 0 {
+			scheme, domain := allowed[:i+3], allowed[i+4:]
+			if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, domain) && len(origin) > len(scheme)+len(domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setOriginHeaders sets the headers that grant the given origin access to the response.
+func (o Options) setOriginHeaders(origin string, headers http.Header) {
+	if contains(o.AllowOrigins, "*") {
+		headers.Set(headerAllowOrigin, "*")
+		return
+	}
+	headers.Set(headerAllowOrigin, origin)
+	if o.AllowCredentials {
+		headers.Set(headerAllowCredentials, "true")
+	}
+}
+
+// setPreflightHeaders sets the response headers of a preflight request if the actual request is allowed.
+func (o Options) setPreflightHeaders(origin, method, reqHeaders string, headers http.Header) {
+	if !o.isOriginAllowed(origin) || !contains(o.AllowMethods, "*") && !contains(o.AllowMethods, method) {
+		return
+	}
+	if reqHeaders != "" && !contains(o.AllowHeaders, "*") {
+		for _, header := range strings.Split(reqHeaders, ",") {
+			if !containsFold(o.AllowHeaders, strings.TrimSpace(header)) {
+				return
+			}
+		}
+	}
+
+	o.setOriginHeaders(origin, headers)
+	headers.Set(headerAllowMethods, method)
+	if reqHeaders != "" {
+		headers.Set(headerAllowHeaders, reqHeaders)
+	}
+	if o.MaxAge > 0 {
+		headers.Set(headerMaxAge, strconv.Itoa(o.MaxAge))
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package cors
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	assert.Nil(t, Options{AllowOrigins: []string{"*"}}.Validate())
+	assert.Nil(t, Options{AllowOrigins: []string{"https://example.com"}, AllowCredentials: true}.Validate())
+	assert.Equal(t, ErrWildcardCredentials, Options{AllowOrigins: []string{"*"}, AllowCredentials: true}.Validate())
+	assert.Panics(t, func() { Handler(Options{AllowOrigins: []string{"*"}, AllowCredentials: true}) })
+}
+
+func TestHandler(t *testing.T) {
+	opts := Options{
+		AllowOrigins:     []string{"https://example.com", "https://*.example.org"},
+		AllowMethods:     []string{"GET", "POST"},
+		AllowHeaders:     []string{"Authorization", "Content-Type"},
+		ExposeHeaders:    []string{"Link", "X-Request-ID"},
+		MaxAge:           600,
+		AllowCredentials: true,
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		reqMethod   string
+		reqHeaders  string
+		wantOrigin  string
+		wantExpose  string
+		wantMethods string
+		wantAborted bool
+	}{
+		{"no origin", "GET", "", "", "", "", "", "", false},
+		{"exact origin", "GET", "https://example.com", "", "", "https://example.com", "Link, X-Request-ID", "", false},
+		{"wildcard subdomain", "GET", "https://api.example.org", "", "", "https://api.example.org", "Link, X-Request-ID", "", false},
+		{"wildcard apex", "GET", "https://example.org", "", "", "", "", "", false},
+		{"wildcard wrong scheme", "GET", "http://api.example.org", "", "", "", "", "", false},
+		{"unknown origin", "GET", "https://evil.com", "", "", "", "", "", false},
+		{"preflight ok", "OPTIONS", "https://example.com", "POST", "authorization, content-type", "https://example.com", "", "POST", true},
+		{"preflight bad method", "OPTIONS", "https://example.com", "DELETE", "", "", "", "", true},
+		{"preflight bad header", "OPTIONS", "https://example.com", "POST", "X-Custom", "", "", "", true},
+		{"plain options", "OPTIONS", "https://example.com", "", "", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "http://127.0.0.1/users", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.reqMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			if tt.reqHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+			}
+			reached := false
+			c := routing.NewContext(res, req, Handler(opts), func(c *routing.Context) error {
+				reached = true
+				return nil
+			})
+			assert.Nil(t, c.Next())
+			assert.Equal(t, !tt.wantAborted, reached)
+			assert.Equal(t, tt.wantOrigin, res.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.wantExpose, res.Header().Get("Access-Control-Expose-Headers"))
+			assert.Equal(t, tt.wantMethods, res.Header().Get("Access-Control-Allow-Methods"))
+			if tt.wantOrigin != "" {
+				assert.Equal(t, "true", res.Header().Get("Access-Control-Allow-Credentials"))
+			}
+		})
+	}
+}
+
+func TestHandler_AnyOrigin(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	req.Header.Set("Origin", "https://example.com")
+	c := routing.NewContext(res, req, Handler(Options{AllowOrigins: []string{"*"}}))
+	assert.Nil(t, c.Next())
+	assert.Equal(t, "*", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, res.Header().Get("Access-Control-Allow-Credentials"))
+}
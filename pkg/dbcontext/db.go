@@ -4,6 +4,7 @@ package dbcontext
 
 import (
 	"context"
+	"errors"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
@@ -21,6 +22,9 @@ type contextKey int
 
 const (
 	txKey contextKey = iota
+	tenantKey
+	userKey
+	unscopedKey
 )
 
 // New returns a new DB connection that wraps the given dbx.DB instance.
@@ -35,30 +39,85 @@ func (db *DB) DB() *dbx.DB {
 
 // With returns a Builder that can be used to build and execute SQL queries.
 // With will return the transaction if it is found in the given context.
-// Otherwise it will return a DB connection associated with the context.
+// Otherwise it will return a DB connection associated with the context. Its queries are not scoped:
+// the row level security policies of the database hide all the rows of the tenant tables from them,
+// so the repositories of these tables run their queries through Transactional.
 func (db *DB) With(ctx context.Context) dbx.Builder {
-	if tx, ok := ctx.Value(txKey).(*dbx.Tx); ok {
-		return tx
+	if tx, ok := ctx.Value(txKey).(*transaction); ok {
+		return tx.Tx
 	}
 	return db.db.WithContext(ctx)
 }
 
 // Transactional starts a transaction and calls the given function with a context storing the transaction.
 // The transaction associated with the context can be accesse via With().
+// If the context already stores a transaction, f runs within it, so that services can be composed
+// in a single transaction. It fails if the context is scoped to a tenant other than the one of the transaction.
+// The transaction is scoped to the user and the tenant of the context, see transaction.scope.
 func (db *DB) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey).(*transaction); ok {
+		if tenantID := Tenant(ctx); tenantID != "" && tenantID != tx.tenantID {
+			return errTenant
+		}
+		return f(ctx)
+	}
 	return db.db.TransactionalContext(ctx, nil, func(tx *dbx.Tx) error {
-		return f(context.WithValue(ctx, txKey, tx))
+		t := &transaction{Tx: tx, tenantID: Tenant(ctx)}
+		if err := t.scope(ctx); err != nil {
+			return err
+		}
+		return f(context.WithValue(ctx, txKey, t))
 	})
 }
 
 // TransactionHandler returns a middleware that starts a transaction.
 // The transaction started is kept in the context and can be accessed via With().
-func (db *DB) TransactionHandler() routing.Handler {
+// It is scoped to the user and the tenant of the request, so it must come after the authentication.
+// The given handlers run within the transaction before the handlers of the route, so that the ones
+// calling Context.Next(), such as the one storing the idempotent responses, keep the transaction.
+func (db *DB) TransactionHandler(handlers ...routing.Handler) routing.Handler {
 	return func(c *routing.Context) error {
 		return db.db.TransactionalContext(c.Request.Context(), nil, func(tx *dbx.Tx) error {
-			ctx := context.WithValue(c.Request.Context(), txKey, tx)
+			t := &transaction{Tx: tx, tenantID: Tenant(c.Request.Context())}
+			if err := t.scope(c.Request.Context()); err != nil {
+				return err
+			}
+			ctx := context.WithValue(c.Request.Context(), txKey, t)
 			c.Request = c.Request.WithContext(ctx)
+			for _, h := range handlers {
+				if err := h(c); err != nil {
+					return err
+				}
+			}
+			// Next does nothing if a handler has already called it or aborted the request
 			return c.Next()
 		})
 	}
 }
+
+// errTenant is returned when a transaction is joined by a context scoped to another tenant.
+var errTenant = errors.New("dbcontext: the transaction is scoped to another tenant")
+
+// transaction is a transaction along with the tenant it is scoped to.
+type transaction struct {
+	*dbx.Tx
+	tenantID string
+}
+
+// scope sets the app.user_id, app.tenant_id and app.unscoped settings of the transaction to the user and
+// the tenant of the given context, which the row level security policies of the database restrict the rows to.
+// The settings are local to the transaction, as with SET LOCAL, so they never leak to the other
+// transactions of the pooled connection. The policies hide all the rows of the tenant tables when no tenant
+// is set, unless the context is explicitly Unscoped.
+func (t *transaction) scope(ctx context.Context) error {
+	unscoped := ""
+	if IsUnscoped(ctx) {
+		unscoped = "on"
+	}
+	_, err := t.NewQuery("SELECT set_config('app.user_id', {:user}, true), set_config('app.tenant_id', {:tenant}, true), " +
+		"set_config('app.unscoped', {:unscoped}, true)").
+		Bind(dbx.Params{"user": User(ctx), "tenant": t.tenantID, "unscoped": unscoped}).
+		WithContext(ctx).
+		Execute()
+	return err
+}
@@ -13,6 +13,8 @@ import (
 	"testing"
 )
 
+// DSN connects as the superuser since the tests create their table. They check the settings of the transactions,
+// not the row level security policies, which the repository tests check as the app role.
 const DSN = "postgres://127.0.0.1/scd?sslmode=disable&user=postgres&password=postgres"
 
 func TestNew(t *testing.T) {
@@ -103,6 +105,99 @@ func TestDB_TransactionHandler(t *testing.T) {
 	})
 }
 
+func TestDB_Settings(t *testing.T) {
+	runDBTest(t, func(db *dbx.DB) {
+		dbc := New(db)
+		settings := func(ctx context.Context) (userID, tenantID, unscoped string) {
+			err := dbc.With(ctx).NewQuery("SELECT COALESCE(current_setting('app.user_id', true), ''), "+
+				"COALESCE(current_setting('app.tenant_id', true), ''), "+
+				"COALESCE(current_setting('app.unscoped', true), '')").Row(&userID, &tenantID, &unscoped)
+			assert.Nil(t, err)
+			return
+		}
+
+		// the transactions are scoped to the user and the tenant of the context
+		ctx := WithTenant(WithUser(context.Background(), "100"), "org1")
+		err := dbc.Transactional(ctx, func(ctx context.Context) error {
+			userID, tenantID, unscoped := settings(ctx)
+			assert.Equal(t, "100", userID)
+			assert.Equal(t, "org1", tenantID)
+			assert.Equal(t, "", unscoped)
+
+			// and cannot be joined by another tenant
+			assert.Equal(t, errTenant, dbc.Transactional(WithTenant(ctx, "org2"), func(ctx context.Context) error {
+				return nil
+			}))
+			return dbc.Transactional(Unscoped(ctx), func(ctx context.Context) error {
+				_, tenantID, unscoped := settings(ctx)
+				assert.Equal(t, "org1", tenantID)
+				assert.Equal(t, "", unscoped)
+				return nil
+			})
+		})
+		assert.Nil(t, err)
+
+		// the settings are local to the transactions, and the rows are only unscoped explicitly
+		err = dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			userID, tenantID, unscoped := settings(ctx)
+			assert.Equal(t, "", userID)
+			assert.Equal(t, "", tenantID)
+			assert.Equal(t, "", unscoped)
+			return nil
+		})
+		assert.Nil(t, err)
+		err = dbc.Transactional(Unscoped(context.Background()), func(ctx context.Context) error {
+			_, tenantID, unscoped := settings(ctx)
+			assert.Equal(t, "", tenantID)
+			assert.Equal(t, "on", unscoped)
+			return nil
+		})
+		assert.Nil(t, err)
+
+		// the transactions of the requests are scoped as well, including for the handlers given to
+		// the transaction handler that call Context.Next()
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+		req = req.WithContext(ctx)
+		calls := 0
+		next := func(c *routing.Context) error {
+			return c.Next()
+		}
+		err = routing.NewContext(res, req, dbc.TransactionHandler(next), func(c *routing.Context) error {
+			calls++
+			userID, tenantID, _ := settings(c.Request.Context())
+			assert.Equal(t, "100", userID)
+			assert.Equal(t, "org1", tenantID)
+			return nil
+		}).Next()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestScope(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", Tenant(ctx))
+	assert.Equal(t, "1=0", Scope(ctx, "organization_id = {:tenant}").Build(nil, nil))
+	assert.Nil(t, Scope(Unscoped(ctx), "organization_id = {:tenant}"))
+
+	assert.Equal(t, "", User(ctx))
+	ctx = WithUser(WithTenant(ctx, "org1"), "100")
+	assert.Equal(t, "org1", Tenant(ctx))
+	assert.Equal(t, "100", User(ctx))
+	params := dbx.Params{}
+	assert.Equal(t, "organization_id = {:tenant}", Scope(ctx, "organization_id = {:tenant}").Build(nil, params))
+	assert.Equal(t, dbx.Params{"tenant": "org1"}, params)
+}
+
+func TestUnscoped(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, IsUnscoped(ctx))
+	ctx = Unscoped(ctx)
+	assert.True(t, IsUnscoped(ctx))
+	assert.False(t, IsUnscoped(WithTenant(ctx, "org1")))
+}
+
 func runDBTest(t *testing.T, f func(db *dbx.DB)) {
 	dsn, ok := os.LookupEnv("APP_DSN")
 	if !ok {
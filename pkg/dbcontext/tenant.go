@@ -0,0 +1,63 @@
+package dbcontext
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// WithTenant returns a context whose queries are scoped to the tenant with the given ID.
+// Its transactions are scoped to the tenant too, so that the row level security policies of the database
+// hide the rows of the other tenants from the queries that fail to add the Scope condition.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantID)
+}
+
+// Tenant returns the ID of the tenant the queries of the given context are scoped to,
+// or an empty string if they are not scoped.
+func Tenant(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey).(string)
+	return tenantID
+}
+
+// WithUser returns a context whose transactions are scoped to the user with the given ID,
+// so that the row level security policies of the database can restrict the rows to the ones of the user.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey, userID)
+}
+
+// User returns the ID of the user the transactions of the given context are scoped to,
+// or an empty string if they are not scoped.
+func User(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey).(string)
+	return userID
+}
+
+// Unscoped returns a context whose transactions are explicitly not scoped to a tenant, for the staff
+// and for the background jobs, so that the row level security policies of
+// the database let them access the rows of all the tenants. It is ignored if the context has a tenant.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey, true)
+}
+
+// IsUnscoped returns whether the transactions of the given context access the rows of all the tenants.
+func IsUnscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey).(bool)
+	return unscoped && Tenant(ctx) == ""
+}
+
+// Scope returns the condition restricting the rows of a query to the tenant of the given context.
+// The condition is the given SQL expression, in which the tenant ID is bound to the {:tenant} parameter,
+// e.g. "album.organization_id = {:tenant}". Nil is returned if the context is explicitly unscoped, so that
+// the result can be added to the conditions of every query: it selects all the rows then. A context that
+// has neither a tenant nor is unscoped selects no rows at all.
+func Scope(ctx context.Context, condition string) dbx.Expression {
+	tenantID := Tenant(ctx)
+	if tenantID == "" {
+		if IsUnscoped(ctx) {
+			return nil
+		}
+		return dbx.NewExp("1=0")
+	}
+	return dbx.NewExp(condition, dbx.Params{"tenant": tenantID})
+}
@@ -0,0 +1,52 @@
+// Package etag provides support for entity tags and conditional requests (If-Match, If-None-Match).
+package etag
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// FromVersion returns the strong entity tag of a resource with the given version.
+func FromVersion(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// Match reports whether an If-Match or If-None-Match header value matches the given entity tag.
+// The header value may be "*" or a comma-separated list of entity tags. Weak tags never match.
+func Match(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Fresh sets the ETag header of the response and reports whether the client copy of the resource is still fresh
+// according to the If-None-Match request header. If it is, an empty HTTP 304 response is written and the caller
+// should not write the resource.
+func Fresh(c *routing.Context, tag string) bool {
+	c.Response.Header().Set("ETag", tag)
+	header := c.Request.Header.Get("If-None-Match")
+	if header == "" || !Match(header, tag) {
+		return false
+	}
+	c.Response.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// CheckIfMatch verifies the If-Match header of a request that modifies a resource with the given entity tag.
+// It fails with HTTP 428 if the header is missing and with HTTP 412 if it does not match.
+func CheckIfMatch(req *http.Request, tag string) error {
+	header := req.Header.Get("If-Match")
+	if header == "" {
+		return routing.NewHTTPError(http.StatusPreconditionRequired, "The If-Match header is required to modify this resource.")
+	}
+	if !Match(header, tag) {
+		return routing.NewHTTPError(http.StatusPreconditionFailed, "The resource has been modified since it was retrieved.")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package etag
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromVersion(t *testing.T) {
+	assert.Equal(t, `"3"`, FromVersion(3))
+}
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match(`"3"`, `"3"`))
+	assert.True(t, Match(`"1", "3"`, `"3"`))
+	assert.True(t, Match("*", `"3"`))
+	assert.False(t, Match(`"2"`, `"3"`))
+	assert.False(t, Match(`W/"3"`, `"3"`))
+	assert.False(t, Match("", `"3"`))
+}
+
+func TestFresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"no header", "", false},
+		{"modified", `"2"`, false},
+		{"not modified", `"3"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://127.0.0.1/albums/1", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			assert.Equal(t, tt.want, Fresh(routing.NewContext(res, req), `"3"`))
+			assert.Equal(t, `"3"`, res.Header().Get("ETag"))
+			if tt.want {
+				assert.Equal(t, http.StatusNotModified, res.Code)
+			}
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "http://127.0.0.1/albums/1", nil)
+	err := CheckIfMatch(req, `"3"`)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusPreconditionRequired, err.(routing.HTTPError).StatusCode())
+	}
+	req.Header.Set("If-Match", `"2"`)
+	err = CheckIfMatch(req, `"3"`)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusPreconditionFailed, err.(routing.HTTPError).StatusCode())
+	}
+	req.Header.Set("If-Match", `"3"`)
+	assert.Nil(t, CheckIfMatch(req, `"3"`))
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMaxAttempts is the number of times a job is run before it is considered failed, unless stated otherwise.
+const DefaultMaxAttempts = 5
+
+// Option customizes a job being enqueued.
+type Option func(*Job)
+
+// Delay makes the job run after the given delay.
+func Delay(d time.Duration) Option {
+	return func(j *Job) {
+		j.RunAt = j.CreatedAt.Add(d)
+	}
+}
+
+// At makes the job run at the given time.
+func At(t time.Time) Option {
+	return func(j *Job) {
+		j.RunAt = t
+	}
+}
+
+// Unique prevents the job from being enqueued while another job of the same type and key is pending or running.
+func Unique(key string) Option {
+	return func(j *Job) {
+		j.UniqueKey = &key
+	}
+}
+
+// MaxAttempts sets the number of times the job is run before it is considered failed.
+func MaxAttempts(n int) Option {
+	return func(j *Job) {
+		j.MaxAttempts = n
+	}
+}
+
+// Client enqueues jobs.
+type Client struct {
+	store Store
+}
+
+// NewClient creates a new Client enqueueing jobs in the given store.
+func NewClient(store Store) *Client {
+	return &Client{store}
+}
+
+// Enqueue enqueues a job of the given type whose payload is the JSON encoding of payload.
+// If the context carries a transaction, the job is enqueued as part of it. ErrDuplicate is returned
+// if the job is unique and another job of the same type and key is pending or running.
+func (c *Client) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...Option) (Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now()
+	job := Job{
+		ID:          uuid.New().String(),
+		Type:        jobType,
+		Payload:     data,
+		Status:      StatusPending,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, opt := range opts {
+		opt(&job)
+	}
+	if err := c.store.Create(ctx, job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
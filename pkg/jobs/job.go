@@ -0,0 +1,69 @@
+// Package jobs provides a background job queue stored in Postgres.
+//
+// Jobs are enqueued with a Client, possibly within the transaction of the change that requires them,
+// and run by a Worker pool which claims them with FOR UPDATE SKIP LOCKED so that any number of workers,
+// on any number of servers, can share the queue. Failed jobs are retried with an exponential backoff.
+// A claimed job stays invisible to the other workers for a visibility timeout, after which it is considered
+// abandoned (e.g. the server crashed) and is claimed again. Jobs must therefore be safe to run more than once.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Statuses of the jobs.
+const (
+	// StatusPending is the status of the jobs waiting to be run, including those waiting for a retry.
+	StatusPending = "pending"
+	// StatusRunning is the status of the jobs claimed by a worker.
+	StatusRunning = "running"
+	// StatusSucceeded is the status of the jobs that have completed.
+	StatusSucceeded = "succeeded"
+	// StatusFailed is the status of the jobs that have failed as many times as they were allowed to.
+	StatusFailed = "failed"
+	// StatusCancelled is the status of the jobs cancelled before they were run.
+	StatusCancelled = "cancelled"
+)
+
+// ErrDuplicate is returned when enqueueing a unique job while another job with the same type and key is pending or running.
+var ErrDuplicate = errors.New("a job with the same unique key is already queued")
+
+// Job represents a job record.
+type Job struct {
+	ID          string          `json:"id" db:"id"`
+	Type        string          `json:"type" db:"type"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	Status      string          `json:"status" db:"status"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	MaxAttempts int             `json:"max_attempts" db:"max_attempts"`
+	LastError   string          `json:"last_error" db:"last_error"`
+	UniqueKey   *string         `json:"unique_key" db:"unique_key"`
+	RunAt       time.Time       `json:"run_at" db:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until" db:"locked_until"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at" db:"finished_at"`
+}
+
+// TableName represents the table name
+func (j Job) TableName() string {
+	return "jobs"
+}
+
+// Decode decodes the payload of the job into v.
+func (j Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler runs a job. A job fails if its handler returns an error or panics.
+// The context is cancelled if the worker is shut down before the job completes.
+type Handler func(ctx context.Context, job Job) error
+
+// Filter represents the conditions that the jobs returned by a query must meet. Empty conditions are ignored.
+type Filter struct {
+	Type   string
+	Status string
+}
@@ -0,0 +1,205 @@
+package jobs
+
+import (
+	"backend/pkg/dbcontext"
+	"context"
+	"errors"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/lib/pq"
+)
+
+// ErrStatus is returned when a job cannot be retried or cancelled because of its status.
+var ErrStatus = errors.New("the operation is not allowed for the job status")
+
+// Store persists the jobs.
+type Store interface {
+	// Create saves a new job. ErrDuplicate is returned if the job is unique and another job of the same
+	// type and key is pending or running.
+	Create(ctx context.Context, job Job) error
+	// Claim marks as running up to limit jobs of the given types which are due at the given time, and
+	// increments their attempts. The running jobs whose visibility timeout has expired are claimed again.
+	// The claimed jobs are invisible to the other workers until now + visibility.
+	Claim(ctx context.Context, types []string, now time.Time, limit int, visibility time.Duration) ([]Job, error)
+	// Update saves the outcome of a claimed job. Nothing is saved if the job has been claimed again
+	// since, because its visibility timeout expired.
+	Update(ctx context.Context, job Job) error
+	// Get returns the job with the specified ID.
+	Get(ctx context.Context, id string) (Job, error)
+	// Count returns the number of jobs matching the filter.
+	Count(ctx context.Context, filter Filter) (int, error)
+	// Query returns the jobs matching the filter with the given offset and limit, the newest first.
+	Query(ctx context.Context, filter Filter, offset, limit int) ([]Job, error)
+	// Retry makes a failed or cancelled job pending again, with its attempts reset.
+	// ErrStatus is returned if the job is in another status.
+	Retry(ctx context.Context, id string, now time.Time) error
+	// Cancel cancels a pending job. ErrStatus is returned if the job is in another status.
+	Cancel(ctx context.Context, id string, now time.Time) error
+}
+
+// postgresStore keeps the jobs in the "jobs" table.
+type postgresStore struct {
+	db *dbcontext.DB
+}
+
+// NewPostgresStore creates a Store keeping the jobs in Postgres.
+func NewPostgresStore(db *dbcontext.DB) Store {
+	return postgresStore{db}
+}
+
+// Create inserts a job unless it is a duplicate of a pending or running unique job.
+// The payload is sent as text because the driver would send a byte slice as binary data.
+func (s postgresStore) Create(ctx context.Context, job Job) error {
+	res, err := s.db.With(ctx).NewQuery(`
+		INSERT INTO jobs (id, type, payload, status, attempts, max_attempts, last_error, unique_key, run_at, created_at, updated_at)
+		VALUES ({:id}, {:type}, {:payload}, {:status}, {:attempts}, {:max_attempts}, {:last_error}, {:unique_key}, {:run_at}, {:created_at}, {:updated_at})
+		ON CONFLICT (type, unique_key) WHERE status IN ('pending', 'running') DO NOTHING`).
+		Bind(dbx.Params{
+			"id":           job.ID,
+			"type":         job.Type,
+			"payload":      string(job.Payload),
+			"status":       job.Status,
+			"attempts":     job.Attempts,
+			"max_attempts": job.MaxAttempts,
+			"last_error":   job.LastError,
+			"unique_key":   job.UniqueKey,
+			"run_at":       job.RunAt,
+			"created_at":   job.CreatedAt,
+			"updated_at":   job.UpdatedAt,
+		}).
+		Execute()
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// Claim locks the due jobs with FOR UPDATE SKIP LOCKED and marks them as running in a single statement,
+// so that concurrent workers never claim the same job and no transaction stays open while the jobs run.
+func (s postgresStore) Claim(ctx context.Context, types []string, now time.Time, limit int, visibility time.Duration) ([]Job, error) {
+	var jobs []Job
+	if len(types) == 0 {
+		return jobs, nil
+	}
+	err := s.db.With(ctx).NewQuery(`
+		UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_until = {:locked_until}, updated_at = {:now}
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE type = ANY({:types})
+				AND (status = 'pending' AND run_at <= {:now} OR status = 'running' AND locked_until <= {:now})
+			ORDER BY run_at
+			LIMIT {:limit}
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`).
+		Bind(dbx.Params{
+			"types":        pq.StringArray(types),
+			"now":          now,
+			"locked_until": now.Add(visibility),
+			"limit":        limit,
+		}).
+		All(&jobs)
+	return jobs, err
+}
+
+// Update saves the outcome of a job if its attempt is still the current one.
+func (s postgresStore) Update(ctx context.Context, job Job) error {
+	_, err := s.db.With(ctx).Update("jobs", dbx.Params{
+		"status":       job.Status,
+		"last_error":   job.LastError,
+		"run_at":       job.RunAt,
+		"locked_until": job.LockedUntil,
+		"updated_at":   job.UpdatedAt,
+		"finished_at":  job.FinishedAt,
+	}, dbx.HashExp{"id": job.ID, "attempts": job.Attempts, "status": StatusRunning}).Execute()
+	return err
+}
+
+// Get reads the job with the specified ID from the database.
+func (s postgresStore) Get(ctx context.Context, id string) (Job, error) {
+	var job Job
+	err := s.db.With(ctx).Select().Model(id, &job)
+	return job, err
+}
+
+// Count returns the number of the jobs matching the filter in the database.
+func (s postgresStore) Count(ctx context.Context, filter Filter) (int, error) {
+	var count int
+	err := s.db.With(ctx).Select("COUNT(*)").From("jobs").Where(filter.condition()).Row(&count)
+	return count, err
+}
+
+// Query retrieves the jobs matching the filter with the specified offset and limit from the database.
+func (s postgresStore) Query(ctx context.Context, filter Filter, offset, limit int) ([]Job, error) {
+	var jobs []Job
+	err := s.db.With(ctx).
+		Select().
+		Where(filter.condition()).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&jobs)
+	return jobs, err
+}
+
+// Retry resets a failed or cancelled job.
+func (s postgresStore) Retry(ctx context.Context, id string, now time.Time) error {
+	return s.transition(ctx, id, []interface{}{StatusFailed, StatusCancelled}, dbx.Params{
+		"status":       StatusPending,
+		"attempts":     0,
+		"last_error":   "",
+		"run_at":       now,
+		"locked_until": nil,
+		"updated_at":   now,
+		"finished_at":  nil,
+	})
+}
+
+// Cancel cancels a pending job.
+func (s postgresStore) Cancel(ctx context.Context, id string, now time.Time) error {
+	return s.transition(ctx, id, []interface{}{StatusPending}, dbx.Params{
+		"status":      StatusCancelled,
+		"updated_at":  now,
+		"finished_at": now,
+	})
+}
+
+// transition updates a job which is in one of the given statuses.
+// sql.ErrNoRows is returned if there is no such job, and ErrStatus if it is in another status.
+func (s postgresStore) transition(ctx context.Context, id string, from []interface{}, params dbx.Params) error {
+	res, err := s.db.With(ctx).Update("jobs", params, dbx.And(dbx.HashExp{"id": id}, dbx.In("status", from...))).Execute()
+	if err != nil {
+		if e, ok := err.(*pq.Error); ok && e.Code == "23505" {
+			// unique_violation: a job with the same unique key has been queued in the meantime
+			return ErrDuplicate
+		}
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrStatus
+}
+
+// condition builds the WHERE condition of the filter.
+func (f Filter) condition() dbx.Expression {
+	hash := dbx.HashExp{}
+	if f.Type != "" {
+		hash["type"] = f.Type
+	}
+	if f.Status != "" {
+		hash["status"] = f.Status
+	}
+	return hash
+}
@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"backend/pkg/dbcontext"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	_ "github.com/lib/pq" // initialize posgresql for test
+	"github.com/stretchr/testify/assert"
+)
+
+const DSN = "postgres://127.0.0.1/scd?sslmode=disable&user=postgres&password=postgres"
+
+func TestPostgresStore(t *testing.T) {
+	dsn, ok := os.LookupEnv("APP_DSN")
+	if !ok {
+		dsn = DSN
+	}
+	db, err := dbx.MustOpen("postgres", dsn)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	if _, err = db.TruncateTable("jobs").Execute(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	store := NewPostgresStore(dbcontext.New(db))
+	client := NewClient(store)
+	ctx := context.Background()
+
+	// enqueue
+	job1, err := client.Enqueue(ctx, "email", map[string]string{"to": "a@test.test"}, Unique("a"))
+	assert.Nil(t, err)
+	_, err = client.Enqueue(ctx, "email", nil, Unique("a"))
+	assert.Equal(t, ErrDuplicate, err)
+	job2, err := client.Enqueue(ctx, "email", nil, Delay(time.Hour))
+	assert.Nil(t, err)
+	_, err = client.Enqueue(ctx, "export", nil)
+	assert.Nil(t, err)
+	count, _ := store.Count(ctx, Filter{Type: "email"})
+	assert.Equal(t, 2, count)
+
+	// claim the due jobs of the given types
+	now := time.Now()
+	jobs, err := store.Claim(ctx, []string{"email"}, now, 10, time.Minute)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(jobs)) {
+		assert.Equal(t, job1.ID, jobs[0].ID)
+		assert.Equal(t, StatusRunning, jobs[0].Status)
+		assert.Equal(t, 1, jobs[0].Attempts)
+		assert.JSONEq(t, `{"to":"a@test.test"}`, string(jobs[0].Payload))
+	}
+	jobs, _ = store.Claim(ctx, []string{"email"}, now, 10, time.Minute)
+	assert.Empty(t, jobs)
+
+	// a running job is claimed again once its visibility timeout has expired
+	jobs, _ = store.Claim(ctx, []string{"email"}, now.Add(2*time.Minute), 10, time.Minute)
+	if assert.Equal(t, 1, len(jobs)) {
+		assert.Equal(t, 2, jobs[0].Attempts)
+	}
+
+	// the outcome of a stale attempt is ignored
+	stale := jobs[0]
+	stale.Attempts = 1
+	stale.Status = StatusFailed
+	assert.Nil(t, store.Update(ctx, stale))
+	job, _ := store.Get(ctx, job1.ID)
+	assert.Equal(t, StatusRunning, job.Status)
+	done := jobs[0]
+	done.Status = StatusSucceeded
+	done.FinishedAt = &now
+	assert.Nil(t, store.Update(ctx, done))
+	job, _ = store.Get(ctx, job1.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+
+	// retry and cancel
+	assert.Equal(t, ErrStatus, store.Retry(ctx, job2.ID, now))
+	assert.Nil(t, store.Cancel(ctx, job2.ID, now))
+	assert.Equal(t, ErrStatus, store.Cancel(ctx, job2.ID, now))
+	assert.Nil(t, store.Retry(ctx, job2.ID, now))
+	job, _ = store.Get(ctx, job2.ID)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, sql.ErrNoRows, store.Cancel(ctx, "unknown", now))
+
+	// query
+	jobs, err = store.Query(ctx, Filter{Status: StatusPending}, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(jobs))
+}
@@ -0,0 +1,193 @@
+package jobs
+
+import (
+	"backend/pkg/log"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxBackoff is the longest delay between two attempts of a job.
+const maxBackoff = 6 * time.Hour
+
+// Options represents the settings of a Worker.
+type Options struct {
+	// the maximum number of jobs run at the same time
+	Concurrency int
+	// how often the store is polled for due jobs
+	PollInterval time.Duration
+	// how long a claimed job is invisible to the other workers. A job running longer than that is cancelled,
+	// as it may be claimed again by another worker
+	VisibilityTimeout time.Duration
+	// the delay before the first retry of a job, doubled after each failed attempt
+	Backoff time.Duration
+}
+
+// Worker runs the jobs of the registered types with a pool of goroutines.
+type Worker struct {
+	store    Store
+	opts     Options
+	logger   log.Logger
+	handlers map[string]Handler
+	slots    chan struct{}
+	running  sync.WaitGroup
+	// ctx is the parent context of the jobs, cancelled if the shutdown times out
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	now      func() time.Time
+}
+
+// NewWorker creates a new Worker claiming jobs from the given store.
+func NewWorker(store Store, opts Options, logger log.Logger) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		store:    store,
+		opts:     opts,
+		logger:   logger,
+		handlers: map[string]Handler{},
+		slots:    make(chan struct{}, opts.Concurrency),
+		ctx:      ctx,
+		cancel:   cancel,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+// Register sets the handler of the jobs of the given type. Only the jobs of registered types are claimed.
+// It must be called before Start.
+func (w *Worker) Register(jobType string, h Handler) {
+	w.handlers[jobType] = h
+}
+
+// Start starts polling the store in the background until Shutdown is called.
+func (w *Worker) Start() {
+	go w.loop()
+}
+
+// Shutdown stops claiming jobs and waits for the running jobs to complete. If the context is done first,
+// the running jobs are cancelled and the context error is returned. The cancelled jobs are retried later.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	finished := make(chan struct{})
+	go func() {
+		<-w.done
+		w.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// loop polls the store at the configured interval until the worker is stopped.
+func (w *Worker) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		w.poll()
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll claims as many jobs as there are free goroutines and runs them, until no more jobs are due.
+func (w *Worker) poll() {
+	types := make([]string, 0, len(w.handlers))
+	for t := range w.handlers {
+		types = append(types, t)
+	}
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+		free := cap(w.slots) - len(w.slots)
+		if free == 0 {
+			return
+		}
+		jobs, err := w.store.Claim(w.ctx, types, w.now(), free, w.opts.VisibilityTimeout)
+		if err != nil {
+			w.logger.Errorf("failed to claim jobs: %v", err)
+			return
+		}
+		for _, job := range jobs {
+			w.slots <- struct{}{}
+			w.running.Add(1)
+			go func(job Job) {
+				defer func() {
+					<-w.slots
+					w.running.Done()
+				}()
+				w.run(job)
+			}(job)
+		}
+		if len(jobs) < free {
+			return
+		}
+	}
+}
+
+// run runs a claimed job and saves its outcome. A failed job is retried after an exponential backoff
+// until it has been attempted MaxAttempts times.
+func (w *Worker) run(job Job) {
+	ctx, cancel := context.WithTimeout(w.ctx, w.opts.VisibilityTimeout)
+	err := call(ctx, w.handlers[job.Type], job)
+	cancel()
+
+	logger := w.logger.With(w.ctx, "job", job.ID, "type", job.Type, "attempt", job.Attempts)
+	now := w.now()
+	job.UpdatedAt = now
+	job.LockedUntil = nil
+	switch {
+	case err == nil:
+		job.Status = StatusSucceeded
+		job.LastError = ""
+		job.FinishedAt = &now
+	case job.Attempts >= job.MaxAttempts:
+		job.Status = StatusFailed
+		job.LastError = err.Error()
+		job.FinishedAt = &now
+		logger.Errorf("job failed: %v", err)
+	default:
+		backoff := w.opts.Backoff << uint(job.Attempts-1)
+		if backoff <= 0 || backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		job.Status = StatusPending
+		job.LastError = err.Error()
+		job.RunAt = now.Add(backoff)
+		logger.Infof("job will be retried at %v: %v", job.RunAt, err)
+	}
+	// the outcome is saved even if the worker is shutting down
+	if err := w.store.Update(context.Background(), job); err != nil {
+		logger.Errorf("failed to save the job: %v", err)
+	}
+}
+
+// call calls the handler of a job, turning a panic into an error.
+func call(ctx context.Context, h Handler, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
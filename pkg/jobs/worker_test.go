@@ -0,0 +1,233 @@
+package jobs
+
+import (
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is a Store keeping the jobs in memory, for testing purpose.
+type memoryStore struct {
+	sync.Mutex
+	jobs []Job
+}
+
+func (s *memoryStore) Create(ctx context.Context, job Job) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, j := range s.jobs {
+		if job.UniqueKey != nil && j.UniqueKey != nil && *j.UniqueKey == *job.UniqueKey && j.Type == job.Type &&
+			(j.Status == StatusPending || j.Status == StatusRunning) {
+			return ErrDuplicate
+		}
+	}
+	s.jobs = append(s.jobs, job)
+	return nil
+}
+
+func (s *memoryStore) Claim(ctx context.Context, types []string, now time.Time, limit int, visibility time.Duration) ([]Job, error) {
+	s.Lock()
+	defer s.Unlock()
+	var jobs []Job
+	for i, j := range s.jobs {
+		due := j.Status == StatusPending && !j.RunAt.After(now) ||
+			j.Status == StatusRunning && !j.LockedUntil.After(now)
+		if !due || len(jobs) == limit || !contains(types, j.Type) {
+			continue
+		}
+		lockedUntil := now.Add(visibility)
+		j.Status = StatusRunning
+		j.Attempts++
+		j.LockedUntil = &lockedUntil
+		s.jobs[i] = j
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, job Job) error {
+	s.Lock()
+	defer s.Unlock()
+	for i, j := range s.jobs {
+		if j.ID == job.ID && j.Attempts == job.Attempts && j.Status == StatusRunning {
+			s.jobs[i] = job
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id string) (Job, error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+	return Job{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) Count(ctx context.Context, filter Filter) (int, error) {
+	return len(s.jobs), nil
+}
+
+func (s *memoryStore) Query(ctx context.Context, filter Filter, offset, limit int) ([]Job, error) {
+	return s.jobs, nil
+}
+
+func (s *memoryStore) Retry(ctx context.Context, id string, now time.Time) error {
+	return nil
+}
+
+func (s *memoryStore) Cancel(ctx context.Context, id string, now time.Time) error {
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClient_Enqueue(t *testing.T) {
+	store := &memoryStore{}
+	client := NewClient(store)
+	ctx := context.Background()
+
+	job, err := client.Enqueue(ctx, "email", map[string]string{"to": "a@test.test"})
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, DefaultMaxAttempts, job.MaxAttempts)
+	assert.Equal(t, job.CreatedAt, job.RunAt)
+	assert.JSONEq(t, `{"to":"a@test.test"}`, string(job.Payload))
+
+	// delayed and scheduled jobs
+	job, _ = client.Enqueue(ctx, "email", nil, Delay(time.Minute), MaxAttempts(1))
+	assert.Equal(t, job.CreatedAt.Add(time.Minute), job.RunAt)
+	assert.Equal(t, 1, job.MaxAttempts)
+	at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	job, _ = client.Enqueue(ctx, "email", nil, At(at))
+	assert.Equal(t, at, job.RunAt)
+
+	// unique jobs
+	_, err = client.Enqueue(ctx, "export", nil, Unique("user-1"))
+	assert.Nil(t, err)
+	_, err = client.Enqueue(ctx, "export", nil, Unique("user-1"))
+	assert.Equal(t, ErrDuplicate, err)
+	_, err = client.Enqueue(ctx, "export", nil, Unique("user-2"))
+	assert.Nil(t, err)
+}
+
+func TestWorker(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := &memoryStore{}
+	client := NewClient(store)
+	ctx := context.Background()
+	w := NewWorker(store, Options{Concurrency: 2, PollInterval: time.Hour, VisibilityTimeout: time.Minute, Backoff: time.Minute}, logger)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	w.Register("ok", func(ctx context.Context, job Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[job.ID]++
+		return nil
+	})
+	w.Register("fail", func(ctx context.Context, job Job) error {
+		return errors.New("unavailable")
+	})
+	w.Register("panic", func(ctx context.Context, job Job) error {
+		panic("boom")
+	})
+
+	ok1, _ := client.Enqueue(ctx, "ok", nil)
+	ok2, _ := client.Enqueue(ctx, "ok", nil)
+	ok3, _ := client.Enqueue(ctx, "ok", nil)
+	delayed, _ := client.Enqueue(ctx, "ok", nil, Delay(time.Hour))
+	fail, _ := client.Enqueue(ctx, "fail", nil, MaxAttempts(2))
+	panicking, _ := client.Enqueue(ctx, "panic", nil, MaxAttempts(1))
+	unknown, _ := client.Enqueue(ctx, "unknown", nil)
+
+	// all due jobs are run, Concurrency jobs at a time
+	for i := 0; i < 3; i++ {
+		w.poll()
+		w.running.Wait()
+	}
+	for _, id := range []string{ok1.ID, ok2.ID, ok3.ID} {
+		job, _ := store.Get(ctx, id)
+		assert.Equal(t, StatusSucceeded, job.Status)
+		assert.NotNil(t, job.FinishedAt)
+		assert.Equal(t, 1, calls[id])
+	}
+	job, _ := store.Get(ctx, delayed.ID)
+	assert.Equal(t, StatusPending, job.Status)
+	job, _ = store.Get(ctx, unknown.ID)
+	assert.Equal(t, StatusPending, job.Status)
+
+	// a failed job is retried after the backoff
+	job, _ = store.Get(ctx, fail.ID)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "unavailable", job.LastError)
+	assert.True(t, job.RunAt.After(time.Now().Add(50*time.Second)))
+
+	// a job is failed once it has been attempted MaxAttempts times
+	job, _ = store.Get(ctx, panicking.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "panic: boom", job.LastError)
+	w.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	w.poll()
+	w.running.Wait()
+	job, _ = store.Get(ctx, fail.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+}
+
+func TestWorker_Shutdown(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := &memoryStore{}
+	client := NewClient(store)
+	ctx := context.Background()
+
+	// the running jobs complete before the shutdown returns
+	w := NewWorker(store, Options{Concurrency: 1, PollInterval: 10 * time.Millisecond, VisibilityTimeout: time.Minute, Backoff: time.Minute}, logger)
+	started := make(chan struct{})
+	w.Register("slow", func(ctx context.Context, job Job) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	slow, _ := client.Enqueue(ctx, "slow", nil)
+	w.Start()
+	<-started
+	assert.Nil(t, w.Shutdown(context.Background()))
+	job, _ := store.Get(ctx, slow.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+
+	// the running jobs are cancelled if the shutdown times out
+	w = NewWorker(store, Options{Concurrency: 1, PollInterval: 10 * time.Millisecond, VisibilityTimeout: time.Minute, Backoff: time.Minute}, logger)
+	started = make(chan struct{})
+	w.Register("blocking", func(ctx context.Context, job Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	blocking, _ := client.Enqueue(ctx, "blocking", nil)
+	w.Start()
+	<-started
+	timeout, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, w.Shutdown(timeout))
+	job, _ = store.Get(ctx, blocking.ID)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, context.Canceled.Error(), job.LastError)
+}
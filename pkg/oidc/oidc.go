@@ -0,0 +1,354 @@
+// Package oidc implements the relying party of the OpenID Connect authorization code flow with PKCE.
+//
+// A Provider discovers the endpoints of an issuer, builds the URLs the users are sent to in order to log in,
+// exchanges the returned authorization codes for ID tokens and verifies them against the keys of the issuer.
+// Only the ID tokens signed with RS256, the algorithm every issuer supports, are accepted.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// leeway is the clock skew tolerated when checking the times of the ID tokens.
+const leeway = time.Minute
+
+// Config represents the registration of the application as a client of an issuer.
+type Config struct {
+	// the URL of the issuer, e.g. "https://accounts.example.com"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// the URL the issuer redirects the users to after they logged in
+	RedirectURL string
+	// the scopes requested. Defaults to "openid", "email" and "profile"
+	Scopes []string
+}
+
+// Claims represents the claims of a verified ID token.
+type Claims map[string]interface{}
+
+// Subject returns the identifier of the user at the issuer.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Email returns the email address of the user, if any.
+func (c Claims) Email() string {
+	s, _ := c["email"].(string)
+	return s
+}
+
+// EmailVerified reports whether the issuer verified the email address of the user.
+func (c Claims) EmailVerified() bool {
+	switch v := c["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Strings returns the claim with the given name as a list of strings. A string claim is split on spaces and commas.
+func (c Claims) Strings(name string) []string {
+	var values []string
+	switch v := c[name].(type) {
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// metadata represents the discovery document of an issuer.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is the client of an OpenID Connect issuer. Its endpoints are discovered on first use, so that
+// the application can start while the issuer is unavailable.
+type Provider struct {
+	config Config
+	client *http.Client
+	now    func() time.Time
+
+	mu   sync.Mutex
+	meta *metadata
+	keys map[string]*rsa.PublicKey
+}
+
+// NewProvider creates a new Provider sending its requests with the given HTTP client.
+func NewProvider(config Config, client *http.Client) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{config: config, client: client, now: time.Now}
+}
+
+// AuthCodeURL returns the URL the user is sent to in order to log in. The state is returned unchanged to
+// the redirect URL, the nonce is included in the ID token, and the challenge is derived from the PKCE verifier
+// passed to Exchange by Challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange exchanges an authorization code for an ID token, and returns the claims of the token once it is
+// verified. The verifier is the PKCE verifier of the challenge passed to AuthCodeURL, and the nonce the nonce
+// passed to it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &token)
+	if err != nil {
+		return nil, err
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token request failed: %v %v", token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %v", status)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("the token response has no ID token")
+	}
+	return p.Verify(ctx, token.IDToken, nonce)
+}
+
+// Verify verifies the signature, the issuer, the audience, the expiry and the nonce of an ID token, and
+// returns its claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}, SkipClaimsValidation: true}
+	_, err = parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := p.now()
+	if iss, _ := claims["iss"].(string); iss != meta.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !hasAudience(claims, p.config.ClientID) {
+		return nil, errors.New("the ID token is not intended for this client")
+	}
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return nil, errors.New("the ID token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("the ID token is not valid yet")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("the nonce of the ID token does not match")
+	}
+	if claims["sub"] == nil || claims["sub"] == "" {
+		return nil, errors.New("the ID token has no subject")
+	}
+	return Claims(claims), nil
+}
+
+// hasAudience reports whether the audience of the claims includes the client. If the token has several
+// audiences, the client must also be the authorized party.
+func hasAudience(claims jwt.MapClaims, clientID string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		found := false
+		for _, a := range aud {
+			found = found || a == clientID
+		}
+		if len(aud) > 1 {
+			azp, _ := claims["azp"].(string)
+			return found && azp == clientID
+		}
+		return found
+	}
+	return false
+}
+
+// discover returns the metadata of the issuer, fetching it if it has not been yet.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	if status, err := p.do(req, &meta); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	} else if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery failed with status %v", status)
+	}
+	if meta.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("the discovered issuer %q does not match %q", meta.Issuer, p.config.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("the discovery document is incomplete")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the public key with the given ID. The keys of the issuer are fetched again if the key is
+// unknown, as the issuer may have rotated them.
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if status, err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("fetching the keys failed: %w", err)
+	} else if status != http.StatusOK {
+		return nil, fmt.Errorf("fetching the keys failed with status %v", status)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// an issuer with a single key may not set the key IDs
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// do sends the request and decodes the JSON response into v. It returns the status of the response.
+func (p *Provider) do(req *http.Request, v interface{}) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return res.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && res.StatusCode == http.StatusOK {
+		return res.StatusCode, err
+	}
+	return res.StatusCode, nil
+}
+
+// GenerateVerifier returns a random PKCE code verifier.
+func GenerateVerifier() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Challenge returns the S256 PKCE code challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"backend/pkg/oidc/oidctest"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProvider(t *testing.T) {
+	issuer, server, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	issuer.SetClaims(map[string]interface{}{"sub": "u1", "email": "ann@test.test", "email_verified": true, "groups": []string{"admins", "staff"}})
+
+	ctx := context.Background()
+	p := NewProvider(Config{Issuer: issuer.URL, ClientID: "client", ClientSecret: "secret", RedirectURL: "http://app.test/callback"}, http.DefaultClient)
+	verifier, err := GenerateVerifier()
+	assert.Nil(t, err)
+	authURL, err := p.AuthCodeURL(ctx, "state1", "nonce1", Challenge(verifier))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	redirect, err := issuer.Authorize(authURL)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "app.test", redirect.Host)
+	assert.Equal(t, "state1", redirect.Query().Get("state"))
+	code := redirect.Query().Get("code")
+
+	// the nonce and the verifier must match
+	_, err = p.Exchange(ctx, code, verifier, "other")
+	assert.NotNil(t, err)
+	redirect, _ = issuer.Authorize(authURL)
+	_, err = p.Exchange(ctx, redirect.Query().Get("code"), "wrong verifier", "nonce1")
+	assert.NotNil(t, err)
+
+	redirect, _ = issuer.Authorize(authURL)
+	claims, err := p.Exchange(ctx, redirect.Query().Get("code"), verifier, "nonce1")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "u1", claims.Subject())
+		assert.Equal(t, "ann@test.test", claims.Email())
+		assert.True(t, claims.EmailVerified())
+		assert.Equal(t, []string{"admins", "staff"}, claims.Strings("groups"))
+	}
+	// the codes can be used once
+	_, err = p.Exchange(ctx, redirect.Query().Get("code"), verifier, "nonce1")
+	assert.NotNil(t, err)
+
+	// the tokens of another client are rejected
+	other := NewProvider(Config{Issuer: issuer.URL, ClientID: "other", ClientSecret: "secret", RedirectURL: "http://app.test/callback"}, http.DefaultClient)
+	_, err = other.Exchange(ctx, code, verifier, "nonce1")
+	assert.NotNil(t, err)
+
+	// expired tokens are rejected
+	redirect, _ = issuer.Authorize(authURL)
+	p.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = p.Exchange(ctx, redirect.Query().Get("code"), verifier, "nonce1")
+	assert.NotNil(t, err)
+}
+
+func TestProvider_discover(t *testing.T) {
+	issuer, server, err := oidctest.NewServer("client", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	p := NewProvider(Config{Issuer: issuer.URL + "/other", ClientID: "client"}, http.DefaultClient)
+	_, err = p.AuthCodeURL(context.Background(), "s", "n", "c")
+	assert.NotNil(t, err)
+
+	// public clients send their ID in the token request
+	p = NewProvider(Config{Issuer: issuer.URL, ClientID: "client", RedirectURL: "http://app.test/callback"}, http.DefaultClient)
+	verifier, _ := GenerateVerifier()
+	authURL, err := p.AuthCodeURL(context.Background(), "s", "n", Challenge(verifier))
+	assert.Nil(t, err)
+	redirect, _ := issuer.Authorize(authURL)
+	claims, err := p.Exchange(context.Background(), redirect.Query().Get("code"), verifier, "n")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "test-user", claims.Subject())
+	}
+}
+
+func TestClaims(t *testing.T) {
+	claims := Claims{"roles": "a b,c", "email_verified": "true", "list": []interface{}{"x", 1}}
+	assert.Equal(t, []string{"a", "b", "c"}, claims.Strings("roles"))
+	assert.Equal(t, []string{"x"}, claims.Strings("list"))
+	assert.Nil(t, claims.Strings("missing"))
+	assert.True(t, claims.EmailVerified())
+	assert.Equal(t, "", claims.Subject())
+}
+
+func TestChallenge(t *testing.T) {
+	// the example of RFC 7636
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
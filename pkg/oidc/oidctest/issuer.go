@@ -0,0 +1,216 @@
+// Package oidctest provides a stub OpenID Connect issuer, for testing the relying parties locally.
+//
+// The issuer logs in every user who visits its authorization endpoint as the user described by Claims,
+// without asking for credentials, and issues ID tokens signed with a key generated at startup.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// keyID is the ID of the signing key of the issuer.
+const keyID = "test-key"
+
+// Issuer is a stub OpenID Connect issuer. It implements http.Handler.
+type Issuer struct {
+	// the URL the issuer is served at, which is also the issuer identifier
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	claims map[string]interface{}
+	codes  map[string]authorization
+	key    *rsa.PrivateKey
+}
+
+// authorization represents an authorization code issued by the authorization endpoint.
+type authorization struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      map[string]interface{}
+}
+
+// NewIssuer creates a new issuer for the given client. Its URL must be set before it serves requests.
+func NewIssuer(clientID, clientSecret string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		claims:       map[string]interface{}{"sub": "test-user"},
+		codes:        map[string]authorization{},
+		key:          key,
+	}, nil
+}
+
+// NewServer starts a new issuer for the given client on a local test server. The server must be closed by the caller.
+func NewServer(clientID, clientSecret string) (*Issuer, *httptest.Server, error) {
+	issuer, err := NewIssuer(clientID, clientSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	server := httptest.NewServer(issuer)
+	issuer.URL = server.URL
+	return issuer, server, nil
+}
+
+// SetClaims sets the claims of the user logged in by the following authorizations, e.g. "sub", "email"
+// and "email_verified". The registered claims iss, aud, exp, iat and nonce are added by the issuer.
+func (i *Issuer) SetClaims(claims map[string]interface{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.claims = claims
+}
+
+// ServeHTTP serves the discovery document, the keys, and the authorization and token endpoints.
+func (i *Issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                i.URL,
+			"authorization_endpoint":                i.URL + "/authorize",
+			"token_endpoint":                        i.URL + "/token",
+			"jwks_uri":                              i.URL + "/keys",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case "/keys":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": keyID,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+			}},
+		})
+	case "/authorize":
+		i.authorize(w, r)
+	case "/token":
+		i.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Authorize simulates a user logging in at the URL returned by the relying party. It returns the URL the
+// user is redirected to, which carries the authorization code and the state.
+func (i *Issuer) Authorize(authURL string) (*url.URL, error) {
+	req := httptest.NewRequest(http.MethodGet, authURL, nil)
+	w := httptest.NewRecorder()
+	i.ServeHTTP(w, req)
+	return url.Parse(w.Header().Get("Location"))
+}
+
+// authorize redirects to the redirect URI with a new code, as if the user had logged in.
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("client_id") != i.ClientID || q.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE is required", http.StatusBadRequest)
+		return
+	}
+	code := randomString()
+	i.mu.Lock()
+	i.codes[code] = authorization{redirect.String(), q.Get("nonce"), q.Get("code_challenge"), i.claims}
+	i.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token, checking the client credentials and the PKCE verifier.
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != i.ClientID || secret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	auth, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != auth.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range auth.claims {
+		claims[k] = v
+	}
+	claims["iss"] = i.URL
+	claims["aud"] = i.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	if auth.nonce != "" {
+		claims["nonce"] = auth.nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// writeJSON writes the value as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// randomString returns a random URL-safe string.
+func randomString() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
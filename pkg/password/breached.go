@@ -0,0 +1,81 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefixLength is the number of the first characters of the hashes by which a breached list is queried.
+const prefixLength = 5
+
+// BreachedList is a list of breached passwords, identified by their SHA-1 hashes.
+//
+// It is queried like the k-anonymity range API of Have I Been Pwned: by the first 5 characters of a hash,
+// which return the rest of the hashes sharing them. The list is read from a file in the format of the password
+// files Have I Been Pwned publishes: one uppercase or lowercase hexadecimal hash per line, optionally followed
+// by a colon and the number of breaches.
+type BreachedList struct {
+	// the sorted suffixes of the hashes, by prefix
+	ranges map[string][]string
+	size   int
+}
+
+// LoadBreachedList reads a breached list from the given file.
+func LoadBreachedList(file string) (*BreachedList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBreachedList(f)
+}
+
+// ReadBreachedList reads a breached list. The empty lines and the lines starting with "#" are ignored.
+func ReadBreachedList(r io.Reader) (*BreachedList, error) {
+	l := &BreachedList{ranges: map[string][]string{}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash := strings.ToUpper(strings.SplitN(text, ":", 2)[0])
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %v: %q is not a SHA-1 hash", line, hash)
+		}
+		l.ranges[hash[:prefixLength]] = append(l.ranges[hash[:prefixLength]], hash[prefixLength:])
+		l.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, suffixes := range l.ranges {
+		sort.Strings(suffixes)
+	}
+	return l, nil
+}
+
+// Len returns the number of passwords in the list.
+func (l *BreachedList) Len() int {
+	return l.size
+}
+
+// Range returns the sorted suffixes of the hashes starting with the given 5 characters.
+func (l *BreachedList) Range(prefix string) []string {
+	return l.ranges[strings.ToUpper(prefix)]
+}
+
+// Contains reports whether the password is in the list. Only the prefix of its hash is used to query the list.
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes := l.Range(hash[:prefixLength])
+	i := sort.SearchStrings(suffixes, hash[prefixLength:])
+	return i < len(suffixes) && suffixes[i] == hash[prefixLength:]
+}
@@ -0,0 +1,181 @@
+// Package password hashes passwords with argon2id or bcrypt.
+//
+// The algorithm of a hash is detected from its format: argon2id hashes are in the PHC string format
+// ("$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>") and bcrypt hashes in the modular crypt format ("$2a$10$...").
+// A Hasher creates the new hashes with the algorithm and cost of its policy, and tells which hashes are outdated
+// so that they can be replaced when the password is known, e.g. when the user logs in.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// the supported algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+const (
+	// saltLength is the number of random bytes of the salts of the argon2id hashes.
+	saltLength = 16
+	// keyLength is the number of bytes of the keys derived by argon2id.
+	keyLength = 32
+)
+
+// ErrInvalidHash is returned when a hash is in none of the supported formats.
+var ErrInvalidHash = errors.New("the hash is in an unsupported format")
+
+// encoding encodes the salts and keys of the argon2id hashes, as in the PHC string format.
+var encoding = base64.RawStdEncoding
+
+// Options represents the hashing policy. The zero values are replaced by the defaults.
+type Options struct {
+	// the algorithm of the new hashes. Defaults to Argon2id
+	Algorithm string
+	// the cost of the bcrypt hashes. Defaults to bcrypt.DefaultCost
+	BcryptCost int
+	// the memory (in KiB), number of iterations and parallelism of the argon2id hashes.
+	// Default to 19456 (19 MiB), 2 and 1, as recommended by OWASP
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+// Hasher hashes and verifies passwords according to a policy.
+type Hasher struct {
+	opts Options
+	// dummy is a hash of the policy that Fake checks passwords against
+	dummy     string
+	dummyOnce sync.Once
+}
+
+// New creates a Hasher with the given policy.
+func New(opts Options) (*Hasher, error) {
+	if opts.Algorithm == "" {
+		opts.Algorithm = Argon2id
+	}
+	if opts.BcryptCost == 0 {
+		opts.BcryptCost = bcrypt.DefaultCost
+	}
+	if opts.Argon2Memory == 0 {
+		opts.Argon2Memory = 19456
+	}
+	if opts.Argon2Iterations == 0 {
+		opts.Argon2Iterations = 2
+	}
+	if opts.Argon2Parallelism == 0 {
+		opts.Argon2Parallelism = 1
+	}
+	if opts.Algorithm != Argon2id && opts.Algorithm != Bcrypt {
+		return nil, fmt.Errorf("unsupported password hashing algorithm %q", opts.Algorithm)
+	}
+	if opts.BcryptCost < bcrypt.MinCost || opts.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("the bcrypt cost must be between %v and %v", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &Hasher{opts: opts}, nil
+}
+
+// Hash returns the hash of the password with the algorithm and cost of the policy.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.opts.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.opts.BcryptCost)
+		return string(hash), err
+	}
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := argon2Params{h.opts.Argon2Memory, h.opts.Argon2Iterations, h.opts.Argon2Parallelism}
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, keyLength)
+	return p.format(salt, key), nil
+}
+
+// Verify reports whether the password matches the hash, whatever the algorithm of the hash.
+// If it does, rehash reports whether the hash should be replaced because its algorithm or cost
+// differ from the policy. ErrInvalidHash is returned if the hash is in an unsupported format.
+func (h *Hasher) Verify(hash, password string) (ok, rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$"+Argon2id+"$"):
+		p, salt, key, err := parseArgon2(hash)
+		if err != nil {
+			return false, false, err
+		}
+		derived := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(derived, key) != 1 {
+			return false, false, nil
+		}
+		return true, h.opts.Algorithm != Argon2id || p != argon2Params{h.opts.Argon2Memory, h.opts.Argon2Iterations, h.opts.Argon2Parallelism}, nil
+	case strings.HasPrefix(hash, "$2"):
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, false, ErrInvalidHash
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		} else if err != nil {
+			return false, false, err
+		}
+		return true, h.opts.Algorithm != Bcrypt || cost != h.opts.BcryptCost, nil
+	}
+	return false, false, ErrInvalidHash
+}
+
+// Fake spends about as long as Verify does on a hash of the policy, so that the logins of unknown users
+// take as long as the logins of the users giving a wrong password, and users cannot be enumerated.
+func (h *Hasher) Fake(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummy, _ = h.Hash("dummy password")
+	})
+	_, _, _ = h.Verify(h.dummy, password)
+}
+
+// argon2Params represents the parameters of an argon2id hash.
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// format returns the argon2id hash in the PHC string format.
+func (p argon2Params) format(salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version, p.memory, p.iterations, p.parallelism,
+		encoding.EncodeToString(salt), encoding.EncodeToString(key))
+}
+
+// parseArgon2 returns the parameters, salt and key of an argon2id hash in the PHC string format.
+func parseArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if p.iterations == 0 || p.parallelism == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,110 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// fast is a policy with the lowest costs, to keep the tests fast.
+var fast = Options{BcryptCost: bcrypt.MinCost, Argon2Memory: 64, Argon2Iterations: 1}
+
+func TestNew(t *testing.T) {
+	h, err := New(Options{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, Options{Argon2id, bcrypt.DefaultCost, 19456, 2, 1}, h.opts)
+	}
+	_, err = New(Options{Algorithm: "md5"})
+	assert.NotNil(t, err)
+	_, err = New(Options{BcryptCost: 40})
+	assert.NotNil(t, err)
+}
+
+func TestHasher(t *testing.T) {
+	for _, algorithm := range []string{Argon2id, Bcrypt} {
+		opts := fast
+		opts.Algorithm = algorithm
+		h, _ := New(opts)
+
+		hash, err := h.Hash("secret")
+		assert.Nil(t, err)
+		other, _ := h.Hash("secret")
+		assert.NotEqual(t, hash, other, "the hashes must be salted")
+
+		ok, rehash, err := h.Verify(hash, "secret")
+		assert.Nil(t, err)
+		assert.True(t, ok, algorithm)
+		assert.False(t, rehash, algorithm)
+		ok, _, err = h.Verify(hash, "wrong")
+		assert.Nil(t, err)
+		assert.False(t, ok, algorithm)
+	}
+	assert.True(t, strings.HasPrefix(mustHash(t, Argon2id, fast), "$argon2id$v=19$m=64,t=1,p=1$"))
+}
+
+func TestHasher_Rehash(t *testing.T) {
+	argon2Hasher, _ := New(fast)
+	bcryptOpts := fast
+	bcryptOpts.Algorithm = Bcrypt
+	bcryptHasher, _ := New(bcryptOpts)
+
+	// the hashes of another algorithm are verified, and outdated
+	ok, rehash, err := argon2Hasher.Verify(mustHash(t, Bcrypt, fast), "secret")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	ok, rehash, _ = bcryptHasher.Verify(mustHash(t, Argon2id, fast), "secret")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	// so are the hashes of another cost
+	stronger := fast
+	stronger.BcryptCost++
+	stronger.Argon2Iterations++
+	_, rehash, _ = argon2Hasher.Verify(mustHash(t, Argon2id, stronger), "secret")
+	assert.True(t, rehash)
+	_, rehash, _ = bcryptHasher.Verify(mustHash(t, Bcrypt, stronger), "secret")
+	assert.True(t, rehash)
+
+	// the outdated hashes are not reported if the password is wrong
+	ok, rehash, _ = argon2Hasher.Verify(mustHash(t, Bcrypt, fast), "wrong")
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestHasher_InvalidHash(t *testing.T) {
+	h, _ := New(fast)
+	for _, hash := range []string{
+		"",
+		"secret",
+		"$2a$broken",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$!!!",
+	} {
+		_, _, err := h.Verify(hash, "secret")
+		assert.Equal(t, ErrInvalidHash, err, hash)
+	}
+}
+
+func TestHasher_Fake(t *testing.T) {
+	h, _ := New(fast)
+	h.Fake("secret")
+	assert.True(t, strings.HasPrefix(h.dummy, "$argon2id$"))
+}
+
+// mustHash returns the hash of "secret" with the given algorithm and policy.
+func mustHash(t *testing.T, algorithm string, opts Options) string {
+	opts.Algorithm = algorithm
+	h, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
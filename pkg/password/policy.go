@@ -0,0 +1,92 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// minPersonalLength is the minimum length of the personal information looked for in the passwords,
+// so that short names do not reject most passwords.
+const minPersonalLength = 3
+
+// Policy represents the rules the new passwords must follow.
+type Policy struct {
+	// the minimum and maximum number of characters. No limit applies if it is 0
+	MinLength int
+	MaxLength int
+	// the character classes the passwords must contain
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// whether the passwords containing the personal information of the user, e.g. their username, are rejected
+	RejectPersonal bool
+	// the breached passwords, which are rejected. No password is rejected as breached if it is nil
+	Breached *BreachedList
+}
+
+// Check checks the password against the rules of the policy. The personal information of the user, such as their
+// username and email address, is looked for ignoring the case. The violated rules are returned as validation.Errors
+// by rule name, each with a specific message, or nil if the password follows the rules.
+func (p Policy) Check(password string, personal ...string) error {
+	errs := validation.Errors{}
+	length := len([]rune(password))
+	if p.MinLength > 0 && length < p.MinLength {
+		errs["min_length"] = validation.NewError("validation_password_min_length", fmt.Sprintf("must be at least %v characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		errs["max_length"] = validation.NewError("validation_password_max_length", fmt.Sprintf("must be at most %v characters long", p.MaxLength))
+	}
+	for _, class := range []struct {
+		name     string
+		required bool
+		is       func(rune) bool
+		message  string
+	}{
+		{"lowercase", p.RequireLowercase, unicode.IsLower, "must contain a lowercase letter"},
+		{"uppercase", p.RequireUppercase, unicode.IsUpper, "must contain an uppercase letter"},
+		{"digit", p.RequireDigit, unicode.IsDigit, "must contain a digit"},
+		{"symbol", p.RequireSymbol, isSymbol, "must contain a symbol"},
+	} {
+		if class.required && strings.IndexFunc(password, class.is) < 0 {
+			errs[class.name] = validation.NewError("validation_password_"+class.name, class.message)
+		}
+	}
+	if p.RejectPersonal && containsPersonal(password, personal) {
+		errs["personal"] = validation.NewError("validation_password_personal", "must not contain your username or email address")
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		errs["breached"] = validation.NewError("validation_password_breached", "has appeared in a data breach and must not be used")
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// isSymbol reports whether the character is neither a letter, a digit nor a space.
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+// containsPersonal reports whether the password contains one of the personal values, or the local part
+// of one of the email addresses among them, ignoring the case.
+func containsPersonal(password string, personal []string) bool {
+	password = strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		values := []string{value}
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			values = append(values, value[:at])
+		}
+		for _, v := range values {
+			if len(v) >= minPersonalLength && strings.Contains(password, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// the SHA-1 hashes of "password" and "123456"
+const breachedFile = `# test list
+5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493
+7c4a8d09ca3762af61e59520943dc26494f8941b
+
+`
+
+func TestReadBreachedList(t *testing.T) {
+	l, err := ReadBreachedList(strings.NewReader(breachedFile))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 2, l.Len())
+	assert.Equal(t, []string{"1E4C9B93F3F0682250B6CF8331B7EE68FD8"}, l.Range("5baa6"))
+	assert.True(t, l.Contains("password"))
+	assert.True(t, l.Contains("123456"))
+	assert.False(t, l.Contains("correct horse battery staple"))
+
+	_, err = ReadBreachedList(strings.NewReader("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\nnot a hash\n"))
+	assert.EqualError(t, err, `line 2: "NOT A HASH" is not a SHA-1 hash`)
+	_, err = LoadBreachedList("unknown.txt")
+	assert.NotNil(t, err)
+}
+
+func TestPolicy_Check(t *testing.T) {
+	breached, _ := ReadBreachedList(strings.NewReader(breachedFile))
+	policy := Policy{
+		MinLength:        8,
+		MaxLength:        20,
+		RequireLowercase: true,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		RejectPersonal:   true,
+		Breached:         breached,
+	}
+	tests := []struct {
+		password string
+		rules    []string
+	}{
+		{"Tr0ub4dor&3", nil},
+		{"Tr0ub&", []string{"min_length"}},
+		{"Tr0ub4dor&3Tr0ub4dor&3", []string{"max_length"}},
+		{"tr0ub4dor&3", []string{"uppercase"}},
+		{"TR0UB4DOR&3", []string{"lowercase"}},
+		{"Troubador&", []string{"digit"}},
+		{"Tr0ub4dor3", []string{"symbol"}},
+		{"Ann.Lee-2026", []string{"personal"}},
+		{"xX_annlee_Xx1", []string{"personal"}},
+		{"password", []string{"breached", "digit", "symbol", "uppercase"}},
+	}
+	for _, tc := range tests {
+		err := policy.Check(tc.password, "ann.lee", "annlee@test.test")
+		if tc.rules == nil {
+			assert.Nil(t, err, tc.password)
+			continue
+		}
+		var rules []string
+		for rule := range err.(validation.Errors) {
+			rules = append(rules, rule)
+		}
+		assert.ElementsMatch(t, tc.rules, rules, tc.password)
+	}
+
+	// the rules are off by default
+	assert.Nil(t, Policy{}.Check("password", "password"))
+}
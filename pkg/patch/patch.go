@@ -0,0 +1,314 @@
+// Package patch implements partial updates of JSON documents using JSON Merge Patch (RFC 7396)
+// and JSON Patch (RFC 6902).
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MergePatchType is the media type of JSON Merge Patch documents.
+	MergePatchType = "application/merge-patch+json"
+	// JSONPatchType is the media type of JSON Patch documents.
+	JSONPatchType = "application/json-patch+json"
+)
+
+// OperationError describes a JSON Patch operation that cannot be applied to the document,
+// e.g. because its path does not exist or a "test" operation failed.
+type OperationError struct {
+	Op   string
+	Path string
+	Msg  string
+}
+
+// Error returns the error message.
+func (e OperationError) Error() string {
+	return fmt.Sprintf("%v %q: %v", e.Op, e.Path, e.Msg)
+}
+
+// Apply applies a patch of the given media type to a JSON document and returns the patched document.
+func Apply(mediaType string, doc, patch []byte) ([]byte, error) {
+	switch mediaType {
+	case MergePatchType:
+		return MergePatch(doc, patch)
+	case JSONPatchType:
+		return JSONPatch(doc, patch)
+	}
+	return nil, fmt.Errorf("unsupported patch media type %q", mediaType)
+}
+
+// MergePatch applies a JSON Merge Patch to a JSON document and returns the patched document.
+// Members set to null in the patch are removed from the document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, p))
+}
+
+// merge merges a patch value into a target value as described in RFC 7396.
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+	return t
+}
+
+// operation represents a single JSON Patch operation.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies a JSON Patch to a JSON document and returns the patched document.
+// The operations are applied in order and the patch fails as a whole if any of them fails.
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		var err error
+		if target, err = op.apply(target); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(target)
+}
+
+// apply applies the operation to a document and returns the modified document.
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(msg string) error {
+		return OperationError{op.Op, op.Path, msg}
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%v %q: missing value", op.Op, op.Path)
+		}
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+		if op.Op == "add" {
+			return add(doc, path, value, fail)
+		}
+		if op.Op == "replace" {
+			if len(path) == 0 {
+				// replacing the root replaces the whole document
+				return value, nil
+			}
+			if _, err := remove(&doc, path, fail); err != nil {
+				return nil, err
+			}
+			return add(doc, path, value, fail)
+		}
+		current, err := get(doc, path, fail)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fail("value does not match")
+		}
+		return doc, nil
+
+	case "remove":
+		_, err := remove(&doc, path, fail)
+		return doc, err
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fail("cannot move a value into one of its children")
+			}
+			value, err = remove(&doc, from, fail)
+		} else {
+			value, err = get(doc, from, fail)
+			if err == nil {
+				value, err = deepCopy(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value, fail)
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// get returns the value at the given path of a document.
+func get(doc interface{}, path []string, fail func(string) error) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fail("path does not exist")
+			}
+			doc = value
+		case []interface{}:
+			i, err := index(token, len(node)-1, fail)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fail("path does not exist")
+		}
+	}
+	return doc, nil
+}
+
+// add adds a value at the given path of a document and returns the modified document.
+// An existing object member is replaced, while a value added to an array is inserted at the given index.
+func add(doc interface{}, path []string, value interface{}, fail func(string) error) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1], fail)
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return doc, nil
+	case []interface{}:
+		i := len(node)
+		if token != "-" {
+			if i, err = index(token, len(node), fail); err != nil {
+				return nil, err
+			}
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return replaceParent(doc, path[:len(path)-1], node, fail)
+	}
+	return nil, fail("path does not exist")
+}
+
+// remove removes the value at the given path of a document, updates the document and returns the removed value.
+func remove(doc *interface{}, path []string, fail func(string) error) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fail("cannot remove the whole document")
+	}
+	parent, err := get(*doc, path[:len(path)-1], fail)
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[token]
+		if !ok {
+			return nil, fail("path does not exist")
+		}
+		delete(node, token)
+		return value, nil
+	case []interface{}:
+		i, err := index(token, len(node)-1, fail)
+		if err != nil {
+			return nil, err
+		}
+		value := node[i]
+		node = append(node[:i], node[i+1:]...)
+		if *doc, err = replaceParent(*doc, path[:len(path)-1], node, fail); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	return nil, fail("path does not exist")
+}
+
+// replaceParent stores an array whose length has changed back at the given path of a document.
+func replaceParent(doc interface{}, path []string, array []interface{}, fail func(string) error) (interface{}, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+	parent, err := get(doc, path[:len(path)-1], fail)
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = array
+	case []interface{}:
+		i, _ := strconv.Atoi(token)
+		node[i] = array
+	}
+	return doc, nil
+}
+
+// index parses an array index and checks that it is not greater than max.
+func index(token string, max int, fail func(string) error) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fail("invalid array index")
+	}
+	return i, nil
+}
+
+// deepCopy returns a copy of a decoded JSON value that shares no maps or slices with it.
+func deepCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
@@ -0,0 +1,118 @@
+package patch
+
+import (
+	"bytes"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"set member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"remove member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"replace array", `{"a":["b"]}`, `{"a":["c","d"]}`, `{"a":["c","d"]}`},
+		{"nested object", `{"a":{"b":"c","d":"e"}}`, `{"a":{"d":null,"f":"g"}}`, `{"a":{"b":"c","f":"g"}}`},
+		{"replace document", `{"a":"b"}`, `["c"]`, `["c"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if assert.Nil(t, err) {
+				assert.JSONEq(t, tt.want, string(got))
+			}
+		})
+	}
+	_, err := MergePatch([]byte(`{}`), []byte(`{`))
+	assert.NotNil(t, err)
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{"add member", `{"a":"b"}`, `[{"op":"add","path":"/c","value":"d"}]`, `{"a":"b","c":"d"}`, false},
+		{"add to array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, false},
+		{"append to array", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, false},
+		{"escaped path", `{}`, `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"a/b~c":1}`, false},
+		{"remove member", `{"a":"b","c":"d"}`, `[{"op":"remove","path":"/a"}]`, `{"c":"d"}`, false},
+		{"remove from array", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2,3]}`, false},
+		{"replace member", `{"a":"b"}`, `[{"op":"replace","path":"/a","value":false}]`, `{"a":false}`, false},
+		{"replace root", `{"a":"b"}`, `[{"op":"replace","path":"","value":{"c":"d"}}]`, `{"c":"d"}`, false},
+		{"move member", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`, false},
+		{"copy member", `{"a":[1]}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":[1],"b":[1]}`, false},
+		{"test then replace", `{"a":"b"}`, `[{"op":"test","path":"/a","value":"b"},{"op":"replace","path":"/a","value":"c"}]`, `{"a":"c"}`, false},
+		{"failed test", `{"a":"b"}`, `[{"op":"test","path":"/a","value":"c"}]`, ``, true},
+		{"replace missing", `{"a":"b"}`, `[{"op":"replace","path":"/c","value":1}]`, ``, true},
+		{"remove missing", `{"a":"b"}`, `[{"op":"remove","path":"/c"}]`, ``, true},
+		{"index out of range", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, ``, true},
+		{"move into child", `{"a":{}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, ``, true},
+		{"missing value", `{"a":"b"}`, `[{"op":"add","path":"/c"}]`, ``, true},
+		{"unknown operation", `{"a":"b"}`, `[{"op":"merge","path":"/a"}]`, ``, true},
+		{"invalid pointer", `{"a":"b"}`, `[{"op":"remove","path":"a"}]`, ``, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.JSONEq(t, tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	type model struct {
+		Name     string `json:"name"`
+		IsActive bool   `json:"is_active"`
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        model
+		wantStatus  int
+	}{
+		{"merge patch", MergePatchType, `{"is_active":false}`, model{"test", false}, 0},
+		{"removed member", MergePatchType, `{"name":null}`, model{"", true}, 0},
+		{"json patch", JSONPatchType + "; charset=utf-8", `[{"op":"replace","path":"/name","value":"xyz"}]`, model{"xyz", true}, 0},
+		{"unsupported type", "application/json", `{"is_active":false}`, model{}, http.StatusUnsupportedMediaType},
+		{"malformed patch", MergePatchType, `{"is_active":`, model{}, http.StatusBadRequest},
+		{"unknown member", MergePatchType, `{"id":"123"}`, model{}, http.StatusBadRequest},
+		{"failed operation", JSONPatchType, `[{"op":"remove","path":"/id"}]`, model{}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("PATCH", "http://127.0.0.1/users/1", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			got := model{"dest", true}
+			err := Read(routing.NewContext(res, req), model{"test", true}, &got)
+			if tt.wantStatus != 0 {
+				if assert.NotNil(t, err) {
+					assert.Equal(t, tt.wantStatus, err.(routing.HTTPError).StatusCode())
+				}
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+)
+
+// Read applies the patch sent in the body of a PATCH request to original and stores the result in dest.
+//
+// The patch media type is taken from the Content-Type header. Requests of other types fail with HTTP 415.
+// Malformed patches, and patched documents with members unknown to dest, fail with HTTP 400.
+// JSON Patch operations that cannot be applied to original fail with HTTP 409.
+// Members removed by the patch are left as zero values in dest, so original and dest may point to the same value.
+func Read(c *routing.Context, original, dest interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if mediaType != MergePatchType && mediaType != JSONPatchType {
+		c.Response.Header().Set("Accept-Patch", MergePatchType+", "+JSONPatchType)
+		return routing.NewHTTPError(http.StatusUnsupportedMediaType, "The patch must be sent as "+MergePatchType+" or "+JSONPatchType+".")
+	}
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return routing.NewHTTPError(http.StatusBadRequest)
+	}
+	doc, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	patched, err := Apply(mediaType, doc, body)
+	if err != nil {
+		if _, ok := err.(OperationError); ok {
+			return routing.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return routing.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if v := reflect.ValueOf(dest); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
+		return routing.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package realip determines the IP address of the client that sent an HTTP request, taking trusted proxies into account.
+package realip
+
+import (
+	"context"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	ipKey contextKey = iota
+)
+
+// ParseCIDRs parses a list of IP addresses or CIDR ranges (e.g. "10.0.0.0/8").
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ClientIP returns the IP address of the client that sent the given request.
+//
+// The X-Forwarded-For header is only honored if the request comes from one of the trusted proxies.
+// In that case the header is walked from right to left and the first address that is not a trusted
+// proxy is returned, so that a client cannot spoof its address by sending the header itself.
+func ClientIP(req *http.Request, trusted []*net.IPNet) string {
+	ip := remoteIP(req.RemoteAddr)
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+	hops := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// Handler returns a middleware that stores the client IP address in the request context.
+// The address can then be retrieved via FromContext().
+func Handler(trusted []*net.IPNet) routing.Handler {
+	return func(c *routing.Context) error {
+		ctx := WithIP(c.Request.Context(), ClientIP(c.Request, trusted))
+		c.Request = c.Request.WithContext(ctx)
+		return nil
+	}
+}
+
+// WithIP returns a context that carries the given client IP address.
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipKey, ip)
+}
+
+// FromContext returns the client IP address stored in the given context.
+// An empty string is returned if the context carries no address.
+func FromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ipKey).(string)
+	return ip
+}
+
+// remoteIP strips the port from a remote address.
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// isTrusted checks if the given IP address belongs to a trusted proxy.
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
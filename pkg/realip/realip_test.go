@@ -0,0 +1,58 @@
+package realip
+
+import (
+	"context"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs([]string{"10.0.0.0/8", "127.0.0.1", "::1"})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "10.0.0.0/8", nets[0].String())
+		assert.Equal(t, "127.0.0.1/32", nets[1].String())
+		assert.Equal(t, "::1/128", nets[2].String())
+	}
+	_, err = ParseCIDRs([]string{"invalid"})
+	assert.NotNil(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, _ := ParseCIDRs([]string{"10.0.0.0/8"})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "1.2.3.4:5678", "", "1.2.3.4"},
+		{"untrusted proxy", "1.2.3.4:5678", "5.6.7.8", "1.2.3.4"},
+		{"trusted proxy", "10.0.0.1:5678", "5.6.7.8", "5.6.7.8"},
+		{"spoofed header", "10.0.0.1:5678", "9.9.9.9, 5.6.7.8", "5.6.7.8"},
+		{"proxy chain", "10.0.0.1:5678", "5.6.7.8, 10.0.0.2", "5.6.7.8"},
+		{"no header", "10.0.0.1:5678", "", "10.0.0.1"},
+		{"invalid header", "10.0.0.1:5678", "unknown", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			assert.Equal(t, tt.want, ClientIP(req, trusted))
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	assert.Empty(t, FromContext(context.Background()))
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	c := routing.NewContext(httptest.NewRecorder(), req)
+	assert.Nil(t, Handler(nil)(c))
+	assert.Equal(t, "1.2.3.4", FromContext(c.Request.Context()))
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	// Friday, 2026-10-16 10:07:30
+	now := time.Date(2026, 10, 16, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2026, 10, 16, 10, 8, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", time.Date(2026, 10, 16, 10, 15, 0, 0, time.UTC)},
+		{"range with step", "0-30/10 * * * *", time.Date(2026, 10, 16, 10, 10, 0, 0, time.UTC)},
+		{"start with step", "5/20 * * * *", time.Date(2026, 10, 16, 10, 25, 0, 0, time.UTC)},
+		{"list", "0 3,12 * * *", time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)},
+		{"next day", "0 3 * * *", time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)},
+		{"day of week", "0 4 * * sun", time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 4 * * 7", time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)},
+		{"weekdays", "30 9 * * mon-fri", time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{"day of month or week", "0 0 20 * mon", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"month name", "0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"hourly", "@hourly", time.Date(2026, 10, 16, 11, 0, 0, 0, time.UTC)},
+		{"daily", "@daily", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"weekly", "@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"monthly", "@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if assert.Nil(t, err) {
+				assert.Equal(t, tt.want, s.Next(now))
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * foo *", "@often"} {
+		_, err := Parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"backend/pkg/dbcontext"
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// postgresLocker provides session-level Postgres advisory locks.
+type postgresLocker struct {
+	db *dbcontext.DB
+}
+
+// NewPostgresLocker creates a Locker based on Postgres advisory locks. A lock is held by a dedicated
+// connection, so it is released by Postgres if the replica holding it dies.
+func NewPostgresLocker(db *dbcontext.DB) Locker {
+	return postgresLocker{db}
+}
+
+// TryLock takes the advisory lock identified by the hash of the name with pg_try_advisory_lock.
+func (l postgresLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.db.DB().DB().Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&ok); err != nil || !ok {
+		_ = conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name)
+		_ = conn.Close()
+	}, true, nil
+}
+
+// postgresStore keeps the status of the tasks in the scheduled_tasks table.
+type postgresStore struct {
+	db *dbcontext.DB
+}
+
+// NewPostgresStore creates a Store keeping the status of the tasks in Postgres.
+func NewPostgresStore(db *dbcontext.DB) Store {
+	return postgresStore{db}
+}
+
+// Register upserts the schedule of a task.
+func (s postgresStore) Register(ctx context.Context, name, schedule string, next time.Time) error {
+	_, err := s.db.With(ctx).NewQuery(`
+		INSERT INTO scheduled_tasks (name, schedule, next_run_at) VALUES ({:name}, {:schedule}, {:next})
+		ON CONFLICT (name) DO UPDATE SET schedule = excluded.schedule, next_run_at = excluded.next_run_at`).
+		Bind(dbx.Params{"name": name, "schedule": schedule, "next": nullTime(next)}).
+		Execute()
+	return err
+}
+
+// Claim records the start of a run unless an activation at or after scheduledAt has already been run.
+func (s postgresStore) Claim(ctx context.Context, name string, scheduledAt, startedAt, next time.Time, runner string) (bool, error) {
+	res, err := s.db.With(ctx).Update("scheduled_tasks", dbx.Params{
+		"last_scheduled_at": scheduledAt,
+		"last_started_at":   startedAt,
+		"last_finished_at":  nil,
+		"last_outcome":      OutcomeRunning,
+		"last_error":        "",
+		"last_run_by":       runner,
+		"next_run_at":       nullTime(next),
+	}, dbx.And(
+		dbx.HashExp{"name": name},
+		dbx.NewExp("(last_scheduled_at IS NULL OR last_scheduled_at < {:scheduled_at})", dbx.Params{"scheduled_at": scheduledAt}),
+	)).Execute()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Finish records the outcome of a run.
+func (s postgresStore) Finish(ctx context.Context, name string, finishedAt time.Time, duration time.Duration, err error) error {
+	outcome, msg := OutcomeSucceeded, ""
+	if err != nil {
+		outcome, msg = OutcomeFailed, err.Error()
+	}
+	_, err = s.db.With(ctx).Update("scheduled_tasks", dbx.Params{
+		"last_finished_at": finishedAt,
+		"last_duration_ms": duration.Milliseconds(),
+		"last_outcome":     outcome,
+		"last_error":       msg,
+	}, dbx.HashExp{"name": name}).Execute()
+	return err
+}
+
+// Get reads the status of a task from the database.
+func (s postgresStore) Get(ctx context.Context, name string) (Status, error) {
+	var status Status
+	err := s.db.With(ctx).Select().Where(dbx.HashExp{"name": name}).One(&status)
+	return status, err
+}
+
+// All reads the status of all tasks from the database.
+func (s postgresStore) All(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := s.db.With(ctx).Select().OrderBy("name").All(&statuses)
+	return statuses, err
+}
+
+// nullTime turns the zero time, meaning that a schedule has no next activation, into NULL.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,208 @@
+// Package scheduler runs periodic tasks according to cron expressions.
+//
+// Every replica of the server runs a Scheduler with the same tasks. Before running a task, a replica takes
+// a lock named after it and claims the activation time in the status store, so that each activation runs once
+// across the replicas and a task never overlaps with itself. The outcome of the last run of every task is
+// recorded in the status store.
+package scheduler
+
+import (
+	"backend/pkg/log"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Outcomes of the task runs.
+const (
+	OutcomeRunning   = "running"
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+)
+
+// Status represents the state of a scheduled task and the outcome of its last run.
+type Status struct {
+	Name     string `json:"name" db:"name"`
+	Schedule string `json:"schedule" db:"schedule"`
+	// the next activation time, as computed by the replica that registered the task or ran it last
+	NextRunAt *time.Time `json:"next_run_at" db:"next_run_at"`
+	// the activation time of the last run
+	LastScheduledAt *time.Time `json:"last_scheduled_at" db:"last_scheduled_at"`
+	LastStartedAt   *time.Time `json:"last_started_at" db:"last_started_at"`
+	LastFinishedAt  *time.Time `json:"last_finished_at" db:"last_finished_at"`
+	LastDurationMS  int64      `json:"last_duration_ms" db:"last_duration_ms"`
+	LastOutcome     string     `json:"last_outcome" db:"last_outcome"`
+	LastError       string     `json:"last_error" db:"last_error"`
+	// the replica which ran the task last, as host:pid
+	LastRunBy string `json:"last_run_by" db:"last_run_by"`
+}
+
+// TableName represents the table name
+func (s Status) TableName() string {
+	return "scheduled_tasks"
+}
+
+// Locker provides locks shared by the replicas.
+type Locker interface {
+	// TryLock takes the lock with the given name without waiting. It returns false if the lock is held,
+	// possibly by the same replica. Otherwise the returned function must be called to release the lock.
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
+// Store persists the status of the scheduled tasks.
+type Store interface {
+	// Register creates or updates the status of a task with its schedule and next activation time.
+	Register(ctx context.Context, name, schedule string, next time.Time) error
+	// Claim records the start of a run for the given activation time. It returns false if the activation
+	// has already been run, by this replica or another one.
+	Claim(ctx context.Context, name string, scheduledAt, startedAt, next time.Time, runner string) (bool, error)
+	// Finish records the outcome of the current run of a task.
+	Finish(ctx context.Context, name string, finishedAt time.Time, duration time.Duration, err error) error
+	// Get returns the status of the task with the given name.
+	Get(ctx context.Context, name string) (Status, error)
+	// All returns the status of all tasks, sorted by name.
+	All(ctx context.Context) ([]Status, error)
+}
+
+// task is a scheduled task.
+type task struct {
+	name     string
+	expr     string
+	schedule Schedule
+	run      func(ctx context.Context) error
+	next     time.Time
+}
+
+// Scheduler runs tasks at the activation times of their schedules.
+type Scheduler struct {
+	store   Store
+	locker  Locker
+	logger  log.Logger
+	tasks   []*task
+	runner  string
+	running sync.WaitGroup
+	now     func() time.Time
+}
+
+// New creates a new Scheduler.
+func New(store Store, locker Locker, logger log.Logger) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		store:  store,
+		locker: locker,
+		logger: logger,
+		runner: fmt.Sprintf("%v:%v", host, os.Getpid()),
+		now:    time.Now,
+	}
+}
+
+// Add adds a task run according to the given cron expression. It must be called before Run.
+func (s *Scheduler) Add(name, expr string, run func(ctx context.Context) error) error {
+	schedule, err := Parse(expr)
+	if err != nil {
+		return fmt.Errorf("task %v: %v", name, err)
+	}
+	s.tasks = append(s.tasks, &task{name: name, expr: expr, schedule: schedule, run: run})
+	return nil
+}
+
+// Run runs the tasks at their activation times until the context is cancelled, then waits for the running
+// tasks to complete. The tasks are given the context, so they should stop early once it is cancelled.
+// An activation missed while no replica was running is not caught up.
+func (s *Scheduler) Run(ctx context.Context) {
+	now := s.now()
+	for _, t := range s.tasks {
+		t.next = t.schedule.Next(now)
+		if err := s.store.Register(ctx, t.name, t.expr, t.next); err != nil {
+			s.logger.With(ctx).Errorf("failed to register the scheduled task %v: %v", t.name, err)
+		}
+	}
+
+	for {
+		var next time.Time
+		for _, t := range s.tasks {
+			if !t.next.IsZero() && (next.IsZero() || t.next.Before(next)) {
+				next = t.next
+			}
+		}
+		if next.IsZero() {
+			<-ctx.Done()
+			break
+		}
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.running.Wait()
+			return
+		case <-timer.C:
+		}
+		s.dispatch(ctx, s.now())
+	}
+	s.running.Wait()
+}
+
+// dispatch starts the tasks whose activation time has come and computes their next activation.
+func (s *Scheduler) dispatch(ctx context.Context, now time.Time) {
+	for _, t := range s.tasks {
+		if t.next.IsZero() || t.next.After(now) {
+			continue
+		}
+		scheduledAt := t.next
+		t.next = t.schedule.Next(now)
+		s.running.Add(1)
+		go func(t *task, next time.Time) {
+			defer s.running.Done()
+			s.execute(ctx, t, scheduledAt, next)
+		}(t, t.next)
+	}
+}
+
+// execute runs an activation of a task unless it is running or has already been run by a replica.
+func (s *Scheduler) execute(ctx context.Context, t *task, scheduledAt, next time.Time) {
+	logger := s.logger.With(ctx, "task", t.name)
+	unlock, ok, err := s.locker.TryLock(ctx, "scheduler:"+t.name)
+	if err != nil {
+		logger.Errorf("failed to lock the scheduled task: %v", err)
+		return
+	}
+	if !ok {
+		logger.Infof("the scheduled task is already running")
+		return
+	}
+	defer unlock()
+
+	start := s.now()
+	claimed, err := s.store.Claim(ctx, t.name, scheduledAt, start, next, s.runner)
+	if err != nil {
+		logger.Errorf("failed to claim the scheduled task: %v", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	err = call(ctx, t.run)
+	finished := s.now()
+	if err != nil {
+		logger.Errorf("the scheduled task failed: %v", err)
+	} else {
+		logger.Infof("the scheduled task succeeded in %v", finished.Sub(start))
+	}
+	// the outcome is saved even if the scheduler is stopping
+	if err := s.store.Finish(context.Background(), t.name, finished, finished.Sub(start), err); err != nil {
+		logger.Errorf("failed to save the outcome of the scheduled task: %v", err)
+	}
+}
+
+// call calls the function of a task, turning a panic into an error.
+func call(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"backend/pkg/log"
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryLocker is a Locker keeping the locks in memory, for testing purpose.
+type memoryLocker struct {
+	sync.Mutex
+	locks map[string]bool
+}
+
+func (l *memoryLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.locks[name] {
+		return nil, false, nil
+	}
+	l.locks[name] = true
+	return func() {
+		l.Lock()
+		defer l.Unlock()
+		delete(l.locks, name)
+	}, true, nil
+}
+
+// memoryStore is a Store keeping the statuses in memory, for testing purpose.
+type memoryStore struct {
+	sync.Mutex
+	statuses map[string]Status
+}
+
+func (s *memoryStore) Register(ctx context.Context, name, schedule string, next time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	status := s.statuses[name]
+	status.Name, status.Schedule, status.NextRunAt = name, schedule, &next
+	s.statuses[name] = status
+	return nil
+}
+
+func (s *memoryStore) Claim(ctx context.Context, name string, scheduledAt, startedAt, next time.Time, runner string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	status := s.statuses[name]
+	if status.LastScheduledAt != nil && !status.LastScheduledAt.Before(scheduledAt) {
+		return false, nil
+	}
+	status.LastScheduledAt, status.LastStartedAt, status.NextRunAt = &scheduledAt, &startedAt, &next
+	status.LastOutcome, status.LastError, status.LastRunBy = OutcomeRunning, "", runner
+	s.statuses[name] = status
+	return true, nil
+}
+
+func (s *memoryStore) Finish(ctx context.Context, name string, finishedAt time.Time, duration time.Duration, err error) error {
+	s.Lock()
+	defer s.Unlock()
+	status := s.statuses[name]
+	status.LastFinishedAt, status.LastDurationMS, status.LastOutcome = &finishedAt, duration.Milliseconds(), OutcomeSucceeded
+	if err != nil {
+		status.LastOutcome, status.LastError = OutcomeFailed, err.Error()
+	}
+	s.statuses[name] = status
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, name string) (Status, error) {
+	s.Lock()
+	defer s.Unlock()
+	status, ok := s.statuses[name]
+	if !ok {
+		return Status{}, sql.ErrNoRows
+	}
+	return status, nil
+}
+
+func (s *memoryStore) All(ctx context.Context) ([]Status, error) {
+	s.Lock()
+	defer s.Unlock()
+	var statuses []Status
+	for _, status := range s.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
+
+func TestScheduler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := &memoryStore{statuses: map[string]Status{}}
+	locker := &memoryLocker{locks: map[string]bool{}}
+	ctx := context.Background()
+
+	// two replicas running the same tasks
+	var mu sync.Mutex
+	runs := map[string]int{}
+	replicas := []*Scheduler{New(store, locker, logger), New(store, locker, logger)}
+	for _, s := range replicas {
+		assert.Nil(t, s.Add("purge", "*/5 * * * *", func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs["purge"]++
+			return nil
+		}))
+		assert.Nil(t, s.Add("analyze", "@daily", func(ctx context.Context) error {
+			return errors.New("unavailable")
+		}))
+		assert.Nil(t, s.Add("panic", "@hourly", func(ctx context.Context) error {
+			panic("boom")
+		}))
+		assert.NotNil(t, s.Add("invalid", "* * *", nil))
+	}
+
+	now := time.Date(2026, 10, 17, 23, 57, 0, 0, time.UTC)
+	for _, s := range replicas {
+		s.now = func() time.Time { return now }
+		for _, task := range s.tasks {
+			task.next = task.schedule.Next(now)
+		}
+	}
+
+	// nothing is due yet
+	replicas[0].dispatch(ctx, now)
+	replicas[0].running.Wait()
+	assert.Equal(t, 0, runs["purge"])
+
+	// each activation runs once across the replicas
+	now = time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	for _, s := range replicas {
+		s.dispatch(ctx, now)
+		s.running.Wait()
+	}
+	assert.Equal(t, 1, runs["purge"])
+	status, _ := store.Get(ctx, "purge")
+	assert.Equal(t, OutcomeSucceeded, status.LastOutcome)
+	assert.Equal(t, now, *status.LastScheduledAt)
+	assert.Equal(t, time.Date(2026, 10, 18, 0, 5, 0, 0, time.UTC), *status.NextRunAt)
+	assert.NotEmpty(t, status.LastRunBy)
+	status, _ = store.Get(ctx, "analyze")
+	assert.Equal(t, OutcomeFailed, status.LastOutcome)
+	assert.Equal(t, "unavailable", status.LastError)
+	status, _ = store.Get(ctx, "panic")
+	assert.Equal(t, OutcomeFailed, status.LastOutcome)
+	assert.Equal(t, "panic: boom", status.LastError)
+
+	// a task is not run while it is locked, e.g. still running
+	unlock, _, _ := locker.TryLock(ctx, "scheduler:purge")
+	now = now.Add(5 * time.Minute)
+	replicas[1].dispatch(ctx, now)
+	replicas[1].running.Wait()
+	assert.Equal(t, 1, runs["purge"])
+	unlock()
+	now = now.Add(5 * time.Minute)
+	replicas[1].dispatch(ctx, now)
+	replicas[1].running.Wait()
+	assert.Equal(t, 2, runs["purge"])
+}
+
+func TestScheduler_Run(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := &memoryStore{statuses: map[string]Status{}}
+	s := New(store, &memoryLocker{locks: map[string]bool{}}, logger)
+	assert.Nil(t, s.Add("purge", "@hourly", func(ctx context.Context) error { return nil }))
+
+	// the tasks are registered when the scheduler starts, and it stops when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		statuses, _ := store.All(context.Background())
+		return len(statuses) == 1 && statuses[0].Schedule == "@hourly" && statuses[0].NextRunAt != nil
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
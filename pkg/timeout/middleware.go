@@ -0,0 +1,23 @@
+// Package timeout provides a middleware that sets a deadline on the context of every HTTP request.
+package timeout
+
+import (
+	"context"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"time"
+)
+
+// Handler returns a middleware that cancels the request context after the given duration.
+// Since repositories run their queries with the request context, the deadline also applies to DB queries.
+// A duration of 0 or less disables the deadline.
+func Handler(d time.Duration) routing.Handler {
+	return func(c *routing.Context) error {
+		if d <= 0 {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		return c.Next()
+	}
+}
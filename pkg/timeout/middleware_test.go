@@ -0,0 +1,39 @@
+package timeout
+
+import (
+	"context"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	var deadline time.Time
+	var ok bool
+	c := routing.NewContext(httptest.NewRecorder(), req, Handler(time.Second), func(c *routing.Context) error {
+		deadline, ok = c.Request.Context().Deadline()
+		return nil
+	})
+	assert.Nil(t, c.Next())
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+
+	req, _ = http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	c = routing.NewContext(httptest.NewRecorder(), req, Handler(time.Millisecond), func(c *routing.Context) error {
+		<-c.Request.Context().Done()
+		return c.Request.Context().Err()
+	})
+	assert.Equal(t, context.DeadlineExceeded, c.Next())
+
+	req, _ = http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	c = routing.NewContext(httptest.NewRecorder(), req, Handler(0), func(c *routing.Context) error {
+		_, ok = c.Request.Context().Deadline()
+		return nil
+	})
+	assert.Nil(t, c.Next())
+	assert.False(t, ok)
+}
@@ -0,0 +1,100 @@
+package tlsconfig
+
+import (
+	"backend/pkg/log"
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader keeps a certificate loaded from a pair of PEM files and reloads it when the files change.
+// It is meant to be used as tls.Config.GetCertificate so that renewed certificates are picked up without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   log.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader creates a CertReloader and loads the certificate for the first time.
+func NewCertReloader(certFile, keyFile string, logger log.Logger) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the currently loaded certificate. It satisfies tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the certificate and key files and replaces the current certificate.
+// The current certificate is kept if the files cannot be loaded.
+func (r *CertReloader) Reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch checks the certificate files at the given interval and reloads them when they change.
+// It blocks until the context is cancelled.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := r.lastModified()
+			if err != nil {
+				r.logger.Errorf("failed to check TLS certificate files: %v", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := modTime.After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.logger.Errorf("failed to reload TLS certificate: %v", err)
+				continue
+			}
+			r.logger.Infof("reloaded TLS certificate from %v", r.certFile)
+		}
+	}
+}
+
+// lastModified returns the latest modification time of the certificate and key files.
+func (r *CertReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,107 @@
+package tlsconfig
+
+import (
+	"backend/pkg/log"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertReloader(t *testing.T) {
+	logger, _ := log.NewForTest()
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	_, err = NewCertReloader(certFile, keyFile, logger)
+	assert.NotNil(t, err)
+
+	writeSelfSignedCert(t, certFile, keyFile, "first")
+	r, err := NewCertReloader(certFile, keyFile, logger)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "first", commonName(t, r))
+
+	// serve HTTPS with the self-signed certificate
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	server.TLS = &tls.Config{GetCertificate: r.GetCertificate}
+	server.StartTLS()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{ServerName: "localhost", InsecureSkipVerify: true}}}
+	res, err := client.Get(server.URL)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "first", res.TLS.PeerCertificates[0].Subject.CommonName)
+		_ = res.Body.Close()
+	}
+
+	// renewed certificate is picked up by the watcher
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+	writeSelfSignedCert(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	assert.Eventually(t, func() bool { return commonName(t, r) == "second" }, time.Second, 10*time.Millisecond)
+
+	// a broken certificate keeps the current one
+	_ = ioutil.WriteFile(certFile, []byte("invalid"), 0600)
+	assert.NotNil(t, r.Reload())
+	assert.Equal(t, "second", commonName(t, r))
+}
+
+func commonName(t *testing.T, r *CertReloader) string {
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, cn string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
@@ -0,0 +1,60 @@
+// Package tlsconfig provides helpers for serving HTTPS, including certificate reloading and HTTP to HTTPS redirection.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ParseVersion converts a TLS version name (e.g. "1.2") into the corresponding crypto/tls constant.
+// An empty name is treated as TLS 1.2.
+func ParseVersion(name string) (uint16, error) {
+	switch name {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q", name)
+}
+
+// ParseCipherSuites converts cipher suite names (e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256") into their IDs.
+// Only the cipher suites considered secure by crypto/tls are accepted.
+// A nil slice is returned if no names are given so that the crypto/tls defaults are used.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	suites := map[string]uint16{}
+	for _, s := range tls.CipherSuites() {
+		suites[s.Name] = s.ID
+	}
+	var ids []uint16
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// RedirectHandler returns an HTTP handler that redirects every request to the same URL using HTTPS.
+// The httpsPort is appended to the host unless it is the default HTTPS port.
+func RedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
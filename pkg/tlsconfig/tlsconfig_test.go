@@ -0,0 +1,52 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), v)
+	v, err = ParseVersion("1.3")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), v)
+	_, err = ParseVersion("1.0")
+	assert.NotNil(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ids)
+	ids, err = ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, ids)
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.NotNil(t, err)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     int
+		url      string
+		location string
+	}{
+		{"default port", 443, "http://example.com:8080/v1/albums?page=2", "https://example.com/v1/albums?page=2"},
+		{"custom port", 8443, "http://example.com/healthcheck", "https://example.com:8443/healthcheck"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			RedirectHandler(tt.port).ServeHTTP(res, req)
+			assert.Equal(t, http.StatusMovedPermanently, res.Code)
+			assert.Equal(t, tt.location, res.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package totp
+
+import (
+	"encoding/base32"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// the SHA1 secret of the test vectors of RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC vectors have 8 digits, of which the codes are the last 6
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tc := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tc.unix, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.code, code, tc.unix)
+	}
+	_, err := Code("not base32!", 1)
+	assert.NotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step, ok := Validate(rfcSecret, "050471", now, 1, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// the code of the previous step is accepted with a skew of 1
+	_, ok = Validate(rfcSecret, "050471", now.Add(Period*time.Second), 1, 0)
+	assert.True(t, ok)
+	_, ok = Validate(rfcSecret, "050471", now.Add(Period*time.Second), 0, 0)
+	assert.False(t, ok)
+
+	// a code cannot be used twice
+	_, ok = Validate(rfcSecret, "050471", now, 1, step)
+	assert.False(t, ok)
+
+	_, ok = Validate(rfcSecret, "000000", now, 1, 0)
+	assert.False(t, ok)
+	_, ok = Validate(rfcSecret, "0504", now, 1, 0)
+	assert.False(t, ok)
+	_, ok = Validate(rfcSecret, "050 471", now, 1, 0)
+	assert.True(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.Nil(t, err)
+	assert.Equal(t, 32, len(secret))
+	other, _ := GenerateSecret()
+	assert.NotEqual(t, secret, other)
+	_, err = Code(secret, 1)
+	assert.Nil(t, err)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("My App", "ann@test.test", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(uri)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "otpauth", u.Scheme)
+		assert.Equal(t, "totp", u.Host)
+		assert.Equal(t, "/My App:ann@test.test", u.Path)
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+		assert.Equal(t, "My App", u.Query().Get("issuer"))
+	}
+}
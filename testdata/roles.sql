@@ -0,0 +1,3 @@
+-- the role the local server connects as. It is created with a password when the database is initialized,
+-- before the migrations grant it its privileges.
+CREATE ROLE app LOGIN PASSWORD 'app';
@@ -7,5 +7,6 @@ VALUES ('967d5bb5-3a7a-4d5e-8a6c-febc8c5b3f13', 'guest'),
        ('e0bb80ec-75a6-ae4c-bfc3-6ac1e89b195e', 'technical'),
        ('967d5bb5-3a7a-4d5e-3484-febc8c5b3f13', 'driver-support'),
        ('e0bb80ec-75a6-ae4c-8a6b-6ac1e89b195e', 'client-support'),
-       ('e0bb80ec-75a6-ae4c-8868-6ac1e89b195e', 'financial');
+       ('e0bb80ec-75a6-ae4c-8868-6ac1e89b195e', 'financial'),
+       ('5f3c2a1e-8d47-4b6a-9e21-7c0d4b8a6f35', 'staff');
 